@@ -2,6 +2,7 @@ package main
 
 import (
 	"codeswitch/services"
+	"context"
 	"embed"
 	_ "embed"
 	"encoding/json"
@@ -146,6 +147,14 @@ func main() {
 		}()
 	}
 
+	// 转发配置注册表：请求期间不再读取配置文件，保存配置或收到 SIGHUP 时重新加载
+	registryCtx, stopRegistry := context.WithCancel(context.Background())
+	if _, err := providerRelay.EnableProviderRegistry(registryCtx, func() ([]services.Provider, error) {
+		return services.LoadRegistryProviders(providerService)
+	}); err != nil {
+		log.Printf("⚠️ 加载转发配置注册表失败，改为每次请求读取配置文件: %v", err)
+	}
+
 	go func() {
 		if err := providerRelay.Start(); err != nil {
 			log.Printf("provider relay start error: %v", err)
@@ -256,12 +265,14 @@ func main() {
 		updateService.StopDailyCheck()
 		log.Println("✅ 更新检查服务已停止")
 
-		// 4. 停止代理服务器
-		_ = providerRelay.Stop()
+		// 停止监听配置重载信号
+		stopRegistry()
 
-		// 5. 优雅关闭数据库写入队列（10秒超时，双队列架构）
-		if err := services.ShutdownGlobalDBQueue(10 * time.Second); err != nil {
-			log.Printf("⚠️ 队列关闭超时: %v", err)
+		// 4. 停止代理服务器：等待在途请求结束，排空并关闭数据库写入队列（15秒超时，双队列架构）
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancelShutdown()
+		if err := providerRelay.Shutdown(shutdownCtx); err != nil {
+			log.Printf("⚠️ 代理服务关闭超时: %v", err)
 		} else {
 			// 单次队列统计
 			stats1 := services.GetGlobalDBQueueStats()
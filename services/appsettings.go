@@ -25,6 +25,15 @@ type AppSettings struct {
 	AutoConnectivityTest bool `json:"auto_connectivity_test"`
 	EnableSwitchNotify   bool `json:"enable_switch_notify"`   // 供应商切换通知开关
 	EnableRoundRobin     bool `json:"enable_round_robin"`     // 同 Level 轮询负载均衡开关（默认关闭）
+
+	// StreamKeepAliveSec 流式响应首字节前的 SSE 心跳间隔（秒），0 表示关闭（见 SetStreamKeepAlive）
+	StreamKeepAliveSec int `json:"stream_keepalive_sec"`
+	// MaxCompletions 拆分 n>1 请求时允许的最大 n，0 使用默认值（见 SetMaxCompletions）
+	MaxCompletions int `json:"max_completions"`
+	// MaxTotalAttempts 单次请求在所有 provider 上合计的最大尝试次数，0 表示不限制（见 SetMaxTotalAttempts）
+	MaxTotalAttempts int `json:"max_total_attempts"`
+	// RetryBudgetSec 单次请求整个重试序列的时间预算（秒），0 表示不限制（见 SetRetryBudget）
+	RetryBudgetSec int `json:"retry_budget_sec"`
 }
 
 type AppSettingsService struct {
@@ -56,10 +65,26 @@ func NewAppSettingsService(autoStartService *AutoStartService) *AppSettingsServi
 		}
 	}
 
-	return &AppSettingsService{
+	as := &AppSettingsService{
 		path:             newPath,
 		autoStartService: autoStartService,
 	}
+	if settings, err := as.GetAppSettings(); err == nil {
+		applyRelaySettings(settings)
+	}
+	return as
+}
+
+// applyRelaySettings 将影响转发行为的设置同步到 relay 的运行时配置，保存后立即生效
+func applyRelaySettings(settings AppSettings) {
+	SetStreamKeepAlive(time.Duration(settings.StreamKeepAliveSec) * time.Second)
+	if settings.MaxCompletions > 0 {
+		SetMaxCompletions(settings.MaxCompletions)
+	} else {
+		SetMaxCompletions(DefaultMaxCompletions)
+	}
+	SetMaxTotalAttempts(settings.MaxTotalAttempts)
+	SetRetryBudget(time.Duration(settings.RetryBudgetSec) * time.Second)
 }
 
 // migrateSettings 完整的配置迁移
@@ -175,6 +200,7 @@ func (as *AppSettingsService) SaveAppSettings(settings AppSettings) (AppSettings
 	if err := as.saveLocked(settings); err != nil {
 		return settings, err
 	}
+	applyRelaySettings(settings)
 	return settings, nil
 }
 
@@ -285,7 +285,7 @@ func (bs *BlacklistService) RecordFailure(platform string, providerName string)
 		// 根据等级获取拉黑时长
 		duration := bs.getLevelDuration(newLevel, levelConfig)
 		blacklistedAt := now
-		blacklistedUntil := now.Add(time.Duration(duration) * time.Minute)
+		blacklistedUntil := now.Add(jitteredDuration(time.Duration(duration)*time.Minute, BlacklistJitter()))
 
 		err = GlobalDBQueue.Exec(`
 			UPDATE provider_blacklist
@@ -386,7 +386,7 @@ func (bs *BlacklistService) recordFailureFixedMode(platform string, providerName
 	// 检查是否达到拉黑阈值
 	if failureCount >= failureThreshold {
 		blacklistedAt := now
-		blacklistedUntil := now.Add(time.Duration(fallbackDuration) * time.Minute)
+		blacklistedUntil := now.Add(jitteredDuration(time.Duration(fallbackDuration)*time.Minute, BlacklistJitter()))
 
 		err = GlobalDBQueue.Exec(`
 			UPDATE provider_blacklist
@@ -41,14 +41,8 @@ func (s *CliConfigService) requireHome() error {
 	return nil
 }
 
-// CLIPlatform CLI 平台类型
-type CLIPlatform string
-
-const (
-	PlatformClaude CLIPlatform = "claude"
-	PlatformCodex  CLIPlatform = "codex"
-	PlatformGemini CLIPlatform = "gemini"
-)
+// CLIPlatform CLI 平台类型，与中转使用同一套 Platform 常量（PlatformClaude/PlatformCodex/PlatformGemini）
+type CLIPlatform = Platform
 
 // CLIConfigField 配置字段信息
 type CLIConfigField struct {
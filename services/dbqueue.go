@@ -526,7 +526,10 @@ func (q *DBWriteQueue) ExecBatchCtx(ctx context.Context, sql string, args ...int
 // Shutdown 优雅关闭
 func (q *DBWriteQueue) Shutdown(timeout time.Duration) error {
 	// 关键修复：先设置关闭标志，拒绝新请求入队
-	q.closed.Store(true)
+	// 重复调用直接返回，避免重复关闭 shutdownChan 导致 panic
+	if q.closed.Swap(true) {
+		return nil
+	}
 
 	// 然后关闭 shutdownChan，通知 worker 排空队列
 	close(q.shutdownChan)
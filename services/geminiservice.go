@@ -36,6 +36,11 @@ type GeminiProvider struct {
 	Level               int               `json:"level,omitempty"`               // 优先级分组 (1-10, 默认 1)
 	EnvConfig           map[string]string `json:"envConfig,omitempty"`           // .env 配置
 	SettingsConfig      map[string]any    `json:"settingsConfig,omitempty"`      // settings.json 配置
+	AllowKeyless        bool              `json:"allowKeyless,omitempty"`        // 允许不配置 APIKey（本地代理等无需认证的端点）
+	Region              string            `json:"region,omitempty"`              // 部署区域（用于就近路由，见 ReorderByRegion）
+	ThinkingBudget      int               `json:"thinkingBudget,omitempty"`      // 客户端未指定时注入的默认思考预算（见 EnsureGeminiThinkingBudget），0 表示不注入
+	Tags                []string          `json:"tags,omitempty"`                // 标签（见 FilterResult.ApplyTags）
+	TimeoutSec          int               `json:"timeoutSec,omitempty"`          // 单次请求超时（秒），0 表示按 Level 超时或 DefaultGeminiTimeout（见 TimeoutFor）
 }
 
 // GeminiPreset 预设供应商
@@ -930,6 +935,11 @@ func (s *GeminiService) DuplicateProvider(sourceID string) (*GeminiProvider, err
 		Description:         source.Description,
 		Category:            source.Category,
 		PartnerPromotionKey: source.PartnerPromotionKey,
+		AllowKeyless:        source.AllowKeyless,
+		Region:              source.Region,
+		ThinkingBudget:      source.ThinkingBudget,
+		TimeoutSec:          source.TimeoutSec,
+		Tags:                append([]string(nil), source.Tags...),
 		Enabled:             false, // 默认禁用，避免与源供应商冲突
 	}
 
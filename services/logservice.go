@@ -64,6 +64,9 @@ func (ls *LogService) ListRequestLogs(platform string, provider string, limit in
 			CreatedAt:         record.GetString("created_at"),
 			IsStream:          record.GetBool("is_stream"),
 			DurationSec:       record.GetFloat64("duration_sec"),
+			APIKeyHash:        record.GetString("api_key_hash"),
+			TimeToFirstByte:   record.GetFloat64("ttfb_sec"),
+			ResponseBytes:     record.GetInt64("response_bytes"),
 		}
 		ls.decorateCost(&logEntry)
 		logs = append(logs, logEntry)
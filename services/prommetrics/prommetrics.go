@@ -0,0 +1,89 @@
+// Package prommetrics 提供基于 Prometheus 的 services.Metrics 实现
+//
+// 用法：
+//
+//	m := prommetrics.New("codeswitch")
+//	prometheus.MustRegister(m)
+//	services.SetMetrics(m)
+package prommetrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics Prometheus 指标集合，同时实现 services.Metrics 和 prometheus.Collector
+type Metrics struct {
+	selected *prometheus.CounterVec
+	skipped  *prometheus.CounterVec
+	failures *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// New 创建 Prometheus 指标集合，namespace 为指标名前缀（可为空）
+func New(namespace string) *Metrics {
+	return &Metrics{
+		selected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "relay",
+			Name:      "provider_selected_total",
+			Help:      "Provider 被选中发起请求的次数",
+		}, []string{"platform", "provider"}),
+		skipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "relay",
+			Name:      "provider_skipped_total",
+			Help:      "Provider 在过滤阶段被跳过的次数",
+		}, []string{"platform", "provider", "reason"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "relay",
+			Name:      "provider_failures_total",
+			Help:      "Provider 请求失败次数",
+		}, []string{"platform", "provider"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "relay",
+			Name:      "provider_request_duration_seconds",
+			Help:      "Provider 请求耗时",
+			Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		}, []string{"platform", "provider"}),
+	}
+}
+
+// IncSelected 实现 services.Metrics
+func (m *Metrics) IncSelected(platform, provider string) {
+	m.selected.WithLabelValues(platform, provider).Inc()
+}
+
+// IncSkipped 实现 services.Metrics
+func (m *Metrics) IncSkipped(platform, provider, reason string) {
+	m.skipped.WithLabelValues(platform, provider, reason).Inc()
+}
+
+// IncFailure 实现 services.Metrics
+func (m *Metrics) IncFailure(platform, provider string) {
+	m.failures.WithLabelValues(platform, provider).Inc()
+}
+
+// ObserveDuration 实现 services.Metrics
+func (m *Metrics) ObserveDuration(platform, provider string, d time.Duration) {
+	m.duration.WithLabelValues(platform, provider).Observe(d.Seconds())
+}
+
+// Describe 实现 prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.selected.Describe(ch)
+	m.skipped.Describe(ch)
+	m.failures.Describe(ch)
+	m.duration.Describe(ch)
+}
+
+// Collect 实现 prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.selected.Collect(ch)
+	m.skipped.Collect(ch)
+	m.failures.Collect(ch)
+	m.duration.Collect(ch)
+}
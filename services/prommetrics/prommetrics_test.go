@@ -0,0 +1,97 @@
+package prommetrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// 编译期检查：实现 prometheus.Collector
+var _ prometheus.Collector = (*Metrics)(nil)
+
+func TestMetrics_Collect(t *testing.T) {
+	m := New("codeswitch")
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(m); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	m.IncSelected("claude", "a")
+	m.IncSelected("claude", "a")
+	m.IncSkipped("claude", "b", "blacklisted")
+	m.IncFailure("claude", "a")
+	m.ObserveDuration("claude", "a", 1500*time.Millisecond)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, f := range families {
+		byName[f.GetName()] = f
+	}
+
+	counters := []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{"codeswitch_relay_provider_selected_total", map[string]string{"platform": "claude", "provider": "a"}, 2},
+		{"codeswitch_relay_provider_skipped_total", map[string]string{"platform": "claude", "provider": "b", "reason": "blacklisted"}, 1},
+		{"codeswitch_relay_provider_failures_total", map[string]string{"platform": "claude", "provider": "a"}, 1},
+	}
+	for _, tt := range counters {
+		t.Run(tt.name, func(t *testing.T) {
+			metric := findMetric(byName[tt.name], tt.labels)
+			if metric == nil {
+				t.Fatalf("未找到指标 %s%v", tt.name, tt.labels)
+			}
+			if got := metric.GetCounter().GetValue(); got != tt.want {
+				t.Errorf("value = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	hist := findMetric(byName["codeswitch_relay_provider_request_duration_seconds"], map[string]string{"platform": "claude", "provider": "a"})
+	if hist == nil {
+		t.Fatal("未找到耗时直方图")
+	}
+	if h := hist.GetHistogram(); h.GetSampleCount() != 1 || h.GetSampleSum() != 1.5 {
+		t.Errorf("直方图 count=%d sum=%v, want 1 / 1.5", h.GetSampleCount(), h.GetSampleSum())
+	}
+}
+
+func TestNew_EmptyNamespace(t *testing.T) {
+	m := New("")
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m)
+	m.IncFailure("codex", "p")
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	if len(families) != 1 || families[0].GetName() != "relay_provider_failures_total" {
+		t.Errorf("namespace 为空时指标名不带前缀, 实际 %v", families)
+	}
+}
+
+// findMetric 在指标族中查找标签完全匹配的指标
+func findMetric(family *dto.MetricFamily, labels map[string]string) *dto.Metric {
+	if family == nil {
+		return nil
+	}
+	for _, metric := range family.GetMetric() {
+		matched := len(metric.GetLabel()) == len(labels)
+		for _, pair := range metric.GetLabel() {
+			if labels[pair.GetName()] != pair.GetValue() {
+				matched = false
+			}
+		}
+		if matched {
+			return metric
+		}
+	}
+	return nil
+}
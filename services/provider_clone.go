@@ -0,0 +1,77 @@
+package services
+
+// Clone 返回 Provider 的深拷贝
+// map/指针字段会被复制，修改副本不会影响原 Provider（避免在重试、缓存选择结果时发生别名问题）
+func (p Provider) Clone() Provider {
+	clone := p
+	if p.SupportedModels != nil {
+		clone.SupportedModels = make(map[string]bool, len(p.SupportedModels))
+		for k, v := range p.SupportedModels {
+			clone.SupportedModels[k] = v
+		}
+	}
+	if p.ModelMapping != nil {
+		clone.ModelMapping = cloneMap(p.ModelMapping)
+	}
+	if p.RequestPipeline != nil {
+		clone.RequestPipeline = make([]TransformSpec, len(p.RequestPipeline))
+		for i, spec := range p.RequestPipeline {
+			spec.Fields = append([]string(nil), spec.Fields...)
+			clone.RequestPipeline[i] = spec
+		}
+	}
+	if p.AvailabilityConfig != nil {
+		cfg := *p.AvailabilityConfig
+		clone.AvailabilityConfig = &cfg
+	}
+	if p.AllowModels != nil {
+		clone.AllowModels = append([]string(nil), p.AllowModels...)
+	}
+	if p.DenyModels != nil {
+		clone.DenyModels = append([]string(nil), p.DenyModels...)
+	}
+	if p.Tags != nil {
+		clone.Tags = append([]string(nil), p.Tags...)
+	}
+	return clone
+}
+
+// Clone 返回 GeminiProvider 的深拷贝
+// SettingsConfig 中嵌套的 map/slice 会递归复制
+func (p GeminiProvider) Clone() GeminiProvider {
+	clone := p
+	if p.EnvConfig != nil {
+		clone.EnvConfig = cloneMap(p.EnvConfig)
+	}
+	if p.SettingsConfig != nil {
+		clone.SettingsConfig = deepCopyValue(p.SettingsConfig).(map[string]any)
+	}
+	if p.Tags != nil {
+		clone.Tags = append([]string(nil), p.Tags...)
+	}
+	return clone
+}
+
+// deepCopyValue 递归复制 JSON 风格的值（map[string]any / []any / 标量）
+func deepCopyValue(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(val))
+		for k, item := range val {
+			copied[k] = deepCopyValue(item)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(val))
+		for i, item := range val {
+			copied[i] = deepCopyValue(item)
+		}
+		return copied
+	case map[string]string:
+		return cloneMap(val)
+	case []string:
+		return append([]string(nil), val...)
+	default:
+		return val
+	}
+}
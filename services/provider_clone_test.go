@@ -0,0 +1,55 @@
+package services
+
+import "testing"
+
+func TestProvider_Clone(t *testing.T) {
+	orig := Provider{
+		Name:               "p",
+		SupportedModels:    map[string]bool{"m1": true},
+		ModelMapping:       map[string]string{"a": "b"},
+		AvailabilityConfig: &AvailabilityConfig{TestModel: "t"},
+	}
+	clone := orig.Clone()
+	clone.SupportedModels["m2"] = true
+	clone.ModelMapping["a"] = "c"
+	clone.AvailabilityConfig.TestModel = "changed"
+
+	if len(orig.SupportedModels) != 1 {
+		t.Error("修改副本 SupportedModels 影响了原 Provider")
+	}
+	if orig.ModelMapping["a"] != "b" {
+		t.Error("修改副本 ModelMapping 影响了原 Provider")
+	}
+	if orig.AvailabilityConfig.TestModel != "t" {
+		t.Error("修改副本 AvailabilityConfig 影响了原 Provider")
+	}
+
+	if empty := (Provider{}).Clone(); empty.SupportedModels != nil || empty.ModelMapping != nil {
+		t.Error("nil 字段应保持 nil")
+	}
+}
+
+func TestGeminiProvider_Clone(t *testing.T) {
+	orig := GeminiProvider{
+		Name:      "g",
+		EnvConfig: map[string]string{"K": "V"},
+		SettingsConfig: map[string]any{
+			"nested": map[string]any{"x": 1},
+			"list":   []any{"a"},
+		},
+	}
+	clone := orig.Clone()
+	clone.EnvConfig["K"] = "changed"
+	clone.SettingsConfig["nested"].(map[string]any)["x"] = 2
+	clone.SettingsConfig["list"].([]any)[0] = "b"
+
+	if orig.EnvConfig["K"] != "V" {
+		t.Error("修改副本 EnvConfig 影响了原 Provider")
+	}
+	if orig.SettingsConfig["nested"].(map[string]any)["x"] != 1 {
+		t.Error("修改副本嵌套 map 影响了原 Provider")
+	}
+	if orig.SettingsConfig["list"].([]any)[0] != "a" {
+		t.Error("修改副本嵌套 slice 影响了原 Provider")
+	}
+}
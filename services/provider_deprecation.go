@@ -0,0 +1,94 @@
+package services
+
+import (
+	"log"
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============================================================================
+// Provider 配置废弃字段检查
+// ============================================================================
+
+// DeprecatedField 描述一个已废弃（或已改名）的 Provider 配置字段
+type DeprecatedField struct {
+	Key         string // 配置文件中的 JSON key
+	Replacement string // 替代字段（JSON 路径），为空表示直接移除
+	Hint        string // 迁移提示
+}
+
+// deprecatedProviderFields 已知的废弃字段列表
+// 新增废弃字段时在此登记即可，校验只告警不阻断
+var deprecatedProviderFields = []DeprecatedField{
+	{
+		Key:         "connectivityCheck",
+		Replacement: "availabilityMonitorEnabled",
+		Hint:        "请在可用性页面开启监控，旧字段会在下次保存时移除",
+	},
+	{
+		Key:         "connectivityTestModel",
+		Replacement: "availabilityConfig.testModel",
+		Hint:        "请在可用性页面的高级配置中设置测试模型",
+	},
+	{
+		Key:         "connectivityTestEndpoint",
+		Replacement: "availabilityConfig.testEndpoint",
+		Hint:        "请在可用性页面的高级配置中设置测试端点",
+	},
+}
+
+// DeprecationWarning 结构化的废弃字段告警
+type DeprecationWarning struct {
+	Kind        string `json:"kind"`
+	Provider    string `json:"provider"`
+	Field       string `json:"field"`
+	Replacement string `json:"replacement,omitempty"`
+	Hint        string `json:"hint"`
+}
+
+// CheckDeprecatedProviderFields 扫描原始配置文件内容，返回使用了废弃字段的告警列表
+// 直接检查 JSON key 是否存在（反序列化后无法区分"未配置"和"零值"）
+func CheckDeprecatedProviderFields(kind string, data []byte) []DeprecationWarning {
+	var warnings []DeprecationWarning
+
+	gjson.GetBytes(data, "providers").ForEach(func(_, provider gjson.Result) bool {
+		name := provider.Get("name").String()
+		for _, field := range deprecatedProviderFields {
+			if provider.Get(field.Key).Exists() {
+				warnings = append(warnings, DeprecationWarning{
+					Kind:        kind,
+					Provider:    name,
+					Field:       field.Key,
+					Replacement: field.Replacement,
+					Hint:        field.Hint,
+				})
+			}
+		}
+		return true
+	})
+
+	return warnings
+}
+
+// loggedDeprecations 已输出过的告警（kind/provider/field），LoadProviders 每次请求都会调用，同一告警只输出一次
+var loggedDeprecations sync.Map
+
+// resetLoggedDeprecations 清空已输出记录，此后每条告警可再次输出一次（测试与重新加载配置时使用）
+func resetLoggedDeprecations() {
+	loggedDeprecations.Range(func(key, _ any) bool {
+		loggedDeprecations.Delete(key)
+		return true
+	})
+}
+
+// logDeprecationWarnings 通过 logger 输出废弃字段告警，同一 kind/provider/field 在进程内只输出一次
+func logDeprecationWarnings(warnings []DeprecationWarning) {
+	for _, w := range warnings {
+		if _, logged := loggedDeprecations.LoadOrStore(w.Kind+"/"+w.Provider+"/"+w.Field, struct{}{}); logged {
+			continue
+		}
+		log.Printf("[ProviderService] [DEPRECATED] kind=%s provider=%s field=%s replacement=%s hint=%s\n",
+			w.Kind, w.Provider, w.Field, w.Replacement, w.Hint)
+	}
+}
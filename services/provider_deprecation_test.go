@@ -0,0 +1,80 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckDeprecatedProviderFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string
+		wantFields []string
+	}{
+		{
+			name: "使用废弃字段",
+			config: `{"providers": [
+				{"name": "old", "connectivityCheck": true, "connectivityTestModel": "claude-haiku"}
+			]}`,
+			wantFields: []string{"connectivityCheck", "connectivityTestModel"},
+		},
+		{
+			name: "仅使用当前字段",
+			config: `{"providers": [
+				{"name": "new", "availabilityMonitorEnabled": true, "availabilityConfig": {"testModel": "claude-haiku"}}
+			]}`,
+			wantFields: nil,
+		},
+		{
+			name:       "空配置",
+			config:     `{}`,
+			wantFields: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := CheckDeprecatedProviderFields("claude", []byte(tt.config))
+			if len(warnings) != len(tt.wantFields) {
+				t.Fatalf("期望 %d 条告警，实际 %d 条: %+v", len(tt.wantFields), len(warnings), warnings)
+			}
+			for i, w := range warnings {
+				if w.Field != tt.wantFields[i] {
+					t.Errorf("告警[%d].Field = %s, 期望 %s", i, w.Field, tt.wantFields[i])
+				}
+				if w.Hint == "" || w.Replacement == "" {
+					t.Errorf("告警[%d] 缺少迁移提示: %+v", i, w)
+				}
+				if w.Kind != "claude" || w.Provider != "old" {
+					t.Errorf("告警[%d] 上下文错误: %+v", i, w)
+				}
+			}
+		})
+	}
+}
+
+func TestLogDeprecationWarnings_Once(t *testing.T) {
+	var buf bytes.Buffer
+	orig := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(orig)
+	resetLoggedDeprecations()
+	t.Cleanup(resetLoggedDeprecations)
+
+	// 每次运行使用不同的 kind，避免 -count=N 时与上一轮的记录冲突
+	kind := fmt.Sprintf("test-once-%d", time.Now().UnixNano())
+	warnings := CheckDeprecatedProviderFields(kind, []byte(`{"providers": [
+		{"name": "a", "connectivityCheck": true},
+		{"name": "b", "connectivityCheck": true}
+	]}`))
+	for i := 0; i < 3; i++ {
+		logDeprecationWarnings(warnings)
+	}
+	if got := strings.Count(buf.String(), "[DEPRECATED]"); got != 2 {
+		t.Errorf("输出了 %d 条告警, 期望每个 provider/字段只输出一次（2 条）:\n%s", got, buf.String())
+	}
+}
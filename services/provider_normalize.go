@@ -0,0 +1,52 @@
+package services
+
+import "strings"
+
+// ============================================================================
+// Provider 配置规范化
+// ============================================================================
+
+// builtinAuthTypes ConnectivityAuthType 的内置取值（大小写不敏感），其余值视为自定义 Header 名
+var builtinAuthTypes = map[string]bool{"bearer": true, "x-api-key": true, "custom": true}
+
+// NormalizeProvider 返回规范化后的 Provider 副本（深拷贝，不修改入参）
+//   - Kind 按 NormalizeKind 规范化（内置平台名与 "custom:" 前缀转为小写）
+//   - 去除 Name、APIURL、APIKey、APIEndpoint、Region、AnthropicBeta、APIVersion、ConnectivityAuthType 首尾空白
+//   - 去除 APIURL 末尾的 "/"
+//   - Level <= 0 时设为 DefaultProviderLevel
+//   - 认证方式为内置取值（bearer / x-api-key / custom）时转为小写；自定义 Header 名保持原样
+//
+// 用于合并来自环境变量、文件等不同来源的配置，使 HasValidConfig 与 URL 拼接的结果与来源无关
+func NormalizeProvider(p Provider) Provider {
+	n := p.Clone()
+	n.Name = strings.TrimSpace(n.Name)
+	n.Kind = NormalizeKind(n.Kind)
+	n.APIURL = strings.TrimRight(strings.TrimSpace(n.APIURL), "/")
+	n.APIKey = strings.TrimSpace(n.APIKey)
+	n.APIEndpoint = strings.TrimSpace(n.APIEndpoint)
+	n.Region = strings.TrimSpace(n.Region)
+	n.AnthropicBeta = strings.TrimSpace(n.AnthropicBeta)
+	n.APIVersion = strings.TrimSpace(n.APIVersion)
+
+	n.ConnectivityAuthType = strings.TrimSpace(n.ConnectivityAuthType)
+	if lower := strings.ToLower(n.ConnectivityAuthType); builtinAuthTypes[lower] {
+		n.ConnectivityAuthType = lower
+	}
+
+	if n.Level <= 0 {
+		n.Level = DefaultProviderLevel
+	}
+	return n
+}
+
+// NormalizeProviders 批量规范化，返回新切片，顺序不变
+func NormalizeProviders(providers []Provider) []Provider {
+	if providers == nil {
+		return nil
+	}
+	normalized := make([]Provider, len(providers))
+	for i, p := range providers {
+		normalized[i] = NormalizeProvider(p)
+	}
+	return normalized
+}
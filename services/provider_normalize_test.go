@@ -0,0 +1,71 @@
+package services
+
+import "testing"
+
+func TestNormalizeProvider(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Provider
+		want Provider
+	}{
+		{
+			"去空白与末尾斜杠",
+			Provider{Name: " p1 ", APIURL: " https://api.example.com/// ", APIKey: " sk-1\n", Level: 2},
+			Provider{Name: "p1", APIURL: "https://api.example.com", APIKey: "sk-1", Level: 2},
+		},
+		{
+			"Level 默认值",
+			Provider{Name: "p", Level: -1},
+			Provider{Name: "p", Level: DefaultProviderLevel},
+		},
+		{
+			"内置认证方式转小写",
+			Provider{Name: "p", Level: 1, ConnectivityAuthType: " X-API-Key "},
+			Provider{Name: "p", Level: 1, ConnectivityAuthType: "x-api-key"},
+		},
+		{
+			"内置平台 Kind 转小写",
+			Provider{Name: "p", Level: 1, Kind: " Claude "},
+			Provider{Name: "p", Level: 1, Kind: "claude"},
+		},
+		{
+			"自定义平台只转换前缀",
+			Provider{Name: "p", Level: 1, Kind: "CUSTOM:MyCLI"},
+			Provider{Name: "p", Level: 1, Kind: "custom:MyCLI"},
+		},
+		{
+			"自定义 Header 名保持原样",
+			Provider{Name: "p", Level: 1, ConnectivityAuthType: "X-Custom-Token"},
+			Provider{Name: "p", Level: 1, ConnectivityAuthType: "X-Custom-Token"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeProvider(tt.in)
+			if got.Name != tt.want.Name || got.APIURL != tt.want.APIURL || got.APIKey != tt.want.APIKey ||
+				got.Level != tt.want.Level || got.ConnectivityAuthType != tt.want.ConnectivityAuthType || got.Kind != tt.want.Kind {
+				t.Errorf("NormalizeProvider() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("返回副本", func(t *testing.T) {
+		orig := Provider{Name: " p ", ModelMapping: map[string]string{"a": "b"}, AllowModels: []string{"m"}}
+		got := NormalizeProvider(orig)
+		got.ModelMapping["a"] = "c"
+		got.AllowModels[0] = "x"
+		if orig.Name != " p " || orig.ModelMapping["a"] != "b" || orig.AllowModels[0] != "m" {
+			t.Errorf("入参被修改: %+v", orig)
+		}
+	})
+
+	t.Run("批量", func(t *testing.T) {
+		got := NormalizeProviders([]Provider{{Name: "a "}, {Name: " b", APIURL: "http://x/"}})
+		if len(got) != 2 || got[0].Name != "a" || got[1].APIURL != "http://x" || got[1].Level != DefaultProviderLevel {
+			t.Errorf("NormalizeProviders() = %+v", got)
+		}
+		if NormalizeProviders(nil) != nil {
+			t.Error("nil 输入应返回 nil")
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ============================================================================
+// Provider 配置中的环境变量引用
+// ============================================================================
+
+// secretRefPattern 环境变量引用 ${VAR}；不支持 $VAR 写法，避免误替换 APIKey 中本身含有的 "$"
+var secretRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// lookupEnv 环境变量来源（测试中替换）
+var lookupEnv = os.LookupEnv
+
+// ExpandProviderSecrets 将 APIKey、APIURL 中的 ${VAR} 替换为环境变量的值，返回展开后的副本（不修改入参）
+// 引用的环境变量未设置时返回错误（列出所有缺失的变量）与原 provider，避免占位符原样发往上游
+// 只用于转发前的内存副本：展开结果不应写回配置文件，否则密钥会落盘
+func ExpandProviderSecrets(p Provider) (Provider, error) {
+	var missing []string
+	expand := func(value string) string {
+		if !strings.Contains(value, "${") {
+			return value
+		}
+		return secretRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+			name := secretRefPattern.FindStringSubmatch(ref)[1]
+			v, ok := lookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+				return ref
+			}
+			return v
+		})
+	}
+
+	expanded := p.Clone()
+	expanded.APIKey = expand(p.APIKey)
+	expanded.APIURL = expand(p.APIURL)
+	if len(missing) > 0 {
+		return p, fmt.Errorf("provider %s 引用的环境变量未设置: %s", p.Name, strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// ExpandProvidersSecrets 批量展开，返回成功展开的 providers（保持顺序）
+// 展开失败的 provider 不包含在结果中，所有失败原因合并为一个错误返回
+func ExpandProvidersSecrets(providers []Provider) ([]Provider, error) {
+	if providers == nil {
+		return nil, nil
+	}
+	expanded := make([]Provider, 0, len(providers))
+	var errs []error
+	for _, p := range providers {
+		ep, err := ExpandProviderSecrets(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		expanded = append(expanded, ep)
+	}
+	return expanded, errors.Join(errs...)
+}
+
+// loadRelayProviders 加载 kind 的 provider 配置并展开环境变量引用，供转发使用
+// 设置了 ProviderRegistry 且其中有该平台时从当前快照读取，否则从配置文件加载
+// 展开失败的 provider 记录警告后跳过，不影响其余 provider
+func (prs *ProviderRelayService) loadRelayProviders(kind string) ([]Provider, error) {
+	providers, ok := prs.registry.Load().snapshot().Providers(kind)
+	if !ok {
+		var err error
+		if providers, err = prs.providerService.LoadProviders(kind); err != nil {
+			return nil, err
+		}
+	}
+	expanded, err := ExpandProvidersSecrets(providers)
+	if err != nil {
+		fmt.Printf("[WARN] [%s] 部分 provider 的环境变量引用无法展开，已跳过: %v\n", kind, err)
+	}
+	return expanded, nil
+}
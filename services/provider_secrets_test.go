@@ -0,0 +1,55 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandProviderSecrets(t *testing.T) {
+	env := map[string]string{"ANTHROPIC_KEY": "sk-secret", "RELAY_HOST": "relay.example.com", "EMPTY": ""}
+	defer func(orig func(string) (string, bool)) { lookupEnv = orig }(lookupEnv)
+	lookupEnv = func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	tests := []struct {
+		name        string
+		provider    Provider
+		wantKey     string
+		wantURL     string
+		wantMissing string
+	}{
+		{"展开 APIKey 与 APIURL", Provider{APIKey: "${ANTHROPIC_KEY}", APIURL: "https://${RELAY_HOST}/api"}, "sk-secret", "https://relay.example.com/api", ""},
+		{"无引用原样保留", Provider{APIKey: "sk-$plain", APIURL: "https://a"}, "sk-$plain", "https://a", ""},
+		{"已设置的空值", Provider{APIKey: "${EMPTY}", APIURL: "https://a"}, "", "https://a", ""},
+		{"未设置的变量", Provider{APIKey: "${MISSING_KEY}", APIURL: "https://${MISSING_HOST}"}, "${MISSING_KEY}", "https://${MISSING_HOST}", "MISSING_KEY, MISSING_HOST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandProviderSecrets(tt.provider)
+			if tt.wantMissing != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantMissing) {
+					t.Errorf("err = %v, 期望包含 %q", err, tt.wantMissing)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.APIKey != tt.wantKey || got.APIURL != tt.wantURL {
+				t.Errorf("got (%q, %q), want (%q, %q)", got.APIKey, got.APIURL, tt.wantKey, tt.wantURL)
+			}
+		})
+	}
+
+	expanded, err := ExpandProvidersSecrets([]Provider{
+		{Name: "a", APIKey: "${ANTHROPIC_KEY}"},
+		{Name: "b", APIKey: "${MISSING_KEY}"},
+		{Name: "c", APIKey: "sk-c"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "provider b") {
+		t.Errorf("批量展开错误 = %v", err)
+	}
+	if len(expanded) != 2 || expanded[0].APIKey != "sk-secret" || expanded[1].Name != "c" {
+		t.Errorf("展开失败的 provider 应被排除: %+v", expanded)
+	}
+}
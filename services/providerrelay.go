@@ -8,9 +8,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/daodao97/xgo/xdb"
@@ -40,6 +43,15 @@ type ProviderRelayService struct {
 	lastUsedMu          sync.RWMutex                 // 保护 lastUsed 的锁
 	rrMu                sync.Mutex                   // 轮询状态锁
 	rrLastStart         map[string]string            // 轮询状态：key="platform:level" → value=上次起始 Provider Name
+	modelsCache         *ModelsCache                 // /v1/models 响应缓存
+	inflight            *inflightTracker             // 在途请求计数（用于优雅关闭）
+	streamResumer       *StreamResumer               // 流式响应断线续传（Provider.ResumableStream）
+	singleFlight        *SingleFlight                // 相同非流式请求合并
+	coalescing          atomic.Bool                  // 是否开启相同请求合并（见 SetRequestCoalescing）
+	warmUpOnStart       atomic.Bool                  // 启动时是否预热 provider 连接（见 SetWarmUpOnStart）
+
+	// 内存中的 provider 配置（见 SetProviderRegistry），为 nil 时从配置文件加载
+	registry atomic.Pointer[ProviderRegistry]
 }
 
 // errClientAbort 表示客户端中断连接，不应计入 provider 失败次数
@@ -65,7 +77,11 @@ func NewProviderRelayService(providerService *ProviderService, geminiService *Ge
 			"codex":  nil,
 			"gemini": nil,
 		},
-		rrLastStart: make(map[string]string),
+		rrLastStart:   make(map[string]string),
+		modelsCache:   NewModelsCache(DefaultModelsCacheTTL),
+		inflight:      newInflightTracker(),
+		streamResumer: NewStreamResumer(),
+		singleFlight:  NewSingleFlight(),
 	}
 }
 
@@ -127,10 +143,11 @@ func (prs *ProviderRelayService) isRoundRobinEnabled() bool {
 //   - level: 当前 Level
 //   - providers: 同 Level 的 providers 列表（已过滤、按用户排序）
 //
-// 返回：轮询排序后的 providers 列表（新切片，不修改原切片）
-func (prs *ProviderRelayService) roundRobinOrder(platform string, level int, providers []Provider) []Provider {
+// 返回：轮询排序后的 providers 列表（新切片，不修改原切片），以及排序所依据的上次起始 provider 名称
+// （记录到日志与 Selection，事后可用 RoundRobinState.SeedKey 复现同样的顺序）
+func (prs *ProviderRelayService) roundRobinOrder(platform string, level int, providers []Provider) ([]Provider, string) {
 	if len(providers) <= 1 {
-		return providers
+		return providers, ""
 	}
 
 	// 构建 key: "platform:level"
@@ -146,7 +163,7 @@ func (prs *ProviderRelayService) roundRobinOrder(platform string, level int, pro
 
 	// 如果没有历史记录，返回原顺序
 	if lastStart == "" {
-		return providers
+		return providers, ""
 	}
 
 	// 查找上次起始 provider 在当前列表中的位置
@@ -160,7 +177,7 @@ func (prs *ProviderRelayService) roundRobinOrder(platform string, level int, pro
 
 	// 上次起始 provider 不在当前列表（可能被禁用/黑名单），返回原顺序
 	if lastIdx == -1 {
-		return providers
+		return providers, lastStart
 	}
 
 	// 构建轮询顺序：从 lastIdx+1 开始，环形遍历
@@ -173,13 +190,13 @@ func (prs *ProviderRelayService) roundRobinOrder(platform string, level int, pro
 	// 更新本次起始 provider 名称
 	prs.rrLastStart[key] = result[0].Name
 
-	return result
+	return result, lastStart
 }
 
 // roundRobinOrderGemini 对 Gemini providers 进行轮询排序（复用相同逻辑）
-func (prs *ProviderRelayService) roundRobinOrderGemini(level int, providers []GeminiProvider) []GeminiProvider {
+func (prs *ProviderRelayService) roundRobinOrderGemini(level int, providers []GeminiProvider) ([]GeminiProvider, string) {
 	if len(providers) <= 1 {
-		return providers
+		return providers, ""
 	}
 
 	// 构建 key: "gemini:level"
@@ -195,7 +212,7 @@ func (prs *ProviderRelayService) roundRobinOrderGemini(level int, providers []Ge
 
 	// 如果没有历史记录，返回原顺序
 	if lastStart == "" {
-		return providers
+		return providers, ""
 	}
 
 	// 查找上次起始 provider 在当前列表中的位置
@@ -209,7 +226,7 @@ func (prs *ProviderRelayService) roundRobinOrderGemini(level int, providers []Ge
 
 	// 上次起始 provider 不在当前列表，返回原顺序
 	if lastIdx == -1 {
-		return providers
+		return providers, lastStart
 	}
 
 	// 构建轮询顺序
@@ -222,7 +239,7 @@ func (prs *ProviderRelayService) roundRobinOrderGemini(level int, providers []Ge
 	// 更新本次起始 provider 名称
 	prs.rrLastStart[key] = result[0].Name
 
-	return result
+	return result, lastStart
 }
 
 func (prs *ProviderRelayService) Start() error {
@@ -236,6 +253,8 @@ func (prs *ProviderRelayService) Start() error {
 	}
 
 	router := gin.Default()
+	router.Use(prs.inflight.middleware())
+	router.Use(coalesceMiddleware(&prs.coalescing, prs.singleFlight))
 	prs.registerRoutes(router)
 
 	prs.server = &http.Server{
@@ -250,6 +269,10 @@ func (prs *ProviderRelayService) Start() error {
 			fmt.Printf("provider relay server error: %v\n", err)
 		}
 	}()
+
+	if prs.warmUpOnStart.Load() {
+		go prs.warmUpProviders()
+	}
 	return nil
 }
 
@@ -264,6 +287,9 @@ func (prs *ProviderRelayService) validateConfig() []string {
 			warnings = append(warnings, fmt.Sprintf("[%s] 加载配置失败: %v", kind, err))
 			continue
 		}
+		if _, err := ExpandProvidersSecrets(providers); err != nil {
+			warnings = append(warnings, fmt.Sprintf("[%s] %v", kind, err))
+		}
 
 		enabledCount := 0
 		for _, p := range providers {
@@ -349,6 +375,13 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 		}
 
+		// 结构明显错误的请求直接返回 400，避免消耗 provider 重试
+		if err := ValidateRequestShape(bodyBytes, formatForKind(kind)); err != nil {
+			fmt.Printf("[WARN] 请求结构校验失败: %v\n", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		if fixedBody, fixed, err := FixIncompleteToolUse(bodyBytes); err != nil {
 			fmt.Printf("[WARN] 修复 tool_use 失败: %v\n", err)
 		} else if fixed {
@@ -356,6 +389,14 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 		}
 
+		// 合并相邻同角色消息（补充 tool_result 或合并历史后可能出现连续 user 消息）
+		if coalesced, changed, err := CoalesceConsecutiveRoles(bodyBytes); err != nil {
+			fmt.Printf("[WARN] 合并相邻同角色消息失败: %v\n", err)
+		} else if changed {
+			bodyBytes = coalesced
+			c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		}
+
 		isStream := gjson.GetBytes(bodyBytes, "stream").Bool()
 		requestedModel := gjson.GetBytes(bodyBytes, "model").String()
 
@@ -364,7 +405,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			fmt.Printf("[WARN] 请求未指定模型名，无法执行模型智能降级\n")
 		}
 
-		providers, err := prs.providerService.LoadProviders(kind)
+		providers, err := prs.loadRelayProviders(kind)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load providers"})
 			return
@@ -372,6 +413,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 		active := make([]Provider, 0, len(providers))
 		skippedCount := 0
+		estimatedTokens := -1 // 输入 token 预估，有 provider 配置上下文上限时才计算
 		for _, provider := range providers {
 			// 基础过滤：enabled、URL、APIKey
 			if !provider.Enabled || provider.APIURL == "" || provider.APIKey == "" {
@@ -382,6 +424,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			if errs := provider.ValidateConfiguration(); len(errs) > 0 {
 				fmt.Printf("[WARN] Provider %s 配置验证失败，已自动跳过: %v\n", provider.Name, errs)
 				skippedCount++
+				currentMetrics().IncSkipped(kind, provider.Name, string(SkipReasonConfigValidationFailed))
 				continue
 			}
 
@@ -389,13 +432,36 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			if requestedModel != "" && !provider.IsModelSupported(requestedModel) {
 				fmt.Printf("[INFO] Provider %s 不支持模型 %s，已跳过\n", provider.Name, requestedModel)
 				skippedCount++
+				currentMetrics().IncSkipped(kind, provider.Name, string(SkipReasonModelUnsupported))
+				continue
+			}
+
+			// 声明式模型策略（allowModels / denyModels）
+			if !provider.ModelAllowedByPolicy(requestedModel) {
+				fmt.Printf("[INFO] Provider %s 的模型策略禁止 %s，已跳过\n", provider.Name, requestedModel)
+				skippedCount++
+				currentMetrics().IncSkipped(kind, provider.Name, string(SkipReasonModelDenied))
 				continue
 			}
 
+			// 上下文上限：预估输入明显超出时跳过，避免浪费一次上游请求
+			if provider.MaxContextTokens > 0 {
+				if estimatedTokens < 0 {
+					estimatedTokens = EstimateInputTokens(bodyBytes, formatForKind(kind))
+				}
+				if !provider.FitsContext(estimatedTokens) {
+					fmt.Printf("[INFO] Provider %s 上下文上限 %d，预估输入 %d tokens，已跳过\n", provider.Name, provider.MaxContextTokens, estimatedTokens)
+					skippedCount++
+					currentMetrics().IncSkipped(kind, provider.Name, string(SkipReasonContextTooLarge))
+					continue
+				}
+			}
+
 			// 黑名单检查：跳过已拉黑的 provider
 			if isBlacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); isBlacklisted {
 				fmt.Printf("⛔ Provider %s 已拉黑，过期时间: %v\n", provider.Name, until.Format("15:04:05"))
 				skippedCount++
+				currentMetrics().IncSkipped(kind, provider.Name, string(SkipReasonBlacklisted))
 				continue
 			}
 
@@ -403,7 +469,11 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 		}
 
 		if len(active) == 0 {
-			if requestedModel != "" {
+			if len(providers) == 0 {
+				// 根本没有配置 provider，与"全部被过滤"区分，便于排查配置问题
+				err := fmt.Errorf("%w for kind %s", ErrNoProvidersConfigured, kind)
+				c.JSON(http.StatusNotFound, BuildFailureResponse(0, "", err, ""))
+			} else if requestedModel != "" {
 				c.JSON(http.StatusNotFound, gin.H{
 					"error": fmt.Sprintf("没有可用的 provider 支持模型 '%s'（已跳过 %d 个不兼容的 provider）", requestedModel, skippedCount),
 				})
@@ -438,7 +508,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 		fmt.Printf("[INFO] 共 %d 个 Level 分组：%v\n", len(levels), levels)
 
-		query := flattenQuery(c.Request.URL.Query())
+		query := c.Request.URL.Query()
 		clientHeaders := cloneHeaders(c.Request.Header)
 
 		// 获取拉黑功能开关状态
@@ -459,14 +529,17 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 			var lastError error
 			var lastProvider string
-			totalAttempts := 0
+			rc := newRelayRetryContext(kind, maxRetryPerProvider, retryWaitSeconds)
+			providersLeft := countLevelProviders(levelGroups) // 当前 provider 之后尚未尝试的 provider 数，用于分配单次尝试超时
 
 			// 遍历所有 Level 和 Provider
+		blacklistLevels:
 			for _, level := range levels {
 				providersInLevel := levelGroups[level]
 				fmt.Printf("[INFO] === 尝试 Level %d（%d 个 provider）===\n", level, len(providersInLevel))
 
 				for _, provider := range providersInLevel {
+					providersLeft--
 					// 检查是否已被拉黑（跳过已拉黑的 provider）
 					if blacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); blacklisted {
 						fmt.Printf("[INFO] ⏭️ 跳过已拉黑的 Provider: %s (解禁时间: %v)\n", provider.Name, until)
@@ -491,7 +564,18 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 
 					// 同 Provider 内重试循环
 					for retryCount := 0; retryCount < maxRetryPerProvider; retryCount++ {
-						totalAttempts++
+						// 客户端已断开，不再尝试后续 Provider
+						if c.Request.Context().Err() != nil {
+							fmt.Printf("[INFO] 客户端已断开，停止尝试后续 Provider\n")
+							return
+						}
+
+						if err := rc.admit(); err != nil {
+							fmt.Printf("[WARN] 停止尝试后续 Provider: %v\n", err)
+							break blacklistLevels
+						}
+						rc.TotalAttempts++
+						markSelection(c, Selection{Platform: kind, Provider: provider.Name, Level: level, Attempt: rc.TotalAttempts, AttemptTimeout: rc.AttemptTimeout(providersLeft + 1)})
 
 						// 再次检查是否已被拉黑（重试过程中可能被拉黑）
 						if blacklisted, _ := prs.blacklistService.IsBlacklisted(kind, provider.Name); blacklisted {
@@ -519,6 +603,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 						// 失败处理
 						lastError = err
 						lastProvider = provider.Name
+						markFailed(c, provider.Name)
 
 						errorMsg := "未知错误"
 						if err != nil {
@@ -533,28 +618,46 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 							return
 						}
 
+						// 请求本身有问题（见 IsFatal）：换 provider 也会失败，不计入失败次数，直接返回
+						if IsFatal(err, 0) {
+							respondFatalError(c, provider.Name, DetectFormat(bodyBytes, c.Request.URL.Path), err)
+							return
+						}
+
 						// 记录失败次数（可能触发拉黑）
 						if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
 							fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
 						}
 
+						// 心跳已写出响应头，换 provider 会重复写入响应
+						if errors.Is(err, errResponseCommitted) {
+							return
+						}
+
 						// 检查是否刚被拉黑
 						if blacklisted, _ := prs.blacklistService.IsBlacklisted(kind, provider.Name); blacklisted {
 							fmt.Printf("[INFO] 🚫 Provider %s 达到失败阈值，已被拉黑，切换到下一个\n", provider.Name)
 							break
 						}
 
-						// 等待后重试（除非是最后一次）
-						if retryCount < maxRetryPerProvider-1 {
+						// 等待后重试（除非是最后一次或已达到尝试次数上限）
+						if retryCount < maxRetryPerProvider-1 && rc.CanAttempt() {
 							fmt.Printf("[INFO] ⏳ 等待 %d 秒后重试...\n", retryWaitSeconds)
-							time.Sleep(time.Duration(retryWaitSeconds) * time.Second)
+							if !rc.WaitRetry(c.Request.Context()) {
+								if c.Request.Context().Err() != nil {
+									fmt.Printf("[INFO] 客户端已断开，停止重试\n")
+									return
+								}
+								fmt.Printf("[WARN] 等待重试会超出时间预算，停止尝试后续 Provider\n")
+								break blacklistLevels
+							}
 						}
 					}
 				}
 			}
 
 			// 所有 Provider 都失败或被拉黑
-			fmt.Printf("[ERROR] 💥 拉黑模式：所有 Provider 都失败或被拉黑（共尝试 %d 次）\n", totalAttempts)
+			fmt.Printf("[ERROR] 💥 拉黑模式：所有 Provider 都失败或被拉黑（共尝试 %d 次）\n", rc.TotalAttempts)
 
 			errorMsg := "未知错误"
 			if lastError != nil {
@@ -563,7 +666,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			c.JSON(http.StatusBadGateway, gin.H{
 				"error":         fmt.Sprintf("所有 Provider 都失败或被拉黑，最后尝试: %s - %s", lastProvider, errorMsg),
 				"lastProvider":  lastProvider,
-				"totalAttempts": totalAttempts,
+				"totalAttempts": rc.TotalAttempts,
 				"mode":          "blacklist_retry",
 				"hint":          "拉黑模式已开启，同 Provider 重试到拉黑再切换。如需立即降级请关闭拉黑功能",
 			})
@@ -581,20 +684,35 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 		var lastError error
 		var lastProvider string
 		var lastDuration time.Duration
-		totalAttempts := 0
+		rc := newRelayRetryContext(kind, 1, 0)
+		providersLeft := countLevelProviders(levelGroups) // 当前 provider 之后尚未尝试的 provider 数，用于分配单次尝试超时
 
+	fallbackLevels:
 		for _, level := range levels {
 			providersInLevel := levelGroups[level]
 
 			// 如果启用轮询，对同 Level 的 providers 进行轮询排序
+			lastStart := ""
 			if roundRobinEnabled {
-				providersInLevel = prs.roundRobinOrder(kind, level, providersInLevel)
+				providersInLevel, lastStart = prs.roundRobinOrder(kind, level, providersInLevel)
 			}
 
-			fmt.Printf("[INFO] === 尝试 Level %d（%d 个 provider）===\n", level, len(providersInLevel))
+			fmt.Printf("[INFO] === 尝试 Level %d（%d 个 provider，lastStart=%q）===\n", level, len(providersInLevel), lastStart)
 
 			for i, provider := range providersInLevel {
-				totalAttempts++
+				providersLeft--
+				// 客户端已断开，不再尝试后续 Provider
+				if c.Request.Context().Err() != nil {
+					fmt.Printf("[INFO] 客户端已断开，停止尝试后续 Provider\n")
+					return
+				}
+
+				if err := rc.admit(); err != nil {
+					fmt.Printf("[WARN] 停止尝试后续 Provider: %v\n", err)
+					break fallbackLevels
+				}
+				rc.TotalAttempts++
+				markSelection(c, Selection{Platform: kind, Provider: provider.Name, Level: level, Attempt: rc.TotalAttempts, AttemptTimeout: rc.AttemptTimeout(providersLeft + 1), LastStart: lastStart})
 
 				// 获取实际应该使用的模型名
 				effectiveModel := provider.GetEffectiveModel(requestedModel)
@@ -639,6 +757,7 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				// 失败：记录错误并尝试下一个
 				lastError = err
 				lastProvider = provider.Name
+				markFailed(c, provider.Name)
 				lastDuration = duration
 
 				errorMsg := "未知错误"
@@ -648,6 +767,12 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 				fmt.Printf("[WARN]   ✗ Level %d 失败: %s | 错误: %s | 耗时: %.2fs\n",
 					level, provider.Name, errorMsg, duration.Seconds())
 
+				// 请求本身有问题（见 IsFatal）：换 provider 也会失败，不计入失败次数，直接返回
+				if IsFatal(err, 0) {
+					respondFatalError(c, provider.Name, DetectFormat(bodyBytes, c.Request.URL.Path), err)
+					return
+				}
+
 				// 客户端中断不计入失败次数
 				if errors.Is(err, errClientAbort) {
 					fmt.Printf("[INFO] 客户端中断，跳过失败计数: %s\n", provider.Name)
@@ -655,6 +780,11 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 					fmt.Printf("[ERROR] 记录失败到黑名单失败: %v\n", err)
 				}
 
+				// 心跳已写出响应头，换 provider 会重复写入响应
+				if errors.Is(err, errResponseCommitted) {
+					return
+				}
+
 				// 发送切换通知：检查是否有下一个可用的 provider
 				if prs.notificationService != nil {
 					nextProvider := ""
@@ -690,13 +820,13 @@ func (prs *ProviderRelayService) proxyHandler(kind string, endpoint string) gin.
 			errorMsg = lastError.Error()
 		}
 		fmt.Printf("[ERROR] 所有 %d 个 provider 均失败，最后尝试: %s | 错误: %s\n",
-			totalAttempts, lastProvider, errorMsg)
+			rc.TotalAttempts, lastProvider, errorMsg)
 
 		c.JSON(http.StatusBadGateway, gin.H{
-			"error":         fmt.Sprintf("所有 %d 个 provider 均失败，最后错误: %s", totalAttempts, errorMsg),
+			"error":         fmt.Sprintf("所有 %d 个 provider 均失败，最后错误: %s", rc.TotalAttempts, errorMsg),
 			"last_provider": lastProvider,
 			"last_duration": fmt.Sprintf("%.2fs", lastDuration.Seconds()),
-			"total_attempts": totalAttempts,
+			"total_attempts": rc.TotalAttempts,
 		})
 	}
 }
@@ -706,13 +836,14 @@ func (prs *ProviderRelayService) forwardRequest(
 	kind string,
 	provider Provider,
 	endpoint string,
-	query map[string]string,
+	query url.Values,
 	clientHeaders map[string]string,
 	bodyBytes []byte,
 	isStream bool,
 	model string,
-) (bool, error) {
-	targetURL := joinURL(provider.APIURL, endpoint)
+) (ok bool, err error) {
+	// 查询参数直接拼入 URL：xrequest.SetQueryParams 只接受单值 map，会丢失重复的 key
+	targetURL := appendQuery(joinURL(provider.APIURL, endpoint), query)
 	headers := cloneMap(clientHeaders)
 
 	// 根据认证方式设置请求头（默认 Bearer，与 v2.2.x 保持一致）
@@ -721,7 +852,9 @@ func (prs *ProviderRelayService) forwardRequest(
 	case "x-api-key":
 		// 仅当用户显式选择 x-api-key 时使用（Anthropic 官方 API）
 		headers["x-api-key"] = provider.APIKey
-		headers["anthropic-version"] = "2023-06-01"
+		if !hasHeaderFold(headers, AnthropicVersionHeader) {
+			headers[AnthropicVersionHeader] = DefaultAnthropicVersion
+		}
 	case "", "bearer":
 		// 默认使用 Bearer token（兼容所有第三方中转）
 		headers["Authorization"] = fmt.Sprintf("Bearer %s", provider.APIKey)
@@ -738,15 +871,28 @@ func (prs *ProviderRelayService) forwardRequest(
 		headers["Accept"] = "application/json"
 	}
 
+	// provider 固定的 API 版本覆盖客户端与默认值
+	if name, value := versionHeaderFor(providerFormat(provider, endpoint), provider.APIVersion); name != "" {
+		setHeaderFold(headers, name, value)
+	}
+
+	// 合并客户端与 provider 要求的 beta 标志（如 prompt caching 与长上下文可以同时生效）
+	if provider.AnthropicBeta != "" {
+		setBetaHeader(headers, provider.AnthropicBeta)
+	}
+
 	requestLog := &ReqeustLog{
-		Platform: kind,
-		Provider: provider.Name,
-		Model:    model,
-		IsStream: isStream,
+		Platform:   kind,
+		Provider:   provider.Name,
+		Model:      model,
+		IsStream:   isStream,
+		APIKeyHash: ClientAPIKeyHash(clientHeaders),
 	}
+	fillLogFromSelection(c.Request.Context(), requestLog)
 	start := time.Now()
 	defer func() {
 		requestLog.DurationSec = time.Since(start).Seconds()
+		observeAttempt(kind, provider.Name, time.Since(start), ok, err)
 
 		// 【修复】判空保护：避免队列未初始化时 panic
 		if GlobalDBQueueLogs == nil {
@@ -762,8 +908,9 @@ func (prs *ProviderRelayService) forwardRequest(
 			INSERT INTO request_log (
 				platform, model, provider, http_code,
 				input_tokens, output_tokens, cache_create_tokens, cache_read_tokens,
-				reasoning_tokens, is_stream, duration_sec
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				reasoning_tokens, is_stream, duration_sec, attempt_count, failed_providers,
+				api_key_hash, ttfb_sec, response_bytes
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		`,
 			requestLog.Platform,
 			requestLog.Model,
@@ -776,6 +923,11 @@ func (prs *ProviderRelayService) forwardRequest(
 			requestLog.ReasoningTokens,
 			boolToInt(requestLog.IsStream),
 			requestLog.DurationSec,
+			max(requestLog.AttemptCount, 1),
+			requestLog.FailedProviders,
+			requestLog.APIKeyHash,
+			requestLog.TimeToFirstByte,
+			requestLog.ResponseBytes,
 		)
 
 		if err != nil {
@@ -783,11 +935,65 @@ func (prs *ProviderRelayService) forwardRequest(
 		}
 	}()
 
+	// 执行 Provider 配置的请求转换流水线
+	clientModel := gjson.GetBytes(bodyBytes, "model").String()
+	transformed, err := applyRequestPipeline(&provider, bodyBytes)
+	if err != nil {
+		return false, fmt.Errorf("请求转换失败: %w", err)
+	}
+	bodyBytes = transformed
+
+	// 移除中转插入内容上的标记字段（上游会拒绝未知字段），调用方保留的请求体仍带标记，重试时不会重复插入
+	if stripped, _, err := StripSyntheticMarkers(bodyBytes); err != nil {
+		fmt.Printf("[WARN] 移除 %s 标记失败，按原请求转发: %v\n", SyntheticMarker, err)
+	} else {
+		bodyBytes = stripped
+	}
+
+	// 流水线改写了模型名（RemapModel）时，响应中的模型名需回写为客户端请求的名称，避免暴露内部映射
+	upstreamModel := gjson.GetBytes(bodyBytes, "model").String()
+	responseHooks := []xrequest.ResponseHook{ReqeustLogHook(c, kind, requestLog)}
+	if hook := ModelRewriteHook(upstreamModel, clientModel); hook != nil {
+		responseHooks = append(responseHooks, hook)
+	}
+
+	// 支持 prompt caching 的上游：自动注入 cache_control 断点，客户端已自行设置时不改动
+	if provider.SupportsPromptCaching && DetectFormat(bodyBytes, endpoint) == FormatClaude {
+		if cached, changed, err := InjectCacheControl(bodyBytes, DefaultCacheBreakpoints); err != nil {
+			fmt.Printf("[WARN] Provider %s 注入 cache_control 失败，按原请求转发: %v\n", provider.Name, err)
+		} else if changed {
+			bodyBytes = cached
+		}
+	}
+
+	// 强制非流式：上游按非流式请求，成功后再切分为 SSE 返回给客户端
+	bufferedStream := false
+	if isStream && provider.ForceNonStream {
+		if nonStream, err := SetStream(bodyBytes, false); err != nil {
+			fmt.Printf("[WARN] Provider %s 强制非流式失败，按原请求转发: %v\n", provider.Name, err)
+		} else {
+			bodyBytes = nonStream
+			bufferedStream = true
+		}
+	}
+
+	// 上游不支持 n>1：拆分为多个单次请求后合并（子请求各自压缩）
+	if needsCompletionSplit(provider, bodyBytes, endpoint, isStream) {
+		return prs.forwardSplitCompletions(c, provider, targetURL, headers, bodyBytes, requestLog, start, upstreamModel, clientModel)
+	}
+
+	// 上游支持时压缩请求体，同时更新 Content-Encoding/Content-Length
+	if provider.SupportsGzip {
+		bodyBytes = compressRequestBody(provider.Name, headers, bodyBytes)
+	}
+
 	req := xrequest.New().
 		SetHeaders(headers).
-		SetQueryParams(query).
 		SetRetry(1, 500*time.Millisecond).
-		SetTimeout(32 * time.Hour) // 32小时超时，适配超大型项目分析
+		SetTimeout(attemptTimeout(c.Request.Context(), provider)) // 默认 32 小时超时，适配超大型项目分析；可按 provider 或 Level 覆盖，受重试时间预算限制
+	if provider.HTTPClient != nil {
+		req = req.SetClient(requestClientFor(provider))
+	}
 
 	reqBody := bytes.NewReader(bodyBytes)
 	req = req.SetBody(reqBody)
@@ -813,6 +1019,8 @@ func (prs *ProviderRelayService) forwardRequest(
 	}
 
 	status := requestLog.HttpCode
+	// 收到响应头即为非流式请求的首字节；流式请求在首个事件到达时更新（见 MeterResponseBody）
+	requestLog.TimeToFirstByte = time.Since(start).Seconds()
 
 	if resp.Error() != nil {
 		// resp 存在、有错误、但状态码为 0：客户端中断，不计入失败
@@ -826,15 +1034,95 @@ func (prs *ProviderRelayService) forwardRequest(
 	// 状态码为 0 且无错误：当作成功处理
 	if status == 0 {
 		fmt.Printf("[WARN] Provider %s 返回状态码 0，但无错误，当作成功处理\n", provider.Name)
-		_, copyErr := resp.ToHttpResponseWriter(c.Writer, ReqeustLogHook(c, kind, requestLog))
+		_, copyErr := resp.ToHttpResponseWriter(c.Writer, responseHooks...)
 		if copyErr != nil {
 			fmt.Printf("[WARN] 复制响应到客户端失败（不影响provider成功判定）: %v\n", copyErr)
 		}
 		return true, nil
 	}
 
+	if status >= http.StatusOK && status < http.StatusMultipleChoices && bufferedStream {
+		requestLog.ResponseBytes = int64(len(resp.Bytes()))
+		body := RewriteResponseModel(resp.Bytes(), upstreamModel, clientModel)
+		format := sseFormatForKind(kind)
+		ExtractUsage(body, format).ApplyTo(requestLog)
+		if _, err := NonStreamToSSE(body, format); err != nil {
+			// 尚未向客户端写入任何内容，可以安全地切换到下一个 provider
+			return false, fmt.Errorf("非流式响应转换为 SSE 失败: %w", err)
+		}
+		if err := writeNonStreamAsSSE(c.Writer, body, format); err != nil {
+			fmt.Printf("[WARN] 写入 SSE 响应到客户端失败（不影响provider成功判定）: %v\n", err)
+		}
+		return true, nil
+	}
+
 	if status >= http.StatusOK && status < http.StatusMultipleChoices {
-		_, copyErr := resp.ToHttpResponseWriter(c.Writer, ReqeustLogHook(c, kind, requestLog))
+		// 支持续传的上游：流中途断开时带 Last-Event-ID 重连继续读取，而不是整体失败
+		if isStream && provider.ResumableStream && resp.RawResponse != nil && resp.RawResponse.Body != nil {
+			requestID := fmt.Sprintf("%s/%p", provider.Name, c.Request)
+			resp.RawResponse.Body = prs.streamResumer.Wrap(requestID, resp.RawResponse.Body, func(lastEventID string) (io.ReadCloser, error) {
+				resumeHeaders := cloneMap(headers)
+				resumeHeaders[LastEventIDHeader] = lastEventID
+				resumeReq := xrequest.New().
+					SetHeaders(resumeHeaders).
+					SetTimeout(attemptTimeout(c.Request.Context(), provider)).
+					SetBody(bytes.NewReader(bodyBytes))
+				if provider.HTTPClient != nil {
+					resumeReq = resumeReq.SetClient(requestClientFor(provider))
+				}
+				resumeResp, err := resumeReq.Post(targetURL)
+				if err != nil {
+					return nil, err
+				}
+				if code := resumeResp.StatusCode(); code < http.StatusOK || code >= http.StatusMultipleChoices {
+					if resumeResp.RawResponse != nil && resumeResp.RawResponse.Body != nil {
+						_ = resumeResp.RawResponse.Body.Close()
+					}
+					return nil, fmt.Errorf("upstream status %d", code)
+				}
+				return resumeResp.RawResponse.Body, nil
+			}, DefaultMaxStreamResumes)
+		}
+		if resp.RawResponse != nil {
+			resp.RawResponse.Body = MeterResponseBody(resp.RawResponse.Body, start, requestLog, isStream)
+		}
+		// 预读流的前几个事件：内容之前出现 error 事件时尚未向客户端写入任何内容，可以安全地切换到下一个 provider
+		// 开启心跳时预读超过心跳间隔会先写出响应头并发送心跳，之后出错不能再切换
+		committed := false
+		if isStream && resp.RawResponse != nil && resp.RawResponse.Body != nil {
+			raw := resp.RawResponse
+			guarded, headersSent, err := peekWithKeepAlive(CurrentStreamGuard(), raw.Body, streamKeepAlive(), c.Writer, func() {
+				for key, values := range raw.Header {
+					c.Writer.Header()[key] = slices.Clone(values)
+				}
+				c.Writer.Header().Del("Content-Length")
+				c.Writer.WriteHeader(status)
+				c.Writer.Flush()
+			})
+			if err != nil {
+				if headersSent {
+					fmt.Printf("[WARN] Provider %s 流式响应在内容之前出错，响应头已随心跳写出，无法切换 provider: %v\n", provider.Name, err)
+				} else {
+					fmt.Printf("[WARN] Provider %s 流式响应在内容之前出错，切换下一个 provider: %v\n", provider.Name, err)
+				}
+				return false, err
+			}
+			resp.RawResponse.Body = guarded
+			committed = headersSent
+		}
+		// 短流缓冲：输出在阈值内的流先完整缓冲，完成前出错时同样尚未写入客户端，可以切换到下一个 provider 从头重试
+		// 响应头已随心跳写出时缓冲不再有意义
+		if isStream && !committed && resp.RawResponse != nil && resp.RawResponse.Body != nil {
+			if sb := CurrentStreamBuffer(); sb.Enabled() {
+				buffered, err := sb.Buffer(resp.RawResponse.Body)
+				if err != nil {
+					fmt.Printf("[WARN] Provider %s 流式响应在完成前出错，丢弃已缓冲的部分并切换下一个 provider: %v\n", provider.Name, err)
+					return false, err
+				}
+				resp.RawResponse.Body = buffered
+			}
+		}
+		_, copyErr := resp.ToHttpResponseWriter(c.Writer, responseHooks...)
 		if copyErr != nil {
 			fmt.Printf("[WARN] 复制响应到客户端失败（不影响provider成功判定）: %v\n", copyErr)
 		}
@@ -842,15 +1130,28 @@ func (prs *ProviderRelayService) forwardRequest(
 		return true, nil
 	}
 
-	return false, fmt.Errorf("upstream status %d", status)
+	return false, newUpstreamStatusError(status, resp.Bytes(), responseContentType(resp.RawResponse))
 }
 
+// headerValueSeparator 同名请求头多个值合并时的分隔符（RFC 9110 §5.3）
+const headerValueSeparator = ", "
+
+// cookieValueSeparator 多个 Cookie 头合并时的分隔符（RFC 6265 §5.4，cookie-pair 之间以 "; " 分隔）
+const cookieValueSeparator = "; "
+
+// cloneHeaders 复制请求头为单值 map，同名请求头的多个值按出现顺序以 headerValueSeparator 合并
+// Cookie 不是逗号分隔的列表，以 cookieValueSeparator 合并；需要逐个取值时使用 RequestContext.HeaderValues
 func cloneHeaders(header http.Header) map[string]string {
 	cloned := make(map[string]string, len(header))
 	for key, values := range header {
-		if len(values) > 0 {
-			cloned[key] = values[len(values)-1]
+		if len(values) == 0 {
+			continue
+		}
+		separator := headerValueSeparator
+		if http.CanonicalHeaderKey(key) == "Cookie" {
+			separator = cookieValueSeparator
 		}
+		cloned[key] = strings.Join(values, separator)
 	}
 	return cloned
 }
@@ -863,6 +1164,8 @@ func cloneMap(m map[string]string) map[string]string {
 	return cloned
 }
 
+// flattenQuery 将查询参数展平为单值 map，重复的 key 只保留最后一个值
+// 仅用于按名读取单个参数（如 ?model=）；转发给上游时使用 appendQuery 保留全部值
 func flattenQuery(values map[string][]string) map[string]string {
 	query := make(map[string]string, len(values))
 	for key, items := range values {
@@ -873,6 +1176,18 @@ func flattenQuery(values map[string][]string) map[string]string {
 	return query
 }
 
+// appendQuery 将查询参数拼接到 URL 后，重复的 key 保留全部值（按 key 排序，同一 key 的值保持原顺序）
+func appendQuery(target string, values url.Values) string {
+	encoded := values.Encode()
+	if encoded == "" {
+		return target
+	}
+	if strings.Contains(target, "?") {
+		return target + "&" + encoded
+	}
+	return target + "?" + encoded
+}
+
 func joinURL(base string, endpoint string) string {
 	base = strings.TrimSuffix(base, "/")
 	endpoint = "/" + strings.TrimPrefix(endpoint, "/")
@@ -923,6 +1238,11 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 		reasoning_tokens INTEGER,
 		is_stream INTEGER DEFAULT 0,
 		duration_sec REAL DEFAULT 0,
+		attempt_count INTEGER DEFAULT 1,
+		failed_providers TEXT DEFAULT '',
+		api_key_hash TEXT DEFAULT '',
+		ttfb_sec REAL DEFAULT 0,
+		response_bytes INTEGER DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	)`
 
@@ -939,6 +1259,21 @@ func ensureRequestLogTableWithDB(db *sql.DB) error {
 	if err := ensureRequestLogColumn(db, "duration_sec", "REAL DEFAULT 0"); err != nil {
 		return err
 	}
+	if err := ensureRequestLogColumn(db, "attempt_count", "INTEGER DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "failed_providers", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "api_key_hash", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "ttfb_sec", "REAL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureRequestLogColumn(db, "response_bytes", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -993,6 +1328,11 @@ type ReqeustLog struct {
 	Ephemeral1hCost   float64 `json:"ephemeral_1h_cost"`
 	TotalCost         float64 `json:"total_cost"`
 	HasPricing        bool    `json:"has_pricing"`
+	AttemptCount      int     `json:"attempt_count"`    // 本次客户端请求的总尝试次数（含失败重试）
+	FailedProviders   string  `json:"failed_providers"` // 成功前失败过的 provider（逗号分隔，按首次失败顺序）
+	APIKeyHash        string  `json:"api_key_hash"`     // 客户端 API Key 的 SHA-256 前缀，用于按租户汇总用量
+	TimeToFirstByte   float64 `json:"ttfb_sec"`         // 首字节耗时（秒）：流式为首个 SSE 事件到达，非流式为收到响应头
+	ResponseBytes     int64   `json:"response_bytes"`   // 上游响应体字节数
 }
 
 // claude code usage parser
@@ -1202,15 +1542,16 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 			return
 		}
 
-		// 1. 过滤可用的 providers（启用 + BaseURL 配置 + 未被拉黑）
+		// 1. 过滤可用的 providers（启用 + BaseURL/APIKey 配置 + 未被拉黑）
 		var activeProviders []GeminiProvider
 		for _, p := range providers {
-			if !p.Enabled || p.BaseURL == "" {
+			if !p.Enabled || !p.HasValidConfig() {
 				continue
 			}
 			// 检查黑名单
 			if isBlacklisted, until := prs.blacklistService.IsBlacklisted("gemini", p.Name); isBlacklisted {
 				fmt.Printf("[Gemini] ⛔ Provider %s 已拉黑，过期时间: %v\n", p.Name, until.Format("15:04:05"))
+				currentMetrics().IncSkipped("gemini", p.Name, string(SkipReasonBlacklisted))
 				continue
 			}
 			// Level 默认值处理
@@ -1225,18 +1566,10 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 			return
 		}
 
-		// 2. 按 Level 分组
-		levelGroups := make(map[int][]GeminiProvider)
-		for _, p := range activeProviders {
-			levelGroups[p.Level] = append(levelGroups[p.Level], p)
-		}
-
-		// 获取排序后的 Level 列表
-		var sortedLevels []int
-		for level := range levelGroups {
-			sortedLevels = append(sortedLevels, level)
-		}
-		sort.Ints(sortedLevels)
+		// 2. 按 Level 分组（与 Claude/Codex 共用同一套分组逻辑）
+		grouped := GroupByLevel(activeProviders)
+		levelGroups := grouped.Groups
+		sortedLevels := grouped.SortedLevels
 
 		fmt.Printf("[Gemini] 共 %d 个 Level 分组: %v\n", len(sortedLevels), sortedLevels)
 
@@ -1246,12 +1579,15 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 			IsStream:     isStream,
 			InputTokens:  0,
 			OutputTokens: 0,
+			APIKeyHash:   ClientAPIKeyHash(cloneHeaders(c.Request.Header)),
 		}
 		start := time.Now()
 
 		// 保存日志的 defer
 		defer func() {
 			requestLog.DurationSec = time.Since(start).Seconds()
+			// 整个请求只记一条日志：尝试次数与失败 provider 取自最后一次选择结果
+			fillLogFromSelection(c.Request.Context(), requestLog)
 			if GlobalDBQueueLogs == nil {
 				return
 			}
@@ -1261,13 +1597,16 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 				INSERT INTO request_log (
 					platform, model, provider, http_code,
 					input_tokens, output_tokens, cache_create_tokens, cache_read_tokens,
-					reasoning_tokens, is_stream, duration_sec
-				) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+					reasoning_tokens, is_stream, duration_sec, attempt_count, failed_providers,
+					api_key_hash, ttfb_sec, response_bytes
+				) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 			`,
 				requestLog.Platform, requestLog.Model, requestLog.Provider, requestLog.HttpCode,
 				requestLog.InputTokens, requestLog.OutputTokens, requestLog.CacheCreateTokens,
 				requestLog.CacheReadTokens, requestLog.ReasoningTokens,
 				boolToInt(requestLog.IsStream), requestLog.DurationSec,
+				max(requestLog.AttemptCount, 1), requestLog.FailedProviders, requestLog.APIKeyHash,
+				requestLog.TimeToFirstByte, requestLog.ResponseBytes,
 			)
 		}()
 
@@ -1287,14 +1626,17 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 
 			var lastError string
 			var lastProvider string
-			totalAttempts := 0
+			rc := newRelayRetryContext("gemini", maxRetryPerProvider, retryWaitSeconds)
+			providersLeft := countLevelProviders(levelGroups) // 当前 provider 之后尚未尝试的 provider 数，用于分配单次尝试超时
 
 			// 遍历所有 Level 和 Provider
+		blacklistLevels:
 			for _, level := range sortedLevels {
 				providersInLevel := levelGroups[level]
 				fmt.Printf("[Gemini] === 尝试 Level %d（%d 个 provider）===\n", level, len(providersInLevel))
 
 				for _, provider := range providersInLevel {
+					providersLeft--
 					// 检查是否已被拉黑（跳过已拉黑的 provider）
 					if blacklisted, until := prs.blacklistService.IsBlacklisted("gemini", provider.Name); blacklisted {
 						fmt.Printf("[Gemini] ⏭️ 跳过已拉黑的 Provider: %s (解禁时间: %v)\n", provider.Name, until)
@@ -1307,7 +1649,18 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 
 					// 同 Provider 内重试循环
 					for retryCount := 0; retryCount < maxRetryPerProvider; retryCount++ {
-						totalAttempts++
+						// 客户端已断开，不再尝试后续 Provider
+						if c.Request.Context().Err() != nil {
+							fmt.Printf("[Gemini] 客户端已断开，停止尝试后续 Provider\n")
+							return
+						}
+
+						if err := rc.admit(); err != nil {
+							fmt.Printf("[Gemini] 停止尝试后续 Provider: %v\n", err)
+							break blacklistLevels
+						}
+						rc.TotalAttempts++
+						markSelection(c, Selection{Platform: "gemini", Provider: provider.Name, Level: level, Attempt: rc.TotalAttempts, AttemptTimeout: rc.AttemptTimeout(providersLeft + 1)})
 
 						// 再次检查是否已被拉黑（重试过程中可能被拉黑）
 						if blacklisted, _ := prs.blacklistService.IsBlacklisted("gemini", provider.Name); blacklisted {
@@ -1336,6 +1689,7 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 						// 失败处理
 						lastError = errMsg
 						lastProvider = provider.Name
+						markFailed(c, provider.Name)
 
 						fmt.Printf("[Gemini] ✗ 失败: %s | 重试 %d/%d | 错误: %s\n",
 							provider.Name, retryCount+1, maxRetryPerProvider, errMsg)
@@ -1349,17 +1703,24 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 							break
 						}
 
-						// 等待后重试（除非是最后一次）
-						if retryCount < maxRetryPerProvider-1 {
+						// 等待后重试（除非是最后一次或已达到尝试次数上限）
+						if retryCount < maxRetryPerProvider-1 && rc.CanAttempt() {
 							fmt.Printf("[Gemini] ⏳ 等待 %d 秒后重试...\n", retryWaitSeconds)
-							time.Sleep(time.Duration(retryWaitSeconds) * time.Second)
+							if !rc.WaitRetry(c.Request.Context()) {
+								if c.Request.Context().Err() != nil {
+									fmt.Printf("[Gemini] 客户端已断开，停止重试\n")
+									return
+								}
+								fmt.Printf("[Gemini] 等待重试会超出时间预算，停止尝试后续 Provider\n")
+								break blacklistLevels
+							}
 						}
 					}
 				}
 			}
 
 			// 所有 Provider 都失败或被拉黑
-			fmt.Printf("[Gemini] 💥 拉黑模式：所有 Provider 都失败或被拉黑（共尝试 %d 次）\n", totalAttempts)
+			fmt.Printf("[Gemini] 💥 拉黑模式：所有 Provider 都失败或被拉黑（共尝试 %d 次）\n", rc.TotalAttempts)
 
 			if requestLog.HttpCode == 0 {
 				requestLog.HttpCode = http.StatusBadGateway
@@ -1367,7 +1728,7 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 			c.JSON(http.StatusBadGateway, gin.H{
 				"error":         fmt.Sprintf("所有 Provider 都失败或被拉黑，最后尝试: %s - %s", lastProvider, lastError),
 				"lastProvider":  lastProvider,
-				"totalAttempts": totalAttempts,
+				"totalAttempts": rc.TotalAttempts,
 				"mode":          "blacklist_retry",
 				"hint":          "拉黑模式已开启，同 Provider 重试到拉黑再切换。如需立即降级请关闭拉黑功能",
 			})
@@ -1383,18 +1744,35 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 		}
 
 		var lastError string
+		rc := newRelayRetryContext("gemini", 1, 0)
+		providersLeft := countLevelProviders(levelGroups) // 当前 provider 之后尚未尝试的 provider 数，用于分配单次尝试超时
+	fallbackLevels:
 		for _, level := range sortedLevels {
 			providersInLevel := levelGroups[level]
 
 			// 如果启用轮询，对同 Level 的 providers 进行轮询排序
+			lastStart := ""
 			if roundRobinEnabled {
-				providersInLevel = prs.roundRobinOrderGemini(level, providersInLevel)
+				providersInLevel, lastStart = prs.roundRobinOrderGemini(level, providersInLevel)
 			}
 
-			fmt.Printf("[Gemini] === 尝试 Level %d（%d 个 provider）===\n", level, len(providersInLevel))
+			fmt.Printf("[Gemini] === 尝试 Level %d（%d 个 provider，lastStart=%q）===\n", level, len(providersInLevel), lastStart)
 
 			for idx, provider := range providersInLevel {
+				providersLeft--
+				// 客户端已断开，不再尝试后续 Provider
+				if c.Request.Context().Err() != nil {
+					fmt.Printf("[Gemini] 客户端已断开，停止尝试后续 Provider\n")
+					return
+				}
+
 				fmt.Printf("[Gemini]   [%d/%d] Provider: %s\n", idx+1, len(providersInLevel), provider.Name)
+				if err := rc.admit(); err != nil {
+					fmt.Printf("[Gemini] 停止尝试后续 Provider: %v\n", err)
+					break fallbackLevels
+				}
+				rc.TotalAttempts++
+				markSelection(c, Selection{Platform: "gemini", Provider: provider.Name, Level: level, Attempt: rc.TotalAttempts, AttemptTimeout: rc.AttemptTimeout(providersLeft + 1), LastStart: lastStart})
 
 				// 预填日志，失败也能落库
 				requestLog.Provider = provider.Name
@@ -1418,6 +1796,7 @@ func (prs *ProviderRelayService) geminiProxyHandler(apiVersion string) gin.Handl
 
 				// 失败，记录并继续
 				lastError = errMsg
+				markFailed(c, provider.Name)
 				_ = prs.blacklistService.RecordFailure("gemini", provider.Name)
 			}
 
@@ -1474,6 +1853,9 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 	requestLog *ReqeustLog,
 ) (success bool, errMsg string, responseWritten bool) {
 	providerStart := time.Now()
+	defer func() {
+		observeAttempt("gemini", provider.Name, time.Since(providerStart), success, nil)
+	}()
 
 	// 构建目标 URL
 	targetURL := strings.TrimSuffix(provider.BaseURL, "/") + endpoint
@@ -1489,6 +1871,15 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 		requestLog.Model = provider.Model
 	}
 
+	// 客户端未指定思考预算时注入 provider 配置的默认值
+	if provider.ThinkingBudget > 0 {
+		if withBudget, injected, err := EnsureGeminiThinkingBudget(bodyBytes, provider.ThinkingBudget); err != nil {
+			fmt.Printf("[Gemini] [WARN] 注入 thinkingBudget 失败，按原请求转发: %v\n", err)
+		} else if injected {
+			bodyBytes = withBudget
+		}
+	}
+
 	// 创建 HTTP 请求
 	req, err := http.NewRequest("POST", targetURL, bytes.NewReader(bodyBytes))
 	if err != nil {
@@ -1508,7 +1899,7 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 	}
 
 	// 发送请求
-	client := &http.Client{Timeout: 300 * time.Second}
+	client := &http.Client{Timeout: attemptTimeout(c.Request.Context(), *provider)}
 	resp, err := client.Do(req)
 	providerDuration := time.Since(providerStart).Seconds()
 
@@ -1520,6 +1911,7 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 
 	// 先记录上游状态码，失败场景也能落库
 	requestLog.HttpCode = resp.StatusCode
+	requestLog.TimeToFirstByte = providerDuration
 
 	// 检查响应状态
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
@@ -1533,15 +1925,29 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 	// 处理响应
 	if isStream {
 		// 流式模式：先写 header 再流式传输
-		for key, values := range resp.Header {
-			for _, value := range values {
-				c.Header(key, value)
+		writeHeader := func() {
+			for key, values := range resp.Header {
+				for _, value := range values {
+					c.Header(key, value)
+				}
 			}
+			c.Status(resp.StatusCode)
+			c.Writer.Flush()
+		}
+		// 预读流的前几个事件：内容之前出现 error 事件时 header 尚未写入，可以重试/降级
+		// 按配置在首字节前发送 SSE 心跳，避免客户端等待首个 token 时超时；心跳写出后 header 即已写入
+		body, committed, guardErr := peekWithKeepAlive(CurrentStreamGuard(),
+			MeterResponseBody(resp.Body, providerStart, requestLog, true), streamKeepAlive(), c.Writer, writeHeader)
+		if guardErr != nil {
+			fmt.Printf("[Gemini]   ✗ 失败: %s | 流式响应在内容之前出错: %v\n", provider.Name, guardErr)
+			return false, fmt.Sprintf("流式响应首部错误: %v", guardErr), committed
+		}
+		if !committed {
+			writeHeader()
 		}
-		c.Status(resp.StatusCode)
-		c.Writer.Flush()
 		// 【重要】从 Flush() 开始，响应头已写入客户端，任何失败都不能重试
-		copyErr := streamGeminiResponseWithHook(resp.Body, c.Writer, requestLog)
+		defer body.Close()
+		copyErr := streamGeminiResponseWithHook(body, c.Writer, requestLog)
 		if copyErr != nil {
 			fmt.Printf("[Gemini]   ⚠️ 流式传输中断: %s | 错误: %v\n", provider.Name, copyErr)
 			// 流式传输中断：已写入部分响应，客户端会收到不完整数据
@@ -1555,6 +1961,7 @@ func (prs *ProviderRelayService) forwardGeminiRequest(
 			// 【修复】此时 header 尚未写入客户端，可以重试/降级
 			return false, fmt.Sprintf("读取响应失败: %v", readErr), false
 		}
+		requestLog.ResponseBytes = int64(len(body))
 		// 解析 Gemini 用量数据
 		parseGeminiUsageMetadata(body, requestLog)
 		// 读取成功后再写 header 和 body
@@ -1620,6 +2027,14 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 			c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 		}
 
+		// 合并相邻同角色消息（补充 tool_result 或合并历史后可能出现连续 user 消息）
+		if coalesced, changed, err := CoalesceConsecutiveRoles(bodyBytes); err != nil {
+			fmt.Printf("[CustomCLI][WARN] 合并相邻同角色消息失败: %v\n", err)
+		} else if changed {
+			bodyBytes = coalesced
+			c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		}
+
 		isStream := gjson.GetBytes(bodyBytes, "stream").Bool()
 		requestedModel := gjson.GetBytes(bodyBytes, "model").String()
 
@@ -1628,7 +2043,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 		}
 
 		// 加载该 CLI 工具的 providers
-		providers, err := prs.providerService.LoadProviders(kind)
+		providers, err := prs.loadRelayProviders(kind)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to load providers for %s: %v", kind, err)})
 			return
@@ -1637,6 +2052,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 		// 过滤可用的 providers
 		active := make([]Provider, 0, len(providers))
 		skippedCount := 0
+		estimatedTokens := -1 // 输入 token 预估，有 provider 配置上下文上限时才计算
 		for _, provider := range providers {
 			if !provider.Enabled || provider.APIURL == "" || provider.APIKey == "" {
 				continue
@@ -1654,6 +2070,25 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 				continue
 			}
 
+			// 声明式模型策略（allowModels / denyModels）
+			if !provider.ModelAllowedByPolicy(requestedModel) {
+				fmt.Printf("[CustomCLI][INFO] Provider %s 的模型策略禁止 %s，已跳过\n", provider.Name, requestedModel)
+				skippedCount++
+				continue
+			}
+
+			// 上下文上限：预估输入明显超出时跳过，避免浪费一次上游请求
+			if provider.MaxContextTokens > 0 {
+				if estimatedTokens < 0 {
+					estimatedTokens = EstimateInputTokens(bodyBytes, FormatClaude)
+				}
+				if !provider.FitsContext(estimatedTokens) {
+					fmt.Printf("[CustomCLI][INFO] Provider %s 上下文上限 %d，预估输入 %d tokens，已跳过\n", provider.Name, provider.MaxContextTokens, estimatedTokens)
+					skippedCount++
+					continue
+				}
+			}
+
 			// 黑名单检查
 			if isBlacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); isBlacklisted {
 				fmt.Printf("[CustomCLI] ⛔ Provider %s 已拉黑，过期时间: %v\n", provider.Name, until.Format("15:04:05"))
@@ -1665,7 +2100,11 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 		}
 
 		if len(active) == 0 {
-			if requestedModel != "" {
+			if len(providers) == 0 {
+				// 根本没有配置 provider，与"全部被过滤"区分，便于排查配置问题
+				err := fmt.Errorf("%w for kind %s", ErrNoProvidersConfigured, kind)
+				c.JSON(http.StatusNotFound, BuildFailureResponse(0, "", err, ""))
+			} else if requestedModel != "" {
 				c.JSON(http.StatusNotFound, gin.H{
 					"error": fmt.Sprintf("没有可用的 provider 支持模型 '%s'（已跳过 %d 个不兼容的 provider）", requestedModel, skippedCount),
 				})
@@ -1699,7 +2138,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 
 		fmt.Printf("[CustomCLI][INFO] 共 %d 个 Level 分组：%v\n", len(levels), levels)
 
-		query := flattenQuery(c.Request.URL.Query())
+		query := c.Request.URL.Query()
 		clientHeaders := cloneHeaders(c.Request.Header)
 
 		// 获取拉黑功能开关状态
@@ -1718,14 +2157,17 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 
 			var lastError error
 			var lastProvider string
-			totalAttempts := 0
+			rc := newRelayRetryContext(kind, maxRetryPerProvider, retryWaitSeconds)
+			providersLeft := countLevelProviders(levelGroups) // 当前 provider 之后尚未尝试的 provider 数，用于分配单次尝试超时
 
 			// 遍历所有 Level 和 Provider
+		blacklistLevels:
 			for _, level := range levels {
 				providersInLevel := levelGroups[level]
 				fmt.Printf("[CustomCLI][INFO] === 尝试 Level %d（%d 个 provider）===\n", level, len(providersInLevel))
 
 				for _, provider := range providersInLevel {
+					providersLeft--
 					// 检查是否已被拉黑（跳过已拉黑的 provider）
 					if blacklisted, until := prs.blacklistService.IsBlacklisted(kind, provider.Name); blacklisted {
 						fmt.Printf("[CustomCLI][INFO] ⏭️ 跳过已拉黑的 Provider: %s (解禁时间: %v)\n", provider.Name, until)
@@ -1750,7 +2192,18 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 
 					// 同 Provider 内重试循环
 					for retryCount := 0; retryCount < maxRetryPerProvider; retryCount++ {
-						totalAttempts++
+						// 客户端已断开，不再尝试后续 Provider
+						if c.Request.Context().Err() != nil {
+							fmt.Printf("[CustomCLI][INFO] 客户端已断开，停止尝试后续 Provider\n")
+							return
+						}
+
+						if err := rc.admit(); err != nil {
+							fmt.Printf("[CustomCLI][WARN] 停止尝试后续 Provider: %v\n", err)
+							break blacklistLevels
+						}
+						rc.TotalAttempts++
+						markSelection(c, Selection{Platform: kind, Provider: provider.Name, Level: level, Attempt: rc.TotalAttempts, AttemptTimeout: rc.AttemptTimeout(providersLeft + 1)})
 
 						// 再次检查是否已被拉黑（重试过程中可能被拉黑）
 						if blacklisted, _ := prs.blacklistService.IsBlacklisted(kind, provider.Name); blacklisted {
@@ -1778,6 +2231,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 						// 失败处理
 						lastError = err
 						lastProvider = provider.Name
+						markFailed(c, provider.Name)
 
 						errorMsg := "未知错误"
 						if err != nil {
@@ -1792,28 +2246,46 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 							return
 						}
 
+						// 请求本身有问题（见 IsFatal）：换 provider 也会失败，不计入失败次数，直接返回
+						if IsFatal(err, 0) {
+							respondFatalError(c, provider.Name, DetectFormat(bodyBytes, c.Request.URL.Path), err)
+							return
+						}
+
 						// 记录失败次数（可能触发拉黑）
 						if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
 							fmt.Printf("[CustomCLI][ERROR] 记录失败到黑名单失败: %v\n", err)
 						}
 
+						// 心跳已写出响应头，换 provider 会重复写入响应
+						if errors.Is(err, errResponseCommitted) {
+							return
+						}
+
 						// 检查是否刚被拉黑
 						if blacklisted, _ := prs.blacklistService.IsBlacklisted(kind, provider.Name); blacklisted {
 							fmt.Printf("[CustomCLI][INFO] 🚫 Provider %s 达到失败阈值，已被拉黑，切换到下一个\n", provider.Name)
 							break
 						}
 
-						// 等待后重试（除非是最后一次）
-						if retryCount < maxRetryPerProvider-1 {
+						// 等待后重试（除非是最后一次或已达到尝试次数上限）
+						if retryCount < maxRetryPerProvider-1 && rc.CanAttempt() {
 							fmt.Printf("[CustomCLI][INFO] ⏳ 等待 %d 秒后重试...\n", retryWaitSeconds)
-							time.Sleep(time.Duration(retryWaitSeconds) * time.Second)
+							if !rc.WaitRetry(c.Request.Context()) {
+								if c.Request.Context().Err() != nil {
+									fmt.Printf("[CustomCLI][INFO] 客户端已断开，停止重试\n")
+									return
+								}
+								fmt.Printf("[CustomCLI][WARN] 等待重试会超出时间预算，停止尝试后续 Provider\n")
+								break blacklistLevels
+							}
 						}
 					}
 				}
 			}
 
 			// 所有 Provider 都失败或被拉黑
-			fmt.Printf("[CustomCLI][ERROR] 💥 拉黑模式：所有 Provider 都失败或被拉黑（共尝试 %d 次）\n", totalAttempts)
+			fmt.Printf("[CustomCLI][ERROR] 💥 拉黑模式：所有 Provider 都失败或被拉黑（共尝试 %d 次）\n", rc.TotalAttempts)
 
 			errorMsg := "未知错误"
 			if lastError != nil {
@@ -1822,7 +2294,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 			c.JSON(http.StatusBadGateway, gin.H{
 				"error":         fmt.Sprintf("所有 Provider 都失败或被拉黑，最后尝试: %s - %s", lastProvider, errorMsg),
 				"lastProvider":  lastProvider,
-				"totalAttempts": totalAttempts,
+				"totalAttempts": rc.TotalAttempts,
 				"mode":          "blacklist_retry",
 				"hint":          "拉黑模式已开启，同 Provider 重试到拉黑再切换。如需立即降级请关闭拉黑功能",
 			})
@@ -1840,20 +2312,35 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 		var lastError error
 		var lastProvider string
 		var lastDuration time.Duration
-		totalAttempts := 0
+		rc := newRelayRetryContext(kind, 1, 0)
+		providersLeft := countLevelProviders(levelGroups) // 当前 provider 之后尚未尝试的 provider 数，用于分配单次尝试超时
 
+	fallbackLevels:
 		for _, level := range levels {
 			providersInLevel := levelGroups[level]
 
 			// 如果启用轮询，对同 Level 的 providers 进行轮询排序
+			lastStart := ""
 			if roundRobinEnabled {
-				providersInLevel = prs.roundRobinOrder(kind, level, providersInLevel)
+				providersInLevel, lastStart = prs.roundRobinOrder(kind, level, providersInLevel)
 			}
 
-			fmt.Printf("[CustomCLI][INFO] === 尝试 Level %d（%d 个 provider）===\n", level, len(providersInLevel))
+			fmt.Printf("[CustomCLI][INFO] === 尝试 Level %d（%d 个 provider，lastStart=%q）===\n", level, len(providersInLevel), lastStart)
 
 			for i, provider := range providersInLevel {
-				totalAttempts++
+				providersLeft--
+				// 客户端已断开，不再尝试后续 Provider
+				if c.Request.Context().Err() != nil {
+					fmt.Printf("[CustomCLI][INFO] 客户端已断开，停止尝试后续 Provider\n")
+					return
+				}
+
+				if err := rc.admit(); err != nil {
+					fmt.Printf("[CustomCLI][WARN] 停止尝试后续 Provider: %v\n", err)
+					break fallbackLevels
+				}
+				rc.TotalAttempts++
+				markSelection(c, Selection{Platform: kind, Provider: provider.Name, Level: level, Attempt: rc.TotalAttempts, AttemptTimeout: rc.AttemptTimeout(providersLeft + 1), LastStart: lastStart})
 
 				effectiveModel := provider.GetEffectiveModel(requestedModel)
 				currentBodyBytes := bodyBytes
@@ -1886,6 +2373,7 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 
 				lastError = err
 				lastProvider = provider.Name
+				markFailed(c, provider.Name)
 				lastDuration = duration
 
 				errorMsg := "未知错误"
@@ -1895,12 +2383,23 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 				fmt.Printf("[CustomCLI][WARN]   ✗ Level %d 失败: %s | 错误: %s | 耗时: %.2fs\n",
 					level, provider.Name, errorMsg, duration.Seconds())
 
+				// 请求本身有问题（见 IsFatal）：换 provider 也会失败，不计入失败次数，直接返回
+				if IsFatal(err, 0) {
+					respondFatalError(c, provider.Name, DetectFormat(bodyBytes, c.Request.URL.Path), err)
+					return
+				}
+
 				if errors.Is(err, errClientAbort) {
 					fmt.Printf("[CustomCLI][INFO] 客户端中断，跳过失败计数: %s\n", provider.Name)
 				} else if err := prs.blacklistService.RecordFailure(kind, provider.Name); err != nil {
 					fmt.Printf("[CustomCLI][ERROR] 记录失败到黑名单失败: %v\n", err)
 				}
 
+				// 心跳已写出响应头，换 provider 会重复写入响应
+				if errors.Is(err, errResponseCommitted) {
+					return
+				}
+
 				// 发送切换通知
 				if prs.notificationService != nil {
 					nextProvider := ""
@@ -1934,13 +2433,13 @@ func (prs *ProviderRelayService) customCliProxyHandler() gin.HandlerFunc {
 			errorMsg = lastError.Error()
 		}
 		fmt.Printf("[CustomCLI][ERROR] 所有 %d 个 provider 均失败，最后尝试: %s | 错误: %s\n",
-			totalAttempts, lastProvider, errorMsg)
+			rc.TotalAttempts, lastProvider, errorMsg)
 
 		c.JSON(http.StatusBadGateway, gin.H{
-			"error":          fmt.Sprintf("所有 %d 个 provider 均失败，最后错误: %s", totalAttempts, errorMsg),
+			"error":          fmt.Sprintf("所有 %d 个 provider 均失败，最后错误: %s", rc.TotalAttempts, errorMsg),
 			"last_provider":  lastProvider,
 			"last_duration":  fmt.Sprintf("%.2fs", lastDuration.Seconds()),
-			"total_attempts": totalAttempts,
+			"total_attempts": rc.TotalAttempts,
 		})
 	}
 }
@@ -1955,7 +2454,7 @@ func (prs *ProviderRelayService) forwardModelsRequest(
 	fmt.Printf("[%s] 收到 /v1/models 请求, kind=%s\n", logPrefix, kind)
 
 	// 加载 providers
-	providers, err := prs.providerService.LoadProviders(kind)
+	providers, err := prs.loadRelayProviders(kind)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load providers"})
 		return fmt.Errorf("failed to load providers: %w", err)
@@ -2015,6 +2514,16 @@ func (prs *ProviderRelayService) forwardModelsRequest(
 
 	fmt.Printf("[%s] 使用 Provider: %s | URL: %s\n", logPrefix, selectedProvider.Name, selectedProvider.APIURL)
 
+	// 命中缓存直接返回，避免每次都请求上游
+	cacheKey := kind + "/" + selectedProvider.Name
+	if prs.modelsCache != nil {
+		if cached, ok := prs.modelsCache.Get(cacheKey); ok {
+			fmt.Printf("[%s] ✓ 命中缓存: %s\n", logPrefix, selectedProvider.Name)
+			c.Data(http.StatusOK, "application/json", cached)
+			return nil
+		}
+	}
+
 	// 构建目标 URL（拼接 provider 的 APIURL 和 /v1/models）
 	targetURL := joinURL(selectedProvider.APIURL, "/v1/models")
 
@@ -2080,6 +2589,11 @@ func (prs *ProviderRelayService) forwardModelsRequest(
 
 	fmt.Printf("[%s] ✓ 成功: %s | HTTP %d\n", logPrefix, selectedProvider.Name, resp.StatusCode)
 
+	// 仅缓存成功响应
+	if prs.modelsCache != nil && resp.StatusCode == http.StatusOK {
+		prs.modelsCache.Set(cacheKey, body, 0)
+	}
+
 	// 返回响应
 	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
 	return nil
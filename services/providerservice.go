@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -29,6 +30,10 @@ type Provider struct {
 	Accent  string `json:"accent"`
 	Enabled bool   `json:"enabled"`
 
+	// 平台类型 - claude / codex / gemini / custom:{toolId}
+	// 多个平台的 provider 合并存放在一个列表时用于拆分（见 PartitionByKind）；按平台分文件存储时可留空
+	Kind string `json:"kind,omitempty"`
+
 	// API 端点路径（可选）- 覆盖平台默认端点
 	// 如：GLM 模型需要使用 /v1/chat/completions 而非 /v1/messages
 	// 留空则使用平台默认（claude: /v1/messages, codex: /responses）
@@ -60,6 +65,55 @@ type Provider struct {
 	// 可用性高级配置 - 可选，在可用性页面的"高级配置"中设置
 	AvailabilityConfig *AvailabilityConfig `json:"availabilityConfig,omitempty"`
 
+	// 兜底 Provider - 不参与正常的 Level 分组和轮询，仅在其他 Provider 全部失败后作为最后一次尝试
+	// 仍然遵守启用状态、配置验证和黑名单检查
+	LastResort bool `json:"lastResort,omitempty"`
+
+	// 上游支持 gzip 请求体 - 开启后转发时压缩较大的请求体并设置 Content-Encoding
+	SupportsGzip bool `json:"supportsGzip,omitempty"`
+
+	// 请求转换流水线 - 转发前按顺序对请求体执行的转换（模型重写、删除字段、限制 max_tokens 等）
+	RequestPipeline []TransformSpec `json:"requestPipeline,omitempty"`
+
+	// 支持 n>1 - 关闭时（默认）非流式 OpenAI Chat Completions 请求的 n>1 拆分为 n 个单次请求再合并（见 MergeCompletions）
+	SupportsMultipleCompletions bool `json:"supportsMultipleCompletions,omitempty"`
+
+	// 支持 prompt caching - 开启后转发 Claude 请求时自动注入 cache_control 断点（见 InjectCacheControl）
+	SupportsPromptCaching bool `json:"supportsPromptCaching,omitempty"`
+
+	// 上游要求的 anthropic-beta 标志（逗号分隔）- 转发时与客户端请求的标志合并，而不是覆盖
+	AnthropicBeta string `json:"anthropicBeta,omitempty"`
+
+	// API 版本 - 转发时按 provider 类型写入对应的版本请求头（如 Anthropic 的 anthropic-version），覆盖客户端的值
+	// 留空则不改动（x-api-key 认证时使用 DefaultAnthropicVersion）；没有版本头的类型忽略该字段（见 VersionHeader）
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// 部署区域 - 与客户端区域相同的 provider 优先尝试（见 ReorderByRegion）
+	Region string `json:"region,omitempty"`
+
+	// 标签 - 如 beta、expensive、eu-only，请求时可按标签限定或排除（见 FilterResult.ApplyTags）
+	Tags []string `json:"tags,omitempty"`
+
+	// 强制非流式 - 向上游发送非流式请求，收到完整响应后再切分为 SSE 返回给流式客户端
+	// 适用于流式模式下不稳定的上游
+	ForceNonStream bool `json:"forceNonStream,omitempty"`
+
+	// 支持流式续传 - 上游按 SSE 规范接受 Last-Event-ID，流中途断开时带该头重连续传而不是故障转移
+	ResumableStream bool `json:"resumableStream,omitempty"`
+
+	// 上下文 token 上限 - 预估输入 token 数超出时跳过该 provider（见 EstimateInputTokens），0 表示不限制
+	MaxContextTokens int `json:"maxContextTokens,omitempty"`
+
+	// 单次请求超时（秒） - 为 0 时按 Level 超时或平台默认（见 TimeoutFor）
+	TimeoutSec int `json:"timeoutSec,omitempty"`
+
+	// 专用 HTTP 客户端 - 由代码注入（不持久化），用于单独配置代理、TLS、连接池；为空时使用共享默认客户端（见 ClientFor）
+	HTTPClient *http.Client `json:"-"`
+
+	// 模型策略 - 支持 * 通配符（如 claude-3-*）；DenyModels 优先，AllowModels 为空表示不限制
+	AllowModels []string `json:"allowModels,omitempty"`
+	DenyModels  []string `json:"denyModels,omitempty"`
+
 	// 认证方式 - bearer / x-api-key / 自定义 Header 名
 	// 空值时使用平台默认（claude: x-api-key, codex: bearer）
 	ConnectivityAuthType string `json:"connectivityAuthType,omitempty"`
@@ -86,6 +140,9 @@ type providerEnvelope struct {
 
 type ProviderService struct {
 	mu sync.Mutex
+
+	// onSave 配置写入磁盘后调用（调用时持有 mu，回调中不能调用加锁的方法）
+	onSave func(kind string)
 }
 
 func NewProviderService() *ProviderService {
@@ -95,6 +152,35 @@ func NewProviderService() *ProviderService {
 func (ps *ProviderService) Start() error { return nil }
 func (ps *ProviderService) Stop() error  { return nil }
 
+// SetOnSave 设置配置写入磁盘后的回调（如同步 relay 的配置注册表），传入 nil 取消
+func (ps *ProviderService) SetOnSave(fn func(kind string)) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.onSave = fn
+}
+
+// ProviderKinds 返回所有已保存配置的平台：claude、codex 以及 providers 目录下的自定义 CLI 工具（custom:{tool-id}）
+func (ps *ProviderService) ProviderKinds() ([]string, error) {
+	kinds := []string{"claude", "codex"}
+	path, err := providerFilePath("claude")
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(filepath.Dir(path), "providers"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return kinds, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		if toolID, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			kinds = append(kinds, "custom:"+toolID)
+		}
+	}
+	return kinds, nil
+}
+
 func providerFilePath(kind string) (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -216,7 +302,13 @@ func (ps *ProviderService) saveProvidersLocked(kind string, providers []Provider
 	if err := os.WriteFile(tmp, data, 0o644); err != nil {
 		return err
 	}
-	return os.Rename(tmp, path)
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if ps.onSave != nil {
+		ps.onSave(kind)
+	}
+	return nil
 }
 
 func (ps *ProviderService) LoadProviders(kind string) ([]Provider, error) {
@@ -242,6 +334,9 @@ func (ps *ProviderService) LoadProviders(kind string) ([]Provider, error) {
 		return nil, err
 	}
 
+	// 废弃字段告警（仅提示，不阻断加载）
+	logDeprecationWarnings(CheckDeprecatedProviderFields(kind, data))
+
 	// 执行字段迁移：将旧字段值迁移到新字段
 	migrated := false
 	for i := range envelope.Providers {
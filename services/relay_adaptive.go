@@ -0,0 +1,73 @@
+package services
+
+import (
+	"math/rand/v2"
+	"sort"
+)
+
+// ============================================================================
+// 按成功率自适应排序
+// ============================================================================
+
+// AdaptiveConfig 自适应排序参数
+type AdaptiveConfig struct {
+	PoorThreshold float64 // 成功率低于该值视为"差" provider
+	ProbeRate     float64 // 每次排序时将一个差 provider 提到最前探测的概率（0~1），用于让其有机会恢复
+}
+
+// DefaultAdaptiveConfig 默认自适应排序参数
+var DefaultAdaptiveConfig = AdaptiveConfig{
+	PoorThreshold: 0.5,
+	ProbeRate:     0.05,
+}
+
+// adaptiveRandFloat 随机数来源（测试中替换）
+var adaptiveRandFloat = rand.Float64
+
+// ReorderAdaptive 按近期成功率从高到低排序，使用 DefaultAdaptiveConfig
+// 见 ReorderAdaptiveWith
+func ReorderAdaptive[T any](providers []T, getName func(T) string, successRate func(name string) float64) []T {
+	return ReorderAdaptiveWith(DefaultAdaptiveConfig, providers, getName, successRate)
+}
+
+// ReorderAdaptiveWith 按近期成功率从高到低排序（稳定排序，成功率相同的保持输入顺序）
+// 传入已经 Reorder 轮询过的列表，则在成功率全部相同或未知时自然退化为轮询
+// 以 cfg.ProbeRate 的概率随机挑选一个差 provider 放到最前，给它恢复的机会
+// 不修改原切片
+func ReorderAdaptiveWith[T any](cfg AdaptiveConfig, providers []T, getName func(T) string, successRate func(name string) float64) []T {
+	if len(providers) <= 1 || successRate == nil {
+		return providers
+	}
+
+	rates := make(map[string]float64, len(providers))
+	for _, p := range providers {
+		name := getName(p)
+		rates[name] = successRate(name)
+	}
+
+	result := make([]T, len(providers))
+	copy(result, providers)
+	sort.SliceStable(result, func(i, j int) bool {
+		return rates[getName(result[i])] > rates[getName(result[j])]
+	})
+
+	if cfg.ProbeRate <= 0 || adaptiveRandFloat() >= cfg.ProbeRate {
+		return result
+	}
+
+	var poor []int
+	for i, p := range result {
+		if rates[getName(p)] < cfg.PoorThreshold {
+			poor = append(poor, i)
+		}
+	}
+	if len(poor) == 0 {
+		return result
+	}
+
+	idx := poor[int(adaptiveRandFloat()*float64(len(poor)))%len(poor)]
+	probe := result[idx]
+	copy(result[1:idx+1], result[:idx])
+	result[0] = probe
+	return result
+}
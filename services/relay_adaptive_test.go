@@ -0,0 +1,51 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReorderAdaptive(t *testing.T) {
+	id := func(s string) string { return s }
+	rates := map[string]float64{"a": 0.2, "b": 0.9, "c": 0.6}
+	rateOf := func(name string) float64 { return rates[name] }
+
+	origRand := adaptiveRandFloat
+	defer func() { adaptiveRandFloat = origRand }()
+
+	t.Run("按成功率排序", func(t *testing.T) {
+		adaptiveRandFloat = func() float64 { return 0.99 } // 不触发探测
+		input := []string{"a", "b", "c"}
+		got := ReorderAdaptive(input, id, rateOf)
+		if want := []string{"b", "c", "a"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ReorderAdaptive() = %v, 期望 %v", got, want)
+		}
+		if !reflect.DeepEqual(input, []string{"a", "b", "c"}) {
+			t.Error("不应修改原切片")
+		}
+	})
+
+	t.Run("成功率相同保持输入顺序", func(t *testing.T) {
+		adaptiveRandFloat = func() float64 { return 0.99 }
+		got := ReorderAdaptive([]string{"c", "a", "b"}, id, func(string) float64 { return 1 })
+		if want := []string{"c", "a", "b"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ReorderAdaptive() = %v, 期望 %v", got, want)
+		}
+	})
+
+	t.Run("探测差 provider", func(t *testing.T) {
+		adaptiveRandFloat = func() float64 { return 0 } // 必定触发探测
+		got := ReorderAdaptiveWith(AdaptiveConfig{PoorThreshold: 0.5, ProbeRate: 0.1}, []string{"a", "b", "c"}, id, rateOf)
+		if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ReorderAdaptiveWith() = %v, 期望 %v", got, want)
+		}
+	})
+
+	t.Run("关闭探测", func(t *testing.T) {
+		adaptiveRandFloat = func() float64 { return 0 }
+		got := ReorderAdaptiveWith(AdaptiveConfig{PoorThreshold: 0.5}, []string{"a", "b", "c"}, id, rateOf)
+		if want := []string{"b", "c", "a"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ReorderAdaptiveWith() = %v, 期望 %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// 客户端 API Key 归属（多租户用量统计）
+// ============================================================================
+
+// apiKeyHashLen 落库的哈希前缀长度（十六进制字符数，64 bit 足以区分租户）
+const apiKeyHashLen = 16
+
+// clientAPIKeyHeaders 识别客户端身份的请求头，按优先级排列
+// Claude 客户端用 x-api-key，Codex/OpenAI 兼容客户端用 Authorization: Bearer，Gemini 用 x-goog-api-key
+var clientAPIKeyHeaders = []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key"}
+
+// HashAPIKey 返回 API Key 的 SHA-256 十六进制前缀，key 为空时返回空串
+// 日志中只保存哈希，不落明文
+func HashAPIKey(key string) string {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:apiKeyHashLen]
+}
+
+// ClientAPIKeyHash 从客户端请求头（cloneHeaders 的结果）中提取 API Key 并哈希
+// Authorization 仅接受 Bearer 方案；均未携带时返回空串
+func ClientAPIKeyHash(headers map[string]string) string {
+	for _, name := range clientAPIKeyHeaders {
+		value := strings.TrimSpace(headers[http.CanonicalHeaderKey(name)])
+		if value == "" {
+			continue
+		}
+		if name == "Authorization" {
+			scheme, token, ok := strings.Cut(value, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") {
+				continue
+			}
+			value = token
+		}
+		if hash := HashAPIKey(value); hash != "" {
+			return hash
+		}
+	}
+	return ""
+}
+
+// UserUsage 单个客户端（按 API Key 哈希区分）的用量汇总
+type UserUsage struct {
+	APIKeyHash        string `json:"api_key_hash"` // 空串表示未携带 API Key 的请求
+	Requests          int64  `json:"requests"`
+	InputTokens       int64  `json:"input_tokens"`
+	OutputTokens      int64  `json:"output_tokens"`
+	CacheCreateTokens int64  `json:"cache_create_tokens"`
+	CacheReadTokens   int64  `json:"cache_read_tokens"`
+	ReasoningTokens   int64  `json:"reasoning_tokens"`
+}
+
+// QueryUsageByUser 按 api_key_hash 汇总自 since 以来的用量，按请求数倒序
+func QueryUsageByUser(since time.Time) ([]UserUsage, error) {
+	db, err := requestLogDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT COALESCE(api_key_hash, ''), COUNT(*),
+			COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+			COALESCE(SUM(cache_create_tokens), 0), COALESCE(SUM(cache_read_tokens), 0),
+			COALESCE(SUM(reasoning_tokens), 0)
+		FROM request_log
+		WHERE created_at >= ?
+		GROUP BY COALESCE(api_key_hash, '')
+		ORDER BY COUNT(*) DESC, 1 ASC`,
+		since.UTC().Format(requestLogTimeLayout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询 request_log 失败: %w", err)
+	}
+	defer rows.Close()
+
+	var usages []UserUsage
+	for rows.Next() {
+		var u UserUsage
+		if err := rows.Scan(&u.APIKeyHash, &u.Requests,
+			&u.InputTokens, &u.OutputTokens,
+			&u.CacheCreateTokens, &u.CacheReadTokens,
+			&u.ReasoningTokens); err != nil {
+			return nil, fmt.Errorf("读取 request_log 失败: %w", err)
+		}
+		usages = append(usages, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取 request_log 失败: %w", err)
+	}
+	return usages, nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "modernc.org/sqlite"
+)
+
+func TestClientAPIKeyHash(t *testing.T) {
+	hash := HashAPIKey("sk-tenant-a")
+	if len(hash) != apiKeyHashLen || strings.Contains(hash, "tenant") {
+		t.Fatalf("HashAPIKey() = %q", hash)
+	}
+	if HashAPIKey("  ") != "" {
+		t.Error("空 key 应返回空串")
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"Bearer", map[string]string{"Authorization": "Bearer sk-tenant-a"}, hash},
+		{"bearer 小写", map[string]string{"Authorization": "bearer sk-tenant-a"}, hash},
+		{"x-api-key", map[string]string{"X-Api-Key": "sk-tenant-a"}, hash},
+		{"x-goog-api-key", map[string]string{"X-Goog-Api-Key": "sk-tenant-a"}, hash},
+		{"非 Bearer 方案回退到 x-api-key", map[string]string{"Authorization": "Basic abc", "X-Api-Key": "sk-tenant-a"}, hash},
+		{"未携带", map[string]string{"Content-Type": "application/json"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClientAPIKeyHash(tt.headers); got != tt.want {
+				t.Errorf("ClientAPIKeyHash() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRequestBody_APIKeyHash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"m"}`))
+	c.Request.Header.Set("x-api-key", "sk-tenant-a")
+
+	rc, err := ReadRequestBody(c)
+	if err != nil {
+		t.Fatalf("ReadRequestBody() error = %v", err)
+	}
+	defer rc.Release()
+	if rc.APIKeyHash != HashAPIKey("sk-tenant-a") {
+		t.Errorf("APIKeyHash = %q", rc.APIKeyHash)
+	}
+}
+
+func TestQueryUsageByUser(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := ensureRequestLogTableWithDB(db); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	insert := `INSERT INTO request_log (platform, model, provider, http_code, input_tokens, output_tokens,
+		cache_create_tokens, cache_read_tokens, reasoning_tokens, is_stream, duration_sec, api_key_hash, created_at)
+		VALUES ('claude', 'm', 'p', 200, ?, ?, 0, 0, 0, 0, 0, ?, ?)`
+	old := time.Now().Add(-2 * time.Hour).UTC().Format(requestLogTimeLayout)
+	now := time.Now().UTC().Format(requestLogTimeLayout)
+	for _, args := range [][]any{
+		{10, 1, "aaaa", now},
+		{20, 2, "aaaa", now},
+		{5, 5, "bbbb", now},
+		{100, 100, "bbbb", old},
+	} {
+		if _, err := db.Exec(insert, args...); err != nil {
+			t.Fatalf("插入失败: %v", err)
+		}
+	}
+
+	orig := GlobalDBQueueLogs
+	GlobalDBQueueLogs = &DBWriteQueue{db: db}
+	defer func() { GlobalDBQueueLogs = orig }()
+
+	usages, err := QueryUsageByUser(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("QueryUsageByUser() error = %v", err)
+	}
+	if len(usages) != 2 {
+		t.Fatalf("QueryUsageByUser() = %+v", usages)
+	}
+	if u := usages[0]; u.APIKeyHash != "aaaa" || u.Requests != 2 || u.InputTokens != 30 || u.OutputTokens != 3 {
+		t.Errorf("usages[0] = %+v", u)
+	}
+	if u := usages[1]; u.APIKeyHash != "bbbb" || u.Requests != 1 || u.InputTokens != 5 {
+		t.Errorf("usages[1] = %+v", u)
+	}
+
+	logs, err := QueryRecentLogs(1)
+	if err != nil || len(logs) != 1 || logs[0].APIKeyHash != "bbbb" {
+		t.Errorf("QueryRecentLogs() = %+v, %v", logs, err)
+	}
+}
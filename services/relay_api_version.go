@@ -0,0 +1,78 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ============================================================================
+// Provider API 版本请求头
+// ============================================================================
+
+const (
+	// AnthropicVersionHeader Anthropic Messages API 的版本请求头
+	AnthropicVersionHeader = "anthropic-version"
+	// DefaultAnthropicVersion provider 未设置 APIVersion 且客户端未携带版本头时，x-api-key 认证默认使用的版本
+	DefaultAnthropicVersion = "2023-06-01"
+)
+
+// versionHeaders 各报文格式对应的版本请求头
+// OpenAI 兼容接口没有版本头，Gemini 的版本在 URL 路径中（v1beta），均不设置
+var versionHeaders = map[Format]string{
+	FormatClaude: AnthropicVersionHeader,
+}
+
+// VersionHeader 返回 provider 的 API 版本请求头
+// provider 类型由 APIEndpoint 推断（见 DetectFormat），未配置端点时 Kind 为 claude 或 x-api-key 认证视为 Anthropic；
+// 未设置 APIVersion 或该类型没有版本头时返回空
+func VersionHeader(p Provider) (name, value string) {
+	return versionHeaderFor(providerFormat(p, ""), p.APIVersion)
+}
+
+// versionHeaderFor 按报文格式返回版本请求头，version 为空时返回空
+func versionHeaderFor(format Format, version string) (name, value string) {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return "", ""
+	}
+	if name = versionHeaders[format]; name == "" {
+		return "", ""
+	}
+	return name, version
+}
+
+// providerFormat 推断 provider 使用的报文格式：优先按实际转发的 endpoint，其次按 APIEndpoint 配置
+func providerFormat(p Provider, endpoint string) Format {
+	if endpoint == "" {
+		endpoint = p.APIEndpoint
+	}
+	if endpoint != "" {
+		return DetectFormat(nil, endpoint)
+	}
+	if Platform(strings.TrimSpace(p.Kind)).Base() == PlatformClaude ||
+		strings.EqualFold(strings.TrimSpace(p.ConnectivityAuthType), "x-api-key") {
+		return FormatClaude
+	}
+	return ""
+}
+
+// hasHeaderFold 是否存在同名请求头（大小写不敏感）
+func hasHeaderFold(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// setHeaderFold 设置请求头并移除大小写不同的同名 key
+// 客户端请求头经 cloneHeaders 复制后为规范形式（如 Anthropic-Version），直接写入小写 key 会出现两个同名头
+func setHeaderFold(headers map[string]string, name, value string) {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			delete(headers, k)
+		}
+	}
+	headers[http.CanonicalHeaderKey(name)] = value
+}
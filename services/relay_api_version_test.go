@@ -0,0 +1,38 @@
+package services
+
+import "testing"
+
+func TestVersionHeader(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  Provider
+		wantName  string
+		wantValue string
+	}{
+		{"Anthropic 端点", Provider{APIEndpoint: "/v1/messages", APIVersion: " 2024-10-22 "}, AnthropicVersionHeader, "2024-10-22"},
+		{"x-api-key 认证未配置端点", Provider{ConnectivityAuthType: "x-api-key", APIVersion: "2024-10-22"}, AnthropicVersionHeader, "2024-10-22"},
+		{"claude 平台未配置端点", Provider{Kind: "claude", APIVersion: "2024-10-22"}, AnthropicVersionHeader, "2024-10-22"},
+		{"未设置版本", Provider{APIEndpoint: "/v1/messages"}, "", ""},
+		{"OpenAI 兼容端点没有版本头", Provider{APIEndpoint: "/v1/chat/completions", APIVersion: "2024-10-22"}, "", ""},
+		{"无法推断类型", Provider{APIVersion: "2024-10-22"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, value := VersionHeader(tt.provider)
+			if name != tt.wantName || value != tt.wantValue {
+				t.Errorf("VersionHeader() = (%q, %q), want (%q, %q)", name, value, tt.wantName, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestSetHeaderFold(t *testing.T) {
+	headers := map[string]string{"Anthropic-Version": "2023-01-01", "anthropic-version": "2023-06-01", "Accept": "application/json"}
+	setHeaderFold(headers, AnthropicVersionHeader, "2024-10-22")
+	if len(headers) != 2 || headers["Anthropic-Version"] != "2024-10-22" {
+		t.Errorf("headers = %v", headers)
+	}
+	if !hasHeaderFold(headers, "ANTHROPIC-VERSION") || hasHeaderFold(headers, AnthropicBetaHeader) {
+		t.Errorf("hasHeaderFold 结果不正确: %v", headers)
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// 审计事件
+// ============================================================================
+
+// 审计事件类型
+const (
+	// AuditEventToolUseFixed 补充了合成的 tool_result，改变了模型看到的消息历史
+	AuditEventToolUseFixed = "tool_use_fixed"
+)
+
+// AuditEvent 结构化审计事件
+type AuditEvent struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Detail any       `json:"detail"`
+}
+
+// AuditSink 审计事件接收器
+type AuditSink func(event AuditEvent)
+
+var (
+	auditSinkMu sync.RWMutex
+	auditSink   AuditSink
+)
+
+// SetAuditSink 设置全局审计事件接收器，传 nil 关闭审计
+func SetAuditSink(sink AuditSink) {
+	auditSinkMu.Lock()
+	defer auditSinkMu.Unlock()
+	auditSink = sink
+}
+
+// emitAudit 发送审计事件，未配置接收器时为 no-op
+func emitAudit(eventType string, detail any) {
+	auditSinkMu.RLock()
+	sink := auditSink
+	auditSinkMu.RUnlock()
+
+	if sink == nil {
+		return
+	}
+	sink(AuditEvent{
+		Type:   eventType,
+		Time:   time.Now(),
+		Detail: detail,
+	})
+}
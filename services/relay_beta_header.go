@@ -0,0 +1,48 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ============================================================================
+// anthropic-beta 请求头合并
+// ============================================================================
+
+// AnthropicBetaHeader Anthropic beta 功能开关请求头，值为逗号分隔的标志列表
+const AnthropicBetaHeader = "anthropic-beta"
+
+// MergeBetaHeader 合并客户端与 provider 的 anthropic-beta 标志
+// 取两者并集，去除空白与重复项；保持出现顺序（客户端在前，provider 新增的追加在后）
+func MergeBetaHeader(clientValue, providerValue string) string {
+	seen := make(map[string]bool)
+	var flags []string
+	for _, value := range []string{clientValue, providerValue} {
+		for _, flag := range strings.Split(value, ",") {
+			flag = strings.TrimSpace(flag)
+			if flag == "" || seen[flag] {
+				continue
+			}
+			seen[flag] = true
+			flags = append(flags, flag)
+		}
+	}
+	return strings.Join(flags, ",")
+}
+
+// setBetaHeader 将 provider 要求的 beta 标志合并进转发请求头
+// 客户端请求头经 cloneHeaders 复制后 key 为规范形式（Anthropic-Beta），这里按大小写不敏感查找，
+// 合并后统一写回同一个 key，避免出现两个大小写不同的 anthropic-beta 头
+func setBetaHeader(headers map[string]string, providerValue string) {
+	key := http.CanonicalHeaderKey(AnthropicBetaHeader)
+	clientValue := ""
+	for k, v := range headers {
+		if strings.EqualFold(k, AnthropicBetaHeader) {
+			clientValue = MergeBetaHeader(clientValue, v)
+			delete(headers, k)
+		}
+	}
+	if merged := MergeBetaHeader(clientValue, providerValue); merged != "" {
+		headers[key] = merged
+	}
+}
@@ -0,0 +1,33 @@
+package services
+
+import "testing"
+
+func TestMergeBetaHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		client   string
+		provider string
+		want     string
+	}{
+		{"都为空", "", "", ""},
+		{"仅客户端", "prompt-caching-2024-07-31", "", "prompt-caching-2024-07-31"},
+		{"仅 provider", "", "context-1m-2025-08-07", "context-1m-2025-08-07"},
+		{"并集保持顺序", "a, b", "c,a", "a,b,c"},
+		{"去除空白和空项", " a ,, b ", " ,b", "a,b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeBetaHeader(tt.client, tt.provider); got != tt.want {
+				t.Errorf("MergeBetaHeader() = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetBetaHeader(t *testing.T) {
+	headers := map[string]string{"anthropic-beta": "a,b", "Accept": "application/json"}
+	setBetaHeader(headers, "b,c")
+	if len(headers) != 2 || headers["Anthropic-Beta"] != "a,b,c" {
+		t.Errorf("headers = %v", headers)
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// 按错误类型区分的拉黑时长策略
+// ============================================================================
+
+// ErrorClass 错误分类
+type ErrorClass string
+
+const (
+	ErrorClassNone        ErrorClass = "none"         // 无错误
+	ErrorClassAuth        ErrorClass = "auth"         // 认证/鉴权失败（401/403）
+	ErrorClassRateLimit   ErrorClass = "rate_limit"   // 限流（429）
+	ErrorClassServer      ErrorClass = "server"       // 上游服务端错误（5xx）
+	ErrorClassNetwork     ErrorClass = "network"      // 网络错误（超时、连接失败等）
+	ErrorClassClient      ErrorClass = "client"       // 其他 4xx 错误
+	ErrorClassClientAbort ErrorClass = "client_abort" // 客户端中断，不应拉黑
+	ErrorClassUnknown     ErrorClass = "unknown"      // 无法识别
+)
+
+// ClassifyError 根据错误和 HTTP 状态码对失败进行分类
+// 优先使用状态码判断；状态码为 0 时根据错误类型判断
+func ClassifyError(err error, httpCode int) ErrorClass {
+	if errors.Is(err, errClientAbort) {
+		return ErrorClassClientAbort
+	}
+
+	switch {
+	case httpCode == http.StatusUnauthorized || httpCode == http.StatusForbidden:
+		return ErrorClassAuth
+	case httpCode == http.StatusTooManyRequests:
+		return ErrorClassRateLimit
+	case httpCode >= http.StatusInternalServerError:
+		return ErrorClassServer
+	case httpCode >= http.StatusBadRequest:
+		return ErrorClassClient
+	}
+
+	if err == nil {
+		return ErrorClassNone
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return ErrorClassNetwork
+	}
+	return ErrorClassUnknown
+}
+
+// BlacklistPolicy 错误分类 → 拉黑时长映射
+type BlacklistPolicy struct {
+	Durations map[ErrorClass]time.Duration // 各分类的拉黑时长
+	Default   time.Duration                // 未配置分类的拉黑时长
+}
+
+// DefaultBlacklistPolicy 默认拉黑策略
+// 认证失败需要人工介入，拉黑时间较长；限流通常很快恢复，只短暂拉黑
+func DefaultBlacklistPolicy() BlacklistPolicy {
+	return BlacklistPolicy{
+		Durations: map[ErrorClass]time.Duration{
+			ErrorClassNone:        0,
+			ErrorClassClientAbort: 0,
+			ErrorClassAuth:        time.Hour,
+			ErrorClassRateLimit:   30 * time.Second,
+			ErrorClassServer:      5 * time.Minute,
+			ErrorClassNetwork:     5 * time.Minute,
+		},
+		Default: 5 * time.Minute,
+	}
+}
+
+// Duration 返回指定错误分类的拉黑时长，0 表示不拉黑
+func (p BlacklistPolicy) Duration(class ErrorClass) time.Duration {
+	if d, ok := p.Durations[class]; ok {
+		return d
+	}
+	return p.Default
+}
+
+// ============================================================================
+// 拉黑到期时间抖动
+// ============================================================================
+
+// blacklistJitterBits 拉黑时长的抖动比例（math.Float64bits 存储），0 表示不抖动
+var blacklistJitterBits atomic.Uint64
+
+// jitterRandFloat 随机数来源（测试中替换）
+var jitterRandFloat = rand.Float64
+
+// SetBlacklistJitter 设置拉黑时长的抖动比例（0~1），超出范围时截断
+// 同一 Level 的 provider 同时被拉黑（如区域故障）时，抖动使它们在不同时刻恢复，避免恢复瞬间的请求洪峰
+func SetBlacklistJitter(fraction float64) {
+	blacklistJitterBits.Store(math.Float64bits(clampFraction(fraction)))
+}
+
+// BlacklistJitter 返回当前的拉黑时长抖动比例
+func BlacklistJitter() float64 {
+	return math.Float64frombits(blacklistJitterBits.Load())
+}
+
+// JitteredExpiry 返回带抖动的到期时间：now + base × [1-fraction, 1+fraction] 内的均匀随机值
+// 写入黑名单的一方应使用它（或 jitteredDuration）计算 blacklisted_until，
+// blacklistChecker 返回的 until 即为抖动后的时间，无需其他改动
+func JitteredExpiry(base time.Duration, fraction float64) time.Time {
+	return clockNow().Add(jitteredDuration(base, fraction))
+}
+
+// jitteredDuration 返回 base × [1-fraction, 1+fraction] 内的均匀随机时长
+func jitteredDuration(base time.Duration, fraction float64) time.Duration {
+	fraction = clampFraction(fraction)
+	if base <= 0 || fraction == 0 {
+		return base
+	}
+	factor := 1 + fraction*(2*jitterRandFloat()-1)
+	return time.Duration(float64(base) * factor)
+}
+
+// clampFraction 将比例截断到 [0, 1]
+func clampFraction(fraction float64) float64 {
+	switch {
+	case math.IsNaN(fraction) || fraction < 0:
+		return 0
+	case fraction > 1:
+		return 1
+	default:
+		return fraction
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestClassifyErrorAndPolicy(t *testing.T) {
+	policy := DefaultBlacklistPolicy()
+
+	tests := []struct {
+		name      string
+		err       error
+		httpCode  int
+		wantClass ErrorClass
+		wantDur   time.Duration
+	}{
+		{"401 认证失败", errors.New("upstream status 401"), 401, ErrorClassAuth, time.Hour},
+		{"403 鉴权失败", nil, 403, ErrorClassAuth, time.Hour},
+		{"429 限流", errors.New("upstream status 429"), 429, ErrorClassRateLimit, 30 * time.Second},
+		{"503 服务端错误", errors.New("upstream status 503"), 503, ErrorClassServer, 5 * time.Minute},
+		{"400 客户端错误", errors.New("upstream status 400"), 400, ErrorClassClient, 5 * time.Minute},
+		{"超时", fmt.Errorf("request: %w", context.DeadlineExceeded), 0, ErrorClassNetwork, 5 * time.Minute},
+		{"客户端中断", fmt.Errorf("%w: eof", errClientAbort), 0, ErrorClassClientAbort, 0},
+		{"成功", nil, 200, ErrorClassNone, 0},
+		{"未知错误", errors.New("boom"), 0, ErrorClassUnknown, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class := ClassifyError(tt.err, tt.httpCode)
+			if class != tt.wantClass {
+				t.Errorf("ClassifyError = %s, 期望 %s", class, tt.wantClass)
+			}
+			if d := policy.Duration(class); d != tt.wantDur {
+				t.Errorf("Duration = %v, 期望 %v", d, tt.wantDur)
+			}
+		})
+	}
+}
+
+func TestJitteredDuration(t *testing.T) {
+	orig := jitterRandFloat
+	defer func() { jitterRandFloat = orig }()
+
+	tests := []struct {
+		name     string
+		random   float64
+		fraction float64
+		want     time.Duration
+	}{
+		{"不抖动", 0.9, 0, 10 * time.Minute},
+		{"下限", 0, 0.2, 8 * time.Minute},
+		{"中点", 0.5, 0.2, 10 * time.Minute},
+		{"比例截断到 1", 0.75, 5, 15 * time.Minute},
+		{"负比例视为 0", 0, -1, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jitterRandFloat = func() float64 { return tt.random }
+			if got := jitteredDuration(10*time.Minute, tt.fraction); got != tt.want {
+				t.Errorf("jitteredDuration() = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+
+	jitterRandFloat = func() float64 { return 1 }
+	if until := JitteredExpiry(time.Minute, 0.5); time.Until(until) <= time.Minute {
+		t.Errorf("JitteredExpiry() = %v, 期望超过 1 分钟后", until)
+	}
+
+	SetBlacklistJitter(2)
+	defer SetBlacklistJitter(0)
+	if got := BlacklistJitter(); got != 1 {
+		t.Errorf("BlacklistJitter() = %v, 期望截断为 1", got)
+	}
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// ============================================================================
+// 请求体缓冲池
+// ============================================================================
+
+// maxPooledBodySize 超过该容量的缓冲区不放回池中，避免偶发的超大请求长期占用内存
+const maxPooledBodySize = 4 << 20
+
+// bodyBufferPool 读取请求体复用的缓冲区
+var bodyBufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// readPooledBody 使用池中的缓冲区读取 r 的全部内容
+// sizeHint 为预期长度（如 Content-Length），> 0 时预先扩容以减少增长拷贝
+func readPooledBody(r io.Reader, sizeHint int64) (*bytes.Buffer, error) {
+	buf := bodyBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if sizeHint > 0 && sizeHint <= maxPooledBodySize {
+		buf.Grow(int(sizeHint))
+	}
+	if _, err := buf.ReadFrom(r); err != nil {
+		putBodyBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// putBodyBuffer 将缓冲区放回池中
+func putBodyBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooledBodySize {
+		return
+	}
+	buf.Reset()
+	bodyBufferPool.Put(buf)
+}
+
+// Release 将请求体缓冲区归还到池中，请求处理完成后调用
+// 调用后 BodyBytes 置为 nil，此前取得的 BodyBytes 切片及 c.Request.Body 均不可再使用；
+// 需要在请求结束后保留请求体的调用方（如异步日志、影子请求）必须在 Release 前自行复制
+// 重复调用安全
+func (rc *RequestContext) Release() {
+	if rc == nil || rc.bodyBuf == nil {
+		return
+	}
+	putBodyBuffer(rc.bodyBuf)
+	rc.bodyBuf = nil
+	rc.BodyBytes = nil
+}
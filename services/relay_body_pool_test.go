@@ -0,0 +1,62 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newBodyContext(body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	return c
+}
+
+func TestReadRequestBody_Release(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := `{"model":"claude-sonnet-4","stream":true}`
+	c := newBodyContext(body)
+
+	rc, err := ReadRequestBody(c)
+	if err != nil {
+		t.Fatalf("ReadRequestBody() error = %v", err)
+	}
+	if string(rc.BodyBytes) != body || !rc.IsStream || rc.RequestedModel != "claude-sonnet-4" {
+		t.Errorf("RequestContext = %+v", rc)
+	}
+	if replay, _ := io.ReadAll(c.Request.Body); string(replay) != body {
+		t.Errorf("重置后的 Body = %s", replay)
+	}
+
+	rc.Release()
+	if rc.BodyBytes != nil {
+		t.Error("Release 后 BodyBytes 应为 nil")
+	}
+	rc.Release() // 重复调用安全
+}
+
+func TestPutBodyBuffer_SkipsOversized(t *testing.T) {
+	big := bytes.NewBuffer(make([]byte, 0, maxPooledBodySize+1))
+	putBodyBuffer(big)
+	if got := bodyBufferPool.Get().(*bytes.Buffer); got == big {
+		t.Error("超大缓冲区不应放回池中")
+	}
+}
+
+func BenchmarkReadRequestBody(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	body := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"` + strings.Repeat("x", 16<<10) + `"}]}`
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rc, err := ReadRequestBody(newBodyContext(body))
+		if err != nil {
+			b.Fatal(err)
+		}
+		rc.Release()
+	}
+}
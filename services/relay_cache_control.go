@@ -0,0 +1,134 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ============================================================================
+// Anthropic prompt caching：自动注入 cache_control 断点
+// ============================================================================
+
+const (
+	// MaxCacheBreakpoints Anthropic 单个请求允许的 cache_control 断点上限
+	MaxCacheBreakpoints = 4
+	// DefaultCacheBreakpoints 转发时默认注入的断点数：system 末尾 1 个 + 最近 2 条消息
+	DefaultCacheBreakpoints = 3
+)
+
+// ephemeralCacheControl 注入的 cache_control 值
+var ephemeralCacheControl = map[string]string{"type": "ephemeral"}
+
+// InjectCacheControl 为 Claude Messages 请求注入最多 breakpoints 个 cache_control 断点（不超过 MaxCacheBreakpoints）：
+//   - 第一个放在 system 的最后一个块（字符串形式的 system 转换为单个 text 块）
+//   - 其余从最后一条消息开始向前，每条消息放在最后一个可缓存的内容块上（thinking 块与空文本不可缓存）
+//
+// 请求中已有任意 cache_control 时视为客户端自行管理缓存，原样返回，因此重复调用是幂等的
+// 返回：新请求体、是否有修改；请求体不是合法 JSON 时返回错误
+func InjectCacheControl(bodyBytes []byte, breakpoints int) ([]byte, bool, error) {
+	if !gjson.ValidBytes(bodyBytes) {
+		return bodyBytes, false, fmt.Errorf("请求体不是合法 JSON")
+	}
+	if breakpoints <= 0 || hasCacheControl(bodyBytes) {
+		return bodyBytes, false, nil
+	}
+	if breakpoints > MaxCacheBreakpoints {
+		breakpoints = MaxCacheBreakpoints
+	}
+
+	result := bodyBytes
+	placed := 0
+	var err error
+
+	if system := gjson.GetBytes(result, "system"); system.Exists() {
+		var ok bool
+		if result, ok, err = markLastBlock(result, "system", system); err != nil {
+			return bodyBytes, false, err
+		}
+		if ok {
+			placed++
+		}
+	}
+
+	messages := gjson.GetBytes(result, "messages").Array()
+	for i := len(messages) - 1; i >= 0 && placed < breakpoints; i-- {
+		path := fmt.Sprintf("messages.%d.content", i)
+		var ok bool
+		if result, ok, err = markLastBlock(result, path, messages[i].Get("content")); err != nil {
+			return bodyBytes, false, err
+		}
+		if ok {
+			placed++
+		}
+	}
+
+	return result, placed > 0, nil
+}
+
+// hasCacheControl 请求的 tools、system 或消息内容中是否已有 cache_control
+func hasCacheControl(bodyBytes []byte) bool {
+	for _, path := range []string{"tools.#.cache_control", "system.#.cache_control", "messages.#.content.#.cache_control"} {
+		found := false
+		gjson.GetBytes(bodyBytes, path).ForEach(func(_, v gjson.Result) bool {
+			// messages 的结果为嵌套数组，需逐层检查
+			if v.IsArray() {
+				found = len(v.Array()) > 0
+			} else {
+				found = v.Exists()
+			}
+			return !found
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// markLastBlock 在 path 处的内容（字符串或内容块数组）的最后一个可缓存块上设置 cache_control
+// 字符串内容转换为单个 text 块；没有可缓存的块时不修改
+func markLastBlock(bodyBytes []byte, path string, content gjson.Result) ([]byte, bool, error) {
+	if content.Type == gjson.String {
+		if strings.TrimSpace(content.String()) == "" {
+			return bodyBytes, false, nil
+		}
+		block := map[string]any{
+			"type":          "text",
+			"text":          content.String(),
+			"cache_control": ephemeralCacheControl,
+		}
+		result, err := sjson.SetBytes(bodyBytes, path, []any{block})
+		if err != nil {
+			return bodyBytes, false, fmt.Errorf("设置 %s 失败: %w", path, err)
+		}
+		return result, true, nil
+	}
+
+	blocks := content.Array()
+	for j := len(blocks) - 1; j >= 0; j-- {
+		if !isCacheableBlock(blocks[j]) {
+			continue
+		}
+		blockPath := fmt.Sprintf("%s.%d.cache_control", path, j)
+		result, err := sjson.SetBytes(bodyBytes, blockPath, ephemeralCacheControl)
+		if err != nil {
+			return bodyBytes, false, fmt.Errorf("设置 %s 失败: %w", blockPath, err)
+		}
+		return result, true, nil
+	}
+	return bodyBytes, false, nil
+}
+
+// isCacheableBlock thinking/redacted_thinking 块与空文本块不能设置 cache_control
+func isCacheableBlock(block gjson.Result) bool {
+	switch block.Get("type").String() {
+	case "thinking", "redacted_thinking":
+		return false
+	case "text":
+		return strings.TrimSpace(block.Get("text").String()) != ""
+	}
+	return block.IsObject()
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestInjectCacheControl(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		breakpoints int
+		wantChanged bool
+		wantPaths   []string // 应带有 cache_control 的路径
+		wantMissing []string // 不应带有 cache_control 的路径
+	}{
+		{
+			name:        "字符串 system 与消息转换为内容块",
+			body:        `{"system":"be brief","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"again"}]}`,
+			breakpoints: 3,
+			wantChanged: true,
+			wantPaths:   []string{"system.0.cache_control", "messages.2.content.0.cache_control", "messages.1.content.0.cache_control"},
+			wantMissing: []string{"messages.0.content.0.cache_control"},
+		},
+		{
+			name:        "跳过 thinking 块与空文本",
+			body:        `{"messages":[{"role":"assistant","content":[{"type":"text","text":"a"},{"type":"thinking","thinking":"x"},{"type":"text","text":" "}]}]}`,
+			breakpoints: 2,
+			wantChanged: true,
+			wantPaths:   []string{"messages.0.content.0.cache_control"},
+			wantMissing: []string{"messages.0.content.1.cache_control", "messages.0.content.2.cache_control"},
+		},
+		{
+			name:        "断点数不超过上限",
+			body:        `{"system":[{"type":"text","text":"s"}],"messages":[{"role":"user","content":"1"},{"role":"user","content":"2"},{"role":"user","content":"3"},{"role":"user","content":"4"},{"role":"user","content":"5"}]}`,
+			breakpoints: 10,
+			wantChanged: true,
+			wantPaths:   []string{"system.0.cache_control", "messages.4.content.0.cache_control", "messages.2.content.0.cache_control"},
+			wantMissing: []string{"messages.1.content.0.cache_control"},
+		},
+		{
+			name:        "客户端已设置断点时不改动",
+			body:        `{"messages":[{"role":"user","content":[{"type":"text","text":"a","cache_control":{"type":"ephemeral"}}]},{"role":"user","content":"b"}]}`,
+			breakpoints: 3,
+			wantChanged: false,
+			wantMissing: []string{"messages.1.content.0.cache_control"},
+		},
+		{
+			name:        "断点数为 0",
+			body:        `{"messages":[{"role":"user","content":"a"}]}`,
+			breakpoints: 0,
+			wantChanged: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := InjectCacheControl([]byte(tt.body), tt.breakpoints)
+			if err != nil {
+				t.Fatalf("InjectCacheControl() error = %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !changed && string(got) != tt.body {
+				t.Errorf("未修改时应原样返回, got %s", got)
+			}
+			for _, path := range tt.wantPaths {
+				if gjson.GetBytes(got, path+".type").String() != "ephemeral" {
+					t.Errorf("%s 缺少 cache_control: %s", path, got)
+				}
+			}
+			for _, path := range tt.wantMissing {
+				if gjson.GetBytes(got, path).Exists() {
+					t.Errorf("%s 不应有 cache_control: %s", path, got)
+				}
+			}
+
+			// 幂等：再次注入不改变结果
+			again, changedAgain, _ := InjectCacheControl(got, tt.breakpoints)
+			if changed && (changedAgain || string(again) != string(got)) {
+				t.Errorf("重复注入应无变化, got %s", again)
+			}
+		})
+	}
+
+	if _, _, err := InjectCacheControl([]byte(`{bad`), 2); err == nil {
+		t.Error("非法 JSON 应返回错误")
+	}
+}
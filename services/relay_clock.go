@@ -0,0 +1,79 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// 可替换的时钟
+// ============================================================================
+
+// Clock 当前时间来源
+// 拉黑到期时间（JitteredExpiry）、重试预算、成功降权/置顶、幂等缓存、模型列表缓存、成功率窗口等依赖时间的逻辑统一通过 clockNow() 取时间，
+// 测试中用 SetClock 换成 ManualClock 即可确定性地推进时间，无需真实 sleep
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock 系统时钟
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// clockHolder atomic.Value 要求每次存入相同的具体类型
+type clockHolder struct{ Clock }
+
+var currentClock atomic.Value // clockHolder
+
+func init() {
+	currentClock.Store(clockHolder{realClock{}})
+}
+
+// SetClock 替换包级时钟，返回恢复原时钟的函数；c 为 nil 时恢复系统时钟
+// 用法：defer SetClock(clk)()
+func SetClock(c Clock) (restore func()) {
+	if c == nil {
+		c = realClock{}
+	}
+	prev := currentClock.Swap(clockHolder{c}).(clockHolder)
+	return func() { currentClock.Store(prev) }
+}
+
+// clockNow 返回包级时钟的当前时间
+func clockNow() time.Time {
+	return currentClock.Load().(clockHolder).Now()
+}
+
+// ManualClock 手动推进的时钟，并发安全，仅用于测试
+type ManualClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewManualClock 创建停在 t 的时钟
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{t: t}
+}
+
+// Now 返回当前设定的时间
+func (mc *ManualClock) Now() time.Time {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.t
+}
+
+// Advance 将时钟向前推进 d
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.t = mc.t.Add(d)
+}
+
+// Set 将时钟设为 t
+func (mc *ManualClock) Set(t time.Time) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.t = t
+}
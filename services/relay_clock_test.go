@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	clk := NewManualClock(start)
+	restore := SetClock(clk)
+
+	if got := clockNow(); !got.Equal(start) {
+		t.Fatalf("clockNow() = %v, want %v", got, start)
+	}
+	clk.Advance(time.Minute)
+	if got := clockNow(); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("Advance 后 clockNow() = %v", got)
+	}
+
+	t.Run("重试预算按时钟推进", func(t *testing.T) {
+		rc := NewRetryContext(1, 0)
+		rc.SetBudget(10 * time.Second)
+		if remaining := rc.TimeRemaining(); remaining != 10*time.Second {
+			t.Errorf("TimeRemaining() = %v, 期望 10s", remaining)
+		}
+		clk.Advance(4 * time.Second)
+		if remaining := rc.TimeRemaining(); remaining != 6*time.Second {
+			t.Errorf("TimeRemaining() = %v, 期望 6s", remaining)
+		}
+		clk.Advance(6 * time.Second)
+		if !rc.Expired() {
+			t.Error("预算耗尽后应过期")
+		}
+	})
+
+	restore()
+	if got := clockNow(); time.Since(got) > time.Minute {
+		t.Errorf("恢复后应使用系统时钟, clockNow() = %v", got)
+	}
+}
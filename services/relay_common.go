@@ -3,15 +3,19 @@ package services
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/tidwall/gjson"
-	"github.com/tidwall/sjson"
 )
 
 // ============================================================================
@@ -49,6 +53,20 @@ func (p Provider) HasValidConfig() bool {
 	return p.APIURL != "" && p.APIKey != ""
 }
 
+// IsLastResort 返回 Provider 是否为兜底 Provider
+func (p Provider) IsLastResort() bool { return p.LastResort }
+
+// lastResortProvider 可选接口：实现该接口的 provider 可声明自己为兜底 Provider
+type lastResortProvider interface {
+	IsLastResort() bool
+}
+
+// isLastResort 判断 provider 是否为兜底 Provider
+func isLastResort(p any) bool {
+	lr, ok := p.(lastResortProvider)
+	return ok && lr.IsLastResort()
+}
+
 // 确保 GeminiProvider 实现 ProviderLike 接口
 var _ ProviderLike = GeminiProvider{}
 
@@ -67,8 +85,20 @@ func (p GeminiProvider) GetLevel() int {
 func (p GeminiProvider) IsEnabled() bool { return p.Enabled }
 
 // HasValidConfig 检查 GeminiProvider 是否有有效配置
+// 需要 BaseURL 和 APIKey；AllowKeyless 为 true 时（如本地代理）不要求 APIKey
 func (p GeminiProvider) HasValidConfig() bool {
-	return p.BaseURL != ""
+	return p.geminiConfigProblem() == ""
+}
+
+// geminiConfigProblem 返回缺失的必要配置描述，配置完整时返回空字符串
+func (p GeminiProvider) geminiConfigProblem() string {
+	if p.BaseURL == "" {
+		return "BaseURL 为空"
+	}
+	if p.APIKey == "" && !p.AllowKeyless {
+		return "APIKey 为空"
+	}
+	return ""
 }
 
 // ============================================================================
@@ -80,100 +110,244 @@ type RequestContext struct {
 	BodyBytes      []byte            // 原始请求体
 	IsStream       bool              // 是否流式请求
 	RequestedModel string            // 请求的模型名
-	Query          map[string]string // URL 查询参数
-	ClientHeaders  map[string]string // 客户端请求头
+	Query          map[string]string // URL 查询参数（重复的 key 只保留最后一个值）
+	ClientHeaders  map[string]string // 客户端请求头（同名请求头的多个值以 ", " 合并）
+	QueryValues    url.Values        // URL 查询参数（保留重复 key 的全部值）
+	HeaderValues   http.Header       // 客户端请求头（保留同名请求头的全部值）
+	IdempotencyKey string            // 客户端幂等键（Idempotency-Key 请求头，可为空）
+	Format         Format            // 请求报文格式（见 DetectFormat，无法识别时为空）
+	APIKeyHash     string            // 客户端 API Key 的 SHA-256 前缀（见 ClientAPIKeyHash，未携带时为空）
+
+	bodyBuf *bytes.Buffer // BodyBytes 所在的池化缓冲区（见 Release）
 }
 
 // ReadRequestBody 读取并解析请求体
+// 请求体读入池化缓冲区，请求处理完成后应调用 RequestContext.Release 归还
 // 返回 RequestContext 和错误信息
 func ReadRequestBody(c *gin.Context) (*RequestContext, error) {
 	var bodyBytes []byte
+	var bodyBuf *bytes.Buffer
 	if c.Request.Body != nil {
-		data, err := io.ReadAll(c.Request.Body)
+		buf, err := readPooledBody(c.Request.Body, c.Request.ContentLength)
 		if err != nil {
 			return nil, fmt.Errorf("invalid request body: %w", err)
 		}
-		bodyBytes = data
+		bodyBuf = buf
+		bodyBytes = buf.Bytes()
 		// 重置 Body 以便后续使用
 		c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 	}
 
+	query := flattenQuery(c.Request.URL.Query())
+	clientHeaders := cloneHeaders(c.Request.Header)
 	return &RequestContext{
+		bodyBuf:        bodyBuf,
 		BodyBytes:      bodyBytes,
 		IsStream:       gjson.GetBytes(bodyBytes, "stream").Bool(),
-		RequestedModel: gjson.GetBytes(bodyBytes, "model").String(),
-		Query:          flattenQuery(c.Request.URL.Query()),
-		ClientHeaders:  cloneHeaders(c.Request.Header),
+		RequestedModel: detectRequestedModel(bodyBytes, c.Request.URL.Path, query),
+		Query:          query,
+		ClientHeaders:  clientHeaders,
+		QueryValues:    c.Request.URL.Query(),
+		HeaderValues:   c.Request.Header.Clone(),
+		IdempotencyKey: strings.TrimSpace(c.GetHeader(IdempotencyHeader)),
+		Format:         DetectFormat(bodyBytes, c.Request.URL.Path),
+		APIKeyHash:     ClientAPIKeyHash(clientHeaders),
 	}, nil
 }
 
+// detectRequestedModel 识别请求的模型名
+// 优先级：请求体 model 字段 > URL 路径（Gemini 风格 /models/{model}:action）> 查询参数 ?model=
+// Gemini 请求体不带 model 字段，若不从路径/查询参数提取，modelChecker 会因模型为空被跳过
+func detectRequestedModel(bodyBytes []byte, path string, query map[string]string) string {
+	if model := gjson.GetBytes(bodyBytes, "model").String(); model != "" {
+		return model
+	}
+	if model := extractGeminiModelFromEndpoint(path); model != "" {
+		return model
+	}
+	return strings.TrimSpace(query["model"])
+}
+
 // ============================================================================
 // Provider 过滤与分组
 // ============================================================================
 
+// SkipReason provider 被跳过的原因
+type SkipReason string
+
+const (
+	SkipReasonDisabled               SkipReason = "disabled"                 // 未启用
+	SkipReasonInvalidConfig          SkipReason = "invalid_config"           // 缺少必要配置（URL/Key）
+	SkipReasonConfigValidationFailed SkipReason = "config_validation_failed" // 配置验证失败
+	SkipReasonModelUnsupported       SkipReason = "model_unsupported"        // 不支持请求的模型
+	SkipReasonModelDenied            SkipReason = "model_denied"             // 模型被 AllowModels/DenyModels 策略禁止
+	SkipReasonBlacklisted            SkipReason = "blacklisted"              // 已拉黑
+	SkipReasonLowSuccessRate         SkipReason = "low_success_rate"         // 近期成功率过低
+	SkipReasonTagExcluded            SkipReason = "tag_excluded"             // 带有被排除的标签
+	SkipReasonTagNotIncluded         SkipReason = "tag_not_included"         // 不带任何要求的标签
+	SkipReasonContextTooLarge        SkipReason = "context_too_large"        // 预估输入 token 超出上下文上限
+	SkipReasonLevelOutOfRange        SkipReason = "level_out_of_range"       // Level 不在请求限定的范围内
+)
+
+// SkipInfo 被跳过的 provider 信息
+type SkipInfo struct {
+	Name   string     `json:"name"`
+	Reason SkipReason `json:"reason"`
+	Detail string     `json:"detail,omitempty"` // 补充说明（验证错误、拉黑过期时间等）
+}
+
 // FilterResult 过滤结果
 type FilterResult[T ProviderLike] struct {
-	Active       []T // 可用的 providers
-	SkippedCount int // 被跳过的数量
+	Active       []T        // 可用的 providers
+	LastResort   []T        // 通过过滤的兜底 providers（不在 Active 中，由 SelectProviders 追加到末尾）
+	Skipped      []SkipInfo // 被跳过的 providers 及原因
+	SkippedCount int        // 被跳过的数量（等于 len(Skipped)，保留用于兼容）
+	TotalInput   int        // 过滤前的 provider 总数，为 0 表示根本没有配置 provider
+}
+
+var (
+	// ErrNoProvidersConfigured 过滤前的 provider 列表为空（配置缺失）
+	ErrNoProvidersConfigured = errors.New("no providers configured")
+	// ErrAllProvidersFiltered 配置了 provider，但全部被过滤（禁用、拉黑、不支持模型等）
+	ErrAllProvidersFiltered = errors.New("all providers filtered out")
+)
+
+// Empty 判断过滤后是否没有任何可尝试的 provider（包括兜底）
+func (r FilterResult[T]) Empty() bool {
+	return len(r.Active) == 0 && len(r.LastResort) == 0
+}
+
+// Err 过滤后没有可尝试的 provider 时返回原因，否则返回 nil
+// 区分"根本没有配置"（ErrNoProvidersConfigured）与"配置了但全部被过滤"（ErrAllProvidersFiltered），
+// 避免调用方在零次尝试后报出令人困惑的"所有 Provider 都失败"
+func (r FilterResult[T]) Err(kind string) error {
+	if !r.Empty() {
+		return nil
+	}
+	if r.TotalInput == 0 {
+		return fmt.Errorf("%w for kind %s", ErrNoProvidersConfigured, kind)
+	}
+	return fmt.Errorf("%w for kind %s (%d configured, %d skipped)", ErrAllProvidersFiltered, kind, r.TotalInput, r.SkippedCount)
+}
+
+// addSkip 记录一个被跳过的 provider
+func (r *FilterResult[T]) addSkip(name string, reason SkipReason, detail string) {
+	r.Skipped = append(r.Skipped, SkipInfo{Name: name, Reason: reason, Detail: detail})
+	r.SkippedCount = len(r.Skipped)
 }
 
 // FilterProviders 过滤 Provider 列表
 // 参数:
 //   - providers: 原始 Provider 列表
-//   - kind: 平台类型 (claude/codex/gemini)
+//   - kind: 平台类型 (PlatformClaude/PlatformCodex/custom:xxx)
 //   - requestedModel: 请求的模型名（可为空）
-//   - blacklistChecker: 黑名单检查函数
+//   - blacklistChecker: 黑名单检查函数，name 参数为 Provider.BlacklistKey()（默认即名称）
 //   - modelChecker: 模型支持检查函数（可为 nil）
 //   - configValidator: 配置验证函数（可为 nil）
 func FilterProviders(
 	providers []Provider,
-	kind string,
+	platform Platform,
 	requestedModel string,
 	blacklistChecker func(kind, name string) (bool, time.Time),
 	modelChecker func(p *Provider, model string) bool,
 	configValidator func(p *Provider) []string,
 ) FilterResult[Provider] {
-	result := FilterResult[Provider]{
-		Active: make([]Provider, 0, len(providers)),
+	kind := string(platform)
+	result := FilterResult[Provider]{TotalInput: len(providers)}
+	active := filterProviders(providers, kind, requestedModel, blacklistChecker, modelChecker, configValidator,
+		func(p Provider, reason SkipReason, detail string) {
+			switch reason {
+			case SkipReasonConfigValidationFailed:
+				logSkipf(kind, p.Name, reason, "[WARN] Provider %s 配置验证失败，已自动跳过: %s", p.Name, detail)
+			case SkipReasonModelUnsupported:
+				logSkipf(kind, p.Name, reason, "[INFO] Provider %s 不支持模型 %s，已跳过", p.Name, requestedModel)
+			case SkipReasonModelDenied:
+				logSkipf(kind, p.Name, reason, "[INFO] Provider %s 的模型策略禁止 %s，已跳过", p.Name, requestedModel)
+			case SkipReasonBlacklisted:
+				logSkipf(kind, p.Name, reason, "⛔ Provider %s 已拉黑，过期时间: %v", p.Name, detail)
+			}
+			result.addSkip(p.Name, reason, detail)
+			currentMetrics().IncSkipped(kind, p.Name, string(reason))
+		},
+	)
+	result.Active, result.LastResort = splitLastResort(active)
+
+	return result
+}
+
+// splitLastResort 将兜底 providers 从列表中分离出来，两部分均保持原顺序
+func splitLastResort[T any](providers []T) (normal []T, lastResort []T) {
+	normal = make([]T, 0, len(providers))
+	for _, p := range providers {
+		if isLastResort(p) {
+			lastResort = append(lastResort, p)
+		} else {
+			normal = append(normal, p)
+		}
 	}
+	return normal, lastResort
+}
 
-	for _, provider := range providers {
+// filterProviders 是 FilterProviders 的核心过滤逻辑
+// 每跳过一个 provider 都会调用 onSkip 报告原因，由调用方决定打印或收集
+func filterProviders(
+	providers []Provider,
+	kind string,
+	requestedModel string,
+	blacklistChecker func(kind, name string) (bool, time.Time),
+	modelChecker func(p *Provider, model string) bool,
+	configValidator func(p *Provider) []string,
+	onSkip func(p Provider, reason SkipReason, detail string),
+) []Provider {
+	active := make([]Provider, 0, len(providers))
+
+	for _, p := range providers {
+		// 深拷贝：checker 通过指针访问，结果也可能被调用方缓存，避免与原配置共享 map
+		provider := p.Clone()
 		// 基础过滤：启用状态和配置有效性
-		if !provider.IsEnabled() || !provider.HasValidConfig() {
+		if !provider.IsEnabled() {
+			onSkip(provider, SkipReasonDisabled, "")
+			continue
+		}
+		if !provider.HasValidConfig() {
+			onSkip(provider, SkipReasonInvalidConfig, "APIURL 或 APIKey 为空")
 			continue
 		}
 
 		// 配置验证
 		if configValidator != nil {
 			if errs := configValidator(&provider); len(errs) > 0 {
-				fmt.Printf("[WARN] Provider %s 配置验证失败，已自动跳过: %v\n", provider.Name, errs)
-				result.SkippedCount++
+				onSkip(provider, SkipReasonConfigValidationFailed, fmt.Sprintf("%v", errs))
 				continue
 			}
 		}
 
+		// 声明式模型策略（AllowModels/DenyModels），与 modelChecker 无关，始终生效
+		if requestedModel != "" && !provider.ModelAllowedByPolicy(requestedModel) {
+			onSkip(provider, SkipReasonModelDenied, requestedModel)
+			continue
+		}
+
 		// 模型支持检查
 		if modelChecker != nil && requestedModel != "" {
 			if !modelChecker(&provider, requestedModel) {
-				fmt.Printf("[INFO] Provider %s 不支持模型 %s，已跳过\n", provider.Name, requestedModel)
-				result.SkippedCount++
+				onSkip(provider, SkipReasonModelUnsupported, requestedModel)
 				continue
 			}
 		}
 
 		// 黑名单检查
 		if blacklistChecker != nil {
-			if isBlacklisted, until := blacklistChecker(kind, provider.Name); isBlacklisted {
-				fmt.Printf("⛔ Provider %s 已拉黑，过期时间: %v\n", provider.Name, until.Format("15:04:05"))
-				result.SkippedCount++
+			if isBlacklisted, until := blacklistChecker(kind, provider.BlacklistKey()); isBlacklisted {
+				onSkip(provider, SkipReasonBlacklisted, until.Format("15:04:05"))
 				continue
 			}
 		}
 
-		result.Active = append(result.Active, provider)
+		active = append(active, provider)
 	}
 
-	return result
+	return active
 }
 
 // FilterGeminiProviders 过滤 GeminiProvider 列表
@@ -181,28 +355,51 @@ func FilterGeminiProviders(
 	providers []GeminiProvider,
 	blacklistChecker func(kind, name string) (bool, time.Time),
 ) FilterResult[GeminiProvider] {
-	result := FilterResult[GeminiProvider]{
-		Active: make([]GeminiProvider, 0, len(providers)),
-	}
+	result := FilterResult[GeminiProvider]{TotalInput: len(providers)}
+	result.Active = filterGeminiProviders(providers, blacklistChecker,
+		func(p GeminiProvider, reason SkipReason, detail string) {
+			if reason == SkipReasonBlacklisted {
+				logSkipf("gemini", p.Name, reason, "[Gemini] ⛔ Provider %s 已拉黑，过期时间: %v", p.Name, detail)
+				currentMetrics().IncSkipped("gemini", p.Name, string(reason))
+			}
+			result.addSkip(p.Name, reason, detail)
+		},
+	)
+	return result
+}
+
+// filterGeminiProviders GeminiProvider 过滤的核心逻辑，不输出日志、不上报指标
+// 每个被跳过的 provider 通过 onSkip 回调通知调用方
+func filterGeminiProviders(
+	providers []GeminiProvider,
+	blacklistChecker func(kind, name string) (bool, time.Time),
+	onSkip func(p GeminiProvider, reason SkipReason, detail string),
+) []GeminiProvider {
+	active := make([]GeminiProvider, 0, len(providers))
 
 	for _, provider := range providers {
 		// 基础过滤
-		if !provider.IsEnabled() || !provider.HasValidConfig() {
+		if !provider.IsEnabled() {
+			onSkip(provider, SkipReasonDisabled, "")
+			continue
+		}
+		if !provider.HasValidConfig() {
+			onSkip(provider, SkipReasonInvalidConfig, provider.geminiConfigProblem())
 			continue
 		}
 
 		// 黑名单检查
 		if blacklistChecker != nil {
-			if isBlacklisted, until := blacklistChecker("gemini", provider.Name); isBlacklisted {
-				fmt.Printf("[Gemini] ⛔ Provider %s 已拉黑，过期时间: %v\n", provider.Name, until.Format("15:04:05"))
+			if isBlacklisted, until := blacklistChecker("gemini", provider.BlacklistKey()); isBlacklisted {
+				onSkip(provider, SkipReasonBlacklisted, until.Format("15:04:05"))
 				continue
 			}
 		}
 
-		result.Active = append(result.Active, provider)
+		active = append(active, provider)
 	}
 
-	return result
+	return active
 }
 
 // ============================================================================
@@ -213,6 +410,8 @@ func FilterGeminiProviders(
 type LevelGroup[T ProviderLike] struct {
 	Groups       map[int][]T // Level -> Providers 映射
 	SortedLevels []int       // 排序后的 Level 列表
+
+	order func(T) int // provider 在输入中的原始位置（见 OrderOf）
 }
 
 // GroupByLevel 将 Provider 列表按 Level 分组并排序
@@ -234,6 +433,7 @@ func GroupByLevel[T ProviderLike](providers []T) LevelGroup[T] {
 	return LevelGroup[T]{
 		Groups:       groups,
 		SortedLevels: levels,
+		order:        OrderIndex(providers, func(p T) string { return p.GetName() }),
 	}
 }
 
@@ -245,19 +445,26 @@ func GroupByLevel[T ProviderLike](providers []T) LevelGroup[T] {
 type RoundRobinState struct {
 	mu        sync.Mutex
 	lastStart map[string]string // key: "platform:level" -> value: 上次起始 Provider Name
+
+	successMode   SuccessMode          // 成功后的排序调整模式（见 SetSuccessMode）
+	successWindow time.Duration        // 成功后降权/置顶的持续时长
+	cooledUntil   map[string]time.Time // key: "platform/name" -> value: 降权截止时间
+	pinned        map[string]stickyPin // key: "platform:level" -> value: 置顶的 provider
 }
 
 // NewRoundRobinState 创建轮询状态管理器
 func NewRoundRobinState() *RoundRobinState {
 	return &RoundRobinState{
-		lastStart: make(map[string]string),
+		lastStart:   make(map[string]string),
+		cooledUntil: make(map[string]time.Time),
+		pinned:      make(map[string]stickyPin),
 	}
 }
 
 // Reorder 对 providers 进行轮询排序（泛型版本）
 // 算法：将上次起始的 provider 移到末尾，实现负载均衡
 // 参数:
-//   - platform: 平台标识 (claude/codex/gemini/custom:xxx)
+//   - platform: 平台标识 (claude/codex/gemini/custom:xxx)，多租户场景使用 PlatformKey 构造
 //   - level: 当前 Level
 //   - providers: 同 Level 的 providers 列表
 //   - getName: 获取 provider 名称的函数
@@ -265,7 +472,7 @@ func NewRoundRobinState() *RoundRobinState {
 // 返回：重新排序后的 providers 列表（新切片，不修改原切片）
 func Reorder[T any](
 	rrs *RoundRobinState,
-	platform string,
+	platform Platform,
 	level int,
 	providers []T,
 	getName func(T) string,
@@ -274,33 +481,115 @@ func Reorder[T any](
 		return providers
 	}
 
-	key := fmt.Sprintf("%s:%d", platform, level)
+	key := RoundRobinKey(platform, level)
+
+	rrs.mu.Lock()
+	defer rrs.mu.Unlock()
+
+	// 成功置顶期内暂停轮询：置顶 provider 打头，其余保持原顺序
+	if pinnedResult, ok := applyStickyPin(rrs, key, providers, getName); ok {
+		return pinnedResult
+	}
+
+	result, newStart := ReorderFrom(rrs.lastStart[key], providers, getName)
+
+	// 记录本次起始 provider 名称（成功降权只影响本次顺序，不影响轮询位置）
+	rrs.lastStart[key] = newStart
 
+	return applySuccessCooldown(rrs, string(platform), result, getName)
+}
+
+// Prune 清理指向已删除 provider 的轮询、成功降权与成功置顶记录，保留其余记录
+// 用于配置热更新：未变化的 provider 保持轮询连续性，已删除的 provider 不再残留
+// 参数 validNames 为更新后仍存在的 provider 名称集合；返回被清理的记录数
+func (rrs *RoundRobinState) Prune(validNames map[string]bool) int {
 	rrs.mu.Lock()
 	defer rrs.mu.Unlock()
 
-	lastStart := rrs.lastStart[key]
+	pruned := 0
+	for key, name := range rrs.lastStart {
+		if !validNames[name] {
+			delete(rrs.lastStart, key)
+			pruned++
+		}
+	}
+	for key := range rrs.cooledUntil {
+		// key 为 "platform/name"，platform 不含 "/"
+		if _, name, _ := strings.Cut(key, "/"); !validNames[name] {
+			delete(rrs.cooledUntil, key)
+			pruned++
+		}
+	}
+	for key, pin := range rrs.pinned {
+		if !validNames[pin.name] {
+			delete(rrs.pinned, key)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// Keys 返回当前存在轮询记录的所有 key（"platform:level"），按字典序排序，便于调试
+func (rrs *RoundRobinState) Keys() []string {
+	rrs.mu.Lock()
+	keys := make([]string, 0, len(rrs.lastStart))
+	for key := range rrs.lastStart {
+		keys = append(keys, key)
+	}
+	rrs.mu.Unlock()
+
+	sort.Strings(keys)
+	return keys
+}
 
-	// 记录本次起始 provider 名称
-	rrs.lastStart[key] = getName(providers[0])
+// peek 读取指定 key 的上次起始 provider 名称，不修改状态
+func (rrs *RoundRobinState) peek(key string) string {
+	rrs.mu.Lock()
+	defer rrs.mu.Unlock()
+	return rrs.lastStart[key]
+}
 
-	// 如果没有历史记录，返回原顺序
-	if lastStart == "" {
+// peekReorder 返回 Reorder 此刻会给出的顺序（成功置顶、轮询、成功降权），但不修改任何状态
+// 用于 dry-run（见 ExplainRouting）：不推进轮询位置，也不清理过期的置顶记录
+func peekReorder[T any](rrs *RoundRobinState, platform Platform, level int, providers []T, getName func(T) string) []T {
+	if len(providers) <= 1 {
 		return providers
 	}
 
+	key := RoundRobinKey(platform, level)
+
+	rrs.mu.Lock()
+	defer rrs.mu.Unlock()
+
+	if pinnedResult, ok := stickyPinOrder(rrs, key, providers, getName); ok {
+		return pinnedResult
+	}
+	result, _ := ReorderFrom(rrs.lastStart[key], providers, getName)
+	return applySuccessCooldown(rrs, string(platform), result, getName)
+}
+
+// ReorderFrom 轮询排序的纯函数版本：显式传入上次起始 provider，不读写任何共享状态
+// 从 lastStart 的下一个位置开始环形排列；lastStart 为空或不在列表中时保持原顺序
+// 返回：排序后的 providers（新切片或原切片，不修改原切片）和本次起始 provider 名称
+func ReorderFrom[T any](lastStart string, providers []T, getName func(T) string) ([]T, string) {
+	if len(providers) == 0 {
+		return providers, ""
+	}
+
 	// 查找上次起始 provider 在当前列表中的位置
 	lastIdx := -1
-	for i, p := range providers {
-		if getName(p) == lastStart {
-			lastIdx = i
-			break
+	if lastStart != "" {
+		for i, p := range providers {
+			if getName(p) == lastStart {
+				lastIdx = i
+				break
+			}
 		}
 	}
 
-	// 上次起始 provider 不在当前列表，返回原顺序
+	// 没有历史记录或上次起始 provider 不在当前列表，返回原顺序
 	if lastIdx == -1 {
-		return providers
+		return providers, getName(providers[0])
 	}
 
 	// 构建轮询顺序：从 lastIdx+1 开始，环形遍历
@@ -310,10 +599,37 @@ func Reorder[T any](
 		result[i] = providers[idx]
 	}
 
-	// 更新本次起始 provider 名称
-	rrs.lastStart[key] = getName(result[0])
+	return result, getName(result[0])
+}
 
-	return result
+// SelectProviders 将过滤后的 providers 按 Level 分组、组内轮询排序，展开为可直接用于重试循环的扁平列表
+// 同时适用于 Provider 和 GeminiProvider
+// 参数:
+//   - rrs: 轮询状态（为 nil 时组内保持原顺序）
+//   - platform: 平台标识 (claude/codex/gemini/custom:xxx)
+//   - providers: 已过滤的 providers（FilterProviders/FilterGeminiProviders 的 Active）
+//   - lastResort: 兜底 providers（FilterResult.LastResort），不分组、不轮询，按原顺序追加到末尾
+func SelectProviders[T ProviderLike](rrs *RoundRobinState, platform Platform, providers []T, lastResort ...T) []T {
+	// 混入 providers 中的兜底 provider 同样不参与轮询
+	providers, mixed := splitLastResort(providers)
+	lastResort = append(mixed, lastResort...)
+
+	grouped := GroupByLevel(providers)
+	ordered := make([]T, 0, len(providers)+len(lastResort))
+	for _, level := range grouped.SortedLevels {
+		inLevel := grouped.Groups[level]
+		if rrs != nil {
+			inLevel = Reorder(rrs, platform, level, inLevel, T.GetName)
+		}
+		ordered = append(ordered, inLevel...)
+	}
+	return append(ordered, lastResort...)
+}
+
+// SelectGeminiProviders 对 FilterGeminiProviders 的结果按 Level 分组并轮询排序
+// Gemini 与 Provider 走同一套 GroupByLevel/Reorder 流程，轮询状态 key 为 "gemini:level"
+func SelectGeminiProviders(rrs *RoundRobinState, result FilterResult[GeminiProvider]) []GeminiProvider {
+	return SelectProviders(rrs, PlatformGemini, result.Active, result.LastResort...)
 }
 
 // ============================================================================
@@ -322,14 +638,34 @@ func Reorder[T any](
 
 // RetryContext 重试上下文
 type RetryContext struct {
+	Platform            string        // 平台标识（用于指标上报，可为空）
 	MaxRetryPerProvider int           // 每个 Provider 最大重试次数
 	RetryWaitDuration   time.Duration // 重试等待时间
 	TotalAttempts       int           // 总尝试次数
 	LastError           error         // 最后一次错误
 	LastProvider        string        // 最后尝试的 Provider
 	LastDuration        time.Duration // 最后一次耗时
+	MaxTotalAttempts    int           // 所有 Provider 合计的最大尝试次数，<= 0 表示不限制
+	Deadline            time.Time     // 整个重试序列的截止时间，零值表示不限制
+	MinAttemptTimeout   time.Duration // 单次尝试超时下限（见 AttemptTimeout），<= 0 表示不限制
+	MaxAttemptTimeout   time.Duration // 单次尝试超时上限（见 AttemptTimeout），<= 0 表示不限制
+	FailedProviders     []string      // 失败过的 Provider（去重，按首次失败顺序）
+	Fatal               bool          // 最近一次失败是否为致命错误（见 IsFatal），为 true 时 ShouldContinue 返回 false
+
+	OnFailover  func(from, to string, reason error) // 从失败的 Provider 切换到下一个时回调（见 BeginAttempt），可为 nil
+	OnExhausted func(ctx *RetryContext)             // 所有 Provider 均失败时回调（见 Exhaust），可为 nil
+
+	lastFailed bool // 最近一次尝试是否失败
+	exhausted  bool // OnExhausted 已触发
 }
 
+var (
+	// ErrMaxTotalAttempts 已达到 MaxTotalAttempts 上限
+	ErrMaxTotalAttempts = errors.New("max total attempts reached")
+	// ErrRetryDeadlineExceeded 已超过 Deadline
+	ErrRetryDeadlineExceeded = errors.New("retry deadline exceeded")
+)
+
 // NewRetryContext 创建重试上下文
 func NewRetryContext(failureThreshold int, retryWaitSeconds int) *RetryContext {
 	return &RetryContext{
@@ -343,8 +679,152 @@ func (rc *RetryContext) RecordAttempt(provider string, duration time.Duration, e
 	rc.TotalAttempts++
 	rc.LastProvider = provider
 	rc.LastDuration = duration
+
+	rc.lastFailed = err != nil
+	rc.Fatal = IsFatal(err, 0)
+
+	m := currentMetrics()
+	m.IncSelected(rc.Platform, provider)
 	if err != nil {
 		rc.LastError = err
+		m.IncFailure(rc.Platform, provider)
+		if !slices.Contains(rc.FailedProviders, provider) {
+			rc.FailedProviders = append(rc.FailedProviders, provider)
+		}
+	}
+}
+
+// FillRequestLog 将重试结果写入请求日志：总尝试次数与失败过的 Provider
+// 用于分析故障转移频率以及哪些 provider 拖累了整体可用性
+func (rc *RetryContext) FillRequestLog(requestLog *ReqeustLog) {
+	requestLog.AttemptCount = rc.TotalAttempts
+	requestLog.FailedProviders = strings.Join(rc.FailedProviders, ",")
+}
+
+// SetBudget 以当前时间为起点设置整个重试序列的时间预算，d <= 0 时清除截止时间
+func (rc *RetryContext) SetBudget(d time.Duration) {
+	if d <= 0 {
+		rc.Deadline = time.Time{}
+		return
+	}
+	rc.Deadline = clockNow().Add(d)
+}
+
+// TimeRemaining 返回距截止时间的剩余时间；未设置截止时间时返回 -1（不限制），已过期返回 0
+func (rc *RetryContext) TimeRemaining() time.Duration {
+	if rc.Deadline.IsZero() {
+		return -1
+	}
+	if remaining := rc.Deadline.Sub(clockNow()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Expired 判断是否已超过截止时间
+func (rc *RetryContext) Expired() bool {
+	return rc.TimeRemaining() == 0
+}
+
+// NextBackoff 返回下一次重试前的等待时间，以及等待后是否仍在截止时间内
+// 等待结束时已超过截止时间则返回 false，调用方应直接放弃而不是白白等待
+func (rc *RetryContext) NextBackoff() (time.Duration, bool) {
+	wait := rc.RetryWaitDuration
+	if remaining := rc.TimeRemaining(); remaining >= 0 && wait >= remaining {
+		return wait, false
+	}
+	return wait, true
+}
+
+// AttemptTimeout 返回下一次尝试的超时时间：剩余总预算 / 剩余待尝试的 provider 数
+// 结果按 MinAttemptTimeout / MaxAttemptTimeout 截断，但不会超过剩余总预算；
+// 未设置截止时间时返回 MaxAttemptTimeout（未配置则为 DefaultRequestTimeout）
+// 保证每个 provider 都能分到一份预算，单个卡死的 provider 不会耗尽整个窗口
+func (rc *RetryContext) AttemptTimeout(providersRemaining int) time.Duration {
+	remaining := rc.TimeRemaining()
+	if remaining < 0 {
+		if rc.MaxAttemptTimeout > 0 {
+			return rc.MaxAttemptTimeout
+		}
+		return DefaultRequestTimeout
+	}
+
+	if providersRemaining < 1 {
+		providersRemaining = 1
+	}
+	timeout := remaining / time.Duration(providersRemaining)
+	if rc.MinAttemptTimeout > 0 && timeout < rc.MinAttemptTimeout {
+		timeout = rc.MinAttemptTimeout
+	}
+	if rc.MaxAttemptTimeout > 0 && timeout > rc.MaxAttemptTimeout {
+		timeout = rc.MaxAttemptTimeout
+	}
+	if timeout > remaining {
+		timeout = remaining
+	}
+	return timeout
+}
+
+// CanAttempt 判断是否还能发起新的尝试（不受单 Provider 重试次数影响）
+func (rc *RetryContext) CanAttempt() bool {
+	return rc.MaxTotalAttempts <= 0 || rc.TotalAttempts < rc.MaxTotalAttempts
+}
+
+// ShouldContinue 判断是否应继续尝试下一个 Provider
+// 客户端断开（ctx 被取消或超时）、最近一次为致命错误或达到 MaxTotalAttempts 后返回 false
+// 客户端断开时将取消原因记为 LastError；达到上限时保留最后一次上游错误
+func (rc *RetryContext) ShouldContinue(ctx context.Context) bool {
+	if err := ctx.Err(); err != nil {
+		rc.LastError = err
+		return false
+	}
+	if rc.Fatal {
+		return false
+	}
+	if !rc.CanAttempt() {
+		if rc.LastError == nil {
+			rc.LastError = ErrMaxTotalAttempts
+		}
+		return false
+	}
+	if rc.Expired() {
+		if rc.LastError == nil {
+			rc.LastError = ErrRetryDeadlineExceeded
+		}
+		return false
+	}
+	return true
+}
+
+// WaitRetry 等待 RetryWaitDuration 后返回 true；等待期间 ctx 被取消则立即返回 false
+// 等待会超过 Deadline 时不再等待，直接返回 false
+func (rc *RetryContext) WaitRetry(ctx context.Context) bool {
+	wait, ok := rc.NextBackoff()
+	if !ok {
+		if rc.LastError == nil {
+			rc.LastError = ErrRetryDeadlineExceeded
+		}
+		return false
+	}
+	if !sleepWithContext(ctx, wait) {
+		rc.LastError = ctx.Err()
+		return false
+	}
+	return true
+}
+
+// sleepWithContext 可被取消的 sleep，ctx 被取消时返回 false
+func sleepWithContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
 }
 
@@ -354,6 +834,9 @@ func (rc *RetryContext) RecordAttempt(provider string, duration time.Duration, e
 
 // WriteRequestLog 写入请求日志到数据库
 func WriteRequestLog(requestLog *ReqeustLog) {
+	currentMetrics().ObserveDuration(requestLog.Platform, requestLog.Provider,
+		time.Duration(requestLog.DurationSec*float64(time.Second)))
+
 	if GlobalDBQueueLogs == nil {
 		fmt.Printf("⚠️  写入 request_log 失败: 队列未初始化\n")
 		return
@@ -362,12 +845,18 @@ func WriteRequestLog(requestLog *ReqeustLog) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	attemptCount := requestLog.AttemptCount
+	if attemptCount <= 0 {
+		attemptCount = 1
+	}
+
 	err := GlobalDBQueueLogs.ExecBatchCtx(ctx, `
 		INSERT INTO request_log (
 			platform, model, provider, http_code,
 			input_tokens, output_tokens, cache_create_tokens, cache_read_tokens,
-			reasoning_tokens, is_stream, duration_sec
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			reasoning_tokens, is_stream, duration_sec, attempt_count, failed_providers,
+			api_key_hash, ttfb_sec, response_bytes
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		requestLog.Platform,
 		requestLog.Model,
@@ -380,6 +869,11 @@ func WriteRequestLog(requestLog *ReqeustLog) {
 		requestLog.ReasoningTokens,
 		boolToInt(requestLog.IsStream),
 		requestLog.DurationSec,
+		attemptCount,
+		requestLog.FailedProviders,
+		requestLog.APIKeyHash,
+		requestLog.TimeToFirstByte,
+		requestLog.ResponseBytes,
 	)
 
 	if err != nil {
@@ -392,6 +886,7 @@ func WriteRequestLog(requestLog *ReqeustLog) {
 // ============================================================================
 
 // BuildFailureResponse 构建失败响应
+// 零次尝试且 lastError 为 FilterResult.Err 返回的错误时，输出"未配置 provider"或"全部被过滤"的明确提示
 func BuildFailureResponse(
 	totalAttempts int,
 	lastProvider string,
@@ -403,6 +898,15 @@ func BuildFailureResponse(
 		errorMsg = lastError.Error()
 	}
 
+	if totalAttempts == 0 {
+		switch {
+		case errors.Is(lastError, ErrNoProvidersConfigured):
+			return gin.H{"error": errorMsg, "reason": "no_providers_configured", "totalAttempts": 0}
+		case errors.Is(lastError, ErrAllProvidersFiltered):
+			return gin.H{"error": errorMsg, "reason": "all_providers_filtered", "totalAttempts": 0}
+		}
+	}
+
 	response := gin.H{
 		"error":         fmt.Sprintf("所有 Provider 都失败，最后尝试: %s - %s", lastProvider, errorMsg),
 		"lastProvider":  lastProvider,
@@ -448,7 +952,8 @@ const (
 // "tool_use ids were found without tool_result blocks immediately after"
 //
 // 修复策略：检查最后一条 assistant 消息是否包含 tool_use，
-// 如果有且没有对应的 tool_result，则补充一个包含错误信息的 tool_result
+// 如果有且没有对应的 tool_result，则紧跟其后补充一个包含错误信息的 tool_result（分析逻辑见 repairToolUse）
+// 按 SetToolUseRepairMode 的设置可改为仅告警或完全关闭
 //
 // 参数：
 //   - bodyBytes: 原始请求体 (JSON)
@@ -458,108 +963,67 @@ const (
 //   - 是否进行了修复
 //   - 错误信息 (如果有)
 func FixIncompleteToolUse(bodyBytes []byte) ([]byte, bool, error) {
-	// 获取 messages 数组
-	messages := gjson.GetBytes(bodyBytes, "messages")
-	if !messages.Exists() || !messages.IsArray() {
-		return bodyBytes, false, nil
-	}
-
-	messagesArray := messages.Array()
-	if len(messagesArray) == 0 {
-		return bodyBytes, false, nil
-	}
+	modified, report, err := FixIncompleteToolUseWithReport(bodyBytes)
+	return modified, report != nil, err
+}
 
-	// 从后向前查找最后一条 assistant 消息
-	var lastAssistantIdx int = -1
-	var lastAssistantMsg gjson.Result
-	for i := len(messagesArray) - 1; i >= 0; i-- {
-		msg := messagesArray[i]
-		if msg.Get("role").String() == "assistant" {
-			lastAssistantIdx = i
-			lastAssistantMsg = msg
-			break
-		}
-	}
+// ToolUseFixReport 记录一次 tool_use 修复的详细内容
+type ToolUseFixReport struct {
+	DanglingIDs     []string                 `json:"danglingIds"`     // 未完成的 tool_use ID
+	AssistantIndex  int                      `json:"assistantIndex"`  // 包含 tool_use 的 assistant 消息下标
+	InjectedIndex   int                      `json:"injectedIndex"`   // 补充的 user 消息下标
+	InjectedContent []map[string]interface{} `json:"injectedContent"` // 补充的 tool_result 内容
+}
 
-	// 没有 assistant 消息，无需修复
-	if lastAssistantIdx == -1 {
-		return bodyBytes, false, nil
-	}
+// FixIncompleteToolUseWithReport 与 FixIncompleteToolUse 相同，但返回修复报告
+// 未进行修复时报告为 nil；进行修复时会向审计接收器发送 AuditEventToolUseFixed 事件
+func FixIncompleteToolUseWithReport(bodyBytes []byte) ([]byte, *ToolUseFixReport, error) {
+	return FixIncompleteToolUseWithMode(bodyBytes, CurrentToolUseRepairMode())
+}
 
-	// 检查这条 assistant 消息是否包含 tool_use
-	content := lastAssistantMsg.Get("content")
-	if !content.Exists() || !content.IsArray() {
-		return bodyBytes, false, nil
+// FixIncompleteToolUseWithMode 按指定模式处理未完成的 tool_use，不读取包级设置
+// ToolUseRepairWarn 只打印告警、ToolUseRepairOff 不做检测，两者都原样返回请求体且报告为 nil
+func FixIncompleteToolUseWithMode(bodyBytes []byte, mode ToolUseRepairMode) ([]byte, *ToolUseFixReport, error) {
+	if mode == ToolUseRepairOff {
+		return bodyBytes, nil, nil
 	}
 
-	// 收集所有 tool_use 的 ID
-	var toolUseIDs []string
-	content.ForEach(func(_, item gjson.Result) bool {
-		if item.Get("type").String() == "tool_use" {
-			id := item.Get("id").String()
-			if id != "" {
-				toolUseIDs = append(toolUseIDs, id)
-			}
-		}
-		return true
-	})
-
-	// 没有 tool_use，无需修复
-	if len(toolUseIDs) == 0 {
-		return bodyBytes, false, nil
-	}
-
-	// 检查 assistant 消息之后是否有对应的 tool_result
-	// 正常情况下，assistant 消息后面紧跟一个 user 消息，里面包含 tool_result
-	hasToolResult := false
-	if lastAssistantIdx+1 < len(messagesArray) {
-		nextMsg := messagesArray[lastAssistantIdx+1]
-		if nextMsg.Get("role").String() == "user" {
-			nextContent := nextMsg.Get("content")
-			if nextContent.IsArray() {
-				nextContent.ForEach(func(_, item gjson.Result) bool {
-					if item.Get("type").String() == "tool_result" {
-						hasToolResult = true
-						return false // 找到了就停止
-					}
-					return true
-				})
-			}
+	// 获取 messages 数组
+	messages := gjson.GetBytes(bodyBytes, "messages")
+	if !messages.Exists() || !messages.IsArray() {
+		// OpenAI Responses API 使用 input 数组，tool 调用为 function_call / function_call_output 条目
+		if gjson.GetBytes(bodyBytes, "input").IsArray() {
+			return fixIncompleteFunctionCalls(bodyBytes, mode)
 		}
+		return bodyBytes, nil, nil
 	}
 
-	// 如果已有 tool_result，无需修复
-	if hasToolResult {
-		return bodyBytes, false, nil
+	patches, err := repairToolUse(messages)
+	if err != nil || len(patches) == 0 {
+		return bodyBytes, nil, err
 	}
+	patch := patches[0]
 
-	// 需要修复：构建 tool_result 消息
-	fmt.Printf("⚠️  检测到未完成的 tool_use (IDs: %v)，正在补充 tool_result...\n", toolUseIDs)
-
-	// 构建 tool_result 内容数组
-	toolResults := make([]map[string]interface{}, 0, len(toolUseIDs))
-	for _, id := range toolUseIDs {
-		toolResults = append(toolResults, map[string]interface{}{
-			"type":        "tool_result",
-			"tool_use_id": id,
-			"content":     "工具调用被中断（中转站切换），请重新执行此操作",
-			"is_error":    true,
-		})
+	if mode == ToolUseRepairWarn {
+		fmt.Printf("⚠️  检测到未完成的 tool_use (IDs: %v)，修复模式为仅告警，请求体保持不变\n", patch.DanglingIDs)
+		return bodyBytes, nil, nil
 	}
 
-	// 构建新的 user 消息
-	newUserMsg := map[string]interface{}{
-		"role":    "user",
-		"content": toolResults,
-	}
+	fmt.Printf("⚠️  检测到未完成的 tool_use (IDs: %v)，正在补充 tool_result...\n", patch.DanglingIDs)
 
-	// 使用 sjson 将新消息追加到 messages 数组末尾
-	newIdx := len(messagesArray)
-	modified, err := sjson.SetBytes(bodyBytes, fmt.Sprintf("messages.%d", newIdx), newUserMsg)
+	modified, err := applyPatches(bodyBytes, patches)
 	if err != nil {
-		return bodyBytes, false, fmt.Errorf("补充 tool_result 失败: %w", err)
+		return bodyBytes, nil, fmt.Errorf("补充 tool_result 失败: %w", err)
+	}
+
+	report := &ToolUseFixReport{
+		DanglingIDs:     patch.DanglingIDs,
+		AssistantIndex:  patch.SourceIndex,
+		InjectedIndex:   patch.Index,
+		InjectedContent: patch.Blocks,
 	}
+	emitAudit(AuditEventToolUseFixed, report)
 
-	fmt.Printf("✅ 已补充 %d 个 tool_result，消息历史已修复\n", len(toolUseIDs))
-	return modified, true, nil
+	fmt.Printf("✅ 已补充 %d 个 tool_result，消息历史已修复\n", len(patch.DanglingIDs))
+	return modified, report, nil
 }
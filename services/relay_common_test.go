@@ -0,0 +1,631 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFilterProviders_SkipReasons(t *testing.T) {
+	providers := []Provider{
+		{Name: "ok", APIURL: "https://a", APIKey: "k", Enabled: true},
+		{Name: "off", APIURL: "https://b", APIKey: "k"},
+		{Name: "nourl", APIKey: "k", Enabled: true},
+		{Name: "bad", APIURL: "https://c", APIKey: "k", Enabled: true},
+		{Name: "nomodel", APIURL: "https://d", APIKey: "k", Enabled: true},
+		{Name: "banned", APIURL: "https://e", APIKey: "k", Enabled: true},
+	}
+
+	result := FilterProviders(providers, "claude", "claude-sonnet-4",
+		func(kind, name string) (bool, time.Time) { return name == "banned", time.Now() },
+		func(p *Provider, model string) bool { return p.Name != "nomodel" },
+		func(p *Provider) []string {
+			if p.Name == "bad" {
+				return []string{"broken"}
+			}
+			return nil
+		},
+	)
+
+	if len(result.Active) != 1 || result.Active[0].Name != "ok" {
+		t.Fatalf("Active = %+v, 期望仅 ok", result.Active)
+	}
+	if result.SkippedCount != len(result.Skipped) {
+		t.Errorf("SkippedCount = %d, len(Skipped) = %d", result.SkippedCount, len(result.Skipped))
+	}
+
+	want := []SkipInfo{
+		{Name: "off", Reason: SkipReasonDisabled},
+		{Name: "nourl", Reason: SkipReasonInvalidConfig},
+		{Name: "bad", Reason: SkipReasonConfigValidationFailed},
+		{Name: "nomodel", Reason: SkipReasonModelUnsupported},
+		{Name: "banned", Reason: SkipReasonBlacklisted},
+	}
+	if len(result.Skipped) != len(want) {
+		t.Fatalf("Skipped = %+v, 期望 %d 项", result.Skipped, len(want))
+	}
+	for i, w := range want {
+		got := result.Skipped[i]
+		if got.Name != w.Name || got.Reason != w.Reason {
+			t.Errorf("Skipped[%d] = %s/%s, 期望 %s/%s", i, got.Name, got.Reason, w.Name, w.Reason)
+		}
+	}
+}
+
+func TestFilterResult_EmptyProviders(t *testing.T) {
+	none := FilterProviders(nil, "claude", "", nil, nil, nil)
+	err := none.Err("claude")
+	if !errors.Is(err, ErrNoProvidersConfigured) {
+		t.Fatalf("Err() = %v, 期望 ErrNoProvidersConfigured", err)
+	}
+	resp := BuildFailureResponse(0, "", err, "")
+	if resp["reason"] != "no_providers_configured" || resp["error"] != "no providers configured for kind claude" {
+		t.Errorf("BuildFailureResponse() = %v", resp)
+	}
+
+	filtered := FilterGeminiProviders([]GeminiProvider{{Name: "off"}}, nil)
+	err = filtered.Err("gemini")
+	if !errors.Is(err, ErrAllProvidersFiltered) || filtered.TotalInput != 1 {
+		t.Fatalf("Err() = %v, TotalInput = %d", err, filtered.TotalInput)
+	}
+	if resp := BuildFailureResponse(0, "", err, ""); resp["reason"] != "all_providers_filtered" {
+		t.Errorf("BuildFailureResponse() = %v", resp)
+	}
+
+	// 有尝试时保持原有的失败响应
+	if resp := BuildFailureResponse(2, "p", err, ""); resp["reason"] != nil || resp["lastProvider"] != "p" {
+		t.Errorf("BuildFailureResponse() = %v", resp)
+	}
+
+	ok := FilterGeminiProviders([]GeminiProvider{{Name: "on", Enabled: true, BaseURL: "https://g", APIKey: "k"}}, nil)
+	if err := ok.Err("gemini"); err != nil {
+		t.Errorf("有可用 provider 时 Err() = %v", err)
+	}
+}
+
+func TestFixIncompleteToolUse_Audit(t *testing.T) {
+	var events []AuditEvent
+	SetAuditSink(func(e AuditEvent) { events = append(events, e) })
+	defer SetAuditSink(nil)
+
+	complete := `{"messages": [
+		{"role": "assistant", "content": [{"type": "tool_use", "id": "t1", "name": "bash"}]},
+		{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "t1", "content": "ok"}]}
+	]}`
+	if _, fixed, err := FixIncompleteToolUse([]byte(complete)); err != nil || fixed {
+		t.Fatalf("完整历史不应修复: fixed=%v err=%v", fixed, err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("未修复时不应产生审计事件，实际 %d 条", len(events))
+	}
+
+	dangling := `{"messages": [
+		{"role": "user", "content": "hi"},
+		{"role": "assistant", "content": [{"type": "tool_use", "id": "t1"}, {"type": "tool_use", "id": "t2"}]}
+	]}`
+	if _, fixed, err := FixIncompleteToolUse([]byte(dangling)); err != nil || !fixed {
+		t.Fatalf("应修复未完成的 tool_use: fixed=%v err=%v", fixed, err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("期望 1 条审计事件，实际 %d 条", len(events))
+	}
+
+	event := events[0]
+	if event.Type != AuditEventToolUseFixed {
+		t.Errorf("事件类型 = %s, 期望 %s", event.Type, AuditEventToolUseFixed)
+	}
+	report, ok := event.Detail.(*ToolUseFixReport)
+	if !ok {
+		t.Fatalf("事件详情类型 = %T, 期望 *ToolUseFixReport", event.Detail)
+	}
+	if len(report.DanglingIDs) != 2 || report.DanglingIDs[0] != "t1" || report.DanglingIDs[1] != "t2" {
+		t.Errorf("DanglingIDs = %v", report.DanglingIDs)
+	}
+	if len(report.InjectedContent) != 2 || report.InjectedContent[1]["tool_use_id"] != "t2" {
+		t.Errorf("InjectedContent = %v", report.InjectedContent)
+	}
+	if report.AssistantIndex != 1 || report.InjectedIndex != 2 {
+		t.Errorf("下标错误: assistant=%d injected=%d", report.AssistantIndex, report.InjectedIndex)
+	}
+}
+
+func TestRetryContext_ShouldContinue(t *testing.T) {
+	rc := NewRetryContext(3, 60)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if !rc.ShouldContinue(ctx) {
+		t.Fatal("未取消的 ctx 应继续")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	if rc.WaitRetry(ctx) {
+		t.Fatal("ctx 取消后 WaitRetry 应返回 false")
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("WaitRetry 未及时响应取消，耗时 %v", time.Since(start))
+	}
+	if rc.ShouldContinue(ctx) {
+		t.Error("ctx 取消后不应继续")
+	}
+	if !errors.Is(rc.LastError, context.Canceled) {
+		t.Errorf("LastError = %v, 期望 context.Canceled", rc.LastError)
+	}
+}
+
+func TestReorderFrom(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	id := func(s string) string { return s }
+
+	tests := []struct {
+		name      string
+		lastStart string
+		want      string
+		wantStart string
+	}{
+		{"无历史记录", "", "abc", "a"},
+		{"从 a 之后开始", "a", "bca", "b"},
+		{"从 c 之后环绕", "c", "abc", "a"},
+		{"上次起始已移除", "x", "abc", "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, newStart := ReorderFrom(tt.lastStart, names, id)
+			joined := ""
+			for _, n := range got {
+				joined += n
+			}
+			if joined != tt.want || newStart != tt.wantStart {
+				t.Errorf("ReorderFrom(%q) = %s/%s, 期望 %s/%s", tt.lastStart, joined, newStart, tt.want, tt.wantStart)
+			}
+		})
+	}
+
+	// Reorder 连续调用应与 ReorderFrom 链式调用一致
+	rrs := NewRoundRobinState()
+	last := ""
+	for i := 0; i < 4; i++ {
+		var expected []string
+		expected, last = ReorderFrom(last, names, id)
+		got := Reorder(rrs, "claude", 1, names, id)
+		if got[0] != expected[0] {
+			t.Errorf("第 %d 次: Reorder 起始 = %s, ReorderFrom 起始 = %s", i, got[0], expected[0])
+		}
+	}
+}
+
+func TestTimeoutForLevel(t *testing.T) {
+	SetLevelTimeouts(map[int]time.Duration{1: 30 * time.Second, 3: 10 * time.Minute})
+	defer SetLevelTimeouts(nil)
+
+	if d := TimeoutForLevel(1); d != 30*time.Second {
+		t.Errorf("Level 1 = %v, 期望 30s", d)
+	}
+	if d := TimeoutForLevel(0); d != 30*time.Second {
+		t.Errorf("Level 0 应按默认 Level 1 处理，实际 %v", d)
+	}
+	if d := TimeoutForLevel(2); d != DefaultRequestTimeout {
+		t.Errorf("未配置的 Level 2 = %v, 期望 DefaultRequestTimeout", d)
+	}
+	if d := timeoutForLevelOr(2, DefaultGeminiTimeout); d != DefaultGeminiTimeout {
+		t.Errorf("Gemini 未配置的 Level 2 = %v, 期望 DefaultGeminiTimeout", d)
+	}
+}
+
+func TestTimeoutFor(t *testing.T) {
+	SetLevelTimeouts(map[int]time.Duration{1: 30 * time.Second})
+	defer SetLevelTimeouts(nil)
+
+	tests := []struct {
+		name     string
+		provider ProviderLike
+		want     time.Duration
+	}{
+		{"provider 自身超时优先于 Level", Provider{Level: 1, TimeoutSec: 7200}, 2 * time.Hour},
+		{"未配置时使用 Level 超时", Provider{Level: 1}, 30 * time.Second},
+		{"均未配置时使用默认超时", Provider{Level: 2}, DefaultRequestTimeout},
+		{"Gemini 自身超时", GeminiProvider{Level: 2, TimeoutSec: 60}, time.Minute},
+		{"Gemini 默认超时", GeminiProvider{Level: 2}, DefaultGeminiTimeout},
+		{"Gemini 指针", &GeminiProvider{Level: 2}, DefaultGeminiTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TimeoutFor(tt.provider); got != tt.want {
+				t.Errorf("TimeoutFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 配置文件中以秒为单位
+	var p Provider
+	if err := json.Unmarshal([]byte(`{"name":"batch","level":1,"timeoutSec":90}`), &p); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got := TimeoutFor(p); got != 90*time.Second {
+		t.Errorf("timeoutSec=90 应为 90s, 实际 %v", got)
+	}
+}
+
+func TestSelectProviders(t *testing.T) {
+	gemini := []GeminiProvider{
+		{Name: "g3", Level: 2},
+		{Name: "g1", Level: 1},
+		{Name: "g2", Level: 1},
+	}
+
+	rrs := NewRoundRobinState()
+	first := SelectProviders(rrs, "gemini", gemini)
+	second := SelectProviders(rrs, "gemini", gemini)
+
+	names := func(ps []GeminiProvider) string {
+		out := ""
+		for _, p := range ps {
+			out += p.Name + " "
+		}
+		return out
+	}
+	if got := names(first); got != "g1 g2 g3 " {
+		t.Errorf("第一次 = %s, 期望 g1 g2 g3", got)
+	}
+	if got := names(second); got != "g2 g1 g3 " {
+		t.Errorf("第二次 = %s, 期望 g2 g1 g3（Level 1 轮询）", got)
+	}
+}
+
+func TestLastResortProvider(t *testing.T) {
+	providers := []Provider{
+		{Name: "backup", APIURL: "https://x", APIKey: "k", Enabled: true, LastResort: true},
+		{Name: "a", APIURL: "https://a", APIKey: "k", Enabled: true, Level: 1},
+		{Name: "b", APIURL: "https://b", APIKey: "k", Enabled: true, Level: 2},
+		{Name: "banned-backup", APIURL: "https://y", APIKey: "k", Enabled: true, LastResort: true},
+	}
+	blacklist := func(kind, name string) (bool, time.Time) { return name == "banned-backup", time.Now() }
+
+	result := FilterProviders(providers, "claude", "", blacklist, nil, nil)
+	if len(result.Active) != 2 {
+		t.Fatalf("Active = %+v, 兜底 provider 不应出现在 Active 中", result.Active)
+	}
+	if len(result.LastResort) != 1 || result.LastResort[0].Name != "backup" {
+		t.Fatalf("LastResort = %+v, 期望仅 backup（已拉黑的兜底 provider 应被跳过）", result.LastResort)
+	}
+
+	rrs := NewRoundRobinState()
+	for i := 0; i < 3; i++ {
+		ordered := SelectProviders(rrs, "claude", result.Active, result.LastResort...)
+		if last := ordered[len(ordered)-1]; last.Name != "backup" {
+			t.Errorf("第 %d 次: 末尾 = %s, 期望 backup", i, last.Name)
+		}
+	}
+}
+
+func TestRoundRobinState_Prune(t *testing.T) {
+	rrs := NewRoundRobinState()
+	id := func(s string) string { return s }
+	Reorder(rrs, "claude", 1, []string{"a", "b"}, id)
+	Reorder(rrs, "claude", 2, []string{"gone", "c"}, id)
+
+	if n := rrs.Prune(map[string]bool{"a": true, "b": true, "c": true}); n != 1 {
+		t.Errorf("清理数量 = %d, 期望 1", n)
+	}
+	if last := rrs.peek("claude:1"); last != "a" {
+		t.Errorf("未变化的记录被清理: claude:1 = %q", last)
+	}
+	if last := rrs.peek("claude:2"); last != "" {
+		t.Errorf("已删除 provider 的记录应被清理: claude:2 = %q", last)
+	}
+
+	// 成功降权记录
+	rrs.SetSuccessMode(SuccessCooldown, time.Minute)
+	rrs.RecordSuccess("claude", 1, "a")
+	rrs.RecordSuccess("claude", 2, "gone")
+	if n := rrs.Prune(map[string]bool{"a": true, "b": true, "c": true}); n != 1 {
+		t.Errorf("降权记录清理数量 = %d, 期望 1", n)
+	}
+	if _, ok := rrs.cooledUntil["claude/a"]; !ok {
+		t.Error("仍存在的 provider 的降权记录被清理")
+	}
+	if _, ok := rrs.cooledUntil["claude/gone"]; ok {
+		t.Error("已删除 provider 的降权记录应被清理")
+	}
+
+	// 成功置顶记录
+	rrs.SetSuccessMode(StickyAfterSuccess, time.Minute)
+	rrs.RecordSuccess("claude", 1, "a")
+	rrs.RecordSuccess("claude", 2, "gone")
+	if n := rrs.Prune(map[string]bool{"a": true, "b": true, "c": true}); n != 1 {
+		t.Errorf("置顶记录清理数量 = %d, 期望 1", n)
+	}
+	if pin, ok := rrs.pinned["claude:1"]; !ok || pin.name != "a" {
+		t.Errorf("仍存在的 provider 的置顶记录被清理: %+v", pin)
+	}
+	if _, ok := rrs.pinned["claude:2"]; ok {
+		t.Error("已删除 provider 的置顶记录应被清理")
+	}
+}
+
+func TestRoundRobinState_SeedKey(t *testing.T) {
+	id := func(s string) string { return s }
+	providers := []string{"a", "b", "c"}
+
+	// 线上：记录每次排序前的 lastStart
+	live := NewRoundRobinState()
+	key := RoundRobinKey(PlatformClaude, 1)
+	Reorder(live, PlatformClaude, 1, providers, id)
+	seen := live.LastStart(key)
+	want := Reorder(live, PlatformClaude, 1, providers, id)
+
+	// 回放：用记录的 lastStart 预置状态后得到相同顺序
+	replay := NewRoundRobinState()
+	replay.SeedKey(key, seen)
+	if got := Reorder(replay, PlatformClaude, 1, providers, id); !slices.Equal(got, want) {
+		t.Errorf("回放顺序 = %v, 线上 = %v", got, want)
+	}
+	if got, _ := ReorderFrom(seen, providers, id); !slices.Equal(got, want) {
+		t.Errorf("ReorderFrom 顺序 = %v, 线上 = %v", got, want)
+	}
+
+	replay.SeedKey(key, "")
+	if last := replay.LastStart(key); last != "" {
+		t.Errorf("空 lastStart 应清除记录, 实际 %q", last)
+	}
+}
+
+func TestSelectGeminiProviders_Levels(t *testing.T) {
+	providers := []GeminiProvider{
+		{Name: "g2", BaseURL: "https://b", APIKey: "k", Enabled: true, Level: 2},
+		{Name: "g1a", BaseURL: "https://a", APIKey: "k", Enabled: true, Level: 1},
+		{Name: "g1b", BaseURL: "https://a", AllowKeyless: true, Enabled: true},
+	}
+	rrs := NewRoundRobinState()
+	result := FilterGeminiProviders(providers, nil)
+
+	first := SelectGeminiProviders(rrs, result)
+	second := SelectGeminiProviders(rrs, result)
+
+	names := func(ps []GeminiProvider) []string {
+		out := make([]string, len(ps))
+		for i, p := range ps {
+			out[i] = p.Name
+		}
+		return out
+	}
+	if got := names(first); got[0] != "g1a" || got[1] != "g1b" || got[2] != "g2" {
+		t.Errorf("第一次选择 = %v, 期望 [g1a g1b g2]", got)
+	}
+	if got := names(second); got[0] != "g1b" || got[1] != "g1a" || got[2] != "g2" {
+		t.Errorf("第二次选择应在 Level 1 内轮询 = %v, 期望 [g1b g1a g2]", got)
+	}
+}
+
+func TestDetectRequestedModel(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		path  string
+		query map[string]string
+		want  string
+	}{
+		{"请求体优先", `{"model":"claude-3"}`, "/v1beta/models/gemini-pro:generateContent", nil, "claude-3"},
+		{"Gemini 路径", `{"contents":[]}`, "/v1beta/models/gemini-2.5-pro:streamGenerateContent", nil, "gemini-2.5-pro"},
+		{"查询参数", `{}`, "/v1/chat", map[string]string{"model": "gemini-flash"}, "gemini-flash"},
+		{"均未提供", `{}`, "/v1/messages", map[string]string{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectRequestedModel([]byte(tt.body), tt.path, tt.query); got != tt.want {
+				t.Errorf("detectRequestedModel() = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryContext_MaxTotalAttempts(t *testing.T) {
+	rc := NewRetryContext(3, 0)
+	rc.MaxTotalAttempts = 2
+	ctx := context.Background()
+
+	upstreamErr := errors.New("upstream 500")
+	for i := 0; i < 2; i++ {
+		if !rc.ShouldContinue(ctx) {
+			t.Fatalf("第 %d 次尝试前不应停止", i+1)
+		}
+		rc.RecordAttempt("p", time.Millisecond, upstreamErr)
+	}
+
+	if rc.CanAttempt() {
+		t.Error("达到上限后 CanAttempt 应返回 false")
+	}
+	if rc.ShouldContinue(ctx) {
+		t.Error("达到上限后 ShouldContinue 应返回 false")
+	}
+	if rc.LastError != upstreamErr {
+		t.Errorf("应保留最后一次上游错误，实际 %v", rc.LastError)
+	}
+
+	unlimited := NewRetryContext(1, 0)
+	unlimited.TotalAttempts = 1000
+	if !unlimited.CanAttempt() {
+		t.Error("MaxTotalAttempts 为 0 时不应限制")
+	}
+}
+
+func TestRetryContext_Deadline(t *testing.T) {
+	rc := NewRetryContext(3, 1)
+	if rc.TimeRemaining() != -1 || rc.Expired() {
+		t.Fatal("未设置截止时间时不应过期")
+	}
+	if _, ok := rc.NextBackoff(); !ok {
+		t.Error("未设置截止时间时不应跳过等待")
+	}
+
+	rc.SetBudget(100 * time.Millisecond)
+	if _, ok := rc.NextBackoff(); ok {
+		t.Error("等待 1s 会超过截止时间，应跳过")
+	}
+	start := time.Now()
+	if rc.WaitRetry(context.Background()) {
+		t.Error("超过截止时间的等待应返回 false")
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Error("不应实际等待")
+	}
+	if !errors.Is(rc.LastError, ErrRetryDeadlineExceeded) {
+		t.Errorf("LastError = %v", rc.LastError)
+	}
+
+	rc.Deadline = time.Now().Add(-time.Second)
+	if !rc.Expired() || rc.TimeRemaining() != 0 {
+		t.Error("截止时间已过应返回过期")
+	}
+	if rc.ShouldContinue(context.Background()) {
+		t.Error("过期后 ShouldContinue 应返回 false")
+	}
+}
+
+func TestRetryContext_AttemptTimeout(t *testing.T) {
+	rc := NewRetryContext(3, 1)
+	if got := rc.AttemptTimeout(3); got != DefaultRequestTimeout {
+		t.Errorf("未设置截止时间 = %v, 期望 DefaultRequestTimeout", got)
+	}
+	rc.MaxAttemptTimeout = 30 * time.Second
+	if got := rc.AttemptTimeout(3); got != 30*time.Second {
+		t.Errorf("未设置截止时间 = %v, 期望上限 30s", got)
+	}
+
+	// within 判断 got 是否在 want 之下 1s 内（测试运行耗时会略微减少剩余预算）
+	within := func(got, want time.Duration) bool {
+		return got <= want && got > want-time.Second
+	}
+
+	rc.MaxAttemptTimeout = 0
+	rc.SetBudget(60 * time.Second)
+	tests := []struct {
+		name      string
+		min, max  time.Duration
+		remaining int
+		want      time.Duration
+	}{
+		{"平均分配", 0, 0, 3, 20 * time.Second},
+		{"剩余数非法按 1 处理", 0, 0, 0, 60 * time.Second},
+		{"低于下限取下限", 30 * time.Second, 0, 6, 30 * time.Second},
+		{"高于上限取上限", 0, 10 * time.Second, 2, 10 * time.Second},
+		{"下限不超过剩余预算", 90 * time.Second, 0, 2, 60 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc.MinAttemptTimeout, rc.MaxAttemptTimeout = tt.min, tt.max
+			if got := rc.AttemptTimeout(tt.remaining); !within(got, tt.want) {
+				t.Errorf("AttemptTimeout(%d) = %v, 期望约 %v", tt.remaining, got, tt.want)
+			}
+		})
+	}
+
+	rc.Deadline = time.Now().Add(-time.Second)
+	if got := rc.AttemptTimeout(1); got != 0 {
+		t.Errorf("已过期 = %v, 期望 0", got)
+	}
+}
+
+func TestRetryContext_FillRequestLog(t *testing.T) {
+	rc := NewRetryContext(3, 0)
+	rc.RecordAttempt("a", time.Millisecond, errors.New("upstream status 500"))
+	rc.RecordAttempt("a", time.Millisecond, errors.New("upstream status 500"))
+	rc.RecordAttempt("b", time.Millisecond, errors.New("upstream status 429"))
+	rc.RecordAttempt("c", time.Millisecond, nil)
+
+	var log ReqeustLog
+	rc.FillRequestLog(&log)
+	if log.AttemptCount != 4 || log.FailedProviders != "a,b" {
+		t.Errorf("AttemptCount = %d, FailedProviders = %q", log.AttemptCount, log.FailedProviders)
+	}
+}
+
+func TestGroupByLevel_MockProvider(t *testing.T) {
+	providers := []MockProvider{
+		{Name: "b", Level: 2},
+		{Name: "a", Level: 1},
+		{Name: "c", Level: 2},
+		{Name: "z", LastResort: true, Level: 1},
+	}
+
+	grouped := GroupByLevel(providers)
+	if len(grouped.SortedLevels) != 2 || grouped.SortedLevels[0] != 1 || grouped.SortedLevels[1] != 2 {
+		t.Fatalf("SortedLevels = %v", grouped.SortedLevels)
+	}
+	if len(grouped.Groups[2]) != 2 || grouped.Groups[2][0].Name != "b" {
+		t.Errorf("Level 2 = %v", grouped.Groups[2])
+	}
+
+	ordered := SelectProviders(nil, "mock", providers)
+	if last := ordered[len(ordered)-1]; last.Name != "z" {
+		t.Errorf("兜底 provider 应排在最后，实际 %v", ordered)
+	}
+}
+
+func TestReadRequestBody_RepeatedValues(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost,
+		"/v1beta/models/gemini-pro:generateContent?safety=a&safety=b&key=k", strings.NewReader(`{}`))
+	c.Request.Header.Add("X-Tag", "one")
+	c.Request.Header.Add("X-Tag", "two")
+	c.Request.Header.Add("Cookie", "a=1")
+	c.Request.Header.Add("Cookie", "b=2")
+
+	rc, err := ReadRequestBody(c)
+	if err != nil {
+		t.Fatalf("ReadRequestBody() error = %v", err)
+	}
+	defer rc.Release()
+
+	if got := rc.QueryValues["safety"]; !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("QueryValues[safety] = %v, want [a b]", got)
+	}
+	if rc.Query["safety"] != "b" {
+		t.Errorf("Query[safety] = %q, want b", rc.Query["safety"])
+	}
+	if got := rc.HeaderValues.Values("X-Tag"); !slices.Equal(got, []string{"one", "two"}) {
+		t.Errorf("HeaderValues[X-Tag] = %v, want [one two]", got)
+	}
+	if rc.ClientHeaders["X-Tag"] != "one, two" {
+		t.Errorf("ClientHeaders[X-Tag] = %q, want %q", rc.ClientHeaders["X-Tag"], "one, two")
+	}
+	if rc.ClientHeaders["Cookie"] != "a=1; b=2" {
+		t.Errorf("ClientHeaders[Cookie] = %q, want %q", rc.ClientHeaders["Cookie"], "a=1; b=2")
+	}
+}
+
+func TestAppendQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		values url.Values
+		want   string
+	}{
+		{"无参数", "https://a/v1/messages", nil, "https://a/v1/messages"},
+		{"重复 key 保留全部值", "https://a/v1/messages", url.Values{"s": {"1", "2"}, "b": {"x"}}, "https://a/v1/messages?b=x&s=1&s=2"},
+		{"已有查询参数", "https://a/v1/messages?beta=true", url.Values{"s": {"1"}}, "https://a/v1/messages?beta=true&s=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := appendQuery(tt.target, tt.values); got != tt.want {
+				t.Errorf("appendQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// ============================================================================
+// 配置顺序（多键排序的稳定兜底）
+// ============================================================================
+
+// OrderIndex 记录 providers 在输入（通常是配置文件）中的原始位置，返回按名称查询位置的函数
+// 同名 provider 取第一次出现的位置；不在输入中的 provider 返回 math.MaxInt，排在最后
+// 轮询等排序会打乱组内顺序，用返回的函数作为比较的最后一个键，可在任意排序后恢复"配置顺序"兜底
+func OrderIndex[T any](providers []T, getName func(T) string) func(T) int {
+	index := make(map[string]int, len(providers))
+	for i, p := range providers {
+		name := getName(p)
+		if _, ok := index[name]; !ok {
+			index[name] = i
+		}
+	}
+	return func(p T) int {
+		if i, ok := index[getName(p)]; ok {
+			return i
+		}
+		return math.MaxInt
+	}
+}
+
+// OrderOf 返回 provider 在 GroupByLevel 输入中的原始位置，不在输入中时返回 math.MaxInt
+func (g LevelGroup[T]) OrderOf(p T) int {
+	if g.order == nil {
+		return math.MaxInt
+	}
+	return g.order(p)
+}
+
+// ReorderByKey 按 key 从小到大排序（如延迟），key 相同时按 getOrder 的原始位置排序
+// getOrder 为 nil 时 key 相同的保持输入顺序；不修改原切片
+func ReorderByKey[T any, K cmp.Ordered](providers []T, key func(T) K, getOrder func(T) int) []T {
+	if len(providers) <= 1 {
+		return providers
+	}
+	result := slices.Clone(providers)
+	slices.SortStableFunc(result, ThenByOrder(func(a, b T) int {
+		return cmp.Compare(key(a), key(b))
+	}, getOrder))
+	return result
+}
+
+// ThenByOrder 组合比较函数：compare 相等时按 getOrder 的原始位置比较，使多键排序的结果确定
+// getOrder 为 nil 时直接返回 compare
+func ThenByOrder[T any](compare func(a, b T) int, getOrder func(T) int) func(a, b T) int {
+	if getOrder == nil {
+		return compare
+	}
+	return func(a, b T) int {
+		if c := compare(a, b); c != 0 {
+			return c
+		}
+		return cmp.Compare(getOrder(a), getOrder(b))
+	}
+}
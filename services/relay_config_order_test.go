@@ -0,0 +1,61 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestReorderByKey(t *testing.T) {
+	config := []Provider{
+		{Name: "a", Level: 1},
+		{Name: "b", Level: 1},
+		{Name: "c", Level: 1},
+		{Name: "d", Level: 1},
+	}
+	latency := map[string]int{"a": 200, "b": 100, "c": 200, "d": 200}
+	group := GroupByLevel(config)
+	// 轮询后的组内顺序：d, a, b, c
+	rotated := []Provider{config[3], config[0], config[1], config[2]}
+	names := func(ps []Provider) string {
+		out := make([]string, len(ps))
+		for i, p := range ps {
+			out[i] = p.Name
+		}
+		return strings.Join(out, ",")
+	}
+	byLatency := func(p Provider) int { return latency[p.Name] }
+
+	tests := []struct {
+		name     string
+		getOrder func(Provider) int
+		want     string
+	}{
+		{"相同延迟按配置顺序", group.OrderOf, "b,a,c,d"},
+		{"独立记录配置顺序", OrderIndex(config, Provider.GetName), "b,a,c,d"},
+		{"未提供原始位置时保持输入顺序", nil, "b,d,a,c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(ReorderByKey(rotated, byLatency, tt.getOrder)); got != tt.want {
+				t.Errorf("ReorderByKey() = %s, 期望 %s", got, tt.want)
+			}
+		})
+	}
+	if got := names(rotated); got != "d,a,b,c" {
+		t.Errorf("不应修改原切片, got %s", got)
+	}
+}
+
+func TestOrderIndex(t *testing.T) {
+	getOrder := OrderIndex([]Provider{{Name: "a"}, {Name: "b"}, {Name: "a"}}, Provider.GetName)
+	if got := getOrder(Provider{Name: "a"}); got != 0 {
+		t.Errorf("同名 provider 应取第一次出现的位置, got %d", got)
+	}
+	if got := getOrder(Provider{Name: "x"}); got != math.MaxInt {
+		t.Errorf("不在输入中的 provider 应排在最后, got %d", got)
+	}
+	if got := (LevelGroup[Provider]{}).OrderOf(Provider{Name: "a"}); got != math.MaxInt {
+		t.Errorf("零值 LevelGroup 的 OrderOf = %d", got)
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============================================================================
+// 一致性哈希选择器
+// ============================================================================
+
+// DefaultVirtualNodes 每个 provider 在哈希环上的默认虚拟节点数
+const DefaultVirtualNodes = 100
+
+// ConsistentHashSelector 按请求的会话键在哈希环上选择 provider，使同一会话固定命中同一 provider（提升上游缓存命中率）
+// 返回顺序为从会话键位置顺时针遍历哈希环遇到的 provider，失败降级时同样稳定；兜底 provider 始终追加在末尾
+// provider 增减时只有落在变化区间的会话会被重新分配
+type ConsistentHashSelector struct {
+	VirtualNodes int                              // 每个 provider 的虚拟节点数，<= 0 时使用 DefaultVirtualNodes
+	KeyFunc      func(ctx *RequestContext) string // 会话键提取函数，为 nil 时使用 DefaultSessionKey
+	Fallback     Selector                         // 会话键为空时使用的选择器，为 nil 时保持原顺序
+
+	mu      sync.Mutex
+	ringKey string     // 当前哈希环对应的 provider 名称集合
+	ring    []ringNode // 按 hash 排序的虚拟节点
+}
+
+type ringNode struct {
+	hash uint64
+	name string
+}
+
+// Select 实现 Selector 接口
+func (s *ConsistentHashSelector) Select(providers []ProviderLike, ctx *RequestContext) []ProviderLike {
+	normal, lastResort := splitLastResort(providers)
+	if len(normal) <= 1 {
+		return append(normal, lastResort...)
+	}
+
+	keyFunc := s.KeyFunc
+	if keyFunc == nil {
+		keyFunc = DefaultSessionKey
+	}
+	key := ""
+	if ctx != nil {
+		key = keyFunc(ctx)
+	}
+	if key == "" {
+		if s.Fallback != nil {
+			return s.Fallback.Select(providers, ctx)
+		}
+		return append(normal, lastResort...)
+	}
+
+	byName := make(map[string]ProviderLike, len(normal))
+	for _, p := range normal {
+		byName[p.GetName()] = p
+	}
+
+	ring := s.ringFor(normal)
+	h := hashString(key)
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+
+	ordered := make([]ProviderLike, 0, len(providers))
+	seen := make(map[string]bool, len(normal))
+	for i := 0; i < len(ring) && len(seen) < len(byName); i++ {
+		node := ring[(start+i)%len(ring)]
+		if seen[node.name] {
+			continue
+		}
+		seen[node.name] = true
+		ordered = append(ordered, byName[node.name])
+	}
+	return append(ordered, lastResort...)
+}
+
+// ringFor 返回 providers 对应的哈希环，provider 集合不变时复用缓存
+func (s *ConsistentHashSelector) ringFor(providers []ProviderLike) []ringNode {
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		names = append(names, p.GetName())
+	}
+	sort.Strings(names)
+	ringKey := strings.Join(names, "\x00")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ring != nil && s.ringKey == ringKey {
+		return s.ring
+	}
+
+	vnodes := s.VirtualNodes
+	if vnodes <= 0 {
+		vnodes = DefaultVirtualNodes
+	}
+	ring := make([]ringNode, 0, len(names)*vnodes)
+	for _, name := range names {
+		for i := 0; i < vnodes; i++ {
+			ring = append(ring, ringNode{hash: hashString(name + "#" + strconv.Itoa(i)), name: name})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	s.ringKey, s.ring = ringKey, ring
+	return ring
+}
+
+// DefaultSessionKey 默认会话键：系统提示词 + 第一条用户消息的哈希
+// 同一会话的后续请求这两部分保持不变，可作为会话标识；两者都不存在时返回空
+func DefaultSessionKey(ctx *RequestContext) string {
+	body := ctx.BodyBytes
+	system := gjson.GetBytes(body, "system").Raw
+	if system == "" {
+		system = gjson.GetBytes(body, "instructions").Raw // OpenAI Responses API
+	}
+
+	var firstUser string
+	for _, msg := range gjson.GetBytes(body, "messages").Array() {
+		switch msg.Get("role").String() {
+		case "system", "developer":
+			if system == "" {
+				system = msg.Get("content").Raw
+			}
+		case "user":
+			if firstUser == "" {
+				firstUser = msg.Get("content").Raw
+			}
+		}
+	}
+
+	if system == "" && firstUser == "" {
+		return ""
+	}
+	return strconv.FormatUint(hashString(system+"\x00"+firstUser), 16)
+}
+
+// hashString 计算 64 位 FNV-1a 哈希
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum64()
+}
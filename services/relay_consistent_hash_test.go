@@ -0,0 +1,59 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConsistentHashSelector(t *testing.T) {
+	providers := toProviderLikes([]MockProvider{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "z", LastResort: true}})
+	selector := &ConsistentHashSelector{}
+	ctxFor := func(user string) *RequestContext {
+		return &RequestContext{BodyBytes: []byte(fmt.Sprintf(`{"system":"s","messages":[{"role":"user","content":%q}]}`, user))}
+	}
+
+	t.Run("同一会话固定命中", func(t *testing.T) {
+		first := selector.Select(providers, ctxFor("hello"))
+		for i := 0; i < 5; i++ {
+			again := selector.Select(providers, ctxFor("hello"))
+			if again[0].GetName() != first[0].GetName() {
+				t.Fatalf("同一会话选择不稳定: %s != %s", again[0].GetName(), first[0].GetName())
+			}
+		}
+		if len(first) != 4 || first[3].GetName() != "z" {
+			t.Errorf("应包含全部 provider 且兜底在末尾: %v", first)
+		}
+	})
+
+	t.Run("移除 provider 只影响其上的会话", func(t *testing.T) {
+		reduced := toProviderLikes([]MockProvider{{Name: "a"}, {Name: "b"}})
+		moved := 0
+		for i := 0; i < 200; i++ {
+			ctx := ctxFor(fmt.Sprintf("user-%d", i))
+			before := selector.Select(providers, ctx)[0].GetName()
+			after := selector.Select(reduced, ctx)[0].GetName()
+			if before != "c" && before != after {
+				moved++
+			}
+		}
+		if moved != 0 {
+			t.Errorf("未落在被移除 provider 上的会话被重新分配了 %d 个", moved)
+		}
+	})
+
+	t.Run("无会话键保持原顺序", func(t *testing.T) {
+		got := selector.Select(providers, &RequestContext{BodyBytes: []byte(`{}`)})
+		if got[0].GetName() != "a" || got[1].GetName() != "b" {
+			t.Errorf("原顺序被修改: %v", got)
+		}
+	})
+
+	t.Run("自定义会话键", func(t *testing.T) {
+		custom := &ConsistentHashSelector{KeyFunc: func(*RequestContext) string { return "tenant-1" }}
+		a := custom.Select(providers, &RequestContext{})
+		b := custom.Select(providers, &RequestContext{})
+		if a[0].GetName() != b[0].GetName() {
+			t.Error("相同自定义键应命中同一 provider")
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============================================================================
+// 输入 token 预估与上下文上限
+// ============================================================================
+
+const (
+	// estimatedTokensPerMessage 每条消息的结构开销（角色、分隔符等）
+	estimatedTokensPerMessage = 4
+	// estimatedTokensPerImage 每张图片按固定 token 数计算，base64 数据本身不计入
+	estimatedTokensPerImage = 1600
+)
+
+// promptPaths 各格式中构成输入上下文的字段，格式未知时统计整个请求体
+var promptPaths = map[Format][]string{
+	FormatClaude:          {"system", "messages", "tools"},
+	FormatOpenAI:          {"messages", "tools", "functions"},
+	FormatOpenAIResponses: {"instructions", "input", "tools"},
+	FormatGemini:          {"systemInstruction", "contents", "tools"},
+}
+
+// messagePaths 各格式中的消息列表字段（用于计算每条消息的结构开销）
+var messagePaths = map[Format]string{
+	FormatClaude:          "messages",
+	FormatOpenAI:          "messages",
+	FormatOpenAIResponses: "input",
+	FormatGemini:          "contents",
+}
+
+// EstimateInputTokens 粗略估算请求的输入 token 数（偏保守，用于拦截明显超出上下文的请求，不追求精确）
+// 规则：ASCII 字符按 4 个一个 token、非 ASCII 字符（如中文）每个按 1 个 token 计，
+// 每条消息额外计 estimatedTokensPerMessage，图片按 estimatedTokensPerImage 计（base64 数据不计字符）
+// 请求体不是合法 JSON 时按整体字节数 / 4 估算
+func EstimateInputTokens(bodyBytes []byte, format Format) int {
+	if !gjson.ValidBytes(bodyBytes) {
+		return (len(bodyBytes) + 3) / 4
+	}
+
+	root := gjson.ParseBytes(bodyBytes)
+	var est tokenEstimator
+	if paths, ok := promptPaths[format]; ok {
+		for _, path := range paths {
+			est.walk("", root.Get(path))
+		}
+	} else {
+		est.walk("", root)
+	}
+
+	tokens := est.tokens()
+	if path, ok := messagePaths[format]; ok {
+		tokens += int(root.Get(path+".#").Int()) * estimatedTokensPerMessage
+	}
+	return tokens
+}
+
+// tokenEstimator 累计字符数与图片数
+type tokenEstimator struct {
+	asciiChars int
+	otherChars int
+	images     int
+}
+
+func (e *tokenEstimator) walk(key string, value gjson.Result) {
+	switch {
+	case value.IsObject() || value.IsArray():
+		value.ForEach(func(k, v gjson.Result) bool {
+			e.walk(k.String(), v)
+			return true
+		})
+	case value.Type == gjson.String:
+		s := value.String()
+		if isImagePayload(key, s) {
+			e.images++
+			return
+		}
+		e.count(s)
+	case value.Exists():
+		e.count(value.Raw)
+	}
+	if key != "" {
+		e.count(key)
+	}
+}
+
+func (e *tokenEstimator) count(s string) {
+	for i := 0; i < len(s); {
+		if s[i] < utf8.RuneSelf {
+			e.asciiChars++
+			i++
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		e.otherChars++
+		i += size
+	}
+}
+
+func (e *tokenEstimator) tokens() int {
+	return (e.asciiChars+3)/4 + e.otherChars + e.images*estimatedTokensPerImage
+}
+
+// isImagePayload 判断字符串是否为内联图片数据（Claude/Gemini 的 base64 data 字段、OpenAI 的 data URL）
+func isImagePayload(key, value string) bool {
+	return key == "data" || strings.HasPrefix(value, "data:image/")
+}
+
+// GetMaxContextTokens 返回上下文 token 上限，0 表示不限制
+func (p Provider) GetMaxContextTokens() int { return p.MaxContextTokens }
+
+// FitsContext 预估 token 数是否在上下文上限内（未配置上限时始终为 true）
+func (p Provider) FitsContext(estimatedTokens int) bool {
+	return p.MaxContextTokens <= 0 || estimatedTokens <= p.MaxContextTokens
+}
+
+// contextLimitedProvider 声明了上下文上限的 provider
+type contextLimitedProvider interface {
+	GetMaxContextTokens() int
+}
+
+// ApplyContextLimit 将上下文上限小于预估 token 数的 Active / LastResort providers 移入 Skipped（SkipReasonContextTooLarge）
+// 全部被过滤时 Active 为空：请求放不进任何 provider，转发也只会失败
+func (r *FilterResult[T]) ApplyContextLimit(estimatedTokens int) {
+	r.Active = r.filterByContext(r.Active, estimatedTokens)
+	r.LastResort = r.filterByContext(r.LastResort, estimatedTokens)
+}
+
+func (r *FilterResult[T]) filterByContext(providers []T, estimatedTokens int) []T {
+	if providers == nil {
+		return nil
+	}
+	kept := make([]T, 0, len(providers))
+	for _, p := range providers {
+		if cp, ok := any(p).(contextLimitedProvider); ok {
+			if limit := cp.GetMaxContextTokens(); limit > 0 && estimatedTokens > limit {
+				r.addSkip(p.GetName(), SkipReasonContextTooLarge, fmt.Sprintf("%d > %d", estimatedTokens, limit))
+				continue
+			}
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
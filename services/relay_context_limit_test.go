@@ -0,0 +1,65 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimateInputTokens(t *testing.T) {
+	longText := strings.Repeat("a", 4000)
+	image := strings.Repeat("A", 100000)
+
+	tests := []struct {
+		name     string
+		body     string
+		format   Format
+		min, max int
+	}{
+		{"Claude 文本", `{"model":"m","system":"` + longText + `","messages":[{"role":"user","content":"hi"}]}`, FormatClaude, 1000, 1100},
+		{"非 ASCII 按字符计", `{"messages":[{"role":"user","content":"` + strings.Repeat("你", 500) + `"}]}`, FormatOpenAI, 500, 560},
+		{"图片不按 base64 长度计",
+			`{"messages":[{"role":"user","content":[{"type":"image","source":{"type":"base64","data":"` + image + `"}}]}]}`,
+			FormatClaude, estimatedTokensPerImage, estimatedTokensPerImage + 50},
+		{"OpenAI data URL",
+			`{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,` + image + `"}}]}]}`,
+			FormatOpenAI, estimatedTokensPerImage, estimatedTokensPerImage + 50},
+		{"Gemini contents", `{"contents":[{"parts":[{"text":"` + longText + `"}]}]}`, FormatGemini, 1000, 1050},
+		{"不统计非上下文字段", `{"metadata":"` + longText + `","input":"hi"}`, FormatOpenAIResponses, 0, 10},
+		{"格式未知时统计整个请求体", `{"metadata":"` + longText + `"}`, "", 1000, 1010},
+		{"非法 JSON 按字节数估算", longText, FormatClaude, 1000, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EstimateInputTokens([]byte(tt.body), tt.format)
+			if got < tt.min || got > tt.max {
+				t.Errorf("EstimateInputTokens() = %d, want [%d, %d]", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestFilterResult_ApplyContextLimit(t *testing.T) {
+	providers := []Provider{
+		{Name: "small", APIURL: "https://a", APIKey: "k", Enabled: true, MaxContextTokens: 1000},
+		{Name: "large", APIURL: "https://a", APIKey: "k", Enabled: true, MaxContextTokens: 200000},
+		{Name: "unlimited", APIURL: "https://a", APIKey: "k", Enabled: true},
+		{Name: "fallback", APIURL: "https://a", APIKey: "k", Enabled: true, LastResort: true, MaxContextTokens: 500},
+	}
+
+	result := FilterProviders(providers, "claude", "", nil, nil, nil)
+	result.ApplyContextLimit(5000)
+
+	if len(result.Active) != 2 || result.Active[0].Name != "large" || result.Active[1].Name != "unlimited" {
+		t.Errorf("Active = %+v", result.Active)
+	}
+	if len(result.LastResort) != 0 {
+		t.Errorf("兜底 provider 同样受上下文上限约束: %+v", result.LastResort)
+	}
+	if len(result.Skipped) != 2 || result.Skipped[0].Reason != SkipReasonContextTooLarge || result.Skipped[0].Detail != "5000 > 1000" {
+		t.Errorf("Skipped = %+v", result.Skipped)
+	}
+
+	if !(Provider{MaxContextTokens: 100}).FitsContext(100) || (Provider{MaxContextTokens: 100}).FitsContext(101) {
+		t.Error("FitsContext 边界错误")
+	}
+}
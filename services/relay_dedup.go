@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ============================================================================
+// 重复 provider 去重
+// ============================================================================
+
+// DedupProviders 去除重复的 provider：名称相同，或 APIURL + APIKey 相同（实际指向同一后端）
+// 保留第一次出现的 provider，每个被移除的重复项打印一条警告
+// 应在 FilterProviders 之前调用，避免同一后端占用多次重试机会、破坏轮询的公平性
+func DedupProviders(providers []Provider) []Provider {
+	return dedupProviders(providers, "", true, func(p Provider) (string, string, string) {
+		return p.Name, p.APIURL, p.APIKey
+	})
+}
+
+// DedupProvidersByName 仅按名称去重，允许多个 provider 共用同一端点和密钥（如不同的模型映射）
+func DedupProvidersByName(providers []Provider) []Provider {
+	return dedupProviders(providers, "", false, func(p Provider) (string, string, string) {
+		return p.Name, p.APIURL, p.APIKey
+	})
+}
+
+// DedupGeminiProviders 去除重复的 GeminiProvider：名称相同，或 BaseURL + APIKey 相同
+func DedupGeminiProviders(providers []GeminiProvider) []GeminiProvider {
+	return dedupProviders(providers, "[Gemini] ", true, func(p GeminiProvider) (string, string, string) {
+		return p.Name, p.BaseURL, p.APIKey
+	})
+}
+
+// dedupProviders 去重核心逻辑，identity 返回名称、端点和密钥
+// 端点或密钥为空时不参与端点去重（未完成配置的 provider 交给过滤阶段处理）
+func dedupProviders[T any](providers []T, logPrefix string, byEndpoint bool, identity func(T) (name, url, key string)) []T {
+	if len(providers) <= 1 {
+		return providers
+	}
+
+	byName := make(map[string]bool, len(providers))
+	byTarget := make(map[string]string, len(providers))
+	result := make([]T, 0, len(providers))
+	for _, p := range providers {
+		name, url, key := identity(p)
+		if byName[name] {
+			fmt.Printf("%s[WARN] Provider %s 重复配置，已忽略后出现的一项\n", logPrefix, name)
+			continue
+		}
+
+		target := ""
+		if byEndpoint {
+			url = strings.TrimRight(strings.TrimSpace(url), "/")
+			key = strings.TrimSpace(key)
+			if url != "" && key != "" {
+				target = url + "\x00" + key
+			}
+		}
+		if first, dup := byTarget[target]; target != "" && dup {
+			fmt.Printf("%s[WARN] Provider %s 与 %s 使用相同的端点和密钥，已忽略\n", logPrefix, name, first)
+			continue
+		}
+
+		byName[name] = true
+		if target != "" {
+			byTarget[target] = name
+		}
+		result = append(result, p)
+	}
+	return result
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedupProviders(t *testing.T) {
+	providers := []Provider{
+		{Name: "a", APIURL: "https://x.com", APIKey: "k1"},
+		{Name: "a", APIURL: "https://y.com", APIKey: "k2"},
+		{Name: "b", APIURL: "https://x.com/", APIKey: "k1"},
+		{Name: "c", APIURL: "https://x.com", APIKey: "k2"},
+		{Name: "d"},
+		{Name: "e"},
+	}
+	names := func(ps []Provider) string {
+		out := make([]string, len(ps))
+		for i, p := range ps {
+			out[i] = p.Name
+		}
+		return strings.Join(out, ",")
+	}
+
+	if got := names(DedupProviders(providers)); got != "a,c,d,e" {
+		t.Errorf("DedupProviders() = %s, 期望 a,c,d,e", got)
+	}
+	if got := names(DedupProvidersByName(providers)); got != "a,b,c,d,e" {
+		t.Errorf("DedupProvidersByName() = %s, 期望 a,b,c,d,e", got)
+	}
+
+	gemini := DedupGeminiProviders([]GeminiProvider{
+		{Name: "g1", BaseURL: "https://g", APIKey: "k"},
+		{Name: "g2", BaseURL: "https://g", APIKey: "k"},
+		{Name: "g1", BaseURL: "https://h", APIKey: "k"},
+	})
+	if len(gemini) != 1 || gemini[0].Name != "g1" || gemini[0].BaseURL != "https://g" {
+		t.Errorf("DedupGeminiProviders() = %+v", gemini)
+	}
+}
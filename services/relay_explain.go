@@ -0,0 +1,98 @@
+package services
+
+import "time"
+
+// ============================================================================
+// 路由解释（dry-run）
+// ============================================================================
+
+// LevelExplanation 单个 Level 的排序结果
+type LevelExplanation struct {
+	Level     int      `json:"level"`
+	Providers []string `json:"providers"` // 轮询排序后的顺序
+}
+
+// RoutingExplanation 路由决策的机器可读解释
+type RoutingExplanation struct {
+	Kind           string             `json:"kind"`
+	RequestedModel string             `json:"requestedModel"`
+	Active         []string           `json:"active"`     // 通过过滤的 providers（配置顺序）
+	LastResort     []string           `json:"lastResort"` // 通过过滤的兜底 providers
+	Skipped        []SkipInfo         `json:"skipped"`    // 被跳过的 providers 及原因
+	Levels         []LevelExplanation `json:"levels"`     // 按 Level 分组并轮询排序后的结果
+	Selection      []string           `json:"selection"`  // 最终尝试顺序
+}
+
+// ExplainRouting 以 dry-run 方式执行 过滤 → 请求级过滤 → 分组 → 排序 流程，返回路由解释
+// 与实际选择使用相同的逻辑：FilterProviders 的过滤、ProviderRouteGroupWithSelector 的请求级过滤
+// （ApplyTags / ApplyLevelRange / ApplyContextLimit），以及 Reorder 的成功置顶、轮询与成功降权；
+// 但不打印日志、不上报指标、不发起请求，也不会修改 RoundRobinState
+// 参数:
+//   - providers: 原始 Provider 列表
+//   - ctx: 请求上下文（用于获取请求模型、标签与 Level 范围请求头、预估输入 token，可为 nil）
+//   - platform: 平台标识 (PlatformClaude/PlatformCodex/custom:xxx)
+//   - rrs: 轮询状态（可为 nil，为 nil 时保持配置顺序）
+//   - blacklistChecker/modelChecker/configValidator: 同 FilterProviders
+func ExplainRouting(
+	providers []Provider,
+	ctx *RequestContext,
+	platform Platform,
+	rrs *RoundRobinState,
+	blacklistChecker func(kind, name string) (bool, time.Time),
+	modelChecker func(p *Provider, model string) bool,
+	configValidator func(p *Provider) []string,
+) RoutingExplanation {
+	kind := string(platform)
+	requestedModel := ""
+	if ctx != nil {
+		requestedModel = ctx.RequestedModel
+	}
+
+	explanation := RoutingExplanation{
+		Kind:           kind,
+		RequestedModel: requestedModel,
+		Active:         []string{},
+		LastResort:     []string{},
+		Levels:         []LevelExplanation{},
+		Selection:      []string{},
+	}
+
+	filtered := FilterResult[Provider]{TotalInput: len(providers)}
+	active := filterProviders(providers, kind, requestedModel, blacklistChecker, modelChecker, configValidator,
+		func(p Provider, reason SkipReason, detail string) {
+			filtered.addSkip(p.Name, reason, detail)
+		},
+	)
+	filtered.Active, filtered.LastResort = splitLastResort(active)
+	if ctx != nil {
+		filtered.ApplyTags(TagsFromRequest(ctx))
+		filtered.ApplyLevelRange(LevelRangeFromRequest(ctx))
+		filtered.ApplyContextLimit(EstimateInputTokens(ctx.BodyBytes, formatForKind(kind)))
+	}
+
+	explanation.Skipped = append([]SkipInfo{}, filtered.Skipped...)
+	for _, p := range filtered.Active {
+		explanation.Active = append(explanation.Active, p.Name)
+	}
+	for _, p := range filtered.LastResort {
+		explanation.LastResort = append(explanation.LastResort, p.Name)
+	}
+
+	grouped := GroupByLevel(filtered.Active)
+	for _, level := range grouped.SortedLevels {
+		ordered := grouped.Groups[level]
+		if rrs != nil {
+			ordered = peekReorder(rrs, platform, level, ordered, Provider.GetName)
+		}
+
+		names := make([]string, 0, len(ordered))
+		for _, p := range ordered {
+			names = append(names, p.Name)
+		}
+		explanation.Levels = append(explanation.Levels, LevelExplanation{Level: level, Providers: names})
+		explanation.Selection = append(explanation.Selection, names...)
+	}
+	explanation.Selection = append(explanation.Selection, explanation.LastResort...)
+
+	return explanation
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainRouting(t *testing.T) {
+	providers := []Provider{
+		{Name: "a", APIURL: "https://a", APIKey: "k", Enabled: true, Level: 1},
+		{Name: "b", APIURL: "https://b", APIKey: "k", Enabled: true, Level: 1},
+		{Name: "off", APIURL: "https://c", APIKey: "k", Enabled: false},
+		{Name: "nokey", APIURL: "https://d", Enabled: true},
+		{Name: "banned", APIURL: "https://e", APIKey: "k", Enabled: true},
+		{Name: "nomodel", APIURL: "https://f", APIKey: "k", Enabled: true},
+		{Name: "c", APIURL: "https://g", APIKey: "k", Enabled: true, Level: 2},
+	}
+	blacklist := func(kind, name string) (bool, time.Time) {
+		return name == "banned", time.Now().Add(time.Minute)
+	}
+	modelChecker := func(p *Provider, model string) bool {
+		return p.Name != "nomodel"
+	}
+
+	rrs := NewRoundRobinState()
+	// 模拟上一次请求从 a 开始，本次应从 b 开始
+	Reorder(rrs, "claude", 1, []Provider{providers[0], providers[1]}, Provider.GetName)
+
+	ctx := &RequestContext{RequestedModel: "claude-sonnet-4"}
+	got := ExplainRouting(providers, ctx, PlatformClaude, rrs, blacklist, modelChecker, nil)
+
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got.Active, want) {
+		t.Errorf("Active = %v, 期望 %v", got.Active, want)
+	}
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(got.Selection, want) {
+		t.Errorf("Selection = %v, 期望 %v", got.Selection, want)
+	}
+
+	reasons := make(map[string]SkipReason)
+	for _, s := range got.Skipped {
+		reasons[s.Name] = s.Reason
+	}
+	wantReasons := map[string]SkipReason{
+		"off":     SkipReasonDisabled,
+		"nokey":   SkipReasonInvalidConfig,
+		"banned":  SkipReasonBlacklisted,
+		"nomodel": SkipReasonModelUnsupported,
+	}
+	if !reflect.DeepEqual(reasons, wantReasons) {
+		t.Errorf("Skipped 原因 = %v, 期望 %v", reasons, wantReasons)
+	}
+
+	// dry-run 不应修改轮询状态
+	if last := rrs.peek("claude:1"); last != "a" {
+		t.Errorf("ExplainRouting 修改了轮询状态: lastStart = %q", last)
+	}
+}
+
+// TestExplainRouting_MatchesSelection dry-run 的顺序与实际选择（Reorder）一致，且不修改轮询状态
+func TestExplainRouting_MatchesSelection(t *testing.T) {
+	providers := []Provider{
+		{Name: "a", APIURL: "https://a", APIKey: "k", Enabled: true, Level: 1},
+		{Name: "b", APIURL: "https://b", APIKey: "k", Enabled: true, Level: 1},
+		{Name: "c", APIURL: "https://c", APIKey: "k", Enabled: true, Level: 1},
+	}
+	names := func(ps []Provider) []string {
+		out := make([]string, len(ps))
+		for i, p := range ps {
+			out[i] = p.Name
+		}
+		return out
+	}
+
+	tests := []struct {
+		name  string
+		setup func(rrs *RoundRobinState)
+		want  []string
+	}{
+		{"成功置顶", func(rrs *RoundRobinState) {
+			rrs.SetSuccessMode(StickyAfterSuccess, time.Minute)
+			Reorder(rrs, PlatformClaude, 1, providers, Provider.GetName)
+			rrs.RecordSuccess("claude", 1, "c")
+		}, []string{"c", "a", "b"}},
+		{"成功降权", func(rrs *RoundRobinState) {
+			rrs.SetSuccessCooldown(time.Minute)
+			Reorder(rrs, PlatformClaude, 1, providers, Provider.GetName)
+			rrs.RecordSuccess("claude", 1, "b")
+		}, []string{"c", "a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrs := NewRoundRobinState()
+			tt.setup(rrs)
+			lastStart := rrs.peek("claude:1")
+
+			got := ExplainRouting(providers, nil, PlatformClaude, rrs, nil, nil, nil)
+			if !reflect.DeepEqual(got.Selection, tt.want) {
+				t.Errorf("Selection = %v, 期望 %v", got.Selection, tt.want)
+			}
+			if rrs.peek("claude:1") != lastStart {
+				t.Error("ExplainRouting 不应推进轮询位置")
+			}
+			if real := names(Reorder(rrs, PlatformClaude, 1, providers, Provider.GetName)); !reflect.DeepEqual(real, got.Selection) {
+				t.Errorf("实际顺序 %v 与 dry-run %v 不一致", real, got.Selection)
+			}
+		})
+	}
+}
+
+func TestExplainRouting_RequestFilters(t *testing.T) {
+	providers := []Provider{
+		{Name: "beta", APIURL: "https://a", APIKey: "k", Enabled: true, Level: 1, Tags: []string{"beta"}},
+		{Name: "small", APIURL: "https://b", APIKey: "k", Enabled: true, Level: 2, MaxContextTokens: 10},
+		{Name: "low", APIURL: "https://c", APIKey: "k", Enabled: true, Level: 5},
+		{Name: "ok", APIURL: "https://d", APIKey: "k", Enabled: true, Level: 2},
+	}
+	ctx := &RequestContext{
+		RequestedModel: "claude-sonnet-4",
+		BodyBytes:      []byte(`{"model":"claude-sonnet-4","messages":[{"role":"user","content":"` + strings.Repeat("long prompt ", 50) + `"}]}`),
+		ClientHeaders: map[string]string{
+			ExcludeProviderTagsHeader: "beta",
+			MaxProviderLevelHeader:    "3",
+		},
+	}
+
+	got := ExplainRouting(providers, ctx, PlatformClaude, nil, nil, nil, nil)
+	if want := []string{"ok"}; !reflect.DeepEqual(got.Selection, want) {
+		t.Errorf("Selection = %v, 期望 %v", got.Selection, want)
+	}
+	reasons := make(map[string]SkipReason)
+	for _, s := range got.Skipped {
+		reasons[s.Name] = s.Reason
+	}
+	wantReasons := map[string]SkipReason{
+		"beta":  SkipReasonTagExcluded,
+		"low":   SkipReasonLevelOutOfRange,
+		"small": SkipReasonContextTooLarge,
+	}
+	if !reflect.DeepEqual(reasons, wantReasons) {
+		t.Errorf("Skipped 原因 = %v, 期望 %v", reasons, wantReasons)
+	}
+}
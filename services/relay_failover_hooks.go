@@ -0,0 +1,27 @@
+package services
+
+// ============================================================================
+// 故障转移事件回调
+// ============================================================================
+
+// BeginAttempt 在向 provider 发起尝试前调用
+// 上一次尝试失败且 provider 与上次不同时触发 OnFailover(上次 Provider, provider, 上次错误)；
+// 同一 Provider 的重试与首次尝试不会触发
+func (rc *RetryContext) BeginAttempt(provider string) {
+	if rc.OnFailover == nil || !rc.lastFailed || rc.LastProvider == "" || rc.LastProvider == provider {
+		return
+	}
+	rc.OnFailover(rc.LastProvider, provider, rc.LastError)
+}
+
+// Exhaust 在所有 Provider 均失败、即将返回失败响应时调用，触发 OnExhausted
+// 同一 RetryContext 只触发一次；最后一次尝试成功时不触发
+func (rc *RetryContext) Exhaust() {
+	if rc.exhausted || (rc.TotalAttempts > 0 && !rc.lastFailed) {
+		return
+	}
+	rc.exhausted = true
+	if rc.OnExhausted != nil {
+		rc.OnExhausted(rc)
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRetryContext_FailoverHooks(t *testing.T) {
+	errA := errors.New("a down")
+
+	t.Run("nil 回调安全", func(t *testing.T) {
+		rc := NewRetryContext(1, 0)
+		rc.RecordAttempt("a", 0, errA)
+		rc.BeginAttempt("b")
+		rc.Exhaust()
+	})
+
+	t.Run("切换 provider 时触发 OnFailover", func(t *testing.T) {
+		type event struct {
+			from, to string
+			reason   error
+		}
+		var events []event
+		rc := NewRetryContext(1, 0)
+		rc.OnFailover = func(from, to string, reason error) {
+			events = append(events, event{from, to, reason})
+		}
+
+		rc.BeginAttempt("a") // 首次尝试
+		rc.RecordAttempt("a", 0, errA)
+		rc.BeginAttempt("a") // 同 provider 重试
+		rc.RecordAttempt("a", 0, errA)
+		rc.BeginAttempt("b")
+		rc.RecordAttempt("b", 0, nil)
+		rc.BeginAttempt("c") // 上次成功，不算故障转移
+
+		if len(events) != 1 || events[0].from != "a" || events[0].to != "b" || events[0].reason != errA {
+			t.Errorf("events = %+v", events)
+		}
+	})
+
+	t.Run("全部失败时触发一次 OnExhausted", func(t *testing.T) {
+		calls := 0
+		rc := NewRetryContext(1, 0)
+		rc.OnExhausted = func(ctx *RetryContext) {
+			calls++
+			if ctx.TotalAttempts != 2 || ctx.LastProvider != "b" {
+				t.Errorf("ctx = %+v", ctx)
+			}
+		}
+		rc.RecordAttempt("a", 0, errA)
+		rc.RecordAttempt("b", 0, errA)
+		rc.Exhaust()
+		rc.Exhaust()
+		if calls != 1 {
+			t.Errorf("OnExhausted 调用 %d 次, 期望 1", calls)
+		}
+	})
+
+	t.Run("最后一次成功时不触发 OnExhausted", func(t *testing.T) {
+		rc := NewRetryContext(1, 0)
+		rc.OnExhausted = func(*RetryContext) { t.Error("不应触发") }
+		rc.RecordAttempt("a", 0, nil)
+		rc.Exhaust()
+	})
+}
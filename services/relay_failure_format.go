@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// 按客户端 API 格式构建失败响应
+// ============================================================================
+
+// BuildFailureResponseFor 按客户端请求格式（RequestContext.Format）构建失败响应
+// OpenAI / Responses 客户端使用 BuildFailureResponseOpenAI，Claude 客户端使用 BuildFailureResponseClaude，
+// 其余（含无法识别的格式）保持 BuildFailureResponse 的原有结构
+func BuildFailureResponseFor(rc *RequestContext, totalAttempts int, lastProvider string, lastError error, mode string) gin.H {
+	var format Format
+	if rc != nil {
+		format = rc.Format
+	}
+	switch format {
+	case FormatOpenAI, FormatOpenAIResponses:
+		return BuildFailureResponseOpenAI(totalAttempts, lastProvider, lastError)
+	case FormatClaude:
+		return BuildFailureResponseClaude(totalAttempts, lastProvider, lastError)
+	default:
+		return BuildFailureResponse(totalAttempts, lastProvider, lastError, mode)
+	}
+}
+
+// BuildFailureResponseOpenAI 构建 OpenAI 标准错误信封：{"error":{"message","type","param","code"}}
+// OpenAI SDK 只解析该结构，不能混入自定义字段
+func BuildFailureResponseOpenAI(totalAttempts int, lastProvider string, lastError error) gin.H {
+	errType, code := "server_error", "all_providers_failed"
+	switch failureKind(totalAttempts, lastError) {
+	case ErrNoProvidersConfigured:
+		code = "no_providers_configured"
+	case ErrAllProvidersFiltered:
+		code = "all_providers_filtered"
+	default:
+		var upstream *UpstreamError
+		if errors.As(lastError, &upstream) {
+			switch upstream.Type {
+			case UpstreamErrorRateLimit, UpstreamErrorOverloaded:
+				errType, code = "rate_limit_error", "rate_limit_exceeded"
+			case UpstreamErrorQuotaExceeded:
+				errType, code = "insufficient_quota", "insufficient_quota"
+			case UpstreamErrorAuth:
+				errType, code = "authentication_error", "invalid_api_key"
+			case UpstreamErrorInvalidRequest:
+				errType, code = "invalid_request_error", "invalid_request"
+			}
+		}
+	}
+
+	return gin.H{
+		"error": gin.H{
+			"message": failureMessage(totalAttempts, lastProvider, lastError),
+			"type":    errType,
+			"param":   nil,
+			"code":    code,
+		},
+	}
+}
+
+// BuildFailureResponseClaude 构建 Anthropic 标准错误结构：{"type":"error","error":{"type","message"}}
+func BuildFailureResponseClaude(totalAttempts int, lastProvider string, lastError error) gin.H {
+	errType := "api_error"
+	if failureKind(totalAttempts, lastError) == nil {
+		var upstream *UpstreamError
+		if errors.As(lastError, &upstream) {
+			switch upstream.Type {
+			case UpstreamErrorOverloaded:
+				errType = "overloaded_error"
+			case UpstreamErrorRateLimit, UpstreamErrorQuotaExceeded:
+				errType = "rate_limit_error"
+			case UpstreamErrorAuth:
+				errType = "authentication_error"
+			case UpstreamErrorInvalidRequest:
+				errType = "invalid_request_error"
+			}
+		}
+	}
+
+	return gin.H{
+		"type": "error",
+		"error": gin.H{
+			"type":    errType,
+			"message": failureMessage(totalAttempts, lastProvider, lastError),
+		},
+	}
+}
+
+// failureKind 零次尝试时返回 ErrNoProvidersConfigured / ErrAllProvidersFiltered，其余返回 nil
+func failureKind(totalAttempts int, lastError error) error {
+	if totalAttempts > 0 {
+		return nil
+	}
+	for _, kind := range []error{ErrNoProvidersConfigured, ErrAllProvidersFiltered} {
+		if errors.Is(lastError, kind) {
+			return kind
+		}
+	}
+	return nil
+}
+
+// failureMessage 与 BuildFailureResponse 一致的错误描述
+func failureMessage(totalAttempts int, lastProvider string, lastError error) string {
+	errorMsg := "未知错误"
+	if lastError != nil {
+		errorMsg = lastError.Error()
+	}
+	if failureKind(totalAttempts, lastError) != nil {
+		return errorMsg
+	}
+	return fmt.Sprintf("所有 Provider 都失败，最后尝试: %s - %s", lastProvider, errorMsg)
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestBuildFailureResponseFor(t *testing.T) {
+	rateLimited := fmt.Errorf("attempt failed: %w", &UpstreamError{HTTPCode: 429, Type: UpstreamErrorRateLimit, Message: "slow down"})
+
+	tests := []struct {
+		name   string
+		format Format
+		err    error
+		checks map[string]string // gjson 路径 -> 期望值
+	}{
+		{"OpenAI 限流", FormatOpenAI, rateLimited, map[string]string{
+			"error.type": "rate_limit_error", "error.code": "rate_limit_exceeded", "lastProvider": "",
+		}},
+		{"Responses 使用 OpenAI 结构", FormatOpenAIResponses, errors.New("boom"), map[string]string{
+			"error.type": "server_error", "error.code": "all_providers_failed",
+			"error.message": "所有 Provider 都失败，最后尝试: p - boom",
+		}},
+		{"Claude 限流", FormatClaude, rateLimited, map[string]string{
+			"type": "error", "error.type": "rate_limit_error",
+		}},
+		{"未识别格式保持原结构", "", errors.New("boom"), map[string]string{
+			"lastProvider": "p", "totalAttempts": "2",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(BuildFailureResponseFor(&RequestContext{Format: tt.format}, 2, "p", tt.err, ""))
+			for path, want := range tt.checks {
+				if got := gjson.GetBytes(body, path).String(); got != want {
+					t.Errorf("%s = %q, 期望 %q（%s）", path, got, want, body)
+				}
+			}
+		})
+	}
+
+	t.Run("未配置 provider", func(t *testing.T) {
+		err := fmt.Errorf("%w for kind codex", ErrNoProvidersConfigured)
+		body, _ := json.Marshal(BuildFailureResponseOpenAI(0, "", err))
+		if gjson.GetBytes(body, "error.code").String() != "no_providers_configured" ||
+			gjson.GetBytes(body, "error.message").String() != "no providers configured for kind codex" {
+			t.Errorf("响应 = %s", body)
+		}
+	})
+}
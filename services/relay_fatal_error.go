@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// 可重试与致命错误的区分
+// ============================================================================
+
+// UpstreamStatusError 上游返回了非 2xx 状态码
+// Upstream 为从响应体识别出的错误（见 ParseUpstreamError），无法识别时为 nil
+// Body / ContentType 为上游原始响应，致命错误时原样返回给客户端，保证 SDK 能按原格式解析
+type UpstreamStatusError struct {
+	StatusCode  int
+	Upstream    *UpstreamError
+	Body        []byte
+	ContentType string
+}
+
+// Error 实现 error 接口
+func (e *UpstreamStatusError) Error() string {
+	if e.Upstream != nil && e.Upstream.Message != "" {
+		return fmt.Sprintf("upstream status %d: %s", e.StatusCode, e.Upstream.Message)
+	}
+	return fmt.Sprintf("upstream status %d", e.StatusCode)
+}
+
+// Unwrap 返回识别出的上游错误，便于 errors.As(err, *UpstreamError)
+func (e *UpstreamStatusError) Unwrap() error {
+	if e.Upstream == nil {
+		return nil
+	}
+	return e.Upstream
+}
+
+// newUpstreamStatusError 根据状态码、响应体与 Content-Type 构造 UpstreamStatusError
+func newUpstreamStatusError(status int, body []byte, contentType string) *UpstreamStatusError {
+	se := &UpstreamStatusError{StatusCode: status, Body: body, ContentType: contentType}
+	if ue, ok := ParseUpstreamError(body, status); ok {
+		se.Upstream = ue
+	}
+	return se
+}
+
+// IsFatal 判断错误是否为请求本身的问题：换任何 provider 都会同样失败，不应故障转移
+// httpCode 为 0 时从 err（UpstreamStatusError / UpstreamError）中读取状态码
+//   - 4xx 视为致命，但 408/429（超时、限流）、401/402/403/404 以及 413 除外：
+//     这几类通常是单个 provider 的凭证、额度、模型路由或请求体大小限制问题，换 provider 可能成功
+//   - 能从响应体识别出错误类型时，只有 UpstreamErrorInvalidRequest 视为致命（如 400 的额度不足不算）
+//   - 上下文长度超限（prompt is too long、context_length_exceeded 等）不是致命错误：各 provider 的上下文上限不同
+//   - 5xx、网络错误、客户端中断均不是致命错误
+func IsFatal(err error, httpCode int) bool {
+	if err == nil || errors.Is(err, errClientAbort) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var se *UpstreamStatusError
+	if errors.As(err, &se) {
+		if httpCode == 0 {
+			httpCode = se.StatusCode
+		}
+		if isContextLengthError(string(se.Body)) {
+			return false
+		}
+	}
+	var ue *UpstreamError
+	if errors.As(err, &ue) {
+		if httpCode == 0 {
+			httpCode = ue.HTTPCode
+		}
+		if ue.Type != UpstreamErrorInvalidRequest || isContextLengthError(ue.RawType+" "+ue.Message) {
+			return false
+		}
+	}
+	return isFatalStatus(httpCode)
+}
+
+// contextLengthMarkers 上下文长度/请求体大小超限的错误特征（小写），出现在错误类型或信息中时换更大上下文的 provider 可能成功
+var contextLengthMarkers = []string{
+	"prompt is too long",
+	"context_length_exceeded",
+	"maximum context length",
+	"context window",
+	"too many tokens",
+	"request_too_large",
+	"request too large",
+	"payload too large",
+}
+
+// isContextLengthError 错误文本是否表示上下文长度或请求体大小超限
+func isContextLengthError(text string) bool {
+	text = strings.ToLower(text)
+	for _, marker := range contextLengthMarkers {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFatalStatus 不可通过更换 provider 解决的状态码
+func isFatalStatus(code int) bool {
+	if code < http.StatusBadRequest || code >= http.StatusInternalServerError {
+		return false
+	}
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden, http.StatusNotFound,
+		http.StatusRequestEntityTooLarge:
+		return false
+	}
+	return true
+}
+
+// respondFatalError 致命错误直接返回给客户端，不再尝试其他 provider
+// 有上游响应体时原样转发（状态码、Content-Type 与响应体），客户端 SDK 可按原格式解析；
+// 否则按客户端请求格式构建失败响应（见 BuildFailureResponseFor）
+func respondFatalError(c *gin.Context, provider string, format Format, err error) {
+	fmt.Printf("[WARN] Provider %s 返回不可重试的错误，停止故障转移: %v\n", provider, err)
+	var se *UpstreamStatusError
+	if errors.As(err, &se) && len(se.Body) > 0 {
+		contentType := se.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		c.Data(se.StatusCode, contentType, se.Body)
+		return
+	}
+	status := http.StatusBadRequest
+	if se != nil {
+		status = se.StatusCode
+	}
+	c.JSON(status, BuildFailureResponseFor(&RequestContext{Format: format}, 1, provider, err, ""))
+}
+
+// responseContentType 返回上游响应的 Content-Type，无法获取时为空
+func responseContentType(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	return resp.Header.Get("Content-Type")
+}
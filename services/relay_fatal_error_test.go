@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsFatal(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		httpCode int
+		want     bool
+	}{
+		{"无错误", nil, 0, false},
+		{"400 请求错误", errors.New("bad request"), 400, true},
+		{"422 参数错误", &UpstreamStatusError{StatusCode: 422}, 0, true},
+		{"413 请求体过大", &UpstreamStatusError{StatusCode: 413}, 0, false},
+		{"Claude 上下文超长", newUpstreamStatusError(400, []byte(`{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`), ""), 0, false},
+		{"OpenAI 上下文超长", newUpstreamStatusError(400, []byte(`{"error":{"type":"invalid_request_error","code":"context_length_exceeded","message":"This model's maximum context length is 128000 tokens"}}`), ""), 0, false},
+		{"未识别格式的上下文超长", newUpstreamStatusError(422, []byte(`Request too large for model`), ""), 0, false},
+		{"429 限流", &UpstreamStatusError{StatusCode: 429}, 0, false},
+		{"408 超时", &UpstreamStatusError{StatusCode: 408}, 0, false},
+		{"401 provider 凭证问题", &UpstreamStatusError{StatusCode: 401}, 0, false},
+		{"404 provider 不支持该模型", &UpstreamStatusError{StatusCode: 404}, 0, false},
+		{"500 服务端错误", &UpstreamStatusError{StatusCode: 500}, 0, false},
+		{"网络错误", errors.New("dial tcp: connection refused"), 0, false},
+		{"客户端中断", fmt.Errorf("%w: eof", errClientAbort), 400, false},
+		{"请求被取消", context.Canceled, 400, false},
+		{"响应体识别为参数错误", newUpstreamStatusError(400, []byte(`{"type":"error","error":{"type":"invalid_request_error","message":"messages: field required"}}`), ""), 0, true},
+		{"响应体识别为额度不足", newUpstreamStatusError(400, []byte(`{"error":{"type":"insufficient_quota","message":"quota exceeded"}}`), ""), 0, false},
+		{"包装后的状态码错误", fmt.Errorf("attempt failed: %w", &UpstreamStatusError{StatusCode: 400}), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsFatal(tt.err, tt.httpCode); got != tt.want {
+				t.Errorf("IsFatal(%v, %d) = %v, want %v", tt.err, tt.httpCode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryContext_FatalStopsFailover(t *testing.T) {
+	rc := NewRetryContext(1, 0)
+	rc.RecordAttempt("a", time.Millisecond, &UpstreamStatusError{StatusCode: 503})
+	if rc.Fatal || !rc.ShouldContinue(context.Background()) {
+		t.Fatal("5xx 应继续故障转移")
+	}
+
+	rc.RecordAttempt("b", time.Millisecond, &UpstreamStatusError{StatusCode: 400})
+	if !rc.Fatal || rc.ShouldContinue(context.Background()) {
+		t.Error("400 应立即停止故障转移")
+	}
+	if rc.LastError == nil || rc.LastError.Error() != "upstream status 400" {
+		t.Errorf("LastError = %v", rc.LastError)
+	}
+}
+
+func TestRouteChain_FatalStopsFailover(t *testing.T) {
+	providers := []Provider{
+		{Name: "a", APIURL: "https://a", APIKey: "k", Enabled: true},
+		{Name: "b", APIURL: "https://b", APIKey: "k", Enabled: true},
+	}
+	chain := NewRouteChain(ProviderRouteGroup("claude", FormatClaude, 1, nil, providers, nil, nil, nil))
+
+	var tried []string
+	_, attempt, err := chain.Execute(&RequestContext{}, FormatClaude, func(a RouteAttempt) ([]byte, error) {
+		tried = append(tried, a.Provider.GetName())
+		return nil, &UpstreamStatusError{StatusCode: 400}
+	})
+	if !IsFatal(err, 0) || errors.Is(err, ErrRouteChainExhausted) {
+		t.Errorf("err = %v, 应直接返回致命错误", err)
+	}
+	if len(tried) != 1 || attempt.Provider.GetName() != "a" {
+		t.Errorf("尝试了 %v, 期望只尝试 a", tried)
+	}
+}
+
+func TestRespondFatalError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("原样转发上游响应", func(t *testing.T) {
+		body := `{"type":"error","error":{"type":"invalid_request_error","message":"messages: field required"}}`
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		respondFatalError(c, "a", FormatClaude, newUpstreamStatusError(400, []byte(body), "application/json; charset=utf-8"))
+
+		if w.Code != 400 {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+			t.Errorf("Content-Type = %q", got)
+		}
+		if w.Body.String() != body {
+			t.Errorf("body = %s, want %s", w.Body.String(), body)
+		}
+	})
+
+	t.Run("无响应体时按请求格式构建", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		respondFatalError(c, "a", FormatClaude, &UpstreamStatusError{StatusCode: 422})
+
+		if w.Code != 422 {
+			t.Errorf("status = %d, want 422", w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `"type":"error"`) {
+			t.Errorf("body = %s, 应为 Claude 错误格式", w.Body.String())
+		}
+	})
+}
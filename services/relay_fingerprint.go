@@ -0,0 +1,64 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync/atomic"
+)
+
+// ============================================================================
+// Provider 指纹与黑名单键
+// ============================================================================
+
+// fingerprintLen 指纹长度（十六进制字符数）
+const fingerprintLen = 16
+
+// blacklistByFingerprint 黑名单是否按指纹区分同名 provider（默认按名称）
+var blacklistByFingerprint atomic.Bool
+
+// SetBlacklistByFingerprint 设置黑名单键的粒度
+// 开启后同名但 URL/API Key 不同的 provider（如 A/B 测试的多个 Key）各自拉黑，互不牵连；
+// 写入与查询黑名单的双方都应使用 BlacklistKey，否则记录与检查对不上
+func SetBlacklistByFingerprint(enabled bool) {
+	blacklistByFingerprint.Store(enabled)
+}
+
+// Fingerprint 返回 provider 的稳定指纹：名称 + URL（忽略末尾 "/"）+ API Key 哈希前缀 的 SHA-256 前缀
+// 指纹中不包含 API Key 明文；任一部分变化都会得到不同的指纹
+func (p Provider) Fingerprint() string {
+	return providerFingerprint(p.Name, p.APIURL, p.APIKey)
+}
+
+// Fingerprint 返回 GeminiProvider 的稳定指纹（见 Provider.Fingerprint）
+func (p GeminiProvider) Fingerprint() string {
+	return providerFingerprint(p.Name, p.BaseURL, p.APIKey)
+}
+
+// BlacklistKey 返回黑名单使用的 provider 键
+// 默认为名称；SetBlacklistByFingerprint(true) 后为 "名称@指纹"，日志中仍可辨认是哪个 provider
+func (p Provider) BlacklistKey() string {
+	return blacklistKey(p.Name, p.Fingerprint)
+}
+
+// BlacklistKey 返回黑名单使用的 GeminiProvider 键（见 Provider.BlacklistKey）
+func (p GeminiProvider) BlacklistKey() string {
+	return blacklistKey(p.Name, p.Fingerprint)
+}
+
+func blacklistKey(name string, fingerprint func() string) string {
+	if !blacklistByFingerprint.Load() {
+		return name
+	}
+	return name + "@" + fingerprint()
+}
+
+func providerFingerprint(name, url, apiKey string) string {
+	h := sha256.New()
+	h.Write([]byte(strings.TrimSpace(name)))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.TrimRight(strings.TrimSpace(url), "/")))
+	h.Write([]byte{0})
+	h.Write([]byte(HashAPIKey(apiKey)))
+	return hex.EncodeToString(h.Sum(nil))[:fingerprintLen]
+}
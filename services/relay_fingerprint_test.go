@@ -0,0 +1,57 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProvider_Fingerprint(t *testing.T) {
+	base := Provider{Name: "p", APIURL: "https://api.example.com", APIKey: "sk-a"}
+	fp := base.Fingerprint()
+	if len(fp) != fingerprintLen || strings.Contains(fp, "sk-a") {
+		t.Fatalf("Fingerprint() = %q", fp)
+	}
+
+	same := base
+	same.APIURL += "/"
+	same.Enabled = true
+	if same.Fingerprint() != fp {
+		t.Error("末尾斜杠与无关字段不应影响指纹")
+	}
+
+	for name, p := range map[string]Provider{
+		"不同 Key": {Name: "p", APIURL: "https://api.example.com", APIKey: "sk-b"},
+		"不同 URL": {Name: "p", APIURL: "https://other.example.com", APIKey: "sk-a"},
+		"不同名称":   {Name: "q", APIURL: "https://api.example.com", APIKey: "sk-a"},
+	} {
+		if p.Fingerprint() == fp {
+			t.Errorf("%s 应得到不同指纹", name)
+		}
+	}
+}
+
+func TestFilterProviders_BlacklistByFingerprint(t *testing.T) {
+	defer SetBlacklistByFingerprint(false)
+
+	keyA := Provider{Name: "p", APIURL: "https://api", APIKey: "sk-a", Enabled: true}
+	keyB := Provider{Name: "p", APIURL: "https://api", APIKey: "sk-b", Enabled: true}
+	blacklisted := map[string]bool{}
+	checker := func(kind, name string) (bool, time.Time) { return blacklisted[name], time.Time{} }
+
+	// 默认按名称：拉黑一个 Key 会连带同名的另一个
+	blacklisted[keyA.BlacklistKey()] = true
+	if got := FilterProviders([]Provider{keyA, keyB}, "claude", "", checker, nil, nil); len(got.Active) != 0 {
+		t.Errorf("按名称拉黑时应全部跳过, Active = %d", len(got.Active))
+	}
+
+	SetBlacklistByFingerprint(true)
+	blacklisted = map[string]bool{keyA.BlacklistKey(): true}
+	if !strings.HasPrefix(keyA.BlacklistKey(), "p@") {
+		t.Errorf("BlacklistKey() = %q, 应以名称开头", keyA.BlacklistKey())
+	}
+	got := FilterProviders([]Provider{keyA, keyB}, "claude", "", checker, nil, nil)
+	if len(got.Active) != 1 || got.Active[0].APIKey != "sk-b" {
+		t.Errorf("按指纹拉黑时只应跳过 sk-a, Active = %+v", got.Active)
+	}
+}
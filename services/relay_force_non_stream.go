@@ -0,0 +1,234 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ============================================================================
+// 上游非流式、客户端流式
+// ============================================================================
+
+// SetStream 设置请求体的 stream 字段
+// stream 为 false 时同时删除 OpenAI 的 stream_options（非流式请求携带该字段会被部分上游拒绝）
+func SetStream(bodyBytes []byte, stream bool) ([]byte, error) {
+	modified, err := sjson.SetBytes(bodyBytes, "stream", stream)
+	if err != nil {
+		return bodyBytes, fmt.Errorf("设置 stream 失败: %w", err)
+	}
+	if !stream && gjson.GetBytes(modified, "stream_options").Exists() {
+		if modified, err = sjson.DeleteBytes(modified, "stream_options"); err != nil {
+			return bodyBytes, fmt.Errorf("删除 stream_options 失败: %w", err)
+		}
+	}
+	return modified, nil
+}
+
+// sseEvent 一个 SSE 事件；Event 为空时不输出 event 行（OpenAI Chat 风格）
+type sseEvent struct {
+	Event string
+	Data  interface{} // 序列化为 JSON；string 类型原样输出（用于 [DONE]）
+}
+
+// NonStreamToSSE 将上游完整的非流式响应重新切分为客户端格式的 SSE 事件流
+// 用于 Provider.ForceNonStream：上游以非流式请求，客户端仍按流式协议接收
+//   - FormatClaude: message_start / content_block_* / message_delta / message_stop
+//   - FormatOpenAI: chat.completion.chunk + [DONE]
+//   - FormatOpenAIResponses: response.created / response.output_item.done / response.completed
+func NonStreamToSSE(bodyBytes []byte, format Format) ([]byte, error) {
+	if !gjson.ValidBytes(bodyBytes) {
+		return nil, fmt.Errorf("上游响应不是合法 JSON")
+	}
+
+	var events []sseEvent
+	switch format {
+	case FormatClaude:
+		events = claudeMessageToEvents(gjson.ParseBytes(bodyBytes))
+	case FormatOpenAI:
+		events = chatCompletionToEvents(gjson.ParseBytes(bodyBytes))
+	case FormatOpenAIResponses:
+		events = responseToEvents(gjson.ParseBytes(bodyBytes))
+	default:
+		return nil, fmt.Errorf("不支持的流式格式: %q", format)
+	}
+
+	var buf bytes.Buffer
+	for _, ev := range events {
+		if ev.Event != "" {
+			fmt.Fprintf(&buf, "event: %s\n", ev.Event)
+		}
+		data, ok := ev.Data.(string)
+		if !ok {
+			raw, err := json.Marshal(ev.Data)
+			if err != nil {
+				return nil, err
+			}
+			data = string(raw)
+		}
+		fmt.Fprintf(&buf, "data: %s\n\n", data)
+	}
+	return buf.Bytes(), nil
+}
+
+// sseFormatForKind 返回平台客户端使用的流式格式
+// 自定义 CLI 工具走 /custom/:toolId/v1/messages，与 Claude 相同
+func sseFormatForKind(kind string) Format {
+	if strings.HasPrefix(kind, "custom:") {
+		return FormatClaude
+	}
+	return formatForKind(kind)
+}
+
+// writeNonStreamAsSSE 将非流式响应以 SSE 写回客户端
+func writeNonStreamAsSSE(w http.ResponseWriter, bodyBytes []byte, format Format) error {
+	sse, err := NonStreamToSSE(bodyBytes, format)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(sse); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// claudeMessageToEvents 将 Claude Messages 响应拆分为流式事件
+func claudeMessageToEvents(msg gjson.Result) []sseEvent {
+	start := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(msg.Raw), &start)
+	start["content"] = []interface{}{}
+	start["stop_reason"] = nil
+	start["stop_sequence"] = nil
+
+	events := []sseEvent{{"message_start", map[string]interface{}{"type": "message_start", "message": start}}}
+	for i, block := range msg.Get("content").Array() {
+		var delta map[string]interface{}
+		startBlock := map[string]interface{}{}
+		_ = json.Unmarshal([]byte(block.Raw), &startBlock)
+
+		switch block.Get("type").String() {
+		case "text":
+			startBlock["text"] = ""
+			delta = map[string]interface{}{"type": "text_delta", "text": block.Get("text").String()}
+		case "thinking":
+			startBlock["thinking"] = ""
+			delete(startBlock, "signature")
+			delta = map[string]interface{}{"type": "thinking_delta", "thinking": block.Get("thinking").String()}
+		case "tool_use":
+			startBlock["input"] = map[string]interface{}{}
+			delta = map[string]interface{}{"type": "input_json_delta", "partial_json": block.Get("input").Raw}
+		}
+
+		events = append(events, sseEvent{"content_block_start", map[string]interface{}{
+			"type": "content_block_start", "index": i, "content_block": startBlock,
+		}})
+		if delta != nil {
+			events = append(events, sseEvent{"content_block_delta", map[string]interface{}{
+				"type": "content_block_delta", "index": i, "delta": delta,
+			}})
+		}
+		if sig := block.Get("signature"); block.Get("type").String() == "thinking" && sig.Exists() {
+			events = append(events, sseEvent{"content_block_delta", map[string]interface{}{
+				"type": "content_block_delta", "index": i,
+				"delta": map[string]interface{}{"type": "signature_delta", "signature": sig.String()},
+			}})
+		}
+		events = append(events, sseEvent{"content_block_stop", map[string]interface{}{
+			"type": "content_block_stop", "index": i,
+		}})
+	}
+
+	events = append(events,
+		sseEvent{"message_delta", map[string]interface{}{
+			"type":  "message_delta",
+			"delta": map[string]interface{}{"stop_reason": msg.Get("stop_reason").Value(), "stop_sequence": msg.Get("stop_sequence").Value()},
+			"usage": msg.Get("usage").Value(),
+		}},
+		sseEvent{"message_stop", map[string]interface{}{"type": "message_stop"}},
+	)
+	return events
+}
+
+// chatCompletionToEvents 将 OpenAI chat.completion 响应转为 chat.completion.chunk 事件
+func chatCompletionToEvents(resp gjson.Result) []sseEvent {
+	base := func(choices []interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":      resp.Get("id").String(),
+			"object":  "chat.completion.chunk",
+			"created": resp.Get("created").Int(),
+			"model":   resp.Get("model").String(),
+			"choices": choices,
+		}
+	}
+
+	var events []sseEvent
+	for _, choice := range resp.Get("choices").Array() {
+		delta := map[string]interface{}{}
+		_ = json.Unmarshal([]byte(choice.Get("message").Raw), &delta)
+		if calls, ok := delta["tool_calls"].([]interface{}); ok {
+			for i, call := range calls {
+				if m, ok := call.(map[string]interface{}); ok {
+					m["index"] = i
+				}
+			}
+		}
+		index := choice.Get("index").Int()
+		events = append(events,
+			sseEvent{Data: base([]interface{}{map[string]interface{}{"index": index, "delta": delta, "finish_reason": nil}})},
+			sseEvent{Data: base([]interface{}{map[string]interface{}{"index": index, "delta": map[string]interface{}{}, "finish_reason": choice.Get("finish_reason").Value()}})},
+		)
+	}
+	if usage := resp.Get("usage"); usage.Exists() {
+		chunk := base([]interface{}{})
+		chunk["usage"] = usage.Value()
+		events = append(events, sseEvent{Data: chunk})
+	}
+	return append(events, sseEvent{Data: "[DONE]"})
+}
+
+// responseToEvents 将 Responses API 的 response 对象转为流式事件
+func responseToEvents(resp gjson.Result) []sseEvent {
+	created := map[string]interface{}{}
+	_ = json.Unmarshal([]byte(resp.Raw), &created)
+	created["status"] = "in_progress"
+	created["output"] = []interface{}{}
+
+	seq := 0
+	next := func() int { seq++; return seq - 1 }
+
+	events := []sseEvent{{"response.created", map[string]interface{}{
+		"type": "response.created", "sequence_number": next(), "response": created,
+	}}}
+	for i, item := range resp.Get("output").Array() {
+		if item.Get("type").String() == "message" {
+			for j, part := range item.Get("content").Array() {
+				if part.Get("type").String() != "output_text" {
+					continue
+				}
+				events = append(events, sseEvent{"response.output_text.delta", map[string]interface{}{
+					"type": "response.output_text.delta", "sequence_number": next(),
+					"item_id": item.Get("id").String(), "output_index": i, "content_index": j,
+					"delta": part.Get("text").String(),
+				}})
+			}
+		}
+		events = append(events, sseEvent{"response.output_item.done", map[string]interface{}{
+			"type": "response.output_item.done", "sequence_number": next(), "output_index": i, "item": item.Value(),
+		}})
+	}
+	return append(events, sseEvent{"response.completed", map[string]interface{}{
+		"type": "response.completed", "sequence_number": next(), "response": resp.Value(),
+	}})
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// parseSSE 解析 SSE 文本为 (event, data) 列表
+func parseSSE(t *testing.T, sse string) (events []string, data []gjson.Result) {
+	t.Helper()
+	for _, block := range strings.Split(strings.TrimSpace(sse), "\n\n") {
+		event := ""
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				events = append(events, event)
+				data = append(data, gjson.Parse(strings.TrimPrefix(line, "data: ")))
+			}
+		}
+	}
+	return events, data
+}
+
+func TestSetStream(t *testing.T) {
+	out, err := SetStream([]byte(`{"model":"m","stream":true,"stream_options":{"include_usage":true}}`), false)
+	if err != nil {
+		t.Fatalf("SetStream() error = %v", err)
+	}
+	if gjson.GetBytes(out, "stream").Bool() || gjson.GetBytes(out, "stream_options").Exists() {
+		t.Errorf("SetStream(false) = %s", out)
+	}
+	if out, _ := SetStream([]byte(`{"model":"m"}`), true); !gjson.GetBytes(out, "stream").Bool() {
+		t.Errorf("SetStream(true) = %s", out)
+	}
+}
+
+func TestNonStreamToSSE(t *testing.T) {
+	t.Run("Claude", func(t *testing.T) {
+		body := `{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[
+			{"type":"text","text":"hello"},
+			{"type":"tool_use","id":"t1","name":"ls","input":{"path":"/"}}],
+			"stop_reason":"tool_use","usage":{"input_tokens":5,"output_tokens":7}}`
+		sse, err := NonStreamToSSE([]byte(body), FormatClaude)
+		if err != nil {
+			t.Fatalf("NonStreamToSSE() error = %v", err)
+		}
+		events, data := parseSSE(t, string(sse))
+		want := []string{"message_start", "content_block_start", "content_block_delta", "content_block_stop",
+			"content_block_start", "content_block_delta", "content_block_stop", "message_delta", "message_stop"}
+		if strings.Join(events, ",") != strings.Join(want, ",") {
+			t.Fatalf("events = %v", events)
+		}
+		if data[0].Get("message.content.#").Int() != 0 || data[2].Get("delta.text").String() != "hello" {
+			t.Errorf("文本块错误: %s / %s", data[0].Raw, data[2].Raw)
+		}
+		if data[5].Get("delta.partial_json").String() != `{"path":"/"}` || data[7].Get("delta.stop_reason").String() != "tool_use" {
+			t.Errorf("tool_use 块错误: %s / %s", data[5].Raw, data[7].Raw)
+		}
+	})
+
+	t.Run("OpenAI Chat", func(t *testing.T) {
+		body := `{"id":"c1","object":"chat.completion","model":"gpt","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":2}}`
+		sse, err := NonStreamToSSE([]byte(body), FormatOpenAI)
+		if err != nil {
+			t.Fatalf("NonStreamToSSE() error = %v", err)
+		}
+		if !strings.HasSuffix(string(sse), "data: [DONE]\n\n") {
+			t.Errorf("缺少 [DONE]: %s", sse)
+		}
+		_, data := parseSSE(t, string(sse))
+		if data[0].Get("object").String() != "chat.completion.chunk" || data[0].Get("choices.0.delta.content").String() != "hi" ||
+			data[1].Get("choices.0.finish_reason").String() != "stop" || data[2].Get("usage.completion_tokens").Int() != 2 {
+			t.Errorf("chunk 错误: %s", sse)
+		}
+	})
+
+	t.Run("Responses", func(t *testing.T) {
+		body := `{"id":"r1","object":"response","status":"completed","output":[{"type":"message","id":"m1","content":[{"type":"output_text","text":"ok"}]}]}`
+		sse, err := NonStreamToSSE([]byte(body), FormatOpenAIResponses)
+		if err != nil {
+			t.Fatalf("NonStreamToSSE() error = %v", err)
+		}
+		events, data := parseSSE(t, string(sse))
+		if strings.Join(events, ",") != "response.created,response.output_text.delta,response.output_item.done,response.completed" {
+			t.Fatalf("events = %v", events)
+		}
+		if data[0].Get("response.status").String() != "in_progress" || data[3].Get("response.status").String() != "completed" {
+			t.Errorf("response 状态错误: %s", sse)
+		}
+	})
+
+	t.Run("非法响应", func(t *testing.T) {
+		if _, err := NonStreamToSSE([]byte("oops"), FormatClaude); err == nil {
+			t.Error("非 JSON 响应应返回错误")
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============================================================================
+// 请求/响应格式
+// ============================================================================
+
+// Format API 报文格式
+type Format string
+
+const (
+	FormatClaude          Format = "claude"           // Anthropic Messages API
+	FormatOpenAI          Format = "openai"           // OpenAI Chat Completions API
+	FormatOpenAIResponses Format = "openai_responses" // OpenAI Responses API（input 代替 messages）
+	FormatGemini          Format = "gemini"           // Google Gemini generateContent API
+)
+
+// DetectFormat 根据请求路径和请求体识别报文格式，无法识别时返回空
+// 优先按路径判断（/v1/messages、/chat/completions、/responses、Gemini 的 :generateContent），
+// 路径无法判断时按请求体特征判断（input → Responses，contents → Gemini，messages → Claude/OpenAI）
+func DetectFormat(bodyBytes []byte, path string) Format {
+	switch {
+	case strings.HasSuffix(path, "/messages"):
+		return FormatClaude
+	case strings.HasSuffix(path, "/chat/completions"):
+		return FormatOpenAI
+	case strings.HasSuffix(path, "/responses"):
+		return FormatOpenAIResponses
+	case strings.Contains(path, "generateContent"):
+		return FormatGemini
+	}
+
+	root := gjson.ParseBytes(bodyBytes)
+	switch {
+	case root.Get("input").Exists() && !root.Get("messages").Exists():
+		return FormatOpenAIResponses
+	case root.Get("contents").Exists():
+		return FormatGemini
+	case root.Get("messages").Exists():
+		// Claude 的 system 在顶层；OpenAI 的 system 是一条消息
+		if root.Get("system").Exists() || root.Get("anthropic_version").Exists() {
+			return FormatClaude
+		}
+		for _, msg := range root.Get("messages").Array() {
+			if role := msg.Get("role").String(); role == "system" || role == "developer" || role == "tool" {
+				return FormatOpenAI
+			}
+		}
+		return FormatClaude
+	}
+	return ""
+}
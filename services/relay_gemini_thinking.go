@@ -0,0 +1,37 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ============================================================================
+// Gemini 思考预算注入
+// ============================================================================
+
+// geminiThinkingBudgetPath Gemini 2.x 思考预算字段
+const geminiThinkingBudgetPath = "generationConfig.thinkingConfig.thinkingBudget"
+
+// EnsureGeminiThinkingBudget 客户端未指定思考预算时设置 generationConfig.thinkingConfig.thinkingBudget
+// 客户端显式指定的值（包括 0 关闭思考、-1 动态预算）保持不变；defaultBudget <= 0 时不注入
+// thinkingConfig 中的其他字段（如 includeThoughts）保留
+// 返回 (新请求体, 是否注入, 错误)
+func EnsureGeminiThinkingBudget(bodyBytes []byte, defaultBudget int) ([]byte, bool, error) {
+	if defaultBudget <= 0 {
+		return bodyBytes, false, nil
+	}
+	if !gjson.ValidBytes(bodyBytes) {
+		return bodyBytes, false, fmt.Errorf("请求体不是合法 JSON")
+	}
+	if gjson.GetBytes(bodyBytes, geminiThinkingBudgetPath).Exists() {
+		return bodyBytes, false, nil
+	}
+
+	modified, err := sjson.SetBytes(bodyBytes, geminiThinkingBudgetPath, defaultBudget)
+	if err != nil {
+		return bodyBytes, false, fmt.Errorf("设置 thinkingBudget 失败: %w", err)
+	}
+	return modified, true, nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestEnsureGeminiThinkingBudget(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		budget       int
+		wantInjected bool
+		wantBudget   int64
+	}{
+		{"无 generationConfig", `{"contents":[]}`, 1024, true, 1024},
+		{"有 generationConfig 无 thinkingConfig", `{"generationConfig":{"temperature":0.5}}`, 1024, true, 1024},
+		{"保留 includeThoughts", `{"generationConfig":{"thinkingConfig":{"includeThoughts":true}}}`, 2048, true, 2048},
+		{"客户端显式指定", `{"generationConfig":{"thinkingConfig":{"thinkingBudget":512}}}`, 1024, false, 512},
+		{"客户端显式关闭", `{"generationConfig":{"thinkingConfig":{"thinkingBudget":0}}}`, 1024, false, 0},
+		{"默认预算为 0 不注入", `{"contents":[]}`, 0, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, injected, err := EnsureGeminiThinkingBudget([]byte(tt.body), tt.budget)
+			if err != nil {
+				t.Fatalf("EnsureGeminiThinkingBudget() error = %v", err)
+			}
+			if injected != tt.wantInjected {
+				t.Errorf("injected = %v, want %v", injected, tt.wantInjected)
+			}
+			if budget := gjson.GetBytes(got, geminiThinkingBudgetPath).Int(); budget != tt.wantBudget {
+				t.Errorf("thinkingBudget = %d, want %d (%s)", budget, tt.wantBudget, got)
+			}
+			for _, path := range []string{"generationConfig.temperature", "generationConfig.thinkingConfig.includeThoughts"} {
+				if gjson.Get(tt.body, path).Exists() && !gjson.GetBytes(got, path).Exists() {
+					t.Errorf("%s 被删除: %s", path, got)
+				}
+			}
+		})
+	}
+
+	if _, _, err := EnsureGeminiThinkingBudget([]byte(`not json`), 1024); err == nil {
+		t.Error("非法 JSON 应返回错误")
+	}
+}
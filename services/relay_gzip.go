@@ -0,0 +1,54 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GzipMinBodySize 小于该大小的请求体不压缩，避免压缩开销大于收益
+const GzipMinBodySize = 1024
+
+// GzipBody 使用 gzip 压缩请求体
+func GzipBody(bodyBytes []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(bodyBytes); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressRequestBody 对转发请求体进行 gzip 压缩并更新 headers
+// 请求体过小、客户端已指定 Content-Encoding 或压缩失败时原样返回
+func compressRequestBody(providerName string, headers map[string]string, bodyBytes []byte) []byte {
+	if len(bodyBytes) < GzipMinBodySize {
+		return bodyBytes
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, "Content-Encoding") && value != "" && !strings.EqualFold(value, "identity") {
+			return bodyBytes
+		}
+	}
+
+	compressed, err := GzipBody(bodyBytes)
+	if err != nil {
+		fmt.Printf("[WARN] Provider %s 请求体压缩失败，使用原始请求体: %v\n", providerName, err)
+		return bodyBytes
+	}
+
+	// 删除客户端原有的大小写变体，避免重复 header
+	for key := range headers {
+		if strings.EqualFold(key, "Content-Encoding") || strings.EqualFold(key, "Content-Length") {
+			delete(headers, key)
+		}
+	}
+	headers["Content-Encoding"] = "gzip"
+	headers["Content-Length"] = strconv.Itoa(len(compressed))
+	return compressed
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressRequestBody(t *testing.T) {
+	large := []byte(`{"messages":"` + strings.Repeat("hello ", GzipMinBodySize) + `"}`)
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		body         []byte
+		wantCompress bool
+	}{
+		{"小请求体不压缩", map[string]string{}, []byte(`{"a":1}`), false},
+		{"大请求体压缩", map[string]string{"Content-Length": "999"}, large, true},
+		{"客户端已指定编码", map[string]string{"Content-Encoding": "br"}, large, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compressRequestBody("p", tt.headers, tt.body)
+			if !tt.wantCompress {
+				if !bytes.Equal(got, tt.body) {
+					t.Error("不应修改请求体")
+				}
+				return
+			}
+
+			if tt.headers["Content-Encoding"] != "gzip" {
+				t.Errorf("Content-Encoding = %q, 期望 gzip", tt.headers["Content-Encoding"])
+			}
+			if tt.headers["Content-Length"] == "999" {
+				t.Error("Content-Length 未重新计算")
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(got))
+			if err != nil {
+				t.Fatalf("解压失败: %v", err)
+			}
+			plain, _ := io.ReadAll(zr)
+			if !bytes.Equal(plain, tt.body) {
+				t.Error("解压后内容不一致")
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ============================================================================
+// 选择流程测试工具（仅用于测试）
+// ============================================================================
+
+// ErrHarnessUnscripted TestHarness 中未设置脚本响应的 provider 被尝试
+var ErrHarnessUnscripted = errors.New("harness: provider has no scripted response")
+
+// HarnessResponse 脚本化的一次上游响应，Err 为 nil 表示成功
+type HarnessResponse struct {
+	Body []byte
+	Err  error
+}
+
+// HarnessAttempt 一次尝试的记录
+type HarnessAttempt struct {
+	Provider string
+	Level    int
+	Retry    int // 同一 provider 的第几次尝试（从 0 开始）
+	Err      error
+}
+
+// HarnessResult 一次 Run 的结果
+type HarnessResult struct {
+	Provider string           // 最终成功的 provider，全部失败时为空
+	Body     []byte           // 成功的响应体
+	Err      error            // 全部失败时为最后一次错误（无可用 provider 时为 ErrNoProvidersConfigured / ErrAllProvidersFiltered）
+	Order    []string         // 选择流程给出的尝试顺序（含未实际尝试到的 provider）
+	Attempts []HarnessAttempt // 实际尝试的顺序与结果
+	Skipped  []SkipInfo       // 过滤阶段跳过的 provider
+}
+
+// AttemptOrder 返回实际尝试的 provider 名称序列（同一 provider 重试会重复出现）
+func (r HarnessResult) AttemptOrder() []string {
+	names := make([]string, len(r.Attempts))
+	for i, a := range r.Attempts {
+		names[i] = a.Provider
+	}
+	return names
+}
+
+// TestHarness 以假 provider 端到端驱动选择流程：FilterProviders → GroupByLevel → Reorder → 重试循环
+// 不发起 HTTP 请求：每次尝试调用 Do，默认按 Script 设置的脚本依次返回响应
+// 轮询状态保存在 RoundRobin 中，多次 Run 之间延续，可用于断言跨请求的轮询顺序
+// 重试循环与转发逻辑一致：每个 provider 最多尝试 MaxRetryPerProvider 次，致命错误（见 IsFatal）立即结束，
+// 客户端取消、MaxTotalAttempts 或 Deadline 到达时停止
+type TestHarness struct {
+	Platform            Platform
+	Providers           []Provider
+	RoundRobin          *RoundRobinState
+	MaxRetryPerProvider int           // <= 0 时按 1 处理
+	MaxTotalAttempts    int           // <= 0 表示不限制
+	RetryWait           time.Duration // 同一 provider 重试前的等待，默认 0
+
+	Blacklisted     map[string]bool                             // 视为已拉黑的 provider 名称
+	ModelChecker    func(p *Provider, model string) bool        // 为 nil 时不检查模型
+	ConfigValidator func(p *Provider) []string                  // 为 nil 时不验证配置
+	Do              func(p Provider, retry int) ([]byte, error) // 发起一次尝试，默认读取脚本；替换后可模拟任意上游行为
+	OnRetryContext  func(rc *RetryContext)                      // 运行前调整 RetryContext（设置 Deadline、回调等），可为 nil
+
+	scripts         map[string][]HarnessResponse
+	scriptPositions map[string]int
+}
+
+// NewTestHarness 创建测试工具，Do 默认读取 Script 设置的脚本
+func NewTestHarness(platform Platform, providers ...Provider) *TestHarness {
+	h := &TestHarness{
+		Platform:            platform,
+		Providers:           providers,
+		RoundRobin:          NewRoundRobinState(),
+		MaxRetryPerProvider: 1,
+		scripts:             make(map[string][]HarnessResponse),
+		scriptPositions:     make(map[string]int),
+	}
+	h.Do = h.scripted
+	return h
+}
+
+// Script 设置 provider 依次返回的响应；脚本用完后重复最后一个响应
+func (h *TestHarness) Script(name string, responses ...HarnessResponse) *TestHarness {
+	h.scripts[name] = responses
+	h.scriptPositions[name] = 0
+	return h
+}
+
+// Succeed 设置 provider 始终成功返回 body
+func (h *TestHarness) Succeed(name string, body string) *TestHarness {
+	return h.Script(name, HarnessResponse{Body: []byte(body)})
+}
+
+// Fail 设置 provider 始终返回 err
+func (h *TestHarness) Fail(name string, err error) *TestHarness {
+	return h.Script(name, HarnessResponse{Err: err})
+}
+
+// scripted 默认的 Do：按脚本返回响应
+func (h *TestHarness) scripted(p Provider, _ int) ([]byte, error) {
+	script := h.scripts[p.Name]
+	if len(script) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrHarnessUnscripted, p.Name)
+	}
+	pos := h.scriptPositions[p.Name]
+	if pos >= len(script) {
+		pos = len(script) - 1
+	} else {
+		h.scriptPositions[p.Name] = pos + 1
+	}
+	return script[pos].Body, script[pos].Err
+}
+
+// Select 只执行选择流程，返回尝试顺序与过滤结果（会推进轮询状态）
+func (h *TestHarness) Select(model string) ([]Provider, FilterResult[Provider]) {
+	var blacklistChecker func(kind, name string) (bool, time.Time)
+	if len(h.Blacklisted) > 0 {
+		blacklistChecker = func(_, name string) (bool, time.Time) {
+			if h.Blacklisted[name] {
+				return true, clockNow().Add(time.Hour)
+			}
+			return false, time.Time{}
+		}
+	}
+	result := FilterProviders(h.Providers, h.Platform, model, blacklistChecker, h.ModelChecker, h.ConfigValidator)
+	return SelectProviders(h.RoundRobin, h.Platform, result.Active, result.LastResort...), result
+}
+
+// Run 对 model 执行一次完整的选择与重试流程
+func (h *TestHarness) Run(ctx context.Context, model string) HarnessResult {
+	ordered, filtered := h.Select(model)
+	result := HarnessResult{Skipped: filtered.Skipped, Order: make([]string, len(ordered))}
+	for i, p := range ordered {
+		result.Order[i] = p.Name
+	}
+
+	rc := &RetryContext{
+		Platform:            string(h.Platform),
+		MaxRetryPerProvider: max(h.MaxRetryPerProvider, 1),
+		RetryWaitDuration:   h.RetryWait,
+		MaxTotalAttempts:    h.MaxTotalAttempts,
+	}
+	if h.OnRetryContext != nil {
+		h.OnRetryContext(rc)
+	}
+
+	if len(ordered) == 0 {
+		result.Err = filtered.Err(string(h.Platform))
+		return result
+	}
+
+providers:
+	for _, p := range ordered {
+		for retry := 0; retry < rc.MaxRetryPerProvider; retry++ {
+			if !rc.ShouldContinue(ctx) {
+				break providers
+			}
+			if retry > 0 && !rc.WaitRetry(ctx) {
+				break providers
+			}
+			rc.BeginAttempt(p.Name)
+			body, err := h.Do(p, retry)
+			rc.RecordAttempt(p.Name, 0, err)
+			result.Attempts = append(result.Attempts, HarnessAttempt{Provider: p.Name, Level: p.GetLevel(), Retry: retry, Err: err})
+			if err == nil {
+				h.RoundRobin.RecordSuccess(string(h.Platform), p.GetLevel(), p.Name)
+				result.Provider = p.Name
+				result.Body = body
+				return result
+			}
+			if rc.Fatal {
+				break providers
+			}
+		}
+	}
+
+	rc.Exhaust()
+	result.Err = rc.LastError
+	return result
+}
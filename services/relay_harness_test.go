@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func harnessProviders() []Provider {
+	return []Provider{
+		{Name: "a", APIURL: "https://a", APIKey: "k", Enabled: true, Level: 1},
+		{Name: "b", APIURL: "https://b", APIKey: "k", Enabled: true, Level: 1},
+		{Name: "c", APIURL: "https://c", APIKey: "k", Enabled: true, Level: 2},
+		{Name: "fallback", APIURL: "https://f", APIKey: "k", Enabled: true, Level: 1, LastResort: true},
+		{Name: "off", APIURL: "https://o", APIKey: "k", Enabled: false, Level: 1},
+	}
+}
+
+func TestTestHarness_Run(t *testing.T) {
+	errUpstream := errors.New("upstream 502")
+	fatal := newUpstreamStatusError(400, []byte(`{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`), "")
+
+	tests := []struct {
+		name         string
+		setup        func(h *TestHarness)
+		wantAttempts []string
+		wantProvider string
+		wantErr      error
+	}{
+		{
+			name:         "首个 provider 成功",
+			setup:        func(h *TestHarness) { h.Succeed("a", "ok") },
+			wantAttempts: []string{"a"},
+			wantProvider: "a",
+		},
+		{
+			name: "同 Level 故障转移后降级",
+			setup: func(h *TestHarness) {
+				h.Fail("a", errUpstream).Fail("b", errUpstream).Succeed("c", "ok")
+			},
+			wantAttempts: []string{"a", "b", "c"},
+			wantProvider: "c",
+		},
+		{
+			name: "单 provider 重试后成功",
+			setup: func(h *TestHarness) {
+				h.MaxRetryPerProvider = 2
+				h.Script("a", HarnessResponse{Err: errUpstream}, HarnessResponse{Body: []byte("ok")})
+			},
+			wantAttempts: []string{"a", "a"},
+			wantProvider: "a",
+		},
+		{
+			name: "全部失败后使用兜底 provider",
+			setup: func(h *TestHarness) {
+				h.Fail("a", errUpstream).Fail("b", errUpstream).Fail("c", errUpstream).Succeed("fallback", "ok")
+			},
+			wantAttempts: []string{"a", "b", "c", "fallback"},
+			wantProvider: "fallback",
+		},
+		{
+			name:         "致命错误不故障转移",
+			setup:        func(h *TestHarness) { h.Fail("a", fatal).Succeed("b", "ok") },
+			wantAttempts: []string{"a"},
+			wantErr:      fatal,
+		},
+		{
+			name: "拉黑的 provider 不参与",
+			setup: func(h *TestHarness) {
+				h.Blacklisted = map[string]bool{"a": true}
+				h.Succeed("b", "ok")
+			},
+			wantAttempts: []string{"b"},
+			wantProvider: "b",
+		},
+		{
+			name: "达到总尝试次数上限",
+			setup: func(h *TestHarness) {
+				h.MaxTotalAttempts = 2
+				h.Fail("a", errUpstream).Fail("b", errUpstream).Succeed("c", "ok")
+			},
+			wantAttempts: []string{"a", "b"},
+			wantErr:      errUpstream,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewTestHarness(PlatformClaude, harnessProviders()...)
+			tt.setup(h)
+			result := h.Run(context.Background(), "")
+
+			if got := result.AttemptOrder(); !slices.Equal(got, tt.wantAttempts) {
+				t.Errorf("尝试顺序 = %v, want %v", got, tt.wantAttempts)
+			}
+			if result.Provider != tt.wantProvider {
+				t.Errorf("Provider = %q, want %q", result.Provider, tt.wantProvider)
+			}
+			if !errors.Is(result.Err, tt.wantErr) {
+				t.Errorf("Err = %v, want %v", result.Err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTestHarness_RoundRobinAcrossRuns(t *testing.T) {
+	h := NewTestHarness(PlatformClaude, harnessProviders()...)
+	h.Succeed("a", "ok").Succeed("b", "ok")
+
+	var winners []string
+	for range 3 {
+		winners = append(winners, h.Run(context.Background(), "").Provider)
+	}
+	if !slices.Equal(winners, []string{"a", "b", "a"}) {
+		t.Errorf("轮询结果 = %v, want [a b a]", winners)
+	}
+}
+
+func TestTestHarness_NoProviders(t *testing.T) {
+	result := NewTestHarness(PlatformClaude).Run(context.Background(), "")
+	if !errors.Is(result.Err, ErrNoProvidersConfigured) || len(result.Attempts) != 0 {
+		t.Errorf("result = %+v", result)
+	}
+
+	h := NewTestHarness(PlatformClaude, Provider{Name: "off", APIURL: "https://o", APIKey: "k"})
+	if result := h.Run(context.Background(), ""); !errors.Is(result.Err, ErrAllProvidersFiltered) {
+		t.Errorf("Err = %v, want ErrAllProvidersFiltered", result.Err)
+	}
+	h = NewTestHarness(PlatformClaude, harnessProviders()[0])
+	if result := h.Run(context.Background(), ""); !errors.Is(result.Err, ErrHarnessUnscripted) {
+		t.Errorf("未设置脚本的 provider 应返回 ErrHarnessUnscripted, got %v", result.Err)
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ============================================================================
+// 对冲请求（并发竞速）
+// ============================================================================
+
+// ErrNoProviders 没有可尝试的 provider
+var ErrNoProviders = errors.New("no providers to try")
+
+// hedgeOutcome 单个 provider 的执行结果
+type hedgeOutcome[T any, R any] struct {
+	provider T
+	result   R
+	err      error
+}
+
+// HedgedSelect 按顺序对 providers 发起对冲请求，返回第一个成功的结果
+// 算法：
+//   - 先发起第一个 provider；每隔 stagger 再追加一个，同时在途请求不超过 n 个
+//   - 某个请求失败时立即补发下一个 provider（不等待 stagger）
+//   - 第一个成功的结果返回后，取消其余在途请求
+//   - n <= 1 时退化为顺序尝试
+//
+// do 必须响应 ctx 取消；结果通道带缓冲，落败的 goroutine 在 do 返回后即退出，不会泄漏
+// 全部失败时返回最后一个错误；父 ctx 被取消时返回 ctx.Err()
+func HedgedSelect[T any, R any](
+	ctx context.Context,
+	providers []T,
+	n int,
+	stagger time.Duration,
+	do func(ctx context.Context, provider T) (R, error),
+) (R, T, error) {
+	var zeroR R
+	var zeroT T
+
+	if len(providers) == 0 {
+		return zeroR, zeroT, ErrNoProviders
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // 返回时取消所有落败的在途请求
+
+	results := make(chan hedgeOutcome[T, R], len(providers))
+	next, inFlight := 0, 0
+
+	var staggerTimer *time.Timer
+	var staggerC <-chan time.Time
+	stopTimer := func() {
+		if staggerTimer != nil {
+			staggerTimer.Stop()
+			staggerTimer = nil
+		}
+		staggerC = nil
+	}
+	defer stopTimer()
+
+	launch := func() {
+		p := providers[next]
+		next++
+		inFlight++
+		go func() {
+			r, err := do(ctx, p)
+			results <- hedgeOutcome[T, R]{provider: p, result: r, err: err}
+		}()
+
+		// 还有剩余 provider 且未达到并发上限时，安排下一次对冲
+		stopTimer()
+		if next < len(providers) && inFlight < n {
+			staggerTimer = time.NewTimer(stagger)
+			staggerC = staggerTimer.C
+		}
+	}
+
+	launch()
+
+	var lastErr error
+	for inFlight > 0 {
+		select {
+		case <-ctx.Done():
+			return zeroR, zeroT, ctx.Err()
+
+		case <-staggerC:
+			launch()
+
+		case out := <-results:
+			inFlight--
+			if out.err == nil {
+				return out.result, out.provider, nil
+			}
+			lastErr = out.err
+			// 失败释放了一个并发槽位，立即补发下一个
+			if next < len(providers) && inFlight < n {
+				launch()
+			}
+		}
+	}
+
+	return zeroR, zeroT, fmt.Errorf("所有 %d 个 provider 均失败: %w", len(providers), lastErr)
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgedSelect(t *testing.T) {
+	t.Run("快者胜出并取消慢者", func(t *testing.T) {
+		var cancelled atomic.Int32
+		do := func(ctx context.Context, name string) (string, error) {
+			delay := map[string]time.Duration{"slow": time.Second, "fast": 10 * time.Millisecond}[name]
+			select {
+			case <-time.After(delay):
+				return name, nil
+			case <-ctx.Done():
+				cancelled.Add(1)
+				return "", ctx.Err()
+			}
+		}
+
+		before := runtime.NumGoroutine()
+		result, winner, err := HedgedSelect(context.Background(), []string{"slow", "fast"}, 2, 5*time.Millisecond, do)
+		if err != nil || result != "fast" || winner != "fast" {
+			t.Fatalf("结果 = %s/%s/%v, 期望 fast", result, winner, err)
+		}
+
+		// 落败的 goroutine 应在取消后退出
+		deadline := time.Now().Add(time.Second)
+		for cancelled.Load() == 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if cancelled.Load() != 1 {
+			t.Error("落败的请求未被取消")
+		}
+		time.Sleep(20 * time.Millisecond)
+		if after := runtime.NumGoroutine(); after > before {
+			t.Errorf("goroutine 泄漏: before=%d after=%d", before, after)
+		}
+	})
+
+	t.Run("n=1 顺序尝试", func(t *testing.T) {
+		var order []string
+		var concurrent, maxConcurrent atomic.Int32
+		do := func(ctx context.Context, name string) (string, error) {
+			if c := concurrent.Add(1); c > maxConcurrent.Load() {
+				maxConcurrent.Store(c)
+			}
+			defer concurrent.Add(-1)
+			order = append(order, name)
+			time.Sleep(5 * time.Millisecond)
+			if name == "c" {
+				return name, nil
+			}
+			return "", errors.New("fail")
+		}
+
+		_, winner, err := HedgedSelect(context.Background(), []string{"a", "b", "c"}, 1, 0, do)
+		if err != nil || winner != "c" {
+			t.Fatalf("winner = %s, err = %v", winner, err)
+		}
+		if maxConcurrent.Load() != 1 {
+			t.Errorf("n=1 时最大并发 = %d, 期望 1", maxConcurrent.Load())
+		}
+		if len(order) != 3 || order[0] != "a" || order[1] != "b" {
+			t.Errorf("尝试顺序 = %v", order)
+		}
+	})
+
+	t.Run("全部失败", func(t *testing.T) {
+		boom := errors.New("boom")
+		_, _, err := HedgedSelect(context.Background(), []string{"a", "b"}, 2, time.Millisecond,
+			func(ctx context.Context, name string) (string, error) { return "", boom })
+		if !errors.Is(err, boom) {
+			t.Errorf("err = %v, 期望包装 boom", err)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package services
+
+import "net/http"
+
+// ============================================================================
+// 按 Provider 定制 HTTP 客户端
+// ============================================================================
+
+// defaultProviderClient 未配置 HTTPClient 的 provider 共享的客户端
+var defaultProviderClient = &http.Client{Transport: http.DefaultTransport}
+
+// ClientFor 返回 provider 使用的 HTTP 客户端：配置了 HTTPClient 时返回它，否则返回共享的默认客户端
+// 用于按上游隔离网络设置（代理、mTLS、连接池大小等）
+func ClientFor(p Provider) *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return defaultProviderClient
+}
+
+// requestClientFor 返回可安全修改 Timeout 的客户端副本（共享 Transport 与连接池）
+// xrequest 会直接改写传入客户端的 Timeout，不能把 provider 的客户端原样交给它
+func requestClientFor(p Provider) *http.Client {
+	client := *ClientFor(p)
+	return &client
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClientFor(t *testing.T) {
+	if ClientFor(Provider{Name: "a"}) != defaultProviderClient || ClientFor(Provider{Name: "b"}) != defaultProviderClient {
+		t.Error("未配置 HTTPClient 时应共享默认客户端")
+	}
+
+	custom := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 64}, Timeout: time.Minute}
+	p := Provider{Name: "c", HTTPClient: custom}
+	if ClientFor(p) != custom {
+		t.Error("应返回 provider 自己的客户端")
+	}
+	if ClientFor(p.Clone()) != custom {
+		t.Error("Clone 后应仍使用同一客户端")
+	}
+
+	t.Run("请求副本不影响原客户端", func(t *testing.T) {
+		copied := requestClientFor(p)
+		copied.Timeout = time.Second
+		if custom.Timeout != time.Minute || copied.Transport != custom.Transport {
+			t.Errorf("副本应共享 Transport 且不改写原 Timeout: %v", custom.Timeout)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// 幂等键去重
+// ============================================================================
+
+// IdempotencyHeader 客户端传递幂等键的请求头
+const IdempotencyHeader = "Idempotency-Key"
+
+// DefaultIdempotencyTTL 请求完成后结果的保留时间
+const DefaultIdempotencyTTL = 10 * time.Minute
+
+// IdempotencyResult 首个请求的响应结果，供重复请求直接返回
+type IdempotencyResult struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyCache 按幂等键记录进行中/已完成的请求，防止客户端重试导致上游重复计费
+type IdempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	done      chan struct{} // 首个请求完成时关闭
+	result    IdempotencyResult
+	expiresAt time.Time // 完成后设置；进行中为零值，不会被淘汰
+}
+
+// NewIdempotencyCache 创建幂等缓存，ttl <= 0 时使用 DefaultIdempotencyTTL
+func NewIdempotencyCache(ttl time.Duration) *IdempotencyCache {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return &IdempotencyCache{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// Begin 登记一个幂等键
+//   - 首次出现：返回 inFlight=false 和 done 回调，调用方处理完成后必须调用 done 保存结果（仅第一次调用生效）
+//   - 重复出现（进行中或未过期）：返回 inFlight=true、done=nil，调用方可用 Wait 获取首个结果，或直接拒绝
+//
+// key 为空时不做去重，返回 inFlight=false 和空操作的 done
+func (ic *IdempotencyCache) Begin(key string) (inFlight bool, done func(IdempotencyResult)) {
+	if key == "" {
+		return false, func(IdempotencyResult) {}
+	}
+
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	now := clockNow()
+	ic.evictLocked(now)
+
+	if _, ok := ic.entries[key]; ok {
+		return true, nil
+	}
+
+	entry := &idempotencyEntry{done: make(chan struct{})}
+	ic.entries[key] = entry
+
+	var once sync.Once
+	return false, func(result IdempotencyResult) {
+		once.Do(func() {
+			ic.mu.Lock()
+			entry.result = result
+			entry.expiresAt = clockNow().Add(ic.ttl)
+			ic.mu.Unlock()
+			close(entry.done)
+		})
+	}
+}
+
+// Wait 等待首个请求完成并返回其结果
+// 键不存在（未登记或已过期）或 ctx 结束时返回 false
+func (ic *IdempotencyCache) Wait(ctx context.Context, key string) (IdempotencyResult, bool) {
+	ic.mu.Lock()
+	entry, ok := ic.entries[key]
+	ic.mu.Unlock()
+	if !ok {
+		return IdempotencyResult{}, false
+	}
+
+	select {
+	case <-entry.done:
+		ic.mu.Lock()
+		defer ic.mu.Unlock()
+		return entry.result, true
+	case <-ctx.Done():
+		return IdempotencyResult{}, false
+	}
+}
+
+// evictLocked 淘汰已完成且过期的记录（调用方需持有锁）
+func (ic *IdempotencyCache) evictLocked(now time.Time) {
+	for key, entry := range ic.entries {
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			delete(ic.entries, key)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyCache(t *testing.T) {
+	ic := NewIdempotencyCache(50 * time.Millisecond)
+
+	inFlight, done := ic.Begin("k1")
+	if inFlight || done == nil {
+		t.Fatal("首次登记不应视为重复")
+	}
+	if dup, dupDone := ic.Begin("k1"); !dup || dupDone != nil {
+		t.Fatal("进行中的重复键应返回 inFlight=true")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		done(IdempotencyResult{StatusCode: 200, Body: []byte("ok")})
+		done(IdempotencyResult{StatusCode: 500}) // 重复调用无效
+	}()
+
+	result, ok := ic.Wait(context.Background(), "k1")
+	if !ok || result.StatusCode != 200 || string(result.Body) != "ok" {
+		t.Fatalf("Wait() = %+v, %v", result, ok)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if dup, _ := ic.Begin("k1"); dup {
+		t.Error("过期后应允许重新登记")
+	}
+
+	if dup, done := ic.Begin(""); dup || done == nil {
+		t.Error("空键不应去重")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok := ic.Wait(ctx, "k1"); ok {
+		t.Error("ctx 已取消时 Wait 应返回 false")
+	}
+}
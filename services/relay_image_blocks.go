@@ -0,0 +1,221 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ============================================================================
+// 图片内容块的跨格式转换
+// ============================================================================
+
+// defaultImageMediaType 无法确定远程图片类型时使用的 MIME 类型（Gemini 的 fileData 要求必须提供）
+const defaultImageMediaType = "image/jpeg"
+
+// imageRef 与格式无关的图片：内联 base64 数据或远程 URL，二者取其一
+type imageRef struct {
+	MediaType string
+	Data      string // base64 数据（不含 data URL 前缀）
+	URL       string // 远程 URL
+}
+
+// ConvertImageBlocks 将请求体中 from 格式的图片内容块转换为 to 格式，其余内容不变
+// 在整个请求体中查找图片块（包括嵌套在 tool_result 等内容中的），因此可以在消息结构转换之前或之后调用
+//   - Claude:    {"type":"image","source":{"type":"base64","media_type":..,"data":..}} / source.type=url
+//   - OpenAI:    {"type":"image_url","image_url":{"url":"data:<type>;base64,<data>" 或远程 URL}}
+//   - Responses: {"type":"input_image","image_url":"data:..." 或远程 URL}
+//   - Gemini:    {"inlineData":{"mimeType":..,"data":..}} / {"fileData":{"mimeType":..,"fileUri":..}}
+//
+// base64 数据与 MIME 类型原样保留；远程 URL 不下载，直接以目标格式的 URL 引用传递
+// （Gemini 的 fileData 需要 MIME 类型，按 URL 扩展名推断，无法推断时使用 defaultImageMediaType）
+func ConvertImageBlocks(bodyBytes []byte, from, to Format) ([]byte, error) {
+	for _, f := range []Format{from, to} {
+		if !isImageFormat(f) {
+			return bodyBytes, fmt.Errorf("不支持的图片格式: %q", f)
+		}
+	}
+	if from == to || !gjson.ValidBytes(bodyBytes) {
+		return bodyBytes, nil
+	}
+
+	var paths []string
+	var images []imageRef
+	var walk func(prefix string, value gjson.Result)
+	walk = func(prefix string, value gjson.Result) {
+		if value.IsObject() {
+			if img, ok := parseImageBlock(value, from); ok {
+				paths = append(paths, prefix)
+				images = append(images, img)
+				return
+			}
+		}
+		if !value.IsObject() && !value.IsArray() {
+			return
+		}
+		value.ForEach(func(key, child gjson.Result) bool {
+			childPath := escapePathKey(key.String())
+			if prefix != "" {
+				childPath = prefix + "." + childPath
+			}
+			walk(childPath, child)
+			return true
+		})
+	}
+	walk("", gjson.ParseBytes(bodyBytes))
+	if len(paths) == 0 {
+		return bodyBytes, nil
+	}
+
+	result := bodyBytes
+	for i, p := range paths {
+		raw, err := json.Marshal(buildImageBlock(images[i], to))
+		if err != nil {
+			return bodyBytes, fmt.Errorf("构造图片块失败: %w", err)
+		}
+		if result, err = sjson.SetRawBytes(result, p, raw); err != nil {
+			return bodyBytes, fmt.Errorf("替换 %s 失败: %w", p, err)
+		}
+	}
+	return result, nil
+}
+
+// isImageFormat 是否为支持图片转换的格式
+func isImageFormat(f Format) bool {
+	switch f {
+	case FormatClaude, FormatOpenAI, FormatOpenAIResponses, FormatGemini:
+		return true
+	}
+	return false
+}
+
+// parseImageBlock 识别 format 格式的图片块
+func parseImageBlock(block gjson.Result, format Format) (imageRef, bool) {
+	switch format {
+	case FormatClaude:
+		if block.Get("type").String() != "image" {
+			return imageRef{}, false
+		}
+		source := block.Get("source")
+		switch source.Get("type").String() {
+		case "base64":
+			return imageRef{MediaType: source.Get("media_type").String(), Data: source.Get("data").String()}, true
+		case "url":
+			return imageRef{URL: source.Get("url").String()}, true
+		}
+	case FormatOpenAI:
+		if block.Get("type").String() == "image_url" {
+			return parseImageURL(block.Get("image_url.url").String())
+		}
+	case FormatOpenAIResponses:
+		if block.Get("type").String() == "input_image" {
+			return parseImageURL(block.Get("image_url").String())
+		}
+	case FormatGemini:
+		// 兼容 REST 的 camelCase 与 proto 风格的 snake_case 字段名
+		if inline := firstField(block, "inlineData", "inline_data"); inline.Exists() {
+			return imageRef{
+				MediaType: firstField(inline, "mimeType", "mime_type").String(),
+				Data:      inline.Get("data").String(),
+			}, true
+		}
+		if file := firstField(block, "fileData", "file_data"); file.Exists() {
+			ref := imageRef{
+				MediaType: firstField(file, "mimeType", "mime_type").String(),
+				URL:       firstField(file, "fileUri", "file_uri").String(),
+			}
+			return ref, strings.HasPrefix(ref.MediaType, "image/") || ref.MediaType == ""
+		}
+	}
+	return imageRef{}, false
+}
+
+// parseImageURL 解析 data URL（data:<type>;base64,<data>）或远程 URL
+func parseImageURL(raw string) (imageRef, bool) {
+	if raw == "" {
+		return imageRef{}, false
+	}
+	rest, ok := strings.CutPrefix(raw, "data:")
+	if !ok {
+		return imageRef{URL: raw}, true
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return imageRef{}, false
+	}
+	return imageRef{MediaType: strings.TrimSuffix(meta, ";base64"), Data: data}, true
+}
+
+// buildImageBlock 构造 format 格式的图片块
+func buildImageBlock(img imageRef, format Format) map[string]any {
+	switch format {
+	case FormatClaude:
+		if img.URL != "" {
+			return map[string]any{"type": "image", "source": map[string]any{"type": "url", "url": img.URL}}
+		}
+		return map[string]any{"type": "image", "source": map[string]any{
+			"type": "base64", "media_type": img.MediaType, "data": img.Data,
+		}}
+	case FormatOpenAI:
+		return map[string]any{"type": "image_url", "image_url": map[string]any{"url": img.dataURL()}}
+	case FormatOpenAIResponses:
+		return map[string]any{"type": "input_image", "image_url": img.dataURL()}
+	default: // FormatGemini
+		if img.URL != "" {
+			return map[string]any{"fileData": map[string]any{"mimeType": img.remoteMediaType(), "fileUri": img.URL}}
+		}
+		return map[string]any{"inlineData": map[string]any{"mimeType": img.MediaType, "data": img.Data}}
+	}
+}
+
+// dataURL 远程图片返回原 URL，内联图片返回 data URL
+func (img imageRef) dataURL() string {
+	if img.URL != "" {
+		return img.URL
+	}
+	return "data:" + img.MediaType + ";base64," + img.Data
+}
+
+// remoteMediaType 远程图片的 MIME 类型：已知时直接使用，否则按 URL 扩展名推断
+func (img imageRef) remoteMediaType() string {
+	if img.MediaType != "" {
+		return img.MediaType
+	}
+	if u, err := url.Parse(img.URL); err == nil {
+		if t := mime.TypeByExtension(strings.ToLower(path.Ext(u.Path))); strings.HasPrefix(t, "image/") {
+			return t
+		}
+	}
+	return defaultImageMediaType
+}
+
+// firstField 返回第一个存在的字段
+func firstField(value gjson.Result, names ...string) gjson.Result {
+	for _, name := range names {
+		if field := value.Get(name); field.Exists() {
+			return field
+		}
+	}
+	return gjson.Result{}
+}
+
+// escapePathKey 转义 gjson/sjson 路径中的特殊字符
+func escapePathKey(key string) string {
+	if !strings.ContainsAny(key, ".*?|#@!\\") {
+		return key
+	}
+	var sb strings.Builder
+	for _, r := range key {
+		if strings.ContainsRune(".*?|#@!\\", r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
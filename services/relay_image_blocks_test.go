@@ -0,0 +1,93 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestConvertImageBlocks(t *testing.T) {
+	const (
+		claudeInline    = `{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0K"}}`
+		claudeRemote    = `{"type":"image","source":{"type":"url","url":"https://example.com/cat.webp"}}`
+		openAIInline    = `{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0K"}}`
+		openAIRemote    = `{"type":"image_url","image_url":{"url":"https://example.com/cat.webp"}}`
+		responsesInline = `{"type":"input_image","image_url":"data:image/png;base64,iVBORw0K"}`
+		geminiInline    = `{"inlineData":{"mimeType":"image/png","data":"iVBORw0K"}}`
+		geminiRemote    = `{"fileData":{"mimeType":"image/webp","fileUri":"https://example.com/cat.webp"}}`
+	)
+	wrap := func(block string) string {
+		return `{"messages":[{"role":"user","content":[{"type":"text","text":"看图"},` + block + `]}]}`
+	}
+
+	tests := []struct {
+		name     string
+		from, to Format
+		block    string
+		want     string
+	}{
+		{"Claude → OpenAI", FormatClaude, FormatOpenAI, claudeInline, openAIInline},
+		{"Claude → Responses", FormatClaude, FormatOpenAIResponses, claudeInline, responsesInline},
+		{"Claude → Gemini", FormatClaude, FormatGemini, claudeInline, geminiInline},
+		{"OpenAI → Claude", FormatOpenAI, FormatClaude, openAIInline, claudeInline},
+		{"OpenAI → Gemini", FormatOpenAI, FormatGemini, openAIInline, geminiInline},
+		{"Gemini → Claude", FormatGemini, FormatClaude, geminiInline, claudeInline},
+		{"Gemini → OpenAI", FormatGemini, FormatOpenAI, geminiInline, openAIInline},
+		{"Gemini snake_case 字段", FormatGemini, FormatClaude, `{"inline_data":{"mime_type":"image/png","data":"iVBORw0K"}}`, claudeInline},
+		{"远程 URL Claude → OpenAI", FormatClaude, FormatOpenAI, claudeRemote, openAIRemote},
+		{"远程 URL OpenAI → Claude", FormatOpenAI, FormatClaude, openAIRemote, claudeRemote},
+		{"远程 URL 推断 Gemini 的 mimeType", FormatOpenAI, FormatGemini, openAIRemote, geminiRemote},
+		{"远程 URL Gemini → Claude", FormatGemini, FormatClaude, geminiRemote, claudeRemote},
+		{"无法推断类型的远程 URL", FormatClaude, FormatGemini,
+			`{"type":"image","source":{"type":"url","url":"https://example.com/img?id=1"}}`,
+			`{"fileData":{"mimeType":"image/jpeg","fileUri":"https://example.com/img?id=1"}}`},
+		{"非 base64 的 data URL 不转换", FormatOpenAI, FormatClaude,
+			`{"type":"image_url","image_url":{"url":"data:image/svg+xml,<svg/>"}}`,
+			`{"type":"image_url","image_url":{"url":"data:image/svg+xml,<svg/>"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConvertImageBlocks([]byte(wrap(tt.block)), tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("ConvertImageBlocks() error = %v", err)
+			}
+			if text := gjson.GetBytes(got, "messages.0.content.0.text").String(); text != "看图" {
+				t.Errorf("非图片内容应保持不变: %s", got)
+			}
+			block := gjson.GetBytes(got, "messages.0.content.1")
+			if !jsonEqual(block.Raw, tt.want) {
+				t.Errorf("图片块 = %s\nwant %s", block.Raw, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertImageBlocks_Nested(t *testing.T) {
+	body := `{"messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":[` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/jpeg","data":"/9j/"}}]}]}]}`
+	got, err := ConvertImageBlocks([]byte(body), FormatClaude, FormatOpenAI)
+	if err != nil {
+		t.Fatalf("ConvertImageBlocks() error = %v", err)
+	}
+	if url := gjson.GetBytes(got, "messages.0.content.0.content.0.image_url.url").String(); url != "data:image/jpeg;base64,/9j/" {
+		t.Errorf("嵌套的图片块应被转换: %s", got)
+	}
+
+	if _, err := ConvertImageBlocks([]byte(body), FormatClaude, "xml"); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+	if same, err := ConvertImageBlocks([]byte(body), FormatClaude, FormatClaude); err != nil || string(same) != body {
+		t.Errorf("相同格式应原样返回: %s, %v", same, err)
+	}
+}
+
+// jsonEqual 比较两个 JSON 是否等价（忽略字段顺序）
+func jsonEqual(a, b string) bool {
+	var va, vb any
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
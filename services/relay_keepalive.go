@@ -0,0 +1,228 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// 流式 keepalive 注入
+// ============================================================================
+
+// keepAlivePing SSE 注释行，符合规范的客户端会忽略
+var keepAlivePing = []byte(": ping\n\n")
+
+// streamKeepAliveInterval 流式响应首字节前的心跳间隔（纳秒），0 表示关闭
+var streamKeepAliveInterval atomic.Int64
+
+// SetStreamKeepAlive 设置流式响应首字节前的心跳间隔，<= 0 关闭
+func SetStreamKeepAlive(interval time.Duration) {
+	if interval < 0 {
+		interval = 0
+	}
+	streamKeepAliveInterval.Store(int64(interval))
+}
+
+// streamKeepAlive 返回当前心跳间隔，0 表示关闭
+func streamKeepAlive() time.Duration {
+	return time.Duration(streamKeepAliveInterval.Load())
+}
+
+// errResponseCommitted 心跳已写出响应头后上游才失败：换 provider 会重复写入响应，调用方应直接结束本次请求
+var errResponseCommitted = errors.New("response already committed to client")
+
+// peekWithKeepAlive 预读上游流（见 StreamGuard.Peek），预读期间按 interval 向客户端发送心跳
+//   - interval 内预读结束：与 guard.Peek 相同，响应头尚未写出，出错时调用方可以故障转移
+//   - 超过 interval：调用 commit 写出响应头，之后每隔 interval 写入 ": ping"，直到预读结束；
+//     此时预读出错不能再切换 provider，已读到的上游原始数据（含 error 事件）原样转发给客户端，返回 errResponseCommitted
+//
+// guard 未开启时等待上游首个数据块，同样在等待期间发送心跳；返回值 committed 表示响应头是否已由 commit 写出
+func peekWithKeepAlive(guard StreamGuard, body io.ReadCloser, interval time.Duration, w http.ResponseWriter, commit func()) (io.ReadCloser, bool, error) {
+	if interval <= 0 || body == nil {
+		stream, err := guard.Peek(body)
+		return stream, false, err
+	}
+	peek := guard.Peek
+	if !guard.Enabled() {
+		peek = waitFirstChunk
+	}
+
+	rec := &recordingReader{ReadCloser: body}
+	type peekResult struct {
+		stream io.ReadCloser
+		err    error
+	}
+	done := make(chan peekResult, 1)
+	go func() {
+		stream, err := peek(rec)
+		done <- peekResult{stream, err}
+	}()
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	committed := false
+	for {
+		select {
+		case r := <-done:
+			recorded := rec.stop()
+			if r.err != nil && committed {
+				_, _ = w.Write(recorded)
+				flushWriter(w)
+				return nil, true, fmt.Errorf("%w: %v", errResponseCommitted, r.err)
+			}
+			return r.stream, committed, r.err
+		case <-timer.C:
+			if !committed {
+				commit()
+				committed = true
+			}
+			if _, err := w.Write(keepAlivePing); err != nil {
+				// 客户端已断开：关闭上游使预读尽快返回
+				_ = body.Close()
+				if r := <-done; r.stream != nil {
+					_ = r.stream.Close()
+				}
+				return nil, true, fmt.Errorf("%w: %v", errResponseCommitted, err)
+			}
+			flushWriter(w)
+			timer.Reset(interval)
+		}
+	}
+}
+
+// waitFirstChunk 等待上游首个数据块，读到后原样放回流的开头；首个数据块之前读取失败时关闭 body 并返回错误
+func waitFirstChunk(body io.ReadCloser) (io.ReadCloser, error) {
+	chunk := make([]byte, 4096)
+	for {
+		n, err := body.Read(chunk)
+		if n > 0 || err == io.EOF {
+			return replayStream(chunk[:n], body), nil
+		}
+		if err != nil {
+			_ = body.Close()
+			return nil, err
+		}
+	}
+}
+
+// recordingReader 记录预读阶段读到的原始数据，stop 之后不再记录
+type recordingReader struct {
+	io.ReadCloser
+	buf     bytes.Buffer
+	stopped bool
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if !r.stopped {
+		r.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+// stop 停止记录并返回已记录的数据；只能在预读结束后调用
+func (r *recordingReader) stop() []byte {
+	r.stopped = true
+	return r.buf.Bytes()
+}
+
+func flushWriter(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// KeepAliveStream 包装上游 SSE 流，在首个真实数据到达前每隔 interval 注入 ": ping" 注释行
+// 真实数据开始流动后不再注入，之后原样透传；上游结束（EOF 或错误）时后台 goroutine 自动退出
+// 返回值同时实现 io.Closer：调用方提前放弃读取时应 Close，以释放后台 goroutine 并关闭上游（若上游可关闭）
+func KeepAliveStream(upstream io.Reader, interval time.Duration) io.ReadCloser {
+	pr, pw := io.Pipe()
+	ka := &keepAliveStream{pr: pr, upstream: upstream}
+	if interval <= 0 {
+		go ka.pump(pw, nil)
+		return ka
+	}
+
+	stop := make(chan struct{})
+	go ka.pump(pw, stop)
+	go ka.ping(pw, interval, stop)
+	return ka
+}
+
+type keepAliveStream struct {
+	pr       *io.PipeReader
+	upstream io.Reader
+
+	mu      sync.Mutex // 保证 ping 与真实数据不交错写入
+	started bool       // 真实数据已开始流动
+}
+
+func (ka *keepAliveStream) Read(p []byte) (int, error) { return ka.pr.Read(p) }
+
+// Close 停止读取；上游实现 io.Closer 时一并关闭，使阻塞中的上游读取尽快返回
+func (ka *keepAliveStream) Close() error {
+	_ = ka.pr.Close()
+	if closer, ok := ka.upstream.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// pump 将上游数据复制到 pipe，结束时关闭 pipe 并通知 ping 停止
+func (ka *keepAliveStream) pump(pw *io.PipeWriter, stop chan struct{}) {
+	if stop != nil {
+		defer close(stop)
+	}
+
+	buf := make([]byte, 8192)
+	for {
+		n, err := ka.upstream.Read(buf)
+		if n > 0 {
+			ka.mu.Lock()
+			ka.started = true
+			_, writeErr := pw.Write(buf[:n])
+			ka.mu.Unlock()
+			if writeErr != nil {
+				return
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				_ = pw.Close()
+			} else {
+				_ = pw.CloseWithError(err)
+			}
+			return
+		}
+	}
+}
+
+// ping 在真实数据到达前周期性写入心跳
+func (ka *keepAliveStream) ping(pw *io.PipeWriter, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ka.mu.Lock()
+			if ka.started {
+				ka.mu.Unlock()
+				return
+			}
+			_, err := pw.Write(keepAlivePing)
+			ka.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slowReader 在首次读取前等待 delay，然后返回 data
+type slowReader struct {
+	delay time.Duration
+	data  *strings.Reader
+	slept bool
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if !r.slept {
+		time.Sleep(r.delay)
+		r.slept = true
+	}
+	return r.data.Read(p)
+}
+
+func TestKeepAliveStream(t *testing.T) {
+	t.Run("首字节前注入心跳", func(t *testing.T) {
+		upstream := &slowReader{delay: 60 * time.Millisecond, data: strings.NewReader("data: {}\n\n")}
+		out, err := io.ReadAll(KeepAliveStream(upstream, 10*time.Millisecond))
+		if err != nil {
+			t.Fatalf("读取失败: %v", err)
+		}
+		if !bytes.HasPrefix(out, keepAlivePing) {
+			t.Errorf("输出应以心跳开头: %q", out)
+		}
+		if !bytes.HasSuffix(out, []byte("data: {}\n\n")) {
+			t.Errorf("真实数据应完整透传: %q", out)
+		}
+	})
+
+	t.Run("数据立即到达时不注入", func(t *testing.T) {
+		out, err := io.ReadAll(KeepAliveStream(strings.NewReader("data: x\n\n"), time.Hour))
+		if err != nil {
+			t.Fatalf("读取失败: %v", err)
+		}
+		if string(out) != "data: x\n\n" {
+			t.Errorf("输出 = %q", out)
+		}
+	})
+}
+
+func TestPeekWithKeepAlive(t *testing.T) {
+	guard := StreamGuard{MaxEvents: DefaultStreamGuardEvents, MaxBytes: DefaultStreamGuardBytes}
+	content := "data: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"hi\"}}\n\n"
+
+	// slowBody 延迟 delay 后写入 data
+	slowBody := func(delay time.Duration, data string) io.ReadCloser {
+		pr, pw := io.Pipe()
+		go func() {
+			time.Sleep(delay)
+			_, _ = pw.Write([]byte(data))
+			_ = pw.Close()
+		}()
+		return pr
+	}
+
+	t.Run("间隔内预读完成时不写出响应头", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		commits := 0
+		stream, committed, err := peekWithKeepAlive(guard, io.NopCloser(strings.NewReader(content)), time.Hour, w, func() { commits++ })
+		if err != nil || committed || commits != 0 || w.Body.Len() != 0 {
+			t.Fatalf("err=%v committed=%v commits=%d body=%q", err, committed, commits, w.Body.String())
+		}
+		if out, _ := io.ReadAll(stream); string(out) != content {
+			t.Errorf("stream = %q", out)
+		}
+	})
+
+	t.Run("预读期间发送心跳", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		commits := 0
+		stream, committed, err := peekWithKeepAlive(guard, slowBody(60*time.Millisecond, content), 10*time.Millisecond, w, func() { commits++ })
+		if err != nil || !committed || commits != 1 {
+			t.Fatalf("err=%v committed=%v commits=%d", err, committed, commits)
+		}
+		if !bytes.HasPrefix(w.Body.Bytes(), keepAlivePing) {
+			t.Errorf("客户端应先收到心跳: %q", w.Body.String())
+		}
+		if out, _ := io.ReadAll(stream); string(out) != content {
+			t.Errorf("stream = %q, 心跳不应混入上游数据", out)
+		}
+	})
+
+	t.Run("心跳后出错时原样转发上游错误", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		errEvent := "event: error\ndata: {\"type\":\"error\",\"error\":{\"message\":\"overloaded\"}}\n\n"
+		_, committed, err := peekWithKeepAlive(guard, slowBody(60*time.Millisecond, errEvent), 10*time.Millisecond, w, func() {})
+		if !committed || !errors.Is(err, errResponseCommitted) || !strings.Contains(err.Error(), "overloaded") {
+			t.Fatalf("committed=%v err=%v", committed, err)
+		}
+		if !strings.HasSuffix(w.Body.String(), errEvent) {
+			t.Errorf("客户端应收到上游 error 事件: %q", w.Body.String())
+		}
+	})
+
+	t.Run("未开启预读时等待首个数据块", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		stream, committed, err := peekWithKeepAlive(StreamGuard{}, slowBody(60*time.Millisecond, content), 10*time.Millisecond, w, func() {})
+		if err != nil || !committed || !bytes.HasPrefix(w.Body.Bytes(), keepAlivePing) {
+			t.Fatalf("err=%v committed=%v body=%q", err, committed, w.Body.String())
+		}
+		if out, _ := io.ReadAll(stream); string(out) != content {
+			t.Errorf("stream = %q", out)
+		}
+	})
+}
+
+func TestForwardRequest_StreamKeepAlive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetStreamKeepAlive(10 * time.Millisecond)
+	defer SetStreamKeepAlive(0)
+
+	content := "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"hi\"}}\n\n"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(60 * time.Millisecond)
+		_, _ = w.Write([]byte(content))
+	}))
+	defer upstream.Close()
+
+	prs := NewProviderRelayService(nil, nil, nil, nil, nil, "")
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	body := []byte(`{"model":"claude-sonnet-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+
+	ok, err := prs.forwardRequest(c, "claude", Provider{Name: "slow", APIURL: upstream.URL, APIKey: "k"},
+		"/v1/messages", nil, map[string]string{}, body, true, "claude-sonnet-4")
+	if !ok {
+		t.Fatalf("forwardRequest() 失败: %v", err)
+	}
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !bytes.HasPrefix(w.Body.Bytes(), keepAlivePing) || !strings.Contains(w.Body.String(), `"text":"hi"`) {
+		t.Errorf("客户端应先收到心跳再收到内容: %q", w.Body.String())
+	}
+}
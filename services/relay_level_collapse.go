@@ -0,0 +1,30 @@
+package services
+
+// ============================================================================
+// Level 合并
+// ============================================================================
+
+// CollapseLevels 合并可用 provider 过少的 Level：某个 Level 的 providers 少于 minPerLevel 时并入下一个 Level，
+// 合并后的分组以被并入的 Level 为 key，组内先原 Level 的 providers 再下一 Level 的，各自保持原顺序
+// 可连续合并多个 Level；最后一个 Level 即使仍不足也保留。minPerLevel <= 1 时分组不变
+// 用于某一层大量 provider 被拉黑时自动与下一层组成一个池，结果可直接按 Level 交给 Reorder 轮询
+// 返回新的 LevelGroup（OrderOf 仍返回合并前的原始位置），不修改 group
+func CollapseLevels[T ProviderLike](group LevelGroup[T], minPerLevel int) LevelGroup[T] {
+	result := LevelGroup[T]{
+		Groups:       make(map[int][]T, len(group.SortedLevels)),
+		SortedLevels: make([]int, 0, len(group.SortedLevels)),
+		order:        group.order,
+	}
+
+	var pending []T
+	for i, level := range group.SortedLevels {
+		pending = append(pending, group.Groups[level]...)
+		if len(pending) < minPerLevel && i < len(group.SortedLevels)-1 {
+			continue
+		}
+		result.Groups[level] = pending
+		result.SortedLevels = append(result.SortedLevels, level)
+		pending = nil
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollapseLevels(t *testing.T) {
+	providers := []MockProvider{
+		{Name: "a1", Level: 1},
+		{Name: "b1", Level: 2},
+		{Name: "b2", Level: 2},
+		{Name: "c1", Level: 3},
+		{Name: "d1", Level: 5},
+	}
+
+	tests := []struct {
+		name        string
+		minPerLevel int
+		wantLevels  []int
+		wantGroups  map[int][]string
+	}{
+		{"不合并", 1, []int{1, 2, 3, 5}, map[int][]string{1: {"a1"}, 2: {"b1", "b2"}, 3: {"c1"}, 5: {"d1"}}},
+		{"不足的 Level 并入下一个", 2, []int{2, 5}, map[int][]string{2: {"a1", "b1", "b2"}, 5: {"c1", "d1"}}},
+		{"连续合并", 4, []int{3, 5}, map[int][]string{3: {"a1", "b1", "b2", "c1"}, 5: {"d1"}}},
+		{"最后一个 Level 不足也保留", 10, []int{5}, map[int][]string{5: {"a1", "b1", "b2", "c1", "d1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := GroupByLevel(providers)
+			got := CollapseLevels(group, tt.minPerLevel)
+
+			if !reflect.DeepEqual(got.SortedLevels, tt.wantLevels) {
+				t.Fatalf("SortedLevels = %v, want %v", got.SortedLevels, tt.wantLevels)
+			}
+			if len(got.Groups) != len(tt.wantGroups) {
+				t.Fatalf("Groups = %v", got.Groups)
+			}
+			for level, want := range tt.wantGroups {
+				names := make([]string, 0, len(got.Groups[level]))
+				for _, p := range got.Groups[level] {
+					names = append(names, p.Name)
+				}
+				if !reflect.DeepEqual(names, want) {
+					t.Errorf("Level %d = %v, want %v", level, names, want)
+				}
+			}
+			if len(group.SortedLevels) != 4 || len(group.Groups[2]) != 2 {
+				t.Error("原分组不应被修改")
+			}
+		})
+	}
+
+	t.Run("合并后的分组可轮询", func(t *testing.T) {
+		rrs := NewRoundRobinState()
+		got := CollapseLevels(GroupByLevel(providers), 2)
+		getName := func(p MockProvider) string { return p.Name }
+		first := Reorder(rrs, "mock", 2, got.Groups[2], getName)
+		second := Reorder(rrs, "mock", 2, got.Groups[2], getName)
+		if first[0].Name == second[0].Name {
+			t.Errorf("合并池未轮询: %v / %v", first, second)
+		}
+	})
+}
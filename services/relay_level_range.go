@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// 按请求限定可用的 Level 范围
+// ============================================================================
+
+const (
+	// MinProviderLevelHeader 只使用 Level >= 该值的 provider
+	MinProviderLevelHeader = "X-Min-Provider-Level"
+	// MaxProviderLevelHeader 只使用 Level <= 该值的 provider（如 1 表示只用 Level 1 的高质量 provider，不降级）
+	MaxProviderLevelHeader = "X-Max-Provider-Level"
+)
+
+// LevelRange 允许使用的 Level 闭区间，Min/Max <= 0 表示该侧不限
+type LevelRange struct {
+	Min int
+	Max int
+}
+
+// IsZero 是否未设置任何限制
+func (lr LevelRange) IsZero() bool {
+	return lr.Min <= 0 && lr.Max <= 0
+}
+
+// Contains level 是否在范围内
+func (lr LevelRange) Contains(level int) bool {
+	if lr.Min > 0 && level < lr.Min {
+		return false
+	}
+	if lr.Max > 0 && level > lr.Max {
+		return false
+	}
+	return true
+}
+
+func (lr LevelRange) String() string {
+	bound := func(v int) string {
+		if v <= 0 {
+			return "*"
+		}
+		return strconv.Itoa(v)
+	}
+	return fmt.Sprintf("[%s, %s]", bound(lr.Min), bound(lr.Max))
+}
+
+// LevelRangeFromRequest 从请求头读取 Level 范围，未提供或不是正整数的一侧不限
+func LevelRangeFromRequest(ctx *RequestContext) LevelRange {
+	if ctx == nil {
+		return LevelRange{}
+	}
+	parse := func(header string) int {
+		n, err := strconv.Atoi(strings.TrimSpace(ctx.ClientHeaders[http.CanonicalHeaderKey(header)]))
+		if err != nil || n <= 0 {
+			return 0
+		}
+		return n
+	}
+	return LevelRange{Min: parse(MinProviderLevelHeader), Max: parse(MaxProviderLevelHeader)}
+}
+
+// ApplyLevelRange 将 Level 不在范围内的 Active 与 LastResort providers 移入 Skipped（SkipReasonLevelOutOfRange）
+// 兜底 provider 同样受限：请求要求的是质量下限，宁可失败也不降级到范围外的 provider
+func (r *FilterResult[T]) ApplyLevelRange(lr LevelRange) {
+	if lr.IsZero() {
+		return
+	}
+	r.Active = r.filterByLevelRange(r.Active, lr)
+	r.LastResort = r.filterByLevelRange(r.LastResort, lr)
+}
+
+func (r *FilterResult[T]) filterByLevelRange(providers []T, lr LevelRange) []T {
+	if providers == nil {
+		return nil
+	}
+	kept := make([]T, 0, len(providers))
+	for _, p := range providers {
+		if !lr.Contains(p.GetLevel()) {
+			r.addSkip(p.GetName(), SkipReasonLevelOutOfRange, fmt.Sprintf("level %d not in %s", p.GetLevel(), lr))
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// SelectProvidersInRange 与 SelectProviders 相同，但跳过 Level 不在 lr 内的分组（兜底 provider 同样按 Level 过滤）
+func SelectProvidersInRange[T ProviderLike](rrs *RoundRobinState, platform Platform, lr LevelRange, providers []T, lastResort ...T) []T {
+	if lr.IsZero() {
+		return SelectProviders(rrs, platform, providers, lastResort...)
+	}
+	return SelectProviders(rrs, platform, filterLevelRange(providers, lr), filterLevelRange(lastResort, lr)...)
+}
+
+func filterLevelRange[T ProviderLike](providers []T, lr LevelRange) []T {
+	kept := make([]T, 0, len(providers))
+	for _, p := range providers {
+		if lr.Contains(p.GetLevel()) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
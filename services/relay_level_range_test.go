@@ -0,0 +1,88 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilterResult_ApplyLevelRange(t *testing.T) {
+	providers := []Provider{
+		{Name: "premium", APIURL: "https://a", APIKey: "k", Enabled: true, Level: 1},
+		{Name: "default-level", APIURL: "https://a", APIKey: "k", Enabled: true},
+		{Name: "mid", APIURL: "https://a", APIKey: "k", Enabled: true, Level: 2},
+		{Name: "cheap", APIURL: "https://a", APIKey: "k", Enabled: true, Level: 3},
+		{Name: "fallback", APIURL: "https://a", APIKey: "k", Enabled: true, Level: 3, LastResort: true},
+	}
+
+	tests := []struct {
+		name        string
+		lr          LevelRange
+		wantActive  []string
+		wantLast    []string
+		wantSkipped []string
+	}{
+		{"未限定", LevelRange{}, []string{"premium", "default-level", "mid", "cheap"}, []string{"fallback"}, nil},
+		{"只用 Level 1 且不兜底", LevelRange{Max: 1}, []string{"premium", "default-level"}, nil, []string{"mid", "cheap", "fallback"}},
+		{"最低 Level 2", LevelRange{Min: 2}, []string{"mid", "cheap"}, []string{"fallback"}, []string{"premium", "default-level"}},
+		{"闭区间", LevelRange{Min: 2, Max: 2}, []string{"mid"}, nil, []string{"premium", "default-level", "cheap", "fallback"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FilterProviders(providers, PlatformClaude, "", nil, nil, nil)
+			result.ApplyLevelRange(tt.lr)
+
+			names := func(ps []Provider) []string {
+				var out []string
+				for _, p := range ps {
+					out = append(out, p.Name)
+				}
+				return out
+			}
+			if got := names(result.Active); !slices.Equal(got, tt.wantActive) {
+				t.Errorf("Active = %v, want %v", got, tt.wantActive)
+			}
+			if got := names(result.LastResort); !slices.Equal(got, tt.wantLast) {
+				t.Errorf("LastResort = %v, want %v", got, tt.wantLast)
+			}
+			var skipped []string
+			for _, skip := range result.Skipped {
+				if skip.Reason != SkipReasonLevelOutOfRange {
+					t.Errorf("%s 跳过原因 = %s", skip.Name, skip.Reason)
+				}
+				skipped = append(skipped, skip.Name)
+			}
+			if !slices.Equal(skipped, tt.wantSkipped) {
+				t.Errorf("Skipped = %v, want %v", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestSelectProvidersInRange(t *testing.T) {
+	providers := []Provider{
+		{Name: "a", Level: 1},
+		{Name: "b", Level: 2},
+		{Name: "c", Level: 3},
+	}
+	got := SelectProvidersInRange(nil, PlatformClaude, LevelRange{Min: 2}, providers, Provider{Name: "z", Level: 1, LastResort: true})
+	var names []string
+	for _, p := range got {
+		names = append(names, p.Name)
+	}
+	if !slices.Equal(names, []string{"b", "c"}) {
+		t.Errorf("SelectProvidersInRange() = %v, want [b c]", names)
+	}
+}
+
+func TestLevelRangeFromRequest(t *testing.T) {
+	rc := &RequestContext{ClientHeaders: map[string]string{
+		"X-Min-Provider-Level": " 1 ",
+		"X-Max-Provider-Level": "abc",
+	}}
+	if got := LevelRangeFromRequest(rc); got != (LevelRange{Min: 1}) {
+		t.Errorf("LevelRangeFromRequest() = %+v, want {Min:1}", got)
+	}
+	if got := LevelRangeFromRequest(nil); !got.IsZero() {
+		t.Errorf("nil 请求应不限定, got %+v", got)
+	}
+}
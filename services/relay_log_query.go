@@ -0,0 +1,125 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ============================================================================
+// 请求日志查询
+// ============================================================================
+
+// DefaultRecentLogsLimit QueryRecentLogs 的默认/最大返回条数
+const DefaultRecentLogsLimit = 1000
+
+// requestLogColumns 与 ensureRequestLogTableWithDB / WriteRequestLog 对应的列
+const requestLogColumns = `id, platform, model, provider, http_code,
+	input_tokens, output_tokens, cache_create_tokens, cache_read_tokens,
+	reasoning_tokens, is_stream, duration_sec, attempt_count, failed_providers, api_key_hash,
+	ttfb_sec, response_bytes, created_at`
+
+// requestLogTimeLayout SQLite CURRENT_TIMESTAMP 的格式（UTC）
+const requestLogTimeLayout = "2006-01-02 15:04:05"
+
+// QueryRecentLogs 查询最近的请求日志（按 id 倒序）
+// limit <= 0 或超过 DefaultRecentLogsLimit 时使用 DefaultRecentLogsLimit
+func QueryRecentLogs(limit int) ([]*ReqeustLog, error) {
+	if limit <= 0 || limit > DefaultRecentLogsLimit {
+		limit = DefaultRecentLogsLimit
+	}
+	db, err := requestLogDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT `+requestLogColumns+` FROM request_log ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("查询 request_log 失败: %w", err)
+	}
+	return scanRequestLogs(rows)
+}
+
+// QueryLogsByProvider 查询指定 provider 自 since 以来的请求日志（按 id 倒序）
+func QueryLogsByProvider(provider string, since time.Time) ([]*ReqeustLog, error) {
+	db, err := requestLogDB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(
+		`SELECT `+requestLogColumns+` FROM request_log WHERE provider = ? AND created_at >= ? ORDER BY id DESC`,
+		provider, since.UTC().Format(requestLogTimeLayout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询 request_log 失败: %w", err)
+	}
+	return scanRequestLogs(rows)
+}
+
+// requestLogDB 返回日志队列使用的数据库连接
+func requestLogDB() (*sql.DB, error) {
+	if GlobalDBQueueLogs == nil || GlobalDBQueueLogs.db == nil {
+		return nil, fmt.Errorf("日志队列未初始化")
+	}
+	return GlobalDBQueueLogs.db, nil
+}
+
+// scanRequestLogs 将查询结果映射为 ReqeustLog（is_stream 整数转回 bool），并关闭 rows
+func scanRequestLogs(rows *sql.Rows) ([]*ReqeustLog, error) {
+	defer rows.Close()
+
+	var logs []*ReqeustLog
+	for rows.Next() {
+		var (
+			platform, model, provider                       sql.NullString
+			httpCode, input, output, cacheCreate, cacheRead sql.NullInt64
+			reasoning, isStream, attemptCount, respBytes    sql.NullInt64
+			failedProviders, apiKeyHash                     sql.NullString
+			duration, ttfb                                  sql.NullFloat64
+			createdAt                                       any
+		)
+		log := &ReqeustLog{}
+		if err := rows.Scan(&log.ID, &platform, &model, &provider, &httpCode,
+			&input, &output, &cacheCreate, &cacheRead,
+			&reasoning, &isStream, &duration, &attemptCount, &failedProviders, &apiKeyHash,
+			&ttfb, &respBytes, &createdAt); err != nil {
+			return nil, fmt.Errorf("读取 request_log 失败: %w", err)
+		}
+
+		log.Platform = platform.String
+		log.Model = model.String
+		log.Provider = provider.String
+		log.HttpCode = int(httpCode.Int64)
+		log.InputTokens = int(input.Int64)
+		log.OutputTokens = int(output.Int64)
+		log.CacheCreateTokens = int(cacheCreate.Int64)
+		log.CacheReadTokens = int(cacheRead.Int64)
+		log.ReasoningTokens = int(reasoning.Int64)
+		log.IsStream = isStream.Int64 != 0
+		log.DurationSec = duration.Float64
+		log.AttemptCount = int(attemptCount.Int64)
+		log.FailedProviders = failedProviders.String
+		log.APIKeyHash = apiKeyHash.String
+		log.TimeToFirstByte = ttfb.Float64
+		log.ResponseBytes = respBytes.Int64
+		log.CreatedAt = formatRequestLogTime(createdAt)
+		logs = append(logs, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取 request_log 失败: %w", err)
+	}
+	return logs, nil
+}
+
+// formatRequestLogTime 统一 created_at 的字符串格式（驱动可能返回 time.Time 或字符串）
+func formatRequestLogTime(v any) string {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC().Format(requestLogTimeLayout)
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	default:
+		return ""
+	}
+}
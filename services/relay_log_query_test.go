@@ -0,0 +1,66 @@
+package services
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestQueryRequestLogs(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := ensureRequestLogTableWithDB(db); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+
+	insert := `INSERT INTO request_log (platform, model, provider, http_code, input_tokens, output_tokens,
+		cache_create_tokens, cache_read_tokens, reasoning_tokens, is_stream, duration_sec, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, 0, 0, 0, ?, ?, ?)`
+	old := time.Now().Add(-2 * time.Hour).UTC().Format(requestLogTimeLayout)
+	now := time.Now().UTC().Format(requestLogTimeLayout)
+	for _, args := range [][]any{
+		{"claude", "m1", "p1", 200, 10, 20, 1, 1.5, old},
+		{"claude", "m1", "p2", 500, 0, 0, 0, 0.2, now},
+		{"codex", "m2", "p1", 200, 5, 6, 0, 0.8, now},
+	} {
+		if _, err := db.Exec(insert, args...); err != nil {
+			t.Fatalf("插入失败: %v", err)
+		}
+	}
+
+	orig := GlobalDBQueueLogs
+	GlobalDBQueueLogs = &DBWriteQueue{db: db}
+	defer func() { GlobalDBQueueLogs = orig }()
+
+	recent, err := QueryRecentLogs(2)
+	if err != nil {
+		t.Fatalf("QueryRecentLogs() error = %v", err)
+	}
+	if len(recent) != 2 || recent[0].Platform != "codex" || recent[1].Provider != "p2" {
+		t.Fatalf("QueryRecentLogs() = %+v", recent)
+	}
+
+	byProvider, err := QueryLogsByProvider("p1", time.Now().Add(-3*time.Hour))
+	if err != nil {
+		t.Fatalf("QueryLogsByProvider() error = %v", err)
+	}
+	if len(byProvider) != 2 {
+		t.Fatalf("QueryLogsByProvider() 返回 %d 条, 期望 2", len(byProvider))
+	}
+	oldest := byProvider[1]
+	if !oldest.IsStream || oldest.InputTokens != 10 || oldest.DurationSec != 1.5 || oldest.CreatedAt != old ||
+		oldest.AttemptCount != 1 || oldest.FailedProviders != "" {
+		t.Errorf("字段映射错误: %+v", oldest)
+	}
+
+	sinceHour, _ := QueryLogsByProvider("p1", time.Now().Add(-time.Hour))
+	if len(sinceHour) != 1 {
+		t.Errorf("since 过滤后应剩 1 条, 实际 %d", len(sinceHour))
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// 指标接口
+// ============================================================================
+
+// Metrics relay 内部指标接口
+// 默认实现为 no-op，可通过 SetMetrics 接入 Prometheus 等监控系统（见 services/prommetrics）
+type Metrics interface {
+	// IncSelected provider 被选中发起一次请求
+	IncSelected(platform, provider string)
+	// IncSkipped provider 在过滤阶段被跳过
+	IncSkipped(platform, provider, reason string)
+	// IncFailure provider 请求失败
+	IncFailure(platform, provider string)
+	// ObserveDuration 记录 provider 请求耗时
+	ObserveDuration(platform, provider string, d time.Duration)
+}
+
+// noopMetrics 默认的空实现
+type noopMetrics struct{}
+
+func (noopMetrics) IncSelected(platform, provider string)                      {}
+func (noopMetrics) IncSkipped(platform, provider, reason string)               {}
+func (noopMetrics) IncFailure(platform, provider string)                       {}
+func (noopMetrics) ObserveDuration(platform, provider string, d time.Duration) {}
+
+var (
+	metricsMu     sync.RWMutex
+	globalMetrics Metrics = noopMetrics{}
+)
+
+// SetMetrics 设置全局指标实现，传 nil 恢复为 no-op
+func SetMetrics(m Metrics) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if m == nil {
+		m = noopMetrics{}
+	}
+	globalMetrics = m
+}
+
+// currentMetrics 获取当前指标实现
+func currentMetrics() Metrics {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+	return globalMetrics
+}
+
+// observeAttempt 上报一次 provider 尝试：选中次数与耗时，失败时计入失败次数（客户端中断不算 provider 失败）
+func observeAttempt(platform, provider string, d time.Duration, ok bool, err error) {
+	m := currentMetrics()
+	m.IncSelected(platform, provider)
+	m.ObserveDuration(platform, provider, d)
+	if !ok && !errors.Is(err, errClientAbort) {
+		m.IncFailure(platform, provider)
+	}
+}
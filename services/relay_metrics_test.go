@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingMetrics 记录所有上报的指标，便于断言
+type recordingMetrics struct {
+	mu        sync.Mutex
+	selected  []string
+	skipped   []string
+	failures  []string
+	durations []string
+}
+
+func (m *recordingMetrics) IncSelected(platform, provider string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.selected = append(m.selected, platform+"/"+provider)
+}
+
+func (m *recordingMetrics) IncSkipped(platform, provider, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.skipped = append(m.skipped, platform+"/"+provider+"/"+reason)
+}
+
+func (m *recordingMetrics) IncFailure(platform, provider string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = append(m.failures, platform+"/"+provider)
+}
+
+func (m *recordingMetrics) ObserveDuration(platform, provider string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.durations = append(m.durations, platform+"/"+provider)
+}
+
+func TestSetMetrics(t *testing.T) {
+	defer SetMetrics(nil)
+
+	if _, ok := currentMetrics().(noopMetrics); !ok {
+		t.Fatalf("默认实现应为 no-op, 实际 %T", currentMetrics())
+	}
+	// no-op 实现可以安全调用
+	observeAttempt("claude", "p", time.Second, false, errors.New("boom"))
+
+	rec := &recordingMetrics{}
+	SetMetrics(rec)
+	if currentMetrics() != Metrics(rec) {
+		t.Errorf("SetMetrics 后 currentMetrics() = %T", currentMetrics())
+	}
+	SetMetrics(nil)
+	if _, ok := currentMetrics().(noopMetrics); !ok {
+		t.Errorf("SetMetrics(nil) 应恢复为 no-op, 实际 %T", currentMetrics())
+	}
+}
+
+func TestObserveAttempt(t *testing.T) {
+	tests := []struct {
+		name         string
+		ok           bool
+		err          error
+		wantFailures int
+	}{
+		{"成功", true, nil, 0},
+		{"失败", false, errors.New("upstream status 500"), 1},
+		{"客户端中断不计入失败", false, errClientAbort, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recordingMetrics{}
+			SetMetrics(rec)
+			defer SetMetrics(nil)
+
+			observeAttempt("claude", "p", time.Second, tt.ok, tt.err)
+			if len(rec.selected) != 1 || len(rec.durations) != 1 || len(rec.failures) != tt.wantFailures {
+				t.Errorf("selected=%v durations=%v failures=%v", rec.selected, rec.durations, rec.failures)
+			}
+		})
+	}
+}
+
+func TestForwardRequest_EmitsMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := &recordingMetrics{}
+	SetMetrics(rec)
+	defer SetMetrics(nil)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	prs := NewProviderRelayService(nil, nil, nil, nil, nil, "")
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	body := []byte(`{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`)
+
+	if ok, _ := prs.forwardRequest(c, "claude", Provider{Name: "down", APIURL: upstream.URL, APIKey: "k"},
+		"/v1/messages", nil, map[string]string{}, body, false, "claude-sonnet-4"); ok {
+		t.Fatal("503 应失败")
+	}
+	if len(rec.selected) != 1 || rec.selected[0] != "claude/down" ||
+		len(rec.failures) != 1 || len(rec.durations) != 1 {
+		t.Errorf("selected=%v failures=%v durations=%v", rec.selected, rec.failures, rec.durations)
+	}
+}
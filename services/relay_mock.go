@@ -0,0 +1,33 @@
+package services
+
+// ============================================================================
+// 测试用 Provider
+// ============================================================================
+
+// 确保 MockProvider 实现 ProviderLike 接口
+var _ ProviderLike = MockProvider{}
+
+// MockProvider 用于测试泛型路由函数（GroupByLevel、Reorder、SelectProviders 等）的轻量 ProviderLike
+// 各字段直接决定接口返回值，无需像 Provider 那样填写 APIURL/APIKey 才能通过 HasValidConfig
+type MockProvider struct {
+	Name        string
+	Level       int // 原样返回，不做默认值处理
+	Enabled     bool
+	ValidConfig bool
+	LastResort  bool
+}
+
+// GetName 返回名称
+func (m MockProvider) GetName() string { return m.Name }
+
+// GetLevel 返回 Level
+func (m MockProvider) GetLevel() int { return m.Level }
+
+// IsEnabled 返回是否启用
+func (m MockProvider) IsEnabled() bool { return m.Enabled }
+
+// HasValidConfig 返回 ValidConfig
+func (m MockProvider) HasValidConfig() bool { return m.ValidConfig }
+
+// IsLastResort 返回是否为兜底 Provider
+func (m MockProvider) IsLastResort() bool { return m.LastResort }
@@ -0,0 +1,36 @@
+package services
+
+// ============================================================================
+// 声明式模型策略
+// ============================================================================
+
+// ModelAllowedByPolicy 按 AllowModels / DenyModels 判断是否允许服务该模型
+//   - 命中 DenyModels 一律拒绝（优先于 AllowModels）
+//   - AllowModels 为空表示不限制；非空时必须命中其中一项
+//
+// 模式支持 * 通配符（与 supportedModels 相同的 matchWildcard 规则）；model 为空时不做限制
+func (p *Provider) ModelAllowedByPolicy(model string) bool {
+	if model == "" {
+		return true
+	}
+	for _, pattern := range p.DenyModels {
+		if matchWildcard(pattern, model) {
+			return false
+		}
+	}
+	if len(p.AllowModels) == 0 {
+		return true
+	}
+	for _, pattern := range p.AllowModels {
+		if matchWildcard(pattern, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultModelChecker FilterProviders 的默认 modelChecker：模型策略允许且 provider 支持该模型
+// （supportedModels 白名单或 modelMapping 映射，见 IsModelSupported）
+func DefaultModelChecker(p *Provider, model string) bool {
+	return p.ModelAllowedByPolicy(model) && p.IsModelSupported(model)
+}
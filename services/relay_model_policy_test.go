@@ -0,0 +1,44 @@
+package services
+
+import "testing"
+
+func TestProvider_ModelAllowedByPolicy(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		model string
+		want  bool
+	}{
+		{"未配置策略", nil, nil, "gpt-4o", true},
+		{"命中白名单通配符", []string{"claude-3-*"}, nil, "claude-3-opus", true},
+		{"未命中白名单", []string{"claude-3-*"}, nil, "gpt-4o", false},
+		{"黑名单优先", []string{"claude-*"}, []string{"claude-3-opus"}, "claude-3-opus", false},
+		{"仅黑名单", nil, []string{"*-preview"}, "gpt-5-preview", false},
+		{"空模型不限制", []string{"claude-*"}, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{AllowModels: tt.allow, DenyModels: tt.deny}
+			if got := p.ModelAllowedByPolicy(tt.model); got != tt.want {
+				t.Errorf("ModelAllowedByPolicy(%q) = %v, 期望 %v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterProviders_ModelPolicy(t *testing.T) {
+	providers := []Provider{
+		{Name: "denied", APIURL: "https://a", APIKey: "k", Enabled: true, DenyModels: []string{"claude-3-*"}},
+		{Name: "unsupported", APIURL: "https://b", APIKey: "k", Enabled: true, SupportedModels: map[string]bool{"gpt-4o": true}},
+		{Name: "ok", APIURL: "https://c", APIKey: "k", Enabled: true, AllowModels: []string{"claude-*"}},
+	}
+
+	result := FilterProviders(providers, "claude", "claude-3-opus", nil, DefaultModelChecker, nil)
+	if len(result.Active) != 1 || result.Active[0].Name != "ok" {
+		t.Fatalf("Active = %+v, 期望仅 ok", result.Active)
+	}
+	if len(result.Skipped) != 2 || result.Skipped[0].Reason != SkipReasonModelDenied || result.Skipped[1].Reason != SkipReasonModelUnsupported {
+		t.Errorf("Skipped = %+v", result.Skipped)
+	}
+}
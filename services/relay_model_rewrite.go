@@ -0,0 +1,69 @@
+package services
+
+import (
+	"bytes"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ============================================================================
+// 响应中的模型名回写
+// ============================================================================
+
+// responseModelPaths 响应/SSE 事件中携带模型名的字段
+//   - model: OpenAI Chat 响应与 chunk、Claude 非流式响应
+//   - message.model: Claude message_start 事件
+//   - response.model: OpenAI Responses 的 response.created / response.completed 等事件
+//   - modelVersion: Gemini 响应
+var responseModelPaths = []string{"model", "message.model", "response.model", "modelVersion"}
+
+// RewriteResponseModel 将 JSON 响应或单行 SSE 事件（"data: {...}"）中值为 upstreamModel 的模型字段改写为 clientModel
+// 仅精确匹配时改写；非 JSON 的行（event:、注释、[DONE]）与不含 upstreamModel 的行原样返回
+func RewriteResponseModel(data []byte, upstreamModel, clientModel string) []byte {
+	if upstreamModel == "" || clientModel == "" || upstreamModel == clientModel {
+		return data
+	}
+	if !bytes.Contains(data, []byte(upstreamModel)) {
+		return data
+	}
+
+	// SSE data 行：只改写 JSON 负载，保留前缀（"data:" 或 "data: "）
+	prefix, payload := []byte(nil), data
+	if rest, ok := bytes.CutPrefix(data, []byte("data:")); ok {
+		trimmed := bytes.TrimLeft(rest, " ")
+		prefix, payload = data[:len(data)-len(trimmed)], trimmed
+	}
+	if !gjson.ValidBytes(payload) {
+		return data
+	}
+
+	rewritten := payload
+	for _, path := range responseModelPaths {
+		if gjson.GetBytes(rewritten, path).String() != upstreamModel {
+			continue
+		}
+		modified, err := sjson.SetBytes(rewritten, path, clientModel)
+		if err != nil {
+			return data
+		}
+		rewritten = modified
+	}
+	if prefix == nil {
+		return rewritten
+	}
+	out := make([]byte, 0, len(prefix)+len(rewritten))
+	return append(append(out, prefix...), rewritten...)
+}
+
+// ModelRewriteHook 返回逐行改写模型名的响应钩子（配合 ToHttpResponseWriter 使用）
+// 流式响应按行处理，不缓冲整个流；message_start 等首个事件中的模型名同样会被改写
+// upstreamModel 与 clientModel 相同或任一为空时返回 nil，调用方应跳过
+func ModelRewriteHook(upstreamModel, clientModel string) func(data []byte) (bool, []byte) {
+	if upstreamModel == "" || clientModel == "" || upstreamModel == clientModel {
+		return nil
+	}
+	return func(data []byte) (bool, []byte) {
+		return true, RewriteResponseModel(data, upstreamModel, clientModel)
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestRewriteResponseModel(t *testing.T) {
+	const upstream, client = "claude-sonnet-4-internal", "claude-sonnet-4"
+
+	tests := []struct {
+		name string
+		in   string
+		path string // 为空表示期望原样返回
+	}{
+		{"message_start", `data: {"type":"message_start","message":{"id":"m1","model":"claude-sonnet-4-internal"}}`, "message.model"},
+		{"无空格前缀", `data:{"type":"message_start","message":{"model":"claude-sonnet-4-internal"}}`, "message.model"},
+		{"chat chunk", `data: {"object":"chat.completion.chunk","model":"claude-sonnet-4-internal"}`, "model"},
+		{"responses 事件", `data: {"type":"response.created","response":{"model":"claude-sonnet-4-internal"}}`, "response.model"},
+		{"非流式响应", `{"id":"m1","type":"message","model":"claude-sonnet-4-internal"}`, "model"},
+		{"Gemini", `data: {"candidates":[],"modelVersion":"claude-sonnet-4-internal"}`, "modelVersion"},
+		{"event 行", `event: message_start`, ""},
+		{"DONE", `data: [DONE]`, ""},
+		{"正文中出现模型名不改写", `data: {"type":"content_block_delta","delta":{"text":"claude-sonnet-4-internal"}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(RewriteResponseModel([]byte(tt.in), upstream, client))
+			if tt.path == "" {
+				if got != tt.in {
+					t.Errorf("不应改写: %s", got)
+				}
+				return
+			}
+			payload := got
+			if len(got) > 5 && got[:5] == "data:" {
+				if got[:len("data:")+1] != tt.in[:len("data:")+1] {
+					t.Errorf("前缀被改动: %s", got)
+				}
+				payload = got[5:]
+			}
+			if model := gjson.Get(payload, tt.path).String(); model != client {
+				t.Errorf("%s = %q, want %q (%s)", tt.path, model, client, got)
+			}
+		})
+	}
+}
+
+func TestModelRewriteHook(t *testing.T) {
+	if ModelRewriteHook("a", "a") != nil || ModelRewriteHook("", "b") != nil {
+		t.Fatal("模型名未改变时应返回 nil")
+	}
+	hook := ModelRewriteHook("up", "client")
+	flush, out := hook([]byte(`data: {"model":"up"}`))
+	if !flush || string(out) != `data: {"model":"client"}` {
+		t.Errorf("hook() = %v, %s", flush, out)
+	}
+}
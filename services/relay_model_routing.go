@@ -0,0 +1,94 @@
+package services
+
+import "sort"
+
+// ============================================================================
+// 按模型指定 provider 偏好
+// ============================================================================
+
+// ModelRoutingTable 按模型指定 provider 的优先顺序，独立于全局 Level
+// key 为模型名（支持 * 通配符，精确匹配优先），value 为按优先级排列的 provider 名称
+//
+//	{"claude-3-opus": ["A", "B"], "gpt-4o": ["C", "D"], "claude-*": ["A"]}
+type ModelRoutingTable map[string][]string
+
+// Preferences 返回模型对应的 provider 偏好列表，未配置时返回 nil
+// 精确匹配优先；多个通配符同时匹配时取字典序最小的 key，保证结果稳定
+func (t ModelRoutingTable) Preferences(model string) []string {
+	if len(t) == 0 || model == "" {
+		return nil
+	}
+	if names, ok := t[model]; ok {
+		return names
+	}
+
+	patterns := make([]string, 0, len(t))
+	for pattern := range t {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if matchWildcard(pattern, model) {
+			return t[pattern]
+		}
+	}
+	return nil
+}
+
+// ApplyModelRouting 将模型偏好列表中的 provider 按偏好顺序提到最前
+// 未列出的 provider 保持输入顺序（即 Level 分组 + 轮询的结果）排在其后；
+// 兜底 provider 不参与提前，始终留在末尾；偏好中不存在于 providers 的名称被忽略
+// model 为空或未配置偏好时原样返回；不修改原切片
+func ApplyModelRouting[T ProviderLike](t ModelRoutingTable, model string, providers []T) []T {
+	prefs := t.Preferences(model)
+	if len(prefs) == 0 || len(providers) <= 1 {
+		return providers
+	}
+
+	byName := make(map[string]int, len(providers))
+	for i, p := range providers {
+		if !isLastResort(p) {
+			byName[p.GetName()] = i
+		}
+	}
+
+	result := make([]T, 0, len(providers))
+	promoted := make(map[int]bool, len(prefs))
+	for _, name := range prefs {
+		if i, ok := byName[name]; ok && !promoted[i] {
+			promoted[i] = true
+			result = append(result, providers[i])
+		}
+	}
+	if len(promoted) == 0 {
+		return providers
+	}
+	for i, p := range providers {
+		if !promoted[i] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// ModelRoutingSelector 在下游 Selector 的结果上应用按模型的 provider 偏好
+// 仅当 RequestContext.RequestedModel 非空且配置了偏好时生效，否则等同于 Next
+type ModelRoutingSelector struct {
+	Table ModelRoutingTable
+	Next  Selector // 基础排序（Level 分组 + 轮询等），为 nil 时使用不轮询的 SelectProviders
+}
+
+// Select 实现 Selector 接口
+func (s *ModelRoutingSelector) Select(providers []ProviderLike, ctx *RequestContext) []ProviderLike {
+	var ordered []ProviderLike
+	if s.Next != nil {
+		ordered = s.Next.Select(providers, ctx)
+	} else {
+		ordered = SelectProviders[ProviderLike](nil, "", providers)
+	}
+
+	if ctx == nil || ctx.RequestedModel == "" {
+		return ordered
+	}
+	return ApplyModelRouting(s.Table, ctx.RequestedModel, ordered)
+}
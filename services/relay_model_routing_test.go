@@ -0,0 +1,50 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestModelRoutingSelector(t *testing.T) {
+	providers := toProviderLikes([]MockProvider{
+		{Name: "A", Level: 2},
+		{Name: "B", Level: 1},
+		{Name: "C", Level: 1},
+		{Name: "D", Level: 2},
+		{Name: "Z", Level: 1, LastResort: true},
+	})
+	table := ModelRoutingTable{
+		"claude-3-opus": {"D", "A"},
+		"gpt-*":         {"C", "missing"},
+		"any":           {"Z"},
+	}
+	selector := &ModelRoutingSelector{Table: table}
+
+	names := func(ps []ProviderLike) string {
+		out := make([]string, len(ps))
+		for i, p := range ps {
+			out[i] = p.GetName()
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name  string
+		model string
+		want  string
+	}{
+		{"未指定模型按 Level 排序", "", "B,C,A,D,Z"},
+		{"精确匹配偏好优先", "claude-3-opus", "D,A,B,C,Z"},
+		{"通配符匹配并忽略不存在的 provider", "gpt-4o", "C,B,A,D,Z"},
+		{"未配置的模型不变", "gemini-pro", "B,C,A,D,Z"},
+		{"兜底 provider 不被提前", "any", "B,C,A,D,Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(selector.Select(providers, &RequestContext{RequestedModel: tt.model}))
+			if got != tt.want {
+				t.Errorf("Select() = %s, 期望 %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultModelsCacheTTL /v1/models 响应的默认缓存时间
+const DefaultModelsCacheTTL = 5 * time.Minute
+
+// ModelsCache 按 provider 名称缓存 /v1/models 响应
+// 模型列表变化很少，客户端却会频繁请求，缓存可避免每次都转发到上游
+type ModelsCache struct {
+	mu         sync.RWMutex
+	entries    map[string]modelsCacheEntry
+	defaultTTL time.Duration
+}
+
+type modelsCacheEntry struct {
+	body      []byte
+	expiresAt time.Time
+}
+
+// NewModelsCache 创建模型列表缓存，defaultTTL <= 0 时使用 DefaultModelsCacheTTL
+func NewModelsCache(defaultTTL time.Duration) *ModelsCache {
+	if defaultTTL <= 0 {
+		defaultTTL = DefaultModelsCacheTTL
+	}
+	return &ModelsCache{
+		entries:    make(map[string]modelsCacheEntry),
+		defaultTTL: defaultTTL,
+	}
+}
+
+// Get 返回未过期的缓存响应；不存在或已过期时返回 false
+func (mc *ModelsCache) Get(name string) ([]byte, bool) {
+	mc.mu.RLock()
+	entry, ok := mc.entries[name]
+	mc.mu.RUnlock()
+
+	if !ok || clockNow().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// Set 写入缓存，ttl <= 0 时使用默认 TTL
+// body 会被复制，调用方之后修改原切片不影响缓存内容
+func (mc *ModelsCache) Set(name string, body []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = mc.defaultTTL
+	}
+	stored := make([]byte, len(body))
+	copy(stored, body)
+
+	mc.mu.Lock()
+	mc.entries[name] = modelsCacheEntry{body: stored, expiresAt: clockNow().Add(ttl)}
+	mc.mu.Unlock()
+}
+
+// Invalidate 删除指定 provider 的缓存（provider 配置变更时调用）
+func (mc *ModelsCache) Invalidate(name string) {
+	mc.mu.Lock()
+	delete(mc.entries, name)
+	mc.mu.Unlock()
+}
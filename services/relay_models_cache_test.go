@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestModelsCache(t *testing.T) {
+	mc := NewModelsCache(0)
+	if mc.defaultTTL != DefaultModelsCacheTTL {
+		t.Fatalf("默认 TTL = %v, 期望 %v", mc.defaultTTL, DefaultModelsCacheTTL)
+	}
+
+	if _, ok := mc.Get("p1"); ok {
+		t.Fatal("空缓存不应命中")
+	}
+
+	body := []byte(`{"data":[]}`)
+	mc.Set("p1", body, 0)
+	body[0] = 'x'
+	got, ok := mc.Get("p1")
+	if !ok || string(got) != `{"data":[]}` {
+		t.Errorf("缓存内容 = %q, %v", got, ok)
+	}
+
+	clk := NewManualClock(time.Unix(1700000000, 0))
+	defer SetClock(clk)()
+	mc.Set("p2", []byte("expired"), time.Minute)
+	clk.Advance(time.Minute + time.Second)
+	if _, ok := mc.Get("p2"); ok {
+		t.Error("过期缓存不应命中")
+	}
+
+	mc.Invalidate("p1")
+	if _, ok := mc.Get("p1"); ok {
+		t.Error("Invalidate 后不应命中")
+	}
+}
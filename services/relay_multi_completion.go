@@ -0,0 +1,222 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/daodao97/xgo/xrequest"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ============================================================================
+// OpenAI n>1（多个候选回答）拆分
+// ============================================================================
+
+const (
+	// DefaultMaxCompletions 拆分 n>1 请求时默认允许的最大 n
+	DefaultMaxCompletions = 8
+	// MaxCompletionsLimit SetMaxCompletions 可设置的上限
+	MaxCompletionsLimit = 128
+)
+
+// maxCompletions 拆分 n>1 请求时允许的最大 n：拆分后每个候选回答都是一次完整的上游请求，需要限制放大倍数
+var maxCompletions atomic.Int64
+
+func init() {
+	maxCompletions.Store(DefaultMaxCompletions)
+}
+
+// SetMaxCompletions 设置拆分 n>1 请求时允许的最大 n，取值范围 [1, MaxCompletionsLimit]，超出时取边界值
+func SetMaxCompletions(n int) {
+	n = min(max(n, 1), MaxCompletionsLimit)
+	maxCompletions.Store(int64(n))
+}
+
+// tooManyCompletionsError n 超过上限时返回的错误，响应体为 OpenAI 格式的 invalid_request_error
+// 请求本身不合法，换 provider 也会失败（见 IsFatal），响应体原样返回给客户端
+func tooManyCompletionsError(n, limit int) error {
+	body, _ := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"message": fmt.Sprintf("n=%d exceeds the maximum of %d supported by this relay", n, limit),
+			"type":    "invalid_request_error",
+			"param":   "n",
+			"code":    "invalid_value",
+		},
+	})
+	return newUpstreamStatusError(http.StatusBadRequest, body, "application/json")
+}
+
+// CompletionCount 返回 OpenAI Chat Completions 请求要求的候选回答数（n），未设置或不合法时为 1
+func CompletionCount(bodyBytes []byte) int {
+	n := gjson.GetBytes(bodyBytes, "n")
+	if n.Type != gjson.Number || n.Int() < 1 {
+		return 1
+	}
+	return int(n.Int())
+}
+
+// SplitCompletions 返回移除 n 后的单次请求体，依次发送 CompletionCount 次即可得到同样数量的候选回答
+func SplitCompletions(bodyBytes []byte) ([]byte, error) {
+	single, err := sjson.DeleteBytes(bodyBytes, "n")
+	if err != nil {
+		return bodyBytes, fmt.Errorf("移除 n 失败: %w", err)
+	}
+	return single, nil
+}
+
+// MergeCompletions 将多个单次 Chat Completions 响应合并为一个多 choice 响应
+// 以第一个响应为基础（id、model、created 等），choices 按响应顺序拼接并重新编号 index，
+// usage 中的数值字段（含 prompt_tokens_details 等嵌套字段）逐项求和：每个子请求都单独计费了输入 token
+func MergeCompletions(responses [][]byte) ([]byte, error) {
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("没有可合并的响应")
+	}
+
+	var choices []map[string]any
+	var usage map[string]any
+	for i, resp := range responses {
+		if !gjson.ValidBytes(resp) {
+			return nil, fmt.Errorf("第 %d 个响应不是合法的 JSON", i+1)
+		}
+		var parsed struct {
+			Choices []map[string]any `json:"choices"`
+			Usage   map[string]any   `json:"usage"`
+		}
+		if err := json.Unmarshal(resp, &parsed); err != nil {
+			return nil, fmt.Errorf("解析第 %d 个响应失败: %w", i+1, err)
+		}
+		for _, choice := range parsed.Choices {
+			choice["index"] = len(choices)
+			choices = append(choices, choice)
+		}
+		if parsed.Usage != nil {
+			usage = sumUsage(usage, parsed.Usage)
+		}
+	}
+
+	merged, err := sjson.SetBytes(responses[0], "choices", choices)
+	if err != nil {
+		return nil, fmt.Errorf("写入 choices 失败: %w", err)
+	}
+	if usage != nil {
+		if merged, err = sjson.SetBytes(merged, "usage", usage); err != nil {
+			return nil, fmt.Errorf("写入 usage 失败: %w", err)
+		}
+	}
+	return merged, nil
+}
+
+// sumUsage 将 add 中的数值字段累加到 total（递归处理嵌套对象），非数值字段保留第一次出现的值
+func sumUsage(total, add map[string]any) map[string]any {
+	if total == nil {
+		total = make(map[string]any, len(add))
+	}
+	for key, value := range add {
+		switch v := value.(type) {
+		case float64:
+			if existing, ok := total[key].(float64); ok {
+				total[key] = existing + v
+			} else if _, exists := total[key]; !exists {
+				total[key] = v
+			}
+		case map[string]any:
+			existing, _ := total[key].(map[string]any)
+			total[key] = sumUsage(existing, v)
+		default:
+			if _, exists := total[key]; !exists {
+				total[key] = value
+			}
+		}
+	}
+	return total
+}
+
+// needsCompletionSplit 是否需要将 n>1 的请求拆分：仅非流式的 OpenAI Chat Completions 请求，且上游不支持 n>1
+// 流式请求的多个候选回答交错在同一条流中，拆分后无法按原顺序合并，仍原样转发
+func needsCompletionSplit(provider Provider, bodyBytes []byte, endpoint string, isStream bool) bool {
+	return !isStream && !provider.SupportsMultipleCompletions &&
+		DetectFormat(bodyBytes, endpoint) == FormatOpenAI && CompletionCount(bodyBytes) > 1
+}
+
+// forwardSplitCompletions 将 n>1 的请求拆分为 n 个单次请求依次发送，合并后返回给客户端
+// 任一子请求失败即整体失败（尚未向客户端写入任何内容，可以切换到下一个 provider）
+func (prs *ProviderRelayService) forwardSplitCompletions(
+	c *gin.Context,
+	provider Provider,
+	targetURL string,
+	headers map[string]string,
+	bodyBytes []byte,
+	requestLog *ReqeustLog,
+	start time.Time,
+	upstreamModel, clientModel string,
+) (bool, error) {
+	n := CompletionCount(bodyBytes)
+	if limit := int(maxCompletions.Load()); n > limit {
+		fmt.Printf("[WARN] 请求的 n=%d 超过拆分上限 %d，拒绝请求\n", n, limit)
+		requestLog.HttpCode = http.StatusBadRequest
+		return false, tooManyCompletionsError(n, limit)
+	}
+	single, err := SplitCompletions(bodyBytes)
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("[INFO] Provider %s 不支持 n>1，拆分为 %d 个单次请求\n", provider.Name, n)
+
+	responses := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		if err := c.Request.Context().Err(); err != nil {
+			return false, fmt.Errorf("%w: %v", errClientAbort, err)
+		}
+
+		subHeaders := cloneMap(headers)
+		body := single
+		if provider.SupportsGzip {
+			body = compressRequestBody(provider.Name, subHeaders, single)
+		}
+		req := xrequest.New().
+			SetHeaders(subHeaders).
+			SetRetry(1, 500*time.Millisecond).
+			SetTimeout(attemptTimeout(c.Request.Context(), provider)).
+			SetBody(bytes.NewReader(body))
+		if provider.HTTPClient != nil {
+			req = req.SetClient(requestClientFor(provider))
+		}
+
+		resp, err := req.Post(targetURL)
+		if resp != nil {
+			requestLog.HttpCode = resp.StatusCode()
+		}
+		if err != nil {
+			return false, err
+		}
+		if resp == nil {
+			return false, fmt.Errorf("empty response")
+		}
+		if resp.Error() != nil {
+			return false, resp.Error()
+		}
+		if status := resp.StatusCode(); status < http.StatusOK || status >= http.StatusMultipleChoices {
+			return false, newUpstreamStatusError(status, resp.Bytes(), responseContentType(resp.RawResponse))
+		}
+		if i == 0 {
+			requestLog.TimeToFirstByte = time.Since(start).Seconds()
+		}
+		responses = append(responses, resp.Bytes())
+	}
+
+	merged, err := MergeCompletions(responses)
+	if err != nil {
+		return false, fmt.Errorf("合并 n=%d 的响应失败: %w", n, err)
+	}
+	merged = RewriteResponseModel(merged, upstreamModel, clientModel)
+	requestLog.ResponseBytes = int64(len(merged))
+	ExtractUsage(merged, FormatOpenAI).ApplyTo(requestLog)
+	c.Data(http.StatusOK, "application/json", merged)
+	return true, nil
+}
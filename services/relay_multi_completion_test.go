@@ -0,0 +1,159 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func TestCompletionCount(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"model":"gpt-4o","n":3}`, 3},
+		{`{"model":"gpt-4o","n":1}`, 1},
+		{`{"model":"gpt-4o"}`, 1},
+		{`{"model":"gpt-4o","n":0}`, 1},
+		{`{"model":"gpt-4o","n":"3"}`, 1},
+	}
+	for _, tt := range tests {
+		if got := CompletionCount([]byte(tt.body)); got != tt.want {
+			t.Errorf("CompletionCount(%s) = %d, want %d", tt.body, got, tt.want)
+		}
+	}
+
+	single, err := SplitCompletions([]byte(`{"model":"gpt-4o","n":3,"messages":[]}`))
+	if err != nil || gjson.GetBytes(single, "n").Exists() || !gjson.GetBytes(single, "messages").Exists() {
+		t.Errorf("SplitCompletions() = %s, %v", single, err)
+	}
+}
+
+func TestMergeCompletions(t *testing.T) {
+	responses := [][]byte{
+		[]byte(`{"id":"a","model":"glm-4","choices":[{"index":0,"message":{"role":"assistant","content":"one"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":3,"total_tokens":13,"prompt_tokens_details":{"cached_tokens":4}}}`),
+		[]byte(`{"id":"b","model":"glm-4","choices":[{"index":0,"message":{"role":"assistant","content":"two"},"finish_reason":"length"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15,"prompt_tokens_details":{"cached_tokens":6}}}`),
+		[]byte(`{"id":"c","model":"glm-4","choices":[{"index":0,"message":{"role":"assistant","content":"three"},"finish_reason":"stop"}]}`),
+	}
+	merged, err := MergeCompletions(responses)
+	if err != nil {
+		t.Fatalf("MergeCompletions() error = %v", err)
+	}
+
+	root := gjson.ParseBytes(merged)
+	if root.Get("id").String() != "a" || root.Get("model").String() != "glm-4" {
+		t.Errorf("应以第一个响应为基础: %s", merged)
+	}
+	choices := root.Get("choices").Array()
+	if len(choices) != 3 {
+		t.Fatalf("choices 数量 = %d, want 3", len(choices))
+	}
+	for i, want := range []string{"one", "two", "three"} {
+		if choices[i].Get("index").Int() != int64(i) || choices[i].Get("message.content").String() != want {
+			t.Errorf("choices[%d] = %s", i, choices[i].Raw)
+		}
+	}
+	if choices[1].Get("finish_reason").String() != "length" {
+		t.Errorf("应保留各自的 finish_reason: %s", choices[1].Raw)
+	}
+	for path, want := range map[string]int64{
+		"usage.prompt_tokens":                       20,
+		"usage.completion_tokens":                   8,
+		"usage.total_tokens":                        28,
+		"usage.prompt_tokens_details.cached_tokens": 10,
+	} {
+		if got := root.Get(path).Int(); got != want {
+			t.Errorf("%s = %d, want %d", path, got, want)
+		}
+	}
+
+	if _, err := MergeCompletions(nil); err == nil {
+		t.Error("空列表应返回错误")
+	}
+	if _, err := MergeCompletions([][]byte{[]byte("not json")}); err == nil {
+		t.Error("非法 JSON 应返回错误")
+	}
+}
+
+func TestNeedsCompletionSplit(t *testing.T) {
+	body := []byte(`{"model":"gpt-4o","n":2,"messages":[{"role":"user","content":"hi"}]}`)
+	tests := []struct {
+		name     string
+		provider Provider
+		endpoint string
+		isStream bool
+		want     bool
+	}{
+		{"不支持 n>1 的 OpenAI 上游", Provider{}, "/v1/chat/completions", false, true},
+		{"上游支持 n>1", Provider{SupportsMultipleCompletions: true}, "/v1/chat/completions", false, false},
+		{"流式请求不拆分", Provider{}, "/v1/chat/completions", true, false},
+		{"Claude 端点不拆分", Provider{}, "/v1/messages", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := needsCompletionSplit(tt.provider, body, tt.endpoint, tt.isStream); got != tt.want {
+				t.Errorf("needsCompletionSplit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetMaxCompletions(t *testing.T) {
+	defer SetMaxCompletions(DefaultMaxCompletions)
+
+	tests := []struct {
+		name string
+		n    int
+		want int64
+	}{
+		{"正常值", 4, 4},
+		{"小于 1 取 1", 0, 1},
+		{"超过上限取上限", 1000, MaxCompletionsLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetMaxCompletions(tt.n)
+			if got := maxCompletions.Load(); got != tt.want {
+				t.Errorf("maxCompletions = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardSplitCompletions_RejectsOverLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetMaxCompletions(2)
+	defer SetMaxCompletions(DefaultMaxCompletions)
+
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer upstream.Close()
+
+	prs := NewProviderRelayService(nil, nil, nil, nil, nil, "")
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	body := []byte(`{"model":"gpt-4o","n":3,"messages":[{"role":"user","content":"hi"}]}`)
+
+	requestLog := &ReqeustLog{}
+	ok, err := prs.forwardSplitCompletions(c, Provider{Name: "p"}, upstream.URL, map[string]string{}, body, requestLog, time.Now(), "", "")
+	if ok || !IsFatal(err, 0) {
+		t.Fatalf("ok=%v err=%v, n 超过上限应返回致命错误", ok, err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("超过上限时不应请求上游, 实际 %d 次", requests.Load())
+	}
+
+	respondFatalError(c, "p", FormatOpenAI, err)
+	if w.Code != http.StatusBadRequest || gjson.Get(w.Body.String(), "error.param").String() != "n" {
+		t.Errorf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ============================================================================
+// 请求转换流水线
+// ============================================================================
+
+// Transformer 请求体转换器
+type Transformer interface {
+	Transform(bodyBytes []byte) ([]byte, error)
+}
+
+// TransformerFunc 函数形式的 Transformer
+type TransformerFunc func(bodyBytes []byte) ([]byte, error)
+
+// Transform 实现 Transformer 接口
+func (f TransformerFunc) Transform(bodyBytes []byte) ([]byte, error) { return f(bodyBytes) }
+
+// Pipeline 按顺序执行的转换器列表，任一步出错立即中止
+type Pipeline []Transformer
+
+// Transform 依次执行所有转换器
+func (pl Pipeline) Transform(bodyBytes []byte) ([]byte, error) {
+	var err error
+	for i, t := range pl {
+		if bodyBytes, err = t.Transform(bodyBytes); err != nil {
+			return nil, fmt.Errorf("pipeline 第 %d 步失败: %w", i+1, err)
+		}
+	}
+	return bodyBytes, nil
+}
+
+// ---------- 内置转换器 ----------
+
+// RemapModel 将请求体中的 model 替换为指定值
+func RemapModel(model string) Transformer {
+	return TransformerFunc(func(bodyBytes []byte) ([]byte, error) {
+		return ReplaceModelInRequestBody(bodyBytes, model)
+	})
+}
+
+// StripFields 删除指定的 JSON 字段（gjson 路径语法），字段不存在时忽略
+func StripFields(paths ...string) Transformer {
+	return TransformerFunc(func(bodyBytes []byte) ([]byte, error) {
+		var err error
+		for _, path := range paths {
+			if !gjson.GetBytes(bodyBytes, path).Exists() {
+				continue
+			}
+			if bodyBytes, err = sjson.DeleteBytes(bodyBytes, path); err != nil {
+				return nil, fmt.Errorf("删除字段 %s 失败: %w", path, err)
+			}
+		}
+		return bodyBytes, nil
+	})
+}
+
+// maxTokensFields 各平台表示输出 token 上限的字段
+var maxTokensFields = []string{"max_tokens", "max_completion_tokens", "max_output_tokens"}
+
+// ClampMaxTokens 将输出 token 上限压到 limit 以内，未设置或未超限时不修改
+func ClampMaxTokens(limit int) Transformer {
+	return TransformerFunc(func(bodyBytes []byte) ([]byte, error) {
+		var err error
+		for _, field := range maxTokensFields {
+			value := gjson.GetBytes(bodyBytes, field)
+			if !value.Exists() || value.Int() <= int64(limit) {
+				continue
+			}
+			if bodyBytes, err = sjson.SetBytes(bodyBytes, field, limit); err != nil {
+				return nil, fmt.Errorf("设置 %s 失败: %w", field, err)
+			}
+		}
+		return bodyBytes, nil
+	})
+}
+
+// FixToolUse 补全未配对的 tool_use（见 FixIncompleteToolUse）
+// 显式配置的步骤始终修复，不受 SetToolUseRepairMode 影响
+func FixToolUse() Transformer {
+	return TransformerFunc(func(bodyBytes []byte) ([]byte, error) {
+		fixed, _, err := FixIncompleteToolUseWithMode(bodyBytes, ToolUseRepairAuto)
+		return fixed, err
+	})
+}
+
+// StripReasoning 移除历史中的推理内容（见 StripReasoningBlocks）
+func StripReasoning() Transformer {
+	return TransformerFunc(func(bodyBytes []byte) ([]byte, error) {
+		stripped, _, err := StripReasoningBlocks(bodyBytes)
+		return stripped, err
+	})
+}
+
+// ---------- 声明式配置 ----------
+
+// 内置转换器类型
+const (
+	TransformRemapModel     = "remap_model"
+	TransformStripFields    = "strip_fields"
+	TransformClampMaxTokens = "clamp_max_tokens"
+	TransformFixToolUse     = "fix_tool_use"
+	TransformStripReasoning = "strip_reasoning"
+)
+
+// TransformSpec 转换器的声明式配置（保存在 Provider.RequestPipeline 中）
+type TransformSpec struct {
+	Type      string   `json:"type"`
+	Model     string   `json:"model,omitempty"`     // remap_model
+	Fields    []string `json:"fields,omitempty"`    // strip_fields
+	MaxTokens int      `json:"maxTokens,omitempty"` // clamp_max_tokens
+}
+
+// BuildPipeline 根据声明式配置构建 Pipeline
+func BuildPipeline(specs []TransformSpec) (Pipeline, error) {
+	pl := make(Pipeline, 0, len(specs))
+	for i, spec := range specs {
+		switch spec.Type {
+		case TransformRemapModel:
+			if spec.Model == "" {
+				return nil, fmt.Errorf("第 %d 步 %s 缺少 model", i+1, spec.Type)
+			}
+			pl = append(pl, RemapModel(spec.Model))
+		case TransformStripFields:
+			pl = append(pl, StripFields(spec.Fields...))
+		case TransformClampMaxTokens:
+			if spec.MaxTokens <= 0 {
+				return nil, fmt.Errorf("第 %d 步 %s 的 maxTokens 必须大于 0", i+1, spec.Type)
+			}
+			pl = append(pl, ClampMaxTokens(spec.MaxTokens))
+		case TransformFixToolUse:
+			pl = append(pl, FixToolUse())
+		case TransformStripReasoning:
+			pl = append(pl, StripReasoning())
+		default:
+			return nil, fmt.Errorf("第 %d 步未知的转换类型: %q", i+1, spec.Type)
+		}
+	}
+	return pl, nil
+}
+
+// applyRequestPipeline 执行 Provider 配置的请求转换流水线，未配置时原样返回
+func applyRequestPipeline(provider *Provider, bodyBytes []byte) ([]byte, error) {
+	if len(provider.RequestPipeline) == 0 {
+		return bodyBytes, nil
+	}
+	pl, err := BuildPipeline(provider.RequestPipeline)
+	if err != nil {
+		return nil, err
+	}
+	return pl.Transform(bodyBytes)
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestPipeline_Transform(t *testing.T) {
+	body := []byte(`{"model":"a","max_tokens":100000,"metadata":{"user_id":"u"},"messages":[]}`)
+
+	pl, err := BuildPipeline([]TransformSpec{
+		{Type: TransformRemapModel, Model: "b"},
+		{Type: TransformStripFields, Fields: []string{"metadata", "not_exist"}},
+		{Type: TransformClampMaxTokens, MaxTokens: 8192},
+	})
+	if err != nil {
+		t.Fatalf("BuildPipeline() error = %v", err)
+	}
+
+	out, err := pl.Transform(body)
+	if err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+	if got := gjson.GetBytes(out, "model").String(); got != "b" {
+		t.Errorf("model = %q, 期望 b", got)
+	}
+	if gjson.GetBytes(out, "metadata").Exists() {
+		t.Error("metadata 应被删除")
+	}
+	if got := gjson.GetBytes(out, "max_tokens").Int(); got != 8192 {
+		t.Errorf("max_tokens = %d, 期望 8192", got)
+	}
+}
+
+func TestPipeline_ShortCircuit(t *testing.T) {
+	called := false
+	pl := Pipeline{
+		TransformerFunc(func([]byte) ([]byte, error) { return nil, errors.New("boom") }),
+		TransformerFunc(func(b []byte) ([]byte, error) { called = true; return b, nil }),
+	}
+	if _, err := pl.Transform([]byte(`{}`)); err == nil {
+		t.Fatal("期望返回错误")
+	}
+	if called {
+		t.Error("出错后不应继续执行后续转换器")
+	}
+}
+
+func TestBuildPipeline_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec TransformSpec
+	}{
+		{"未知类型", TransformSpec{Type: "unknown"}},
+		{"remap 缺少 model", TransformSpec{Type: TransformRemapModel}},
+		{"clamp 非正数", TransformSpec{Type: TransformClampMaxTokens}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := BuildPipeline([]TransformSpec{tt.spec}); err == nil {
+				t.Error("期望返回错误")
+			}
+		})
+	}
+}
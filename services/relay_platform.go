@@ -0,0 +1,79 @@
+package services
+
+import "strings"
+
+// ============================================================================
+// 平台类型
+// ============================================================================
+
+// Platform 平台标识：claude / codex / gemini / custom:{toolId}，多租户场景可带 "@tenant" 后缀（见 PlatformKey）
+// 基础类型为 string，字面量可直接赋值；来自配置或 URL 的值应先用 IsValid 校验，避免拼写错误导致静默路由为空
+type Platform string
+
+const (
+	PlatformClaude Platform = "claude"
+	PlatformCodex  Platform = "codex"
+	PlatformGemini Platform = "gemini"
+)
+
+// customPlatformPrefix 自定义 CLI 工具平台前缀
+const customPlatformPrefix = "custom:"
+
+// CustomPlatform 构造自定义 CLI 工具的平台标识（"custom:{name}"）
+func CustomPlatform(name string) Platform {
+	return Platform(customPlatformPrefix + name)
+}
+
+// String 实现 fmt.Stringer
+func (p Platform) String() string {
+	return string(p)
+}
+
+// Base 返回去掉租户后缀的平台标识
+func (p Platform) Base() Platform {
+	base, _, _ := strings.Cut(string(p), platformTenantSep)
+	return Platform(base)
+}
+
+// IsCustom 是否为自定义 CLI 工具平台
+func (p Platform) IsCustom() bool {
+	return strings.HasPrefix(string(p.Base()), customPlatformPrefix)
+}
+
+// IsValid 是否为已知平台：内置平台，或名称非空且满足 ValidatePlatformBase 的自定义平台；租户后缀不参与判断
+func (p Platform) IsValid() bool {
+	base := p.Base()
+	switch base {
+	case PlatformClaude, PlatformCodex, PlatformGemini:
+		return true
+	}
+	name, ok := strings.CutPrefix(string(base), customPlatformPrefix)
+	return ok && name != "" && ValidatePlatformBase(string(base)) == nil
+}
+
+// NormalizeKind 规范化 Provider.Kind：去除首尾空白，内置平台名与 "custom:" 前缀转为小写
+// 自定义工具名保持原样（工具 ID 区分大小写），例如 " Claude " -> "claude"，"Custom:MyCLI" -> "custom:MyCLI"
+func NormalizeKind(kind string) string {
+	kind = strings.TrimSpace(kind)
+	lower := strings.ToLower(kind)
+	switch Platform(lower) {
+	case PlatformClaude, PlatformCodex, PlatformGemini:
+		return lower
+	}
+	if strings.HasPrefix(lower, customPlatformPrefix) {
+		return customPlatformPrefix + kind[len(customPlatformPrefix):]
+	}
+	return kind
+}
+
+// PartitionByKind 按 Provider.Kind 将合并存放的 provider 列表拆分为各平台的列表，一次遍历完成
+// key 为 NormalizeKind 规范化后的 Kind，可直接作为 Platform 传给 FilterProviders；未声明 Kind 的归入 "" 分组，由调用方决定如何处理
+// 各分组保持输入顺序（轮询与配置顺序兜底依赖该顺序）；Provider 按值复制，不深拷贝内部的 map/切片
+func PartitionByKind(providers []Provider) map[string][]Provider {
+	partitions := make(map[string][]Provider)
+	for _, p := range providers {
+		kind := NormalizeKind(p.Kind)
+		partitions[kind] = append(partitions[kind], p)
+	}
+	return partitions
+}
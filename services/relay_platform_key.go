@@ -0,0 +1,54 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ============================================================================
+// 平台标识
+// ============================================================================
+
+// platformTenantSep 平台与租户之间的分隔符
+const platformTenantSep = "@"
+
+// PlatformKey 构造带租户的平台标识，用于隔离不同租户的轮询状态
+// 格式为 "base@tenant"，tenant 中的特殊字符会被转义，保证不同 (base, tenant) 不会产生相同的 key
+// tenant 为空时直接返回 base
+func PlatformKey(base Platform, tenant string) Platform {
+	if tenant == "" {
+		return base
+	}
+	return base + Platform(platformTenantSep+url.QueryEscape(tenant))
+}
+
+// ValidatePlatformBase 校验平台基础标识（PlatformKey 的 base 参数）
+// base 不能为空、不能包含空白或 "@"，且不能以 ":数字" 结尾（会与轮询 key 的 Level 后缀混淆）
+func ValidatePlatformBase(base string) error {
+	if base == "" {
+		return fmt.Errorf("平台标识不能为空")
+	}
+	if strings.ContainsAny(base, " \t\r\n") {
+		return fmt.Errorf("平台标识 %q 不能包含空白字符", base)
+	}
+	if strings.Contains(base, platformTenantSep) {
+		return fmt.Errorf("平台标识 %q 不能包含 %q", base, platformTenantSep)
+	}
+	if idx := strings.LastIndex(base, ":"); idx >= 0 && isAllDigits(base[idx+1:]) {
+		return fmt.Errorf("平台标识 %q 不能以 \":数字\" 结尾", base)
+	}
+	return nil
+}
+
+func isAllDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlatformKey(t *testing.T) {
+	if got := PlatformKey("claude", ""); got != "claude" {
+		t.Errorf("无租户 = %q", got)
+	}
+	if got := PlatformKey("custom:cli", "team-a"); got != "custom:cli@team-a" {
+		t.Errorf("带租户 = %q", got)
+	}
+	// tenant 中的分隔符被转义，不会与其他组合冲突
+	if PlatformKey("claude", "a@b") == PlatformKey("claude@a", "b") {
+		t.Error("不同 (base, tenant) 产生了相同的 key")
+	}
+	if PlatformKey("claude", "x:1") == PlatformKey("claude", "x")+":1" {
+		t.Error("tenant 不应与 Level 后缀混淆")
+	}
+}
+
+func TestValidatePlatformBase(t *testing.T) {
+	tests := []struct {
+		base    string
+		wantErr bool
+	}{
+		{"claude", false},
+		{"custom:mycli", false},
+		{"", true},
+		{"my cli", true},
+		{"claude@a", true},
+		{"custom:1", true},
+	}
+	for _, tt := range tests {
+		if err := ValidatePlatformBase(tt.base); (err != nil) != tt.wantErr {
+			t.Errorf("ValidatePlatformBase(%q) error = %v, wantErr %v", tt.base, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRoundRobinState_Keys(t *testing.T) {
+	rrs := NewRoundRobinState()
+	id := func(s string) string { return s }
+	Reorder(rrs, PlatformKey("claude", "t2"), 1, []string{"a", "b"}, id)
+	Reorder(rrs, "claude", 2, []string{"a", "b"}, id)
+	Reorder(rrs, "codex", 1, []string{"a"}, id) // 单个 provider 不记录状态
+
+	want := []string{"claude:2", "claude@t2:1"}
+	if got := rrs.Keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, 期望 %v", got, want)
+	}
+}
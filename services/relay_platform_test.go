@@ -0,0 +1,90 @@
+package services
+
+import "testing"
+
+func TestPlatform_IsValid(t *testing.T) {
+	tests := []struct {
+		platform Platform
+		want     bool
+	}{
+		{PlatformClaude, true},
+		{PlatformCodex, true},
+		{PlatformGemini, true},
+		{CustomPlatform("my-cli"), true},
+		{PlatformKey(PlatformClaude, "team-a"), true},
+		{PlatformKey(CustomPlatform("my-cli"), "team-a"), true},
+		{"claud", false},
+		{"Claude", false},
+		{"", false},
+		{CustomPlatform(""), false},
+		{CustomPlatform("my cli"), false},
+		{CustomPlatform("cli:2"), false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.platform), func(t *testing.T) {
+			if got := tt.platform.IsValid(); got != tt.want {
+				t.Errorf("%q.IsValid() = %v, want %v", tt.platform, got, tt.want)
+			}
+		})
+	}
+
+	if !CustomPlatform("x").IsCustom() || PlatformClaude.IsCustom() {
+		t.Error("IsCustom 判断错误")
+	}
+	if got := PlatformKey(CustomPlatform("x"), "t").Base(); got != "custom:x" {
+		t.Errorf("Base() = %q", got)
+	}
+}
+
+func TestPartitionByKind(t *testing.T) {
+	providers := []Provider{
+		{Name: "a", Kind: "claude"},
+		{Name: "b", Kind: "codex"},
+		{Name: "c", Kind: " claude "},
+		{Name: "d", Kind: "custom:my-cli"},
+		{Name: "e"},
+		{Name: "f", Kind: "Claude"}, // 大小写不同的 Kind 归入 PlatformClaude 分组
+		{Name: "g", Kind: "Custom:my-cli"},
+	}
+	partitions := PartitionByKind(providers)
+
+	want := map[string][]string{
+		"claude":        {"a", "c", "f"},
+		"codex":         {"b"},
+		"custom:my-cli": {"d", "g"},
+		"":              {"e"},
+	}
+	if len(partitions) != len(want) {
+		t.Fatalf("分组数 = %d, want %d: %v", len(partitions), len(want), partitions)
+	}
+	for kind, names := range want {
+		got := partitions[kind]
+		if len(got) != len(names) {
+			t.Errorf("%q 分组 = %v, want %v", kind, got, names)
+			continue
+		}
+		for i, name := range names {
+			if got[i].Name != name {
+				t.Errorf("%q 分组第 %d 个 = %s, want %s", kind, i, got[i].Name, name)
+			}
+		}
+	}
+}
+
+func TestNormalizeKind(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{" Claude ", "claude"},
+		{"CODEX", "codex"},
+		{"Gemini", "gemini"},
+		{"Custom:MyCLI", "custom:MyCLI"},
+		{"custom:my-cli", "custom:my-cli"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeKind(tt.in); got != tt.want {
+			t.Errorf("NormalizeKind(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============================================================================
+// 基于请求内容的 Provider 选择
+// ============================================================================
+
+// RequestPredicate 请求谓词，根据请求内容判断规则是否命中
+type RequestPredicate func(rc *RequestContext) bool
+
+// PredicateRule 请求谓词规则
+// 命中时：Exclude=false 表示只保留 Providers 中的 provider，Exclude=true 表示排除它们
+type PredicateRule struct {
+	Name      string           // 规则名称（用于日志）
+	Match     RequestPredicate // 请求谓词
+	Providers []string         // 规则作用的 provider 名称
+	Exclude   bool             // 命中后排除（true）还是限定（false）
+}
+
+// PredicateRegistry 请求谓词规则注册表（并发安全）
+type PredicateRegistry struct {
+	mu    sync.RWMutex
+	rules []PredicateRule
+}
+
+// NewPredicateRegistry 创建请求谓词注册表
+func NewPredicateRegistry() *PredicateRegistry {
+	return &PredicateRegistry{}
+}
+
+// Register 注册一条规则，规则按注册顺序依次生效
+func (r *PredicateRegistry) Register(rule PredicateRule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, rule)
+}
+
+// matchedRules 返回命中当前请求的规则
+func (r *PredicateRegistry) matchedRules(rc *RequestContext) []PredicateRule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matched []PredicateRule
+	for _, rule := range r.rules {
+		if rule.Match != nil && rule.Match(rc) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// ApplyRequestPredicates 按命中的规则过滤 providers（在 FilterProviders 之后、GroupByLevel 之前调用）
+// 没有规则命中时原样返回；多个规则命中时依次取交集/差集
+func ApplyRequestPredicates[T ProviderLike](r *PredicateRegistry, rc *RequestContext, providers []T) []T {
+	if r == nil || rc == nil {
+		return providers
+	}
+
+	matched := r.matchedRules(rc)
+	if len(matched) == 0 {
+		return providers
+	}
+
+	result := providers
+	for _, rule := range matched {
+		names := make(map[string]bool, len(rule.Providers))
+		for _, name := range rule.Providers {
+			names[name] = true
+		}
+
+		kept := make([]T, 0, len(result))
+		for _, p := range result {
+			if names[p.GetName()] != rule.Exclude {
+				kept = append(kept, p)
+			}
+		}
+		result = kept
+	}
+
+	return result
+}
+
+// RequestHasTool 返回一个谓词：请求的 tools 中包含指定名称的工具时命中
+// 同时兼容 Claude（tools[].name）和 OpenAI（tools[].function.name）格式
+func RequestHasTool(toolName string) RequestPredicate {
+	return func(rc *RequestContext) bool {
+		found := false
+		gjson.GetBytes(rc.BodyBytes, "tools").ForEach(func(_, tool gjson.Result) bool {
+			if tool.Get("name").String() == toolName || tool.Get("function.name").String() == toolName {
+				found = true
+				return false
+			}
+			return true
+		})
+		return found
+	}
+}
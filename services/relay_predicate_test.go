@@ -0,0 +1,72 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyRequestPredicates(t *testing.T) {
+	providers := []Provider{
+		{Name: "a", Enabled: true},
+		{Name: "b", Enabled: true},
+		{Name: "c", Enabled: true},
+	}
+
+	registry := NewPredicateRegistry()
+	registry.Register(PredicateRule{
+		Name:      "web_search 走 b",
+		Match:     RequestHasTool("web_search"),
+		Providers: []string{"b"},
+	})
+	registry.Register(PredicateRule{
+		Name:      "computer 不走 c",
+		Match:     RequestHasTool("computer"),
+		Providers: []string{"c"},
+		Exclude:   true,
+	})
+
+	names := func(ps []Provider) []string {
+		out := make([]string, 0, len(ps))
+		for _, p := range ps {
+			out = append(out, p.Name)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "Claude 格式命中限定规则",
+			body: `{"tools": [{"name": "web_search"}]}`,
+			want: []string{"b"},
+		},
+		{
+			name: "OpenAI 格式命中排除规则",
+			body: `{"tools": [{"type": "function", "function": {"name": "computer"}}]}`,
+			want: []string{"a", "b"},
+		},
+		{
+			name: "未命中任何规则",
+			body: `{"tools": [{"name": "bash"}]}`,
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "无 tools 字段",
+			body: `{"messages": []}`,
+			want: []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &RequestContext{BodyBytes: []byte(tt.body)}
+			got := names(ApplyRequestPredicates(registry, rc, providers))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("结果 = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
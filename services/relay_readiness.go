@@ -0,0 +1,74 @@
+package services
+
+import "time"
+
+// ============================================================================
+// 就绪状态汇总
+// ============================================================================
+
+// KindReadiness 单个平台的 provider 就绪统计
+type KindReadiness struct {
+	Total       int `json:"total"`       // 配置的 provider 总数
+	Enabled     int `json:"enabled"`     // 已启用
+	Valid       int `json:"valid"`       // 已启用且配置有效（含 configValidator）
+	Blacklisted int `json:"blacklisted"` // 配置有效但已拉黑
+	Selectable  int `json:"selectable"`  // 可被路由选中（含兜底 provider）
+}
+
+// Readiness 中转服务就绪状态
+type Readiness struct {
+	Ready bool                     `json:"ready"` // 至少有一个平台存在可选中的 provider
+	Kinds map[string]KindReadiness `json:"kinds"`
+}
+
+// ReadinessSummary 汇总各平台 provider 的就绪状态，可用于 /healthz
+// 使用与 FilterProviders / FilterGeminiProviders 完全相同的过滤逻辑，保证与真实路由一致；不输出日志、不上报指标
+// 参数:
+//   - providersByKind: 平台 -> Provider 列表（claude/codex/custom:xxx）
+//   - geminiProviders: Gemini provider 列表（统计在 "gemini" 下，为空时不统计）
+//   - blacklistChecker: 黑名单检查函数（可为 nil）
+//   - configValidator: 配置验证函数（可为 nil）
+func ReadinessSummary(
+	providersByKind map[string][]Provider,
+	geminiProviders []GeminiProvider,
+	blacklistChecker func(kind, name string) (bool, time.Time),
+	configValidator func(p *Provider) []string,
+) Readiness {
+	readiness := Readiness{Kinds: make(map[string]KindReadiness, len(providersByKind)+1)}
+
+	for kind, providers := range providersByKind {
+		kr := KindReadiness{Total: len(providers)}
+		skipped := make(map[SkipReason]int)
+		active := filterProviders(providers, kind, "", blacklistChecker, nil, configValidator,
+			func(_ Provider, reason SkipReason, _ string) { skipped[reason]++ },
+		)
+		kr.fill(skipped, len(active))
+		readiness.Kinds[kind] = kr
+	}
+
+	if len(geminiProviders) > 0 {
+		kr := KindReadiness{Total: len(geminiProviders)}
+		skipped := make(map[SkipReason]int)
+		active := filterGeminiProviders(geminiProviders, blacklistChecker,
+			func(_ GeminiProvider, reason SkipReason, _ string) { skipped[reason]++ },
+		)
+		kr.fill(skipped, len(active))
+		readiness.Kinds["gemini"] = kr
+	}
+
+	for _, kr := range readiness.Kinds {
+		if kr.Selectable > 0 {
+			readiness.Ready = true
+			break
+		}
+	}
+	return readiness
+}
+
+// fill 根据跳过原因统计填充各项计数
+func (kr *KindReadiness) fill(skipped map[SkipReason]int, selectable int) {
+	kr.Enabled = kr.Total - skipped[SkipReasonDisabled]
+	kr.Valid = kr.Enabled - skipped[SkipReasonInvalidConfig] - skipped[SkipReasonConfigValidationFailed]
+	kr.Blacklisted = skipped[SkipReasonBlacklisted]
+	kr.Selectable = selectable
+}
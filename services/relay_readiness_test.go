@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadinessSummary(t *testing.T) {
+	blacklist := func(kind, name string) (bool, time.Time) {
+		return name == "blocked", time.Now().Add(time.Minute)
+	}
+	providers := map[string][]Provider{
+		"claude": {
+			{Name: "ok", APIURL: "https://a", APIKey: "k", Enabled: true},
+			{Name: "blocked", APIURL: "https://a", APIKey: "k", Enabled: true},
+			{Name: "nokey", APIURL: "https://a", Enabled: true},
+			{Name: "off", APIURL: "https://a", APIKey: "k"},
+		},
+		"codex": {
+			{Name: "blocked", APIURL: "https://a", APIKey: "k", Enabled: true},
+		},
+	}
+	gemini := []GeminiProvider{{Name: "g", BaseURL: "https://g", APIKey: "k", Enabled: true}}
+
+	r := ReadinessSummary(providers, gemini, blacklist, nil)
+	if !r.Ready {
+		t.Error("存在可选 provider 时应就绪")
+	}
+
+	want := KindReadiness{Total: 4, Enabled: 3, Valid: 2, Blacklisted: 1, Selectable: 1}
+	if got := r.Kinds["claude"]; got != want {
+		t.Errorf("claude = %+v, 期望 %+v", got, want)
+	}
+	if got := r.Kinds["codex"]; got.Selectable != 0 || got.Blacklisted != 1 {
+		t.Errorf("codex = %+v", got)
+	}
+	if got := r.Kinds["gemini"]; got.Selectable != 1 {
+		t.Errorf("gemini = %+v", got)
+	}
+
+	if r := ReadinessSummary(map[string][]Provider{"codex": providers["codex"]}, nil, blacklist, nil); r.Ready {
+		t.Error("没有可选 provider 时不应就绪")
+	}
+}
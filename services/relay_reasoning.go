@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ============================================================================
+// 推理内容剥离
+// ============================================================================
+
+// reasoningBlockTypes Claude 格式中的推理内容块类型
+var reasoningBlockTypes = map[string]bool{
+	"thinking":          true,
+	"redacted_thinking": true,
+}
+
+// StripReasoningBlocks 从历史消息中移除推理内容，使请求可被不支持推理的 provider 接受
+// 处理范围：
+//   - Claude：assistant 消息 content 中的 thinking / redacted_thinking 块（移除后为空的 assistant 消息整条删除）
+//   - OpenAI Chat：assistant 消息上的 reasoning / reasoning_content 字段
+//   - OpenAI Responses：input 中 type=reasoning 的条目
+//
+// 其余内容块保持原样；返回 (新请求体, 是否有移除, 错误)
+func StripReasoningBlocks(bodyBytes []byte) ([]byte, bool, error) {
+	result := bodyBytes
+	removed := false
+
+	messages := gjson.GetBytes(result, "messages")
+	if messages.IsArray() {
+		msgs := messages.Array()
+		// 从后向前删除，保证前面的下标不受影响
+		for i := len(msgs) - 1; i >= 0; i-- {
+			msg := msgs[i]
+			if msg.Get("role").String() != "assistant" {
+				continue
+			}
+
+			for _, field := range []string{"reasoning_content", "reasoning"} {
+				if msg.Get(field).Exists() {
+					var err error
+					if result, err = sjson.DeleteBytes(result, fmt.Sprintf("messages.%d.%s", i, field)); err != nil {
+						return bodyBytes, false, fmt.Errorf("删除 %s 失败: %w", field, err)
+					}
+					removed = true
+				}
+			}
+
+			content := msg.Get("content")
+			if !content.IsArray() {
+				continue
+			}
+			blocks := content.Array()
+			var reasoningIdx []int
+			for j, block := range blocks {
+				if reasoningBlockTypes[block.Get("type").String()] {
+					reasoningIdx = append(reasoningIdx, j)
+				}
+			}
+			if len(reasoningIdx) == 0 {
+				continue
+			}
+			removed = true
+
+			var err error
+			if len(reasoningIdx) == len(blocks) {
+				// 只有推理内容的 assistant 消息，保留空 content 会被上游拒绝，整条删除
+				if result, err = sjson.DeleteBytes(result, fmt.Sprintf("messages.%d", i)); err != nil {
+					return bodyBytes, false, fmt.Errorf("删除消息失败: %w", err)
+				}
+				continue
+			}
+			for k := len(reasoningIdx) - 1; k >= 0; k-- {
+				if result, err = sjson.DeleteBytes(result, fmt.Sprintf("messages.%d.content.%d", i, reasoningIdx[k])); err != nil {
+					return bodyBytes, false, fmt.Errorf("删除推理块失败: %w", err)
+				}
+			}
+		}
+	}
+
+	input := gjson.GetBytes(result, "input")
+	if input.IsArray() {
+		items := input.Array()
+		for i := len(items) - 1; i >= 0; i-- {
+			if items[i].Get("type").String() != "reasoning" {
+				continue
+			}
+			var err error
+			if result, err = sjson.DeleteBytes(result, fmt.Sprintf("input.%d", i)); err != nil {
+				return bodyBytes, false, fmt.Errorf("删除 reasoning 条目失败: %w", err)
+			}
+			removed = true
+		}
+	}
+
+	return result, removed, nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestStripReasoningBlocks(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantRemoved bool
+		check       func(t *testing.T, out []byte)
+	}{
+		{
+			name:        "Claude thinking 块",
+			body:        `{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":[{"type":"thinking","thinking":"..."},{"type":"text","text":"hello"},{"type":"redacted_thinking","data":"x"}]}]}`,
+			wantRemoved: true,
+			check: func(t *testing.T, out []byte) {
+				content := gjson.GetBytes(out, "messages.1.content").Array()
+				if len(content) != 1 || content[0].Get("text").String() != "hello" {
+					t.Errorf("content = %s", gjson.GetBytes(out, "messages.1.content").Raw)
+				}
+			},
+		},
+		{
+			name:        "仅含推理的 assistant 消息整条删除",
+			body:        `{"messages":[{"role":"user","content":"a"},{"role":"assistant","content":[{"type":"thinking","thinking":"..."}]},{"role":"user","content":"b"}]}`,
+			wantRemoved: true,
+			check: func(t *testing.T, out []byte) {
+				if n := len(gjson.GetBytes(out, "messages").Array()); n != 2 {
+					t.Errorf("消息数 = %d, 期望 2", n)
+				}
+			},
+		},
+		{
+			name:        "OpenAI reasoning_content 字段",
+			body:        `{"messages":[{"role":"assistant","content":"ok","reasoning_content":"..."}]}`,
+			wantRemoved: true,
+			check: func(t *testing.T, out []byte) {
+				if gjson.GetBytes(out, "messages.0.reasoning_content").Exists() {
+					t.Error("reasoning_content 未删除")
+				}
+				if gjson.GetBytes(out, "messages.0.content").String() != "ok" {
+					t.Error("content 不应被修改")
+				}
+			},
+		},
+		{
+			name:        "Responses reasoning 条目",
+			body:        `{"input":[{"type":"reasoning","summary":[]},{"type":"message","role":"user","content":"x"}]}`,
+			wantRemoved: true,
+			check: func(t *testing.T, out []byte) {
+				items := gjson.GetBytes(out, "input").Array()
+				if len(items) != 1 || items[0].Get("type").String() != "message" {
+					t.Errorf("input = %s", gjson.GetBytes(out, "input").Raw)
+				}
+			},
+		},
+		{
+			name:        "无推理内容",
+			body:        `{"messages":[{"role":"assistant","content":[{"type":"text","text":"hi"}]}]}`,
+			wantRemoved: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, removed, err := StripReasoningBlocks([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("StripReasoningBlocks() error = %v", err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("removed = %v, 期望 %v", removed, tt.wantRemoved)
+			}
+			if !tt.wantRemoved && string(out) != tt.body {
+				t.Errorf("未移除时请求体应保持不变: %s", out)
+			}
+			if tt.check != nil {
+				tt.check(t, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// 请求/响应录制
+// ============================================================================
+
+// sensitiveHeaders 需要脱敏的请求头（小写）
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"x-api-key":           true,
+	"api-key":             true,
+	"x-goog-api-key":      true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// redactedValue 脱敏后的占位值
+const redactedValue = "[REDACTED]"
+
+// RedactHeaders 返回脱敏后的请求头副本，认证类请求头的值被替换为 [REDACTED]
+func RedactHeaders(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for key, value := range headers {
+		if sensitiveHeaders[strings.ToLower(key)] {
+			value = redactedValue
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// sensitiveQueryParams 需要脱敏的查询参数（小写），如 Gemini 客户端通过 ?key= 传递 API Key
+var sensitiveQueryParams = map[string]bool{
+	"key":          true,
+	"api_key":      true,
+	"access_token": true,
+}
+
+// RedactQuery 返回脱敏后的查询参数副本，认证类参数的值被替换为 [REDACTED]
+func RedactQuery(query map[string]string) map[string]string {
+	if query == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(query))
+	for key, value := range query {
+		if sensitiveQueryParams[strings.ToLower(key)] {
+			value = redactedValue
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// Recorder 按采样率将请求/响应成对写入目录，用于构建回放测试语料
+type Recorder struct {
+	Dir        string  // 录制文件目录
+	SampleRate float64 // 采样率（0~1），<= 0 不录制，>= 1 全部录制
+
+	seq       atomic.Uint64
+	randFloat func() float64 // 随机数来源（测试中替换）
+}
+
+// NewRecorder 创建录制器
+func NewRecorder(dir string, sampleRate float64) *Recorder {
+	return &Recorder{Dir: dir, SampleRate: sampleRate, randFloat: rand.Float64}
+}
+
+// ShouldRecord 按采样率决定本次请求是否录制
+func (r *Recorder) ShouldRecord() bool {
+	if r == nil || r.SampleRate <= 0 {
+		return false
+	}
+	if r.SampleRate >= 1 {
+		return true
+	}
+	return r.randFloat() < r.SampleRate
+}
+
+// recording 录制文件内容
+type recording struct {
+	RecordedAt string          `json:"recordedAt"`
+	Meta       ReqeustLog      `json:"meta"`
+	Request    recordedRequest `json:"request"`
+	Response   json.RawMessage `json:"response"`
+}
+
+type recordedRequest struct {
+	Headers map[string]string `json:"headers"`
+	Query   map[string]string `json:"query,omitempty"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// Record 将一次请求与响应写入 Dir 下的独立 JSON 文件，请求头与查询参数会先脱敏
+// 调用方应先通过 ShouldRecord 判断是否需要录制
+func (r *Recorder) Record(ctx *RequestContext, responseBody []byte, meta ReqeustLog) error {
+	if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+		return fmt.Errorf("创建录制目录失败: %w", err)
+	}
+
+	now := time.Now()
+	rec := recording{
+		RecordedAt: now.Format(time.RFC3339Nano),
+		Meta:       meta,
+		Request: recordedRequest{
+			Headers: RedactHeaders(ctx.ClientHeaders),
+			Query:   RedactQuery(ctx.Query),
+			Body:    rawJSONOrString(ctx.BodyBytes),
+		},
+		Response: rawJSONOrString(responseBody),
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化录制内容失败: %w", err)
+	}
+
+	name := fmt.Sprintf("%s_%06d_%s.json", now.Format("20060102T150405"), r.seq.Add(1), sanitizeFileName(meta.Provider))
+	if err := os.WriteFile(filepath.Join(r.Dir, name), data, 0o600); err != nil {
+		return fmt.Errorf("写入录制文件失败: %w", err)
+	}
+	return nil
+}
+
+// rawJSONOrString 合法 JSON 原样嵌入，否则（如 SSE 流）作为字符串嵌入
+func rawJSONOrString(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return json.RawMessage("null")
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// sanitizeFileName 将 provider 名称中不适合作为文件名的字符替换为下划线
+func sanitizeFileName(name string) string {
+	if name == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRecorder(dir, 0.5)
+
+	r.randFloat = func() float64 { return 0.4 }
+	if !r.ShouldRecord() {
+		t.Error("随机数低于采样率时应录制")
+	}
+	r.randFloat = func() float64 { return 0.6 }
+	if r.ShouldRecord() {
+		t.Error("随机数高于采样率时不应录制")
+	}
+	if NewRecorder(dir, 0).ShouldRecord() {
+		t.Error("采样率为 0 时不应录制")
+	}
+
+	ctx := &RequestContext{
+		BodyBytes:     []byte(`{"model":"m"}`),
+		ClientHeaders: map[string]string{"Authorization": "Bearer secret", "X-Api-Key": "secret", "Accept": "application/json"},
+		Query:         map[string]string{"key": "secret", "alt": "sse"},
+	}
+	if err := r.Record(ctx, []byte("data: {}\n\n"), ReqeustLog{Provider: "my/provider", HttpCode: 200}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 || !strings.HasSuffix(files[0], "_my_provider.json") {
+		t.Fatalf("录制文件 = %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if strings.Contains(string(data), "secret") {
+		t.Error("敏感请求头或查询参数未脱敏")
+	}
+
+	var rec recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		t.Fatalf("录制文件不是合法 JSON: %v", err)
+	}
+	if gjson.GetBytes(rec.Request.Body, "model").String() != "m" || rec.Request.Headers["Accept"] != "application/json" {
+		t.Errorf("请求内容 = %+v", rec.Request)
+	}
+	if rec.Request.Query["key"] != redactedValue || rec.Request.Query["alt"] != "sse" {
+		t.Errorf("查询参数 = %v", rec.Request.Query)
+	}
+	if rec.Meta.HttpCode != 200 {
+		t.Errorf("meta = %+v", rec.Meta)
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	got := RedactQuery(map[string]string{"key": "k", "API_KEY": "k", "access_token": "t", "alt": "sse"})
+	for _, name := range []string{"key", "API_KEY", "access_token"} {
+		if got[name] != redactedValue {
+			t.Errorf("%s = %q, 期望脱敏", name, got[name])
+		}
+	}
+	if got["alt"] != "sse" {
+		t.Errorf("普通参数被修改: %v", got)
+	}
+	if RedactQuery(nil) != nil {
+		t.Error("nil 输入应返回 nil")
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ============================================================================
+// 按区域就近路由
+// ============================================================================
+
+// ClientRegionHeader 客户端区域请求头（由前置网关或 GeoIP 中间件写入）
+const ClientRegionHeader = "X-Client-Region"
+
+// GetRegion 返回部署区域
+func (p Provider) GetRegion() string { return p.Region }
+
+// GetRegion 返回部署区域
+func (g GeminiProvider) GetRegion() string { return g.Region }
+
+// ClientRegion 从请求上下文读取客户端区域，未提供时返回空
+func ClientRegion(ctx *RequestContext) string {
+	if ctx == nil {
+		return ""
+	}
+	return strings.TrimSpace(ctx.ClientHeaders[http.CanonicalHeaderKey(ClientRegionHeader)])
+}
+
+// ReorderByRegion 将与客户端同区域的 providers 移到最前，其余保持在后
+// 稳定分区：每个区域桶内保持输入顺序，传入已轮询排序的列表即可在桶内继续轮询
+// 区域比较不区分大小写；clientRegion 为空或没有同区域 provider 时原样返回；不修改原切片
+func ReorderByRegion[T any](providers []T, getRegion func(T) string, clientRegion string) []T {
+	clientRegion = strings.TrimSpace(clientRegion)
+	if clientRegion == "" || len(providers) <= 1 {
+		return providers
+	}
+
+	local := make([]T, 0, len(providers))
+	var remote []T
+	for _, p := range providers {
+		if strings.EqualFold(strings.TrimSpace(getRegion(p)), clientRegion) {
+			local = append(local, p)
+		} else {
+			remote = append(remote, p)
+		}
+	}
+	if len(local) == 0 || len(remote) == 0 {
+		return providers
+	}
+	return append(local, remote...)
+}
+
+// regionProvider 声明了部署区域的 provider
+type regionProvider interface {
+	GetRegion() string
+}
+
+// RegionSelector 在下游 Selector 的结果上按客户端区域就近排序
+// 客户端区域取自 ClientRegionHeader；兜底 provider 始终留在末尾
+type RegionSelector struct {
+	Next Selector // 基础排序（Level 分组 + 轮询等），为 nil 时使用不轮询的 SelectProviders
+}
+
+// Select 实现 Selector 接口
+func (s *RegionSelector) Select(providers []ProviderLike, ctx *RequestContext) []ProviderLike {
+	var ordered []ProviderLike
+	if s.Next != nil {
+		ordered = s.Next.Select(providers, ctx)
+	} else {
+		ordered = SelectProviders[ProviderLike](nil, "", providers)
+	}
+
+	region := ClientRegion(ctx)
+	if region == "" {
+		return ordered
+	}
+	normal, lastResort := splitLastResort(ordered)
+	return append(ReorderByRegion(normal, providerRegion, region), lastResort...)
+}
+
+// providerRegion 返回 provider 的部署区域，未声明时返回空
+func providerRegion(p ProviderLike) string {
+	if rp, ok := p.(regionProvider); ok {
+		return rp.GetRegion()
+	}
+	return ""
+}
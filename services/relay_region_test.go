@@ -0,0 +1,54 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReorderByRegion(t *testing.T) {
+	providers := []Provider{
+		{Name: "a", Region: "us"},
+		{Name: "b", Region: "eu"},
+		{Name: "c", Region: "US"},
+		{Name: "d"},
+	}
+	names := func(ps []Provider) string {
+		out := make([]string, len(ps))
+		for i, p := range ps {
+			out[i] = p.Name
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name   string
+		region string
+		want   string
+	}{
+		{"未提供客户端区域", "", "a,b,c,d"},
+		{"同区域提前且保持顺序", "us", "a,c,b,d"},
+		{"单个同区域", " eu ", "b,a,c,d"},
+		{"没有同区域", "ap", "a,b,c,d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(ReorderByRegion(providers, Provider.GetRegion, tt.region)); got != tt.want {
+				t.Errorf("ReorderByRegion() = %s, 期望 %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegionSelector(t *testing.T) {
+	providers := toProviderLikes([]Provider{
+		{Name: "a", Level: 1, Region: "us"},
+		{Name: "b", Level: 1, Region: "eu"},
+		{Name: "z", Level: 1, Region: "eu", LastResort: true},
+	})
+	ctx := &RequestContext{ClientHeaders: map[string]string{"X-Client-Region": "eu"}}
+
+	got := (&RegionSelector{}).Select(providers, ctx)
+	if len(got) != 3 || got[0].GetName() != "b" || got[1].GetName() != "a" || got[2].GetName() != "z" {
+		t.Errorf("Select() = %v, 期望 b,a,z", got)
+	}
+}
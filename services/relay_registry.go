@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ============================================================================
+// Provider 配置注册表（原子切换，零停机重载）
+// ============================================================================
+
+// ProviderSnapshot 某一时刻的完整 provider 配置，发布后只读
+// 请求在开始选择时取一次快照并全程使用，重载只替换注册表中的指针，不会看到新旧混合的列表
+type ProviderSnapshot struct {
+	Version   uint64                // 从 1 开始递增，每次 Reload 加 1
+	LoadedAt  time.Time             // 发布时间
+	providers map[string][]Provider // kind -> providers（见 PartitionByKind）
+}
+
+// Providers 返回 kind 的 provider 列表副本，kind 不存在时返回 nil, false
+// 返回副本而不是内部切片：调用方修改（如 ValidateConfiguration 写入 configErrors）不会影响其他请求
+func (s *ProviderSnapshot) Providers(kind string) ([]Provider, bool) {
+	if s == nil {
+		return nil, false
+	}
+	providers, ok := s.providers[kind]
+	if !ok {
+		return nil, false
+	}
+	return cloneProviders(providers), true
+}
+
+// Kinds 返回快照中包含的平台数
+func (s *ProviderSnapshot) Kinds() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.providers)
+}
+
+// ProviderRegistry 以 atomic.Pointer 保存当前的 ProviderSnapshot
+// Current 无锁读取；Reload 构造新快照后一次性替换，正在处理的请求继续使用各自取到的旧快照
+type ProviderRegistry struct {
+	current atomic.Pointer[ProviderSnapshot]
+	mu      sync.Mutex       // 串行化 Reload，保证 Version 递增与发布顺序一致
+	rrs     *RoundRobinState // 重载后清理指向已删除 provider 的轮询记录，可为 nil
+
+	onReload func(prev, next *ProviderSnapshot) // 新快照发布后回调（见 SetOnReload），可为 nil
+}
+
+// NewProviderRegistry 创建空注册表；rrs 非 nil 时每次 Reload 后调用 rrs.Prune
+func NewProviderRegistry(rrs *RoundRobinState) *ProviderRegistry {
+	r := &ProviderRegistry{rrs: rrs}
+	r.current.Store(&ProviderSnapshot{providers: map[string][]Provider{}})
+	return r
+}
+
+// SetOnReload 设置新快照发布后的回调，用于清理依赖旧配置的状态（轮询记录、模型列表缓存等）
+// 回调在 Reload 的锁内按发布顺序执行，不应再调用 Reload；传入 nil 取消
+func (r *ProviderRegistry) SetOnReload(fn func(prev, next *ProviderSnapshot)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReload = fn
+}
+
+// Current 返回当前快照（不为 nil）；一次请求内应只调用一次，并从同一个快照读取所有平台的配置
+func (r *ProviderRegistry) Current() *ProviderSnapshot {
+	return r.current.Load()
+}
+
+// Reload 以新的 provider 列表替换当前配置，按 Provider.Kind 拆分（见 PartitionByKind），返回新快照
+// 入参会被深拷贝，调用方之后修改不影响已发布的快照；未声明 Kind 的 provider 无法被任何平台读取
+func (r *ProviderRegistry) Reload(providers []Provider) *ProviderSnapshot {
+	partitions := PartitionByKind(providers)
+	valid := make(map[string]bool, len(providers))
+	for kind, list := range partitions {
+		partitions[kind] = cloneProviders(list)
+		for _, p := range list {
+			valid[p.Name] = true
+		}
+	}
+
+	r.mu.Lock()
+	prev := r.current.Load()
+	snap := &ProviderSnapshot{
+		Version:   prev.Version + 1,
+		LoadedAt:  clockNow(),
+		providers: partitions,
+	}
+	r.current.Store(snap)
+	if r.onReload != nil {
+		r.onReload(prev, snap)
+	}
+	r.mu.Unlock()
+
+	if r.rrs != nil {
+		if pruned := r.rrs.Prune(valid); pruned > 0 {
+			fmt.Printf("[INFO] 配置重载后清理了 %d 条轮询记录\n", pruned)
+		}
+	}
+	return snap
+}
+
+// WatchReloadSignal 收到 sig（默认 SIGHUP）时调用 load 重新加载配置并 Reload，直到 ctx 结束
+// load 失败时保留当前配置，只记录警告
+func (r *ProviderRegistry) WatchReloadSignal(ctx context.Context, load func() ([]Provider, error), sig ...os.Signal) {
+	if len(sig) == 0 {
+		sig = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case s := <-ch:
+				providers, err := load()
+				if err != nil {
+					fmt.Printf("[WARN] 收到 %v，重新加载配置失败，继续使用当前配置: %v\n", s, err)
+					continue
+				}
+				snap := r.Reload(providers)
+				fmt.Printf("[INFO] 收到 %v，已重新加载配置: version=%d, %d 个 provider\n", s, snap.Version, len(providers))
+			}
+		}
+	}()
+}
+
+// cloneProviders 深拷贝 provider 列表
+func cloneProviders(providers []Provider) []Provider {
+	if providers == nil {
+		return nil
+	}
+	cloned := make([]Provider, len(providers))
+	for i, p := range providers {
+		cloned[i] = p.Clone()
+	}
+	return cloned
+}
+
+// LoadRegistryProviders 读取所有平台的配置文件（见 ProviderService.ProviderKinds），按文件所属平台设置 Kind，供 Reload 使用
+// 只在内存中迁移旧字段，不写回磁盘也不加锁，可以在 ProviderService 的保存回调中调用
+func LoadRegistryProviders(ps *ProviderService) ([]Provider, error) {
+	kinds, err := ps.ProviderKinds()
+	if err != nil {
+		return nil, err
+	}
+	var all []Provider
+	for _, kind := range kinds {
+		providers, err := ps.loadProvidersRaw(kind)
+		if err != nil {
+			return nil, fmt.Errorf("加载 %s 配置失败: %w", kind, err)
+		}
+		for i := range providers {
+			providers[i].migrateFromLegacy()
+			providers[i].Kind = kind
+		}
+		all = append(all, providers...)
+	}
+	return all, nil
+}
+
+// EnableProviderRegistry 用 load 加载配置并切换到注册表转发：
+// 配置保存后立即重新加载，收到 SIGHUP 时也会重新加载（见 WatchReloadSignal），直到 ctx 结束
+// 首次加载失败时返回错误，仍从配置文件加载
+func (prs *ProviderRelayService) EnableProviderRegistry(ctx context.Context, load func() ([]Provider, error)) (*ProviderRegistry, error) {
+	providers, err := load()
+	if err != nil {
+		return nil, err
+	}
+	registry := NewProviderRegistry(nil)
+	registry.SetOnReload(prs.onRegistryReload)
+	registry.Reload(providers)
+	prs.SetProviderRegistry(registry)
+
+	if prs.providerService != nil {
+		prs.providerService.SetOnSave(func(kind string) {
+			providers, err := load()
+			if err != nil {
+				fmt.Printf("[WARN] 保存 %s 配置后重新加载注册表失败，继续使用当前配置: %v\n", kind, err)
+				return
+			}
+			snap := registry.Reload(providers)
+			fmt.Printf("[INFO] 保存 %s 配置后已重新加载注册表: version=%d\n", kind, snap.Version)
+		})
+	}
+	registry.WatchReloadSignal(ctx, load)
+	return registry, nil
+}
+
+// onRegistryReload 注册表重载后清理 relay 中依赖旧配置的状态：
+// 指向已删除 provider 的轮询记录（rrLastStart），以及已删除或地址、密钥变化的 provider 的 /v1/models 缓存
+// 只处理快照中包含的平台，其余平台（如 Gemini）仍从配置文件加载，状态保持不变
+func (prs *ProviderRelayService) onRegistryReload(prev, next *ProviderSnapshot) {
+	prs.rrMu.Lock()
+	pruned := 0
+	for key, name := range prs.rrLastStart {
+		i := strings.LastIndex(key, ":")
+		if i < 0 {
+			continue
+		}
+		providers, ok := next.providers[key[:i]]
+		if !ok {
+			continue
+		}
+		if !slices.ContainsFunc(providers, func(p Provider) bool { return p.Name == name }) {
+			delete(prs.rrLastStart, key)
+			pruned++
+		}
+	}
+	prs.rrMu.Unlock()
+	if pruned > 0 {
+		fmt.Printf("[INFO] 配置重载后清理了 %d 条轮询记录\n", pruned)
+	}
+
+	if prs.modelsCache == nil || prev == nil {
+		return
+	}
+	for kind, providers := range prev.providers {
+		for _, old := range providers {
+			idx := slices.IndexFunc(next.providers[kind], func(p Provider) bool { return p.Name == old.Name })
+			if idx >= 0 {
+				cur := next.providers[kind][idx]
+				if cur.APIURL == old.APIURL && cur.APIKey == old.APIKey && cur.ConnectivityAuthType == old.ConnectivityAuthType {
+					continue
+				}
+			}
+			prs.modelsCache.Invalidate(kind + "/" + old.Name)
+		}
+	}
+}
+
+// SetProviderRegistry 使用注册表中的配置转发请求，取代每次请求从配置文件加载
+// 注册表中没有的平台仍从配置文件加载；传入 nil 恢复从配置文件加载
+func (prs *ProviderRelayService) SetProviderRegistry(r *ProviderRegistry) {
+	prs.registry.Store(r)
+}
+
+// snapshot 返回当前快照，注册表为 nil 时返回 nil
+func (r *ProviderRegistry) snapshot() *ProviderSnapshot {
+	if r == nil {
+		return nil
+	}
+	return r.Current()
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package services
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProviderRegistry_WatchReloadSignal(t *testing.T) {
+	reg := NewProviderRegistry(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	loaded := make(chan struct{}, 1)
+	reg.WatchReloadSignal(ctx, func() ([]Provider, error) {
+		defer func() { loaded <- struct{}{} }()
+		return []Provider{{Name: "a", Kind: "claude"}}, nil
+	}, syscall.SIGUSR1)
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Skipf("无法发送信号: %v", err)
+	}
+	select {
+	case <-loaded:
+	case <-time.After(2 * time.Second):
+		t.Fatal("收到信号后应重新加载配置")
+	}
+	deadline := time.Now().Add(time.Second)
+	for reg.Current().Version != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := reg.Current().Providers("claude"); !ok {
+		t.Error("重新加载后应发布新快照")
+	}
+}
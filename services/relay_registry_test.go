@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestProviderRegistry_Reload(t *testing.T) {
+	rrs := NewRoundRobinState()
+	rrs.SeedKey(RoundRobinKey(PlatformClaude, 1), "old")
+	rrs.SeedKey(RoundRobinKey(PlatformClaude, 2), "a")
+	reg := NewProviderRegistry(rrs)
+
+	if snap := reg.Current(); snap == nil || snap.Version != 0 || snap.Kinds() != 0 {
+		t.Fatalf("初始快照 = %+v", snap)
+	}
+	if _, ok := reg.Current().Providers("claude"); ok {
+		t.Error("空注册表不应包含任何平台")
+	}
+
+	input := []Provider{
+		{Name: "a", Kind: "claude", ModelMapping: map[string]string{"x": "y"}},
+		{Name: "b", Kind: "codex"},
+	}
+	first := reg.Reload(input)
+	input[0].ModelMapping["x"] = "changed"
+
+	if first.Version != 1 || reg.Current() != first {
+		t.Errorf("Reload 后应发布新快照: version=%d", first.Version)
+	}
+	claude, ok := first.Providers("claude")
+	if !ok || len(claude) != 1 || claude[0].ModelMapping["x"] != "y" {
+		t.Errorf("快照应与调用方的后续修改隔离: %+v", claude)
+	}
+	claude[0].Name = "mutated"
+	if again, _ := first.Providers("claude"); again[0].Name != "a" {
+		t.Error("Providers 应返回副本")
+	}
+	if keys := rrs.Keys(); len(keys) != 1 || rrs.LastStart(RoundRobinKey(PlatformClaude, 2)) != "a" {
+		t.Errorf("重载后应清理指向已删除 provider 的轮询记录: %v", keys)
+	}
+
+	second := reg.Reload([]Provider{{Name: "c", Kind: "claude"}})
+	if second.Version != 2 {
+		t.Errorf("Version = %d, want 2", second.Version)
+	}
+	if _, ok := second.Providers("codex"); ok {
+		t.Error("新快照不应包含已移除的平台")
+	}
+	if old, _ := first.Providers("claude"); old[0].Name != "a" {
+		t.Error("已取到的旧快照不应被重载修改")
+	}
+}
+
+func TestProviderRegistry_ConcurrentReload(t *testing.T) {
+	reg := NewProviderRegistry(nil)
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				// 每个快照中 claude 与 codex 的 provider 数量相同，读到混合的列表即可发现
+				n := (i+j)%3 + 1
+				var providers []Provider
+				for range n {
+					providers = append(providers, Provider{Name: "p", Kind: "claude"}, Provider{Name: "p", Kind: "codex"})
+				}
+				reg.Reload(providers)
+			}
+		}()
+	}
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				snap := reg.Current()
+				claude, _ := snap.Providers("claude")
+				codex, _ := snap.Providers("codex")
+				if len(claude) != len(codex) {
+					t.Errorf("同一快照内各平台不一致: claude=%d codex=%d", len(claude), len(codex))
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got := reg.Current().Version; got != 200 {
+		t.Errorf("Version = %d, want 200", got)
+	}
+}
+
+func TestEnableProviderRegistry(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{{ID: 1, Name: "c1", APIURL: "https://c1", APIKey: "k", Enabled: true}}); err != nil {
+		t.Fatalf("保存 claude 配置失败: %v", err)
+	}
+	if err := ps.SaveProviders("custom:mytool", []Provider{{ID: 1, Name: "t1", APIURL: "https://t1", APIKey: "k", Enabled: true}}); err != nil {
+		t.Fatalf("保存自定义工具配置失败: %v", err)
+	}
+
+	prs := NewProviderRelayService(ps, nil, nil, nil, nil, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg, err := prs.EnableProviderRegistry(ctx, func() ([]Provider, error) { return LoadRegistryProviders(ps) })
+	if err != nil {
+		t.Fatalf("EnableProviderRegistry() error = %v", err)
+	}
+	defer ps.SetOnSave(nil)
+
+	for kind, want := range map[string]string{"claude": "c1", "custom:mytool": "t1"} {
+		providers, ok := reg.Current().Providers(kind)
+		if !ok || len(providers) != 1 || providers[0].Name != want || providers[0].Kind != kind {
+			t.Errorf("Providers(%q) = %+v, %v; 应按配置文件设置 Kind", kind, providers, ok)
+		}
+	}
+	if providers, ok := reg.Current().Providers("codex"); ok && len(providers) != 0 {
+		t.Errorf("codex 没有配置, 实际 %+v", providers)
+	}
+
+	// 保存配置后注册表立即更新，转发时读取到新配置
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "c1", APIURL: "https://c1", APIKey: "k", Enabled: true},
+		{ID: 2, Name: "c2", APIURL: "https://c2", APIKey: "k", Enabled: true},
+	}); err != nil {
+		t.Fatalf("保存 claude 配置失败: %v", err)
+	}
+	if reg.Current().Version != 2 {
+		t.Errorf("Version = %d, 保存后应重新加载", reg.Current().Version)
+	}
+	providers, err := prs.loadRelayProviders("claude")
+	if err != nil || len(providers) != 2 || providers[1].Name != "c2" {
+		t.Errorf("loadRelayProviders() = %+v, %v", providers, err)
+	}
+}
+
+func TestEnableProviderRegistry_ClearsStaleState(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "c1", APIURL: "https://c1", APIKey: "k", Enabled: true},
+		{ID: 2, Name: "c2", APIURL: "https://c2", APIKey: "k", Enabled: true},
+		{ID: 3, Name: "c3", APIURL: "https://c3", APIKey: "k", Enabled: true},
+	}); err != nil {
+		t.Fatalf("保存 claude 配置失败: %v", err)
+	}
+
+	prs := NewProviderRelayService(ps, nil, nil, nil, nil, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := prs.EnableProviderRegistry(ctx, func() ([]Provider, error) { return LoadRegistryProviders(ps) }); err != nil {
+		t.Fatalf("EnableProviderRegistry() error = %v", err)
+	}
+	defer ps.SetOnSave(nil)
+
+	prs.rrLastStart["claude:1"] = "c2"
+	prs.rrLastStart["claude:2"] = "c3"
+	prs.rrLastStart["gemini:1"] = "g1" // 不在注册表中的平台保持不变
+	for _, name := range []string{"c1", "c2", "c3"} {
+		prs.modelsCache.Set("claude/"+name, []byte(`{"data":[]}`), 0)
+	}
+
+	// c1 更换密钥，c2 被删除，c3 不变
+	if err := ps.SaveProviders("claude", []Provider{
+		{ID: 1, Name: "c1", APIURL: "https://c1", APIKey: "k2", Enabled: true},
+		{ID: 3, Name: "c3", APIURL: "https://c3", APIKey: "k", Enabled: true},
+	}); err != nil {
+		t.Fatalf("保存 claude 配置失败: %v", err)
+	}
+
+	if _, ok := prs.rrLastStart["claude:1"]; ok {
+		t.Error("指向已删除 provider 的轮询记录应被清理")
+	}
+	if prs.rrLastStart["claude:2"] != "c3" || prs.rrLastStart["gemini:1"] != "g1" {
+		t.Errorf("其余轮询记录不应变化: %v", prs.rrLastStart)
+	}
+	for name, want := range map[string]bool{"c1": false, "c2": false, "c3": true} {
+		if _, ok := prs.modelsCache.Get("claude/" + name); ok != want {
+			t.Errorf("模型缓存 %s 命中 = %v, 期望 %v", name, ok, want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============================================================================
+// 请求结构校验
+// ============================================================================
+
+// ErrInvalidRequestShape 请求体结构不合法（应直接返回 400，不消耗 provider 重试）
+var ErrInvalidRequestShape = errors.New("invalid request shape")
+
+var (
+	claudeRoles = map[string]bool{"user": true, "assistant": true}
+	openAIRoles = map[string]bool{"system": true, "developer": true, "user": true, "assistant": true, "tool": true, "function": true}
+	geminiRoles = map[string]bool{"": true, "user": true, "model": true, "function": true}
+)
+
+// ValidateRequestShape 对请求体做基础结构校验（基于 gjson，不做完整反序列化）
+// 只检查会导致上游必然拒绝的结构问题：消息数组缺失/为空、角色非法、content 类型错误
+// 返回的错误包装 ErrInvalidRequestShape，并描述具体位置
+func ValidateRequestShape(bodyBytes []byte, format Format) error {
+	if format != FormatClaude && format != FormatOpenAI && format != FormatOpenAIResponses && format != FormatGemini {
+		return nil
+	}
+	if !gjson.ValidBytes(bodyBytes) {
+		return shapeError("请求体不是合法的 JSON")
+	}
+	root := gjson.ParseBytes(bodyBytes)
+	if !root.IsObject() {
+		return shapeError("请求体必须是 JSON 对象")
+	}
+
+	switch format {
+	case FormatClaude:
+		return validateMessages(root.Get("messages"), claudeRoles, false)
+	case FormatOpenAI:
+		// Responses API 使用 input（字符串或数组），Chat Completions 使用 messages
+		if input := root.Get("input"); input.Exists() {
+			if input.Type != gjson.String && !input.IsArray() {
+				return shapeError("input 必须是字符串或数组")
+			}
+			if input.IsArray() && len(input.Array()) == 0 {
+				return shapeError("input 不能为空数组")
+			}
+			return nil
+		}
+		return validateMessages(root.Get("messages"), openAIRoles, true)
+	case FormatOpenAIResponses:
+		input := root.Get("input")
+		if !input.Exists() {
+			return shapeError("缺少 input 字段")
+		}
+		if input.Type != gjson.String && !input.IsArray() {
+			return shapeError("input 必须是字符串或数组")
+		}
+		if input.IsArray() && len(input.Array()) == 0 {
+			return shapeError("input 不能为空数组")
+		}
+		return nil
+	case FormatGemini:
+		return validateGeminiContents(root.Get("contents"))
+	}
+	return nil
+}
+
+// validateMessages 校验 Claude/OpenAI 风格的 messages 数组
+// allowNullContent: OpenAI 中带 tool_calls 的 assistant 消息 content 可以为 null
+func validateMessages(messages gjson.Result, roles map[string]bool, allowNullContent bool) error {
+	if !messages.Exists() {
+		return shapeError("缺少 messages 字段")
+	}
+	if !messages.IsArray() {
+		return shapeError("messages 必须是数组")
+	}
+	msgs := messages.Array()
+	if len(msgs) == 0 {
+		return shapeError("messages 不能为空")
+	}
+
+	for i, msg := range msgs {
+		if !msg.IsObject() {
+			return shapeError(fmt.Sprintf("messages[%d] 必须是对象", i))
+		}
+		role := msg.Get("role").String()
+		if !roles[role] {
+			return shapeError(fmt.Sprintf("messages[%d].role 非法: %q", i, role))
+		}
+
+		content := msg.Get("content")
+		switch {
+		case !content.Exists(), content.Type == gjson.Null:
+			if !allowNullContent {
+				return shapeError(fmt.Sprintf("messages[%d] 缺少 content", i))
+			}
+		case content.Type == gjson.String:
+		case content.IsArray():
+			for j, block := range content.Array() {
+				if !block.IsObject() || block.Get("type").String() == "" {
+					return shapeError(fmt.Sprintf("messages[%d].content[%d] 必须是带 type 的对象", i, j))
+				}
+			}
+		default:
+			return shapeError(fmt.Sprintf("messages[%d].content 必须是字符串或数组", i))
+		}
+	}
+	return nil
+}
+
+// validateGeminiContents 校验 Gemini contents 数组
+func validateGeminiContents(contents gjson.Result) error {
+	if !contents.Exists() {
+		return shapeError("缺少 contents 字段")
+	}
+	if !contents.IsArray() {
+		return shapeError("contents 必须是数组")
+	}
+	items := contents.Array()
+	if len(items) == 0 {
+		return shapeError("contents 不能为空")
+	}
+
+	for i, item := range items {
+		if !item.IsObject() {
+			return shapeError(fmt.Sprintf("contents[%d] 必须是对象", i))
+		}
+		role := item.Get("role").String()
+		if !geminiRoles[role] {
+			return shapeError(fmt.Sprintf("contents[%d].role 非法: %q", i, role))
+		}
+		parts := item.Get("parts")
+		if !parts.IsArray() || len(parts.Array()) == 0 {
+			return shapeError(fmt.Sprintf("contents[%d].parts 必须是非空数组", i))
+		}
+	}
+	return nil
+}
+
+func shapeError(detail string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRequestShape, detail)
+}
+
+// formatForKind 返回平台对应的请求格式，未知平台返回空（不校验）
+func formatForKind(kind string) Format {
+	switch kind {
+	case "claude":
+		return FormatClaude
+	case "codex":
+		return FormatOpenAIResponses
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRequestShape(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		format  Format
+		wantErr bool
+	}{
+		{"Claude 合法", `{"model":"m","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":[{"type":"text","text":"ok"}]}]}`, FormatClaude, false},
+		{"Claude 缺少 messages", `{"model":"m"}`, FormatClaude, true},
+		{"Claude messages 为空", `{"messages":[]}`, FormatClaude, true},
+		{"Claude 非法角色", `{"messages":[{"role":"system","content":"x"}]}`, FormatClaude, true},
+		{"Claude content 块缺少 type", `{"messages":[{"role":"user","content":[{"text":"x"}]}]}`, FormatClaude, true},
+		{"Claude content 为数字", `{"messages":[{"role":"user","content":1}]}`, FormatClaude, true},
+		{"非法 JSON", `{"messages":`, FormatClaude, true},
+		{"OpenAI assistant content 为 null", `{"messages":[{"role":"user","content":"x"},{"role":"assistant","content":null,"tool_calls":[]}]}`, FormatOpenAI, false},
+		{"OpenAI Responses input 字符串", `{"model":"m","input":"hello"}`, FormatOpenAI, false},
+		{"OpenAI Responses input 空数组", `{"input":[]}`, FormatOpenAI, true},
+		{"Gemini 合法", `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`, FormatGemini, false},
+		{"Gemini parts 为空", `{"contents":[{"role":"user","parts":[]}]}`, FormatGemini, true},
+		{"未知格式不校验", `not json`, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRequestShape([]byte(tt.body), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateRequestShape() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidRequestShape) {
+				t.Errorf("错误应包装 ErrInvalidRequestShape: %v", err)
+			}
+		})
+	}
+}
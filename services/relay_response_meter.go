@@ -0,0 +1,44 @@
+package services
+
+import (
+	"io"
+	"time"
+)
+
+// ============================================================================
+// 响应首字节耗时与字节数统计
+// ============================================================================
+
+// responseMeter 统计上游响应体字节数，可选地在首个字节到达时记录首字节耗时
+type responseMeter struct {
+	io.ReadCloser
+	start     time.Time
+	log       *ReqeustLog
+	firstByte bool // 是否在首个字节到达时更新 TimeToFirstByte
+	seen      bool
+}
+
+// MeterResponseBody 包装上游响应体，读取时累计 requestLog.ResponseBytes（包装时清零）
+// firstByte 为 true 时（流式请求），首个字节到达时以 start 为起点更新 requestLog.TimeToFirstByte；
+// 非流式请求的首字节耗时在收到响应头时记录，不由此处更新
+func MeterResponseBody(body io.ReadCloser, start time.Time, requestLog *ReqeustLog, firstByte bool) io.ReadCloser {
+	if body == nil || requestLog == nil {
+		return body
+	}
+	requestLog.ResponseBytes = 0
+	return &responseMeter{ReadCloser: body, start: start, log: requestLog, firstByte: firstByte}
+}
+
+func (m *responseMeter) Read(p []byte) (int, error) {
+	n, err := m.ReadCloser.Read(p)
+	if n > 0 {
+		if !m.seen {
+			m.seen = true
+			if m.firstByte {
+				m.log.TimeToFirstByte = time.Since(m.start).Seconds()
+			}
+		}
+		m.log.ResponseBytes += int64(n)
+	}
+	return n, err
+}
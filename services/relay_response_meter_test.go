@@ -0,0 +1,66 @@
+package services
+
+import (
+	"database/sql"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMeterResponseBody(t *testing.T) {
+	t.Run("流式请求记录首字节耗时与字节数", func(t *testing.T) {
+		log := &ReqeustLog{ResponseBytes: 99}
+		start := time.Now().Add(-time.Second)
+		body := MeterResponseBody(io.NopCloser(strings.NewReader("data: a\n\ndata: b\n\n")), start, log, true)
+		if log.ResponseBytes != 0 {
+			t.Errorf("包装时应清零 ResponseBytes, 实际 %d", log.ResponseBytes)
+		}
+		if _, err := io.ReadAll(body); err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+		if log.ResponseBytes != 18 {
+			t.Errorf("ResponseBytes = %d, want 18", log.ResponseBytes)
+		}
+		if log.TimeToFirstByte < 1 {
+			t.Errorf("TimeToFirstByte = %v, 应从 start 起算", log.TimeToFirstByte)
+		}
+	})
+
+	t.Run("非流式请求不覆盖首字节耗时", func(t *testing.T) {
+		log := &ReqeustLog{TimeToFirstByte: 0.25}
+		body := MeterResponseBody(io.NopCloser(strings.NewReader(`{"ok":true}`)), time.Now().Add(-time.Minute), log, false)
+		_, _ = io.ReadAll(body)
+		if log.TimeToFirstByte != 0.25 || log.ResponseBytes != 11 {
+			t.Errorf("log = %+v", log)
+		}
+	})
+}
+
+func TestQueryRecentLogs_TimeToFirstByte(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := ensureRequestLogTableWithDB(db); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO request_log (platform, provider, http_code, ttfb_sec, response_bytes)
+		VALUES ('claude', 'p', 200, 0.75, 4096)`); err != nil {
+		t.Fatalf("插入失败: %v", err)
+	}
+
+	orig := GlobalDBQueueLogs
+	GlobalDBQueueLogs = &DBWriteQueue{db: db}
+	defer func() { GlobalDBQueueLogs = orig }()
+
+	logs, err := QueryRecentLogs(1)
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("QueryRecentLogs() = %+v, %v", logs, err)
+	}
+	if logs[0].TimeToFirstByte != 0.75 || logs[0].ResponseBytes != 4096 {
+		t.Errorf("字段映射错误: %+v", logs[0])
+	}
+}
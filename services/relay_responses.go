@@ -0,0 +1,213 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============================================================================
+// OpenAI Responses API 支持
+// ============================================================================
+
+// fixIncompleteFunctionCalls Responses 格式的 tool 调用修复
+// 为没有对应 function_call_output 的 function_call 追加错误输出，避免上游报 "No tool output found"
+func fixIncompleteFunctionCalls(bodyBytes []byte, mode ToolUseRepairMode) ([]byte, *ToolUseFixReport, error) {
+	patches, err := repairFunctionCalls(gjson.GetBytes(bodyBytes, "input"))
+	if err != nil || len(patches) == 0 {
+		return bodyBytes, nil, err
+	}
+
+	report := &ToolUseFixReport{InjectedIndex: patches[0].Index}
+	for _, patch := range patches {
+		report.DanglingIDs = append(report.DanglingIDs, patch.DanglingIDs...)
+		report.AssistantIndex = patch.SourceIndex
+		report.InjectedContent = append(report.InjectedContent, patch.Blocks...)
+	}
+
+	if mode == ToolUseRepairWarn {
+		fmt.Printf("⚠️  检测到未完成的 function_call (IDs: %v)，修复模式为仅告警，请求体保持不变\n", report.DanglingIDs)
+		return bodyBytes, nil, nil
+	}
+	fmt.Printf("⚠️  检测到未完成的 function_call (IDs: %v)，正在补充 function_call_output...\n", report.DanglingIDs)
+
+	modified, err := applyPatches(bodyBytes, patches)
+	if err != nil {
+		return bodyBytes, nil, fmt.Errorf("补充 function_call_output 失败: %w", err)
+	}
+	emitAudit(AuditEventToolUseFixed, report)
+
+	fmt.Printf("✅ 已补充 %d 个 function_call_output，输入历史已修复\n", len(patches))
+	return modified, report, nil
+}
+
+// ResponsesToClaudeMessages 将 Responses API 请求体转换为 Claude Messages 请求体
+//   - instructions 及 system/developer 消息 → system
+//   - message 条目 → 对应角色的 text 块
+//   - function_call → assistant 的 tool_use；function_call_output → user 的 tool_result
+//   - max_output_tokens → max_tokens
+//
+// 相邻的同角色条目合并为一条消息；model、stream、temperature、top_p 原样保留
+func ResponsesToClaudeMessages(bodyBytes []byte) ([]byte, error) {
+	root := gjson.ParseBytes(bodyBytes)
+	out := map[string]interface{}{}
+	for _, key := range []string{"model", "stream", "temperature", "top_p"} {
+		if v := root.Get(key); v.Exists() {
+			out[key] = v.Value()
+		}
+	}
+	if v := root.Get("max_output_tokens"); v.Exists() {
+		out["max_tokens"] = v.Int()
+	}
+
+	var systemParts []string
+	if v := root.Get("instructions"); v.String() != "" {
+		systemParts = append(systemParts, v.String())
+	}
+
+	var messages []map[string]interface{}
+	appendBlock := func(role string, block map[string]interface{}) {
+		if n := len(messages); n > 0 && messages[n-1]["role"] == role {
+			messages[n-1]["content"] = append(messages[n-1]["content"].([]map[string]interface{}), block)
+			return
+		}
+		messages = append(messages, map[string]interface{}{"role": role, "content": []map[string]interface{}{block}})
+	}
+
+	input := root.Get("input")
+	if input.Type == gjson.String {
+		appendBlock("user", map[string]interface{}{"type": "text", "text": input.String()})
+	}
+	for _, item := range input.Array() {
+		switch item.Get("type").String() {
+		case "function_call":
+			var args interface{} = map[string]interface{}{}
+			if raw := item.Get("arguments").String(); raw != "" {
+				if err := json.Unmarshal([]byte(raw), &args); err != nil {
+					return nil, fmt.Errorf("function_call %s 的 arguments 不是合法 JSON: %w", item.Get("call_id").String(), err)
+				}
+			}
+			appendBlock("assistant", map[string]interface{}{
+				"type":  "tool_use",
+				"id":    item.Get("call_id").String(),
+				"name":  item.Get("name").String(),
+				"input": args,
+			})
+		case "function_call_output":
+			appendBlock("user", map[string]interface{}{
+				"type":        "tool_result",
+				"tool_use_id": item.Get("call_id").String(),
+				"content":     item.Get("output").String(),
+			})
+		case "message", "":
+			role := item.Get("role").String()
+			text := responsesContentText(item.Get("content"))
+			switch role {
+			case "system", "developer":
+				if text != "" {
+					systemParts = append(systemParts, text)
+				}
+			case "user", "assistant":
+				appendBlock(role, map[string]interface{}{"type": "text", "text": text})
+			}
+		}
+	}
+
+	if len(systemParts) > 0 {
+		out["system"] = strings.Join(systemParts, "\n\n")
+	}
+	out["messages"] = messages
+	return json.Marshal(out)
+}
+
+// ClaudeMessagesToResponses 将 Claude Messages 请求体转换为 Responses API 请求体（ResponsesToClaudeMessages 的逆操作）
+func ClaudeMessagesToResponses(bodyBytes []byte) ([]byte, error) {
+	root := gjson.ParseBytes(bodyBytes)
+	out := map[string]interface{}{}
+	for _, key := range []string{"model", "stream", "temperature", "top_p"} {
+		if v := root.Get(key); v.Exists() {
+			out[key] = v.Value()
+		}
+	}
+	if v := root.Get("max_tokens"); v.Exists() {
+		out["max_output_tokens"] = v.Int()
+	}
+	if system := claudeSystemText(root.Get("system")); system != "" {
+		out["instructions"] = system
+	}
+
+	input := []map[string]interface{}{}
+	for _, msg := range root.Get("messages").Array() {
+		role := msg.Get("role").String()
+		textType := "input_text"
+		if role == "assistant" {
+			textType = "output_text"
+		}
+
+		content := msg.Get("content")
+		if content.Type == gjson.String {
+			input = append(input, responsesMessage(role, textType, content.String()))
+			continue
+		}
+		for _, block := range content.Array() {
+			switch block.Get("type").String() {
+			case "text":
+				input = append(input, responsesMessage(role, textType, block.Get("text").String()))
+			case "tool_use":
+				input = append(input, map[string]interface{}{
+					"type":      "function_call",
+					"call_id":   block.Get("id").String(),
+					"name":      block.Get("name").String(),
+					"arguments": block.Get("input").Raw,
+				})
+			case "tool_result":
+				input = append(input, map[string]interface{}{
+					"type":    "function_call_output",
+					"call_id": block.Get("tool_use_id").String(),
+					"output":  claudeSystemText(block.Get("content")),
+				})
+			}
+		}
+	}
+	out["input"] = input
+	return json.Marshal(out)
+}
+
+// responsesMessage 构建 Responses API 的 message 条目
+func responsesMessage(role, textType, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":    "message",
+		"role":    role,
+		"content": []map[string]interface{}{{"type": textType, "text": text}},
+	}
+}
+
+// responsesContentText 提取 Responses message content（字符串或 input_text/output_text 数组）中的文本
+func responsesContentText(content gjson.Result) string {
+	if content.Type == gjson.String {
+		return content.String()
+	}
+	var parts []string
+	for _, part := range content.Array() {
+		if text := part.Get("text"); text.Exists() {
+			parts = append(parts, text.String())
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// claudeSystemText 提取 Claude system / tool_result content（字符串或 text 块数组）中的文本
+func claudeSystemText(v gjson.Result) string {
+	if v.Type == gjson.String {
+		return v.String()
+	}
+	var parts []string
+	for _, block := range v.Array() {
+		if block.Get("type").String() == "text" {
+			parts = append(parts, block.Get("text").String())
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
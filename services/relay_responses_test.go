@@ -0,0 +1,94 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		path string
+		want Format
+	}{
+		{"Claude 路径", `{}`, "/v1/messages", FormatClaude},
+		{"Responses 路径", `{}`, "/responses", FormatOpenAIResponses},
+		{"Chat 路径", `{}`, "/v1/chat/completions", FormatOpenAI},
+		{"Gemini 路径", `{}`, "/v1beta/models/gemini-pro:generateContent", FormatGemini},
+		{"Responses 请求体", `{"model":"m","input":"hi"}`, "/custom", FormatOpenAIResponses},
+		{"OpenAI 请求体", `{"messages":[{"role":"system","content":"s"},{"role":"user","content":"hi"}]}`, "", FormatOpenAI},
+		{"Claude 请求体", `{"system":"s","messages":[{"role":"user","content":"hi"}]}`, "", FormatClaude},
+		{"无法识别", `{"foo":1}`, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat([]byte(tt.body), tt.path); got != tt.want {
+				t.Errorf("DetectFormat() = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixIncompleteToolUse_Responses(t *testing.T) {
+	body := `{"model":"m","input":[
+		{"type":"message","role":"user","content":"run"},
+		{"type":"function_call","call_id":"c1","name":"ls","arguments":"{}"},
+		{"type":"function_call_output","call_id":"c1","output":"ok"},
+		{"type":"function_call","call_id":"c2","name":"cat","arguments":"{}"}
+	]}`
+	fixed, report, err := FixIncompleteToolUseWithReport([]byte(body))
+	if err != nil {
+		t.Fatalf("FixIncompleteToolUseWithReport() error = %v", err)
+	}
+	if report == nil || len(report.DanglingIDs) != 1 || report.DanglingIDs[0] != "c2" {
+		t.Fatalf("report = %+v", report)
+	}
+	last := gjson.GetBytes(fixed, "input.4")
+	if last.Get("type").String() != "function_call_output" || last.Get("call_id").String() != "c2" {
+		t.Errorf("补充的条目 = %s", last.Raw)
+	}
+
+	if _, fixed, _ := FixIncompleteToolUse(fixed); fixed {
+		t.Error("修复后不应再次修复")
+	}
+}
+
+func TestResponsesClaudeConversion(t *testing.T) {
+	responses := `{"model":"m","stream":true,"instructions":"be brief","max_output_tokens":100,"input":[
+		{"type":"message","role":"user","content":[{"type":"input_text","text":"hi"}]},
+		{"type":"function_call","call_id":"c1","name":"ls","arguments":"{\"path\":\"/\"}"},
+		{"type":"function_call_output","call_id":"c1","output":"a b"}
+	]}`
+
+	claude, err := ResponsesToClaudeMessages([]byte(responses))
+	if err != nil {
+		t.Fatalf("ResponsesToClaudeMessages() error = %v", err)
+	}
+	if gjson.GetBytes(claude, "system").String() != "be brief" || gjson.GetBytes(claude, "max_tokens").Int() != 100 {
+		t.Errorf("system/max_tokens 转换错误: %s", claude)
+	}
+	msgs := gjson.GetBytes(claude, "messages").Array()
+	if len(msgs) != 3 {
+		t.Fatalf("messages = %s", gjson.GetBytes(claude, "messages").Raw)
+	}
+	if tu := msgs[1].Get("content.0"); tu.Get("type").String() != "tool_use" || tu.Get("input.path").String() != "/" {
+		t.Errorf("tool_use 转换错误: %s", tu.Raw)
+	}
+	if tr := msgs[2].Get("content.0"); tr.Get("type").String() != "tool_result" || tr.Get("tool_use_id").String() != "c1" {
+		t.Errorf("tool_result 转换错误: %s", tr.Raw)
+	}
+
+	back, err := ClaudeMessagesToResponses(claude)
+	if err != nil {
+		t.Fatalf("ClaudeMessagesToResponses() error = %v", err)
+	}
+	if gjson.GetBytes(back, "instructions").String() != "be brief" || !gjson.GetBytes(back, "stream").Bool() {
+		t.Errorf("往返转换丢失字段: %s", back)
+	}
+	items := gjson.GetBytes(back, "input").Array()
+	if len(items) != 3 || items[1].Get("type").String() != "function_call" || items[2].Get("output").String() != "a b" {
+		t.Errorf("input = %s", gjson.GetBytes(back, "input").Raw)
+	}
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// 实际转发循环的重试上限
+// ============================================================================
+
+// relayMaxTotalAttempts 单次客户端请求在所有 provider 上合计的最大尝试次数，0 表示不限制
+var relayMaxTotalAttempts atomic.Int64
+
+// SetMaxTotalAttempts 设置单次客户端请求合计的最大尝试次数（含同 provider 重试），<= 0 表示不限制
+func SetMaxTotalAttempts(n int) {
+	relayMaxTotalAttempts.Store(int64(max(n, 0)))
+}
+
+// relayRetryBudget 单次客户端请求整个重试序列的时间预算（纳秒），0 表示不限制
+var relayRetryBudget atomic.Int64
+
+// SetRetryBudget 设置单次客户端请求整个重试序列的时间预算，<= 0 表示不限制
+// 预算耗尽后不再尝试后续 provider，也不再等待重试间隔
+func SetRetryBudget(d time.Duration) {
+	relayRetryBudget.Store(int64(max(d, 0)))
+}
+
+// newRelayRetryContext 为一次客户端请求创建重试上下文，应用 SetMaxTotalAttempts / SetRetryBudget 配置的上限
+// 实际转发循环只用它计数与判断是否继续，请求指标由 forwardRequest / forwardGeminiRequest 上报
+func newRelayRetryContext(platform string, maxRetryPerProvider, retryWaitSeconds int) *RetryContext {
+	rc := NewRetryContext(maxRetryPerProvider, retryWaitSeconds)
+	rc.Platform = platform
+	rc.MaxTotalAttempts = int(relayMaxTotalAttempts.Load())
+	rc.SetBudget(time.Duration(relayRetryBudget.Load()))
+	return rc
+}
+
+// admit 在发起下一次尝试前检查尝试次数上限与时间预算，超出时返回停止原因
+// 与 ShouldContinue 不同，不检查客户端断开与致命错误（转发循环已分别处理）
+func (rc *RetryContext) admit() error {
+	if !rc.CanAttempt() {
+		return ErrMaxTotalAttempts
+	}
+	if rc.Expired() {
+		return ErrRetryDeadlineExceeded
+	}
+	return nil
+}
+
+// countLevelProviders 返回各 Level 分组中 provider 的总数
+func countLevelProviders[T any](groups map[int][]T) int {
+	total := 0
+	for _, providers := range groups {
+		total += len(providers)
+	}
+	return total
+}
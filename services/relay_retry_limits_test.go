@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewRelayRetryContext(t *testing.T) {
+	defer SetMaxTotalAttempts(0)
+
+	SetMaxTotalAttempts(2)
+	rc := newRelayRetryContext("claude", 3, 0)
+	if rc.Platform != "claude" || rc.MaxRetryPerProvider != 3 || rc.MaxTotalAttempts != 2 {
+		t.Fatalf("rc = %+v", rc)
+	}
+	for i := 0; i < 2; i++ {
+		if err := rc.admit(); err != nil {
+			t.Fatalf("第 %d 次尝试 admit() = %v", i+1, err)
+		}
+		rc.TotalAttempts++
+	}
+	if err := rc.admit(); !errors.Is(err, ErrMaxTotalAttempts) {
+		t.Errorf("达到上限后 admit() = %v, 期望 ErrMaxTotalAttempts", err)
+	}
+
+	SetMaxTotalAttempts(0)
+	clock := NewManualClock(time.Now())
+	defer SetClock(clock)()
+	SetRetryBudget(time.Minute)
+	defer SetRetryBudget(0)
+	rc = newRelayRetryContext("claude", 1, 0)
+	if err := rc.admit(); err != nil {
+		t.Fatalf("预算内 admit() = %v", err)
+	}
+	clock.Advance(time.Minute)
+	if err := rc.admit(); !errors.Is(err, ErrRetryDeadlineExceeded) {
+		t.Errorf("预算耗尽后 admit() = %v, 期望 ErrRetryDeadlineExceeded", err)
+	}
+	SetRetryBudget(0)
+
+	SetMaxTotalAttempts(-1)
+	if rc := newRelayRetryContext("claude", 1, 0); rc.MaxTotalAttempts != 0 || rc.admit() != nil {
+		t.Errorf("负数应视为不限制: %+v", rc)
+	}
+}
+
+// newRetryLimitRelay 准备一个所有 provider 都返回 503 的转发服务，返回服务与上游收到的请求数
+// 未初始化数据库时拉黑服务按默认配置工作（固定模式、不拉黑）
+func newRetryLimitRelay(t *testing.T, providerCount int) (*ProviderRelayService, *atomic.Int32) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(upstream.Close)
+
+	providers := make([]Provider, providerCount)
+	for i := range providers {
+		providers[i] = Provider{ID: int64(i + 1), Name: fmt.Sprintf("p%d", i+1), APIURL: upstream.URL, APIKey: "k", Enabled: true}
+	}
+	ps := NewProviderService()
+	if err := ps.SaveProviders("claude", providers); err != nil {
+		t.Fatalf("保存配置失败: %v", err)
+	}
+	return NewProviderRelayService(ps, nil, NewBlacklistService(&SettingsService{}, nil), nil, nil, ""), &hits
+}
+
+func TestProxyHandler_MaxTotalAttempts(t *testing.T) {
+	defer SetMaxTotalAttempts(0)
+	SetMaxTotalAttempts(1)
+
+	prs, hits := newRetryLimitRelay(t, 3)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"claude-sonnet-4","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+	prs.proxyHandler("claude", "/v1/messages")(c)
+
+	if got := hits.Load(); got != 1 {
+		t.Errorf("上游收到 %d 次请求, 期望达到上限后停止（1 次）", got)
+	}
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, 期望 502", w.Code)
+	}
+}
+
+func TestProxyHandler_RetryBudget(t *testing.T) {
+	defer SetRetryBudget(0)
+	// 默认重试间隔为 3 秒，超出 1 秒的预算：第一次失败后不再等待，也不再尝试后续 provider
+	SetRetryBudget(time.Second)
+
+	prs, hits := newRetryLimitRelay(t, 2)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"claude-sonnet-4","max_tokens":16,"messages":[{"role":"user","content":"hi"}]}`))
+
+	start := time.Now()
+	prs.proxyHandler("claude", "/v1/messages")(c)
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("耗时 %v, 应在预算内返回", elapsed)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("上游收到 %d 次请求, 期望 1 次", got)
+	}
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, 期望 502", w.Code)
+	}
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	p := Provider{Name: "p", TimeoutSec: 60}
+	if got := attemptTimeout(context.Background(), p); got != time.Minute {
+		t.Errorf("未分配预算时 = %v, 期望 provider 自身超时", got)
+	}
+	ctx := WithSelection(context.Background(), Selection{AttemptTimeout: time.Second})
+	if got := attemptTimeout(ctx, p); got != time.Second {
+		t.Errorf("预算更短时 = %v, 期望 1s", got)
+	}
+	ctx = WithSelection(context.Background(), Selection{AttemptTimeout: time.Hour})
+	if got := attemptTimeout(ctx, p); got != time.Minute {
+		t.Errorf("预算更长时 = %v, 期望 provider 自身超时", got)
+	}
+}
+
+func TestForwardRequest_AttemptTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	prs := NewProviderRelayService(nil, nil, nil, nil, nil, "")
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	markSelection(c, Selection{Platform: "claude", Provider: "slow", Attempt: 1, AttemptTimeout: 200 * time.Millisecond})
+	body := []byte(`{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`)
+
+	start := time.Now()
+	ok, _ := prs.forwardRequest(c, "claude", Provider{Name: "slow", APIURL: upstream.URL, APIKey: "k"},
+		"/v1/messages", nil, map[string]string{}, body, false, "claude-sonnet-4")
+	if ok {
+		t.Fatal("上游无响应时应失败")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("耗时 %v, 应受分配的单次尝试超时限制", elapsed)
+	}
+}
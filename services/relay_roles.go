@@ -0,0 +1,113 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ============================================================================
+// 相邻同角色消息合并
+// ============================================================================
+
+// CoalesceConsecutiveRoles 合并 messages 中相邻的同角色消息，使 user/assistant 严格交替
+// 合并多个会话历史后常出现连续两条 user 消息，Claude 等上游会直接拒绝
+//   - 两条都是字符串 content 时以空行拼接
+//   - 否则统一转为内容块数组后按原顺序拼接（字符串转为 text 块），块类型保持不变
+//   - 含 role/content 之外字段的消息（如 OpenAI 的 tool_calls、tool_call_id）不参与合并，避免丢失信息
+//
+// 与 FixIncompleteToolUse 配合使用（先补 tool_result，再合并），可得到完整合法的消息序列
+// 返回：处理后的请求体、是否有修改、错误
+func CoalesceConsecutiveRoles(bodyBytes []byte) ([]byte, bool, error) {
+	messages := gjson.GetBytes(bodyBytes, "messages")
+	if !messages.IsArray() {
+		return bodyBytes, false, nil
+	}
+
+	items := messages.Array()
+	out := make([]json.RawMessage, 0, len(items))
+	var prev gjson.Result
+	merged := 0
+	for _, msg := range items {
+		if len(out) > 0 && coalescible(prev) && coalescible(msg) &&
+			prev.Get("role").String() == msg.Get("role").String() {
+			combined, err := mergeMessages(prev, msg)
+			if err != nil {
+				return bodyBytes, false, err
+			}
+			out[len(out)-1] = combined
+			prev = gjson.ParseBytes(combined)
+			merged++
+			continue
+		}
+		out = append(out, json.RawMessage(msg.Raw))
+		prev = msg
+	}
+	if merged == 0 {
+		return bodyBytes, false, nil
+	}
+
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return bodyBytes, false, fmt.Errorf("序列化 messages 失败: %w", err)
+	}
+	modified, err := sjson.SetRawBytes(bodyBytes, "messages", raw)
+	if err != nil {
+		return bodyBytes, false, fmt.Errorf("写回 messages 失败: %w", err)
+	}
+
+	fmt.Printf("✅ 已合并 %d 条相邻同角色消息（%d → %d）\n", merged, len(items), len(out))
+	return modified, true, nil
+}
+
+// coalescible 消息是否可以参与合并：仅包含 role 和 content 字段
+func coalescible(msg gjson.Result) bool {
+	if !msg.IsObject() || msg.Get("role").String() == "" {
+		return false
+	}
+	ok := true
+	msg.ForEach(func(key, _ gjson.Result) bool {
+		if k := key.String(); k != "role" && k != "content" {
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
+
+// mergeMessages 合并两条同角色消息的 content
+func mergeMessages(a, b gjson.Result) (json.RawMessage, error) {
+	ca, cb := a.Get("content"), b.Get("content")
+
+	var content interface{}
+	if ca.Type == gjson.String && cb.Type == gjson.String {
+		content = ca.String() + "\n\n" + cb.String()
+	} else {
+		blocks := append(contentBlocks(ca), contentBlocks(cb)...)
+		content = blocks
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"role":    a.Get("role").String(),
+		"content": content,
+	})
+}
+
+// contentBlocks 将 content 统一转为内容块数组（原始 JSON 保持不变）
+func contentBlocks(content gjson.Result) []json.RawMessage {
+	switch {
+	case content.IsArray():
+		var blocks []json.RawMessage
+		for _, block := range content.Array() {
+			blocks = append(blocks, json.RawMessage(block.Raw))
+		}
+		return blocks
+	case content.Type == gjson.String:
+		raw, _ := json.Marshal(map[string]string{"type": "text", "text": content.String()})
+		return []json.RawMessage{raw}
+	default:
+		return nil
+	}
+}
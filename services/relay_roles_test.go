@@ -0,0 +1,85 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestCoalesceConsecutiveRoles(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantModified bool
+		wantRoles    []string
+		check        func(t *testing.T, messages gjson.Result)
+	}{
+		{
+			name:         "已交替无需修改",
+			body:         `{"messages":[{"role":"user","content":"a"},{"role":"assistant","content":"b"}]}`,
+			wantModified: false,
+			wantRoles:    []string{"user", "assistant"},
+		},
+		{
+			name:         "字符串内容以空行拼接",
+			body:         `{"messages":[{"role":"user","content":"a"},{"role":"user","content":"b"},{"role":"user","content":"c"}]}`,
+			wantModified: true,
+			wantRoles:    []string{"user"},
+			check: func(t *testing.T, messages gjson.Result) {
+				if got := messages.Get("0.content").String(); got != "a\n\nb\n\nc" {
+					t.Errorf("content = %q", got)
+				}
+			},
+		},
+		{
+			name: "块数组保持顺序和类型",
+			body: `{"messages":[
+				{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"ls","input":{}}]},
+				{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"ok"}]},
+				{"role":"user","content":"继续"}]}`,
+			wantModified: true,
+			wantRoles:    []string{"assistant", "user"},
+			check: func(t *testing.T, messages gjson.Result) {
+				blocks := messages.Get("1.content").Array()
+				if len(blocks) != 2 || blocks[0].Get("type").String() != "tool_result" ||
+					blocks[1].Get("type").String() != "text" || blocks[1].Get("text").String() != "继续" {
+					t.Errorf("content = %s", messages.Get("1.content").Raw)
+				}
+			},
+		},
+		{
+			name:         "带额外字段的消息不合并",
+			body:         `{"messages":[{"role":"tool","tool_call_id":"1","content":"a"},{"role":"tool","tool_call_id":"2","content":"b"}]}`,
+			wantModified: false,
+			wantRoles:    []string{"tool", "tool"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, modified, err := CoalesceConsecutiveRoles([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("CoalesceConsecutiveRoles() error = %v", err)
+			}
+			if modified != tt.wantModified {
+				t.Errorf("modified = %v, 期望 %v", modified, tt.wantModified)
+			}
+			messages := gjson.GetBytes(out, "messages")
+			var roles []string
+			for _, m := range messages.Array() {
+				roles = append(roles, m.Get("role").String())
+			}
+			if len(roles) != len(tt.wantRoles) {
+				t.Fatalf("roles = %v, 期望 %v", roles, tt.wantRoles)
+			}
+			for i := range roles {
+				if roles[i] != tt.wantRoles[i] {
+					t.Errorf("roles = %v, 期望 %v", roles, tt.wantRoles)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, messages)
+			}
+		})
+	}
+}
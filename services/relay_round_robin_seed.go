@@ -0,0 +1,32 @@
+package services
+
+import "fmt"
+
+// ============================================================================
+// 轮询状态的复现（事后排查负载均衡问题）
+// ============================================================================
+
+// RoundRobinKey 返回轮询状态的 key（"platform:level"），与 Reorder 内部使用的 key 一致
+func RoundRobinKey(platform Platform, level int) string {
+	return fmt.Sprintf("%s:%d", platform, level)
+}
+
+// SeedKey 将 key 的上次起始 provider 设置为 lastStart，用于测试或回放时复现线上请求看到的顺序
+// lastStart 取自请求日志或 Selection.LastStart；为空时清除该 key 的记录（下次 Reorder 保持原顺序）
+// 之后对同一 key 调用 Reorder，与线上在相同 provider 列表下得到的顺序一致
+func (rrs *RoundRobinState) SeedKey(key, lastStart string) {
+	rrs.mu.Lock()
+	defer rrs.mu.Unlock()
+
+	if lastStart == "" {
+		delete(rrs.lastStart, key)
+		return
+	}
+	rrs.lastStart[key] = lastStart
+}
+
+// LastStart 返回 key 当前的上次起始 provider 名称（无记录时为空），不修改状态
+// 在 Reorder 之前读取并记录，即可事后通过 SeedKey 复现本次排序
+func (rrs *RoundRobinState) LastStart(key string) string {
+	return rrs.peek(key)
+}
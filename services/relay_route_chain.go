@@ -0,0 +1,217 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ============================================================================
+// 跨平台降级链
+// ============================================================================
+
+// ErrRouteChainExhausted 所有分组的所有 provider 均失败
+var ErrRouteChainExhausted = errors.New("route chain exhausted")
+
+// FormatConverter 格式转换器（可插拔）
+// ConvertRequest 将客户端格式的请求体转换为目标格式，ConvertResponse 将目标格式的响应体转换回客户端格式
+// 注意：转换基于完整报文，跨格式降级时流式响应需由调用方自行处理
+type FormatConverter interface {
+	ConvertRequest(body []byte) ([]byte, error)
+	ConvertResponse(body []byte) ([]byte, error)
+}
+
+// RouteGroup 降级链中的一个分组（通常对应一个平台）
+type RouteGroup struct {
+	Kind     string                                  // 平台标识
+	Format   Format                                  // 该分组 provider 接受的报文格式
+	Priority int                                     // 优先级，数字越小越先尝试
+	Select   func(rc *RequestContext) []ProviderLike // 返回排好序的候选 providers
+}
+
+// RouteAttempt 一次具体的尝试
+type RouteAttempt struct {
+	Kind     string
+	Format   Format
+	Provider ProviderLike
+	Body     []byte // 已转换为目标格式的请求体
+}
+
+// RouteChain 按优先级串联多个平台分组，一个分组全部失败后切换到下一个分组
+type RouteChain struct {
+	groups     []RouteGroup
+	converters map[[2]Format]FormatConverter
+}
+
+// NewRouteChain 创建降级链，分组按 Priority 升序排列（相同优先级保持传入顺序）
+func NewRouteChain(groups ...RouteGroup) *RouteChain {
+	sorted := append([]RouteGroup(nil), groups...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+	return &RouteChain{
+		groups:     sorted,
+		converters: make(map[[2]Format]FormatConverter),
+	}
+}
+
+// RegisterConverter 注册 from → to 的格式转换器
+func (c *RouteChain) RegisterConverter(from, to Format, conv FormatConverter) {
+	c.converters[[2]Format{from, to}] = conv
+}
+
+// Execute 依次尝试各分组的 provider，直到 do 成功
+// 参数:
+//   - rc: 请求上下文（BodyBytes 为客户端格式）
+//   - clientFormat: 客户端请求的格式
+//   - do: 执行一次尝试，返回目标格式的响应体
+//
+// 返回：转换回客户端格式的响应体、成功的尝试；全部失败时返回包装了最后错误的 ErrRouteChainExhausted
+// do 返回致命错误（见 IsFatal）时不再尝试后续 provider，直接返回该错误与对应的尝试
+func (c *RouteChain) Execute(
+	rc *RequestContext,
+	clientFormat Format,
+	do func(attempt RouteAttempt) ([]byte, error),
+) ([]byte, RouteAttempt, error) {
+	var lastErr error
+
+	for _, group := range c.groups {
+		candidates := group.Select(rc)
+		if len(candidates) == 0 {
+			continue
+		}
+
+		body := rc.BodyBytes
+		var conv FormatConverter
+		if group.Format != clientFormat {
+			conv = c.converters[[2]Format{clientFormat, group.Format}]
+			if conv == nil {
+				fmt.Printf("[WARN] 未注册 %s → %s 的格式转换器，跳过分组 %s\n", clientFormat, group.Format, group.Kind)
+				continue
+			}
+			converted, err := conv.ConvertRequest(body)
+			if err != nil {
+				fmt.Printf("[WARN] 请求转换失败 (%s → %s)，跳过分组 %s: %v\n", clientFormat, group.Format, group.Kind, err)
+				lastErr = err
+				continue
+			}
+			body = converted
+		}
+
+		for _, provider := range candidates {
+			attempt := RouteAttempt{
+				Kind:     group.Kind,
+				Format:   group.Format,
+				Provider: provider,
+				Body:     body,
+			}
+
+			resp, err := do(attempt)
+			if IsFatal(err, 0) {
+				return nil, attempt, err
+			}
+			if err != nil {
+				lastErr = err
+				continue
+			}
+
+			if conv != nil {
+				converted, err := conv.ConvertResponse(resp)
+				if err != nil {
+					lastErr = fmt.Errorf("响应转换失败 (%s → %s): %w", group.Format, clientFormat, err)
+					continue
+				}
+				resp = converted
+			}
+			return resp, attempt, nil
+		}
+
+		fmt.Printf("[WARN] 分组 %s 的所有 provider 均失败，尝试下一分组\n", group.Kind)
+	}
+
+	if lastErr != nil {
+		return nil, RouteAttempt{}, fmt.Errorf("%w: %v", ErrRouteChainExhausted, lastErr)
+	}
+	return nil, RouteAttempt{}, ErrRouteChainExhausted
+}
+
+// ProviderRouteGroup 基于 Provider 列表构建分组：FilterProviders → ApplyTags（请求头标签）→ ApplyLevelRange（请求头 Level 范围）→ GroupByLevel → Reorder
+func ProviderRouteGroup(
+	kind string,
+	format Format,
+	priority int,
+	rrs *RoundRobinState,
+	providers []Provider,
+	blacklistChecker func(kind, name string) (bool, time.Time),
+	modelChecker func(p *Provider, model string) bool,
+	configValidator func(p *Provider) []string,
+) RouteGroup {
+	return ProviderRouteGroupWithSelector(kind, format, priority, NewRoundRobinSelector(rrs, Platform(kind)),
+		providers, blacklistChecker, modelChecker, configValidator)
+}
+
+// ProviderRouteGroupWithSelector 与 ProviderRouteGroup 相同，但使用自定义 Selector 决定尝试顺序
+func ProviderRouteGroupWithSelector(
+	kind string,
+	format Format,
+	priority int,
+	selector Selector,
+	providers []Provider,
+	blacklistChecker func(kind, name string) (bool, time.Time),
+	modelChecker func(p *Provider, model string) bool,
+	configValidator func(p *Provider) []string,
+) RouteGroup {
+	return RouteGroup{
+		Kind:     kind,
+		Format:   format,
+		Priority: priority,
+		Select: func(rc *RequestContext) []ProviderLike {
+			filtered := FilterProviders(providers, Platform(kind), rc.RequestedModel, blacklistChecker, modelChecker, configValidator)
+			filtered.ApplyTags(TagsFromRequest(rc))
+			filtered.ApplyLevelRange(LevelRangeFromRequest(rc))
+			filtered.ApplyContextLimit(EstimateInputTokens(rc.BodyBytes, format))
+			candidates := append(toProviderLikes(filtered.Active), toProviderLikes(filtered.LastResort)...)
+			return selector.Select(candidates, rc)
+		},
+	}
+}
+
+// GeminiRouteGroup 基于 GeminiProvider 列表构建分组：FilterGeminiProviders → ApplyTags（请求头标签）→ ApplyLevelRange（请求头 Level 范围）→ GroupByLevel → Reorder
+func GeminiRouteGroup(
+	priority int,
+	rrs *RoundRobinState,
+	providers []GeminiProvider,
+	blacklistChecker func(kind, name string) (bool, time.Time),
+) RouteGroup {
+	return GeminiRouteGroupWithSelector(priority, NewRoundRobinSelector(rrs, PlatformGemini), providers, blacklistChecker)
+}
+
+// GeminiRouteGroupWithSelector 与 GeminiRouteGroup 相同，但使用自定义 Selector 决定尝试顺序
+func GeminiRouteGroupWithSelector(
+	priority int,
+	selector Selector,
+	providers []GeminiProvider,
+	blacklistChecker func(kind, name string) (bool, time.Time),
+) RouteGroup {
+	return RouteGroup{
+		Kind:     "gemini",
+		Format:   FormatGemini,
+		Priority: priority,
+		Select: func(rc *RequestContext) []ProviderLike {
+			filtered := FilterGeminiProviders(providers, blacklistChecker)
+			filtered.ApplyTags(TagsFromRequest(rc))
+			filtered.ApplyLevelRange(LevelRangeFromRequest(rc))
+			return selector.Select(toProviderLikes(filtered.Active), rc)
+		},
+	}
+}
+
+// toProviderLikes 将具体类型切片转换为接口切片
+func toProviderLikes[T ProviderLike](providers []T) []ProviderLike {
+	result := make([]ProviderLike, len(providers))
+	for i, p := range providers {
+		result[i] = p
+	}
+	return result
+}
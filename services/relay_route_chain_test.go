@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// upperConverter 测试用转换器：请求加前缀，响应去前缀
+type upperConverter struct{}
+
+func (upperConverter) ConvertRequest(body []byte) ([]byte, error) {
+	return append([]byte("gemini:"), body...), nil
+}
+
+func (upperConverter) ConvertResponse(body []byte) ([]byte, error) {
+	return []byte(strings.TrimPrefix(string(body), "gemini:")), nil
+}
+
+func TestRouteChain_FallbackAcrossKinds(t *testing.T) {
+	claude := []Provider{
+		{Name: "c1", APIURL: "https://c1", APIKey: "k", Enabled: true},
+		{Name: "c2", APIURL: "https://c2", APIKey: "k", Enabled: true, Level: 2},
+	}
+	gemini := []GeminiProvider{
+		{Name: "g1", BaseURL: "https://g1", APIKey: "k", Enabled: true},
+	}
+
+	chain := NewRouteChain(
+		GeminiRouteGroup(2, nil, gemini, nil),
+		ProviderRouteGroup("claude", FormatClaude, 1, nil, claude, nil, nil, nil),
+	)
+	chain.RegisterConverter(FormatClaude, FormatGemini, upperConverter{})
+
+	var attempted []string
+	rc := &RequestContext{BodyBytes: []byte("hello")}
+	resp, attempt, err := chain.Execute(rc, FormatClaude, func(a RouteAttempt) ([]byte, error) {
+		attempted = append(attempted, a.Provider.GetName())
+		if a.Kind == "claude" {
+			return nil, errors.New("upstream status 503")
+		}
+		if string(a.Body) != "gemini:hello" {
+			t.Errorf("Gemini 请求体未转换: %s", a.Body)
+		}
+		return []byte("gemini:ok"), nil
+	})
+
+	if err != nil {
+		t.Fatalf("期望成功，实际错误: %v", err)
+	}
+	if got := strings.Join(attempted, ","); got != "c1,c2,g1" {
+		t.Errorf("尝试顺序 = %s, 期望 c1,c2,g1", got)
+	}
+	if attempt.Kind != "gemini" || string(resp) != "ok" {
+		t.Errorf("结果 = %s/%s, 期望 gemini/ok", attempt.Kind, resp)
+	}
+
+	// 全部失败
+	_, _, err = chain.Execute(rc, FormatClaude, func(a RouteAttempt) ([]byte, error) {
+		return nil, errors.New("down")
+	})
+	if !errors.Is(err, ErrRouteChainExhausted) {
+		t.Errorf("期望 ErrRouteChainExhausted，实际 %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"iter"
+	"sort"
+)
+
+// ============================================================================
+// 惰性 provider 选择
+// ============================================================================
+
+// SelectProvidersSeq SelectProviders 的惰性版本：按 Level 从小到大、组内轮询的顺序逐个产出 provider
+// 只有遍历到某个 Level 时才构建该 Level 的列表并轮询排序，首个 provider 成功（最常见情况）时
+// 不会为后续 Level 分配切片；兜底 provider 在所有 Level 之后按原顺序产出
+//
+// 产出顺序与相同状态下的 SelectProviders 完全一致；区别是只有实际遍历到的 Level 会推进轮询状态
+// 需要拉取式用法时可配合 iter.Pull：
+//
+//	next, stop := iter.Pull(SelectProvidersSeq(rrs, "claude", providers))
+//	defer stop()
+//	for p, ok := next(); ok; p, ok = next() { ... }
+func SelectProvidersSeq[T ProviderLike](rrs *RoundRobinState, platform Platform, providers []T, lastResort ...T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		levelSet := make(map[int]bool)
+		for _, p := range providers {
+			if !isLastResort(p) {
+				levelSet[p.GetLevel()] = true
+			}
+		}
+		levels := make([]int, 0, len(levelSet))
+		for level := range levelSet {
+			levels = append(levels, level)
+		}
+		sort.Ints(levels)
+
+		for _, level := range levels {
+			var inLevel []T
+			for _, p := range providers {
+				if !isLastResort(p) && p.GetLevel() == level {
+					inLevel = append(inLevel, p)
+				}
+			}
+			if rrs != nil {
+				inLevel = Reorder(rrs, platform, level, inLevel, T.GetName)
+			}
+			for _, p := range inLevel {
+				if !yield(p) {
+					return
+				}
+			}
+		}
+
+		// 混入 providers 中的兜底 provider 在前，显式传入的在后（与 SelectProviders 一致）
+		for _, p := range providers {
+			if isLastResort(p) && !yield(p) {
+				return
+			}
+		}
+		for _, p := range lastResort {
+			if !yield(p) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"iter"
+	"slices"
+	"testing"
+)
+
+func TestSelectProvidersSeq(t *testing.T) {
+	providers := []MockProvider{
+		{Name: "b1", Level: 2},
+		{Name: "a1", Level: 1},
+		{Name: "z1", Level: 1, LastResort: true},
+		{Name: "a2", Level: 1},
+		{Name: "b2", Level: 2},
+	}
+	extra := MockProvider{Name: "z2", LastResort: true}
+
+	t.Run("顺序与 SelectProviders 一致", func(t *testing.T) {
+		eager, lazy := NewRoundRobinState(), NewRoundRobinState()
+		for i := 0; i < 3; i++ {
+			want := SelectProviders(eager, "claude", providers, extra)
+			got := slices.Collect(SelectProvidersSeq(lazy, "claude", providers, extra))
+			if !slices.Equal(got, want) {
+				t.Fatalf("第 %d 次: Seq = %v, SelectProviders = %v", i, got, want)
+			}
+		}
+	})
+
+	t.Run("提前结束不推进后续 Level", func(t *testing.T) {
+		rrs := NewRoundRobinState()
+		next, stop := iter.Pull(SelectProvidersSeq(rrs, "claude", providers))
+		defer stop()
+		if p, ok := next(); !ok || p.Name != "a1" {
+			t.Fatalf("next() = %v, %v", p, ok)
+		}
+		stop()
+		if keys := rrs.Keys(); len(keys) != 1 || keys[0] != "claude:1" {
+			t.Errorf("Keys() = %v, 期望仅 claude:1", keys)
+		}
+	})
+}
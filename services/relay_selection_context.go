@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// 通过 context 传递 provider 选择结果
+// ============================================================================
+
+// Selection 重试循环当前选中的 provider
+type Selection struct {
+	Platform string // 平台标识（claude/codex/gemini/custom:xxx）
+	Provider string // provider 名称
+	Level    int    // provider 所在 Level
+	Attempt  int    // 本次客户端请求的第几次尝试（从 1 开始，含同 provider 重试）
+
+	// LastStart 本 Level 轮询排序所依据的上次起始 provider（未轮询时为空）
+	// 配合 RoundRobinState.SeedKey 与 ReorderFrom 可复现该请求看到的 provider 顺序
+	LastStart string
+
+	// FailedProviders 本次尝试之前失败过的 provider（去重，按首次失败顺序）
+	FailedProviders []string
+
+	// AttemptTimeout 按重试时间预算分配给本次尝试的超时（见 RetryContext.AttemptTimeout），0 表示不限制
+	AttemptTimeout time.Duration
+}
+
+type selectionKey struct{}
+
+// WithSelection 返回携带 sel 的子 context；同一请求多次写入时以最近一次为准
+func WithSelection(ctx context.Context, sel Selection) context.Context {
+	return context.WithValue(ctx, selectionKey{}, sel)
+}
+
+// SelectionFromContext 读取最近一次写入的选择结果，未写入时返回 false
+func SelectionFromContext(ctx context.Context) (Selection, bool) {
+	if ctx == nil {
+		return Selection{}, false
+	}
+	sel, ok := ctx.Value(selectionKey{}).(Selection)
+	return sel, ok
+}
+
+// markSelection 在每次尝试前把选择结果写入请求 context
+// gin 中间件在 c.Next() 返回后可通过 SelectionFromContext(c.Request.Context()) 读取实际服务请求的 provider
+// sel 未指定 FailedProviders 时沿用上一次选择记录的失败列表
+func markSelection(c *gin.Context, sel Selection) {
+	if prev, ok := SelectionFromContext(c.Request.Context()); ok && sel.FailedProviders == nil {
+		sel.FailedProviders = prev.FailedProviders
+	}
+	c.Request = c.Request.WithContext(WithSelection(c.Request.Context(), sel))
+}
+
+// markFailed 记录 provider 本次尝试失败，后续尝试写日志时据此填写 failed_providers
+func markFailed(c *gin.Context, provider string) {
+	sel, _ := SelectionFromContext(c.Request.Context())
+	if slices.Contains(sel.FailedProviders, provider) {
+		return
+	}
+	sel.FailedProviders = append(slices.Clip(sel.FailedProviders), provider)
+	c.Request = c.Request.WithContext(WithSelection(c.Request.Context(), sel))
+}
+
+// fillLogFromSelection 用 ctx 中的选择结果补齐 requestLog 未填写的尝试次数与失败 provider
+func fillLogFromSelection(ctx context.Context, requestLog *ReqeustLog) {
+	sel, ok := SelectionFromContext(ctx)
+	if !ok {
+		return
+	}
+	if requestLog.AttemptCount <= 0 {
+		requestLog.AttemptCount = sel.Attempt
+	}
+	if requestLog.FailedProviders == "" {
+		requestLog.FailedProviders = strings.Join(sel.FailedProviders, ",")
+	}
+}
+
+// WriteRequestLogCtx 与 WriteRequestLog 相同，requestLog 中未填写的 provider 与尝试次数从 ctx 的选择结果补齐
+func WriteRequestLogCtx(ctx context.Context, requestLog *ReqeustLog) {
+	if sel, ok := SelectionFromContext(ctx); ok {
+		if requestLog.Platform == "" {
+			requestLog.Platform = sel.Platform
+		}
+		if requestLog.Provider == "" {
+			requestLog.Provider = sel.Provider
+		}
+	}
+	fillLogFromSelection(ctx, requestLog)
+	WriteRequestLog(requestLog)
+}
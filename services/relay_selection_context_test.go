@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSelectionContext(t *testing.T) {
+	if _, ok := SelectionFromContext(context.Background()); ok {
+		t.Error("未写入时应返回 false")
+	}
+
+	ctx := WithSelection(context.Background(), Selection{Platform: "claude", Provider: "a", Level: 1, Attempt: 1})
+	ctx = WithSelection(ctx, Selection{Platform: "claude", Provider: "b", Level: 2, Attempt: 2})
+	sel, ok := SelectionFromContext(ctx)
+	if !ok || sel.Provider != "b" || sel.Level != 2 || sel.Attempt != 2 {
+		t.Errorf("SelectionFromContext() = %+v, %v; 应以最近一次为准", sel, ok)
+	}
+}
+
+func TestMarkSelection_VisibleToMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	var seen Selection
+	router.Use(func(c *gin.Context) {
+		c.Next()
+		seen, _ = SelectionFromContext(c.Request.Context())
+	})
+	router.POST("/v1/messages", func(c *gin.Context) {
+		markSelection(c, Selection{Platform: "claude", Provider: "first", Level: 1, Attempt: 1})
+		markSelection(c, Selection{Platform: "claude", Provider: "second", Level: 1, Attempt: 2})
+		c.Status(http.StatusOK)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/messages", nil))
+	if seen.Provider != "second" || seen.Attempt != 2 {
+		t.Errorf("中间件读到 %+v, 期望最后一次尝试的 provider", seen)
+	}
+}
+
+func TestWriteRequestLogCtx_FillsFromSelection(t *testing.T) {
+	orig := GlobalDBQueueLogs
+	GlobalDBQueueLogs = nil
+	defer func() { GlobalDBQueueLogs = orig }()
+
+	ctx := WithSelection(context.Background(), Selection{Platform: "codex", Provider: "p1", Level: 1, Attempt: 3})
+	log := &ReqeustLog{Platform: "claude"}
+	WriteRequestLogCtx(ctx, log)
+	if log.Platform != "claude" || log.Provider != "p1" || log.AttemptCount != 3 {
+		t.Errorf("log = %+v; 已填写的字段不应被覆盖，未填写的从 context 补齐", log)
+	}
+}
+
+func TestMarkFailed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	markSelection(c, Selection{Platform: "claude", Provider: "a", Attempt: 1})
+	markFailed(c, "a")
+	markSelection(c, Selection{Platform: "claude", Provider: "a", Attempt: 2})
+	markFailed(c, "a")
+	markSelection(c, Selection{Platform: "claude", Provider: "b", Attempt: 3})
+
+	log := &ReqeustLog{}
+	fillLogFromSelection(c.Request.Context(), log)
+	if log.AttemptCount != 3 || log.FailedProviders != "a" {
+		t.Errorf("log = %+v; 失败 provider 应去重并在后续选择中保留", log)
+	}
+}
+
+func TestForwardRequest_LogsAttemptsAndFailedProviders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := ensureRequestLogTableWithDB(db); err != nil {
+		t.Fatalf("建表失败: %v", err)
+	}
+	queue := NewDBWriteQueue(db, 16, true)
+	orig := GlobalDBQueueLogs
+	GlobalDBQueueLogs = queue
+	defer func() { GlobalDBQueueLogs = orig }()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"type":"message","usage":{"input_tokens":1,"output_tokens":1}}`))
+	}))
+	defer up.Close()
+
+	prs := NewProviderRelayService(nil, nil, nil, nil, nil, "")
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	body := []byte(`{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`)
+
+	// 按故障转移循环的顺序：选择 → 转发 → 失败时 markFailed
+	markSelection(c, Selection{Platform: "claude", Provider: "down", Level: 1, Attempt: 1})
+	if ok, _ := prs.forwardRequest(c, "claude", Provider{Name: "down", APIURL: down.URL, APIKey: "k"},
+		"/v1/messages", nil, map[string]string{}, body, false, "claude-sonnet-4"); ok {
+		t.Fatal("down 应失败")
+	}
+	markFailed(c, "down")
+	markSelection(c, Selection{Platform: "claude", Provider: "up", Level: 2, Attempt: 2})
+	if ok, err := prs.forwardRequest(c, "claude", Provider{Name: "up", APIURL: up.URL, APIKey: "k"},
+		"/v1/messages", nil, map[string]string{}, body, false, "claude-sonnet-4"); !ok {
+		t.Fatalf("up 应成功: %v", err)
+	}
+	if err := queue.Shutdown(5 * time.Second); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	rows, err := db.Query(`SELECT provider, attempt_count, failed_providers FROM request_log ORDER BY id`)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var provider, failed string
+		var attempts int
+		if err := rows.Scan(&provider, &attempts, &failed); err != nil {
+			t.Fatalf("Scan() error = %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s|%d|%s", provider, attempts, failed))
+	}
+	want := "down|1|,up|2|down"
+	if strings.Join(got, ",") != want {
+		t.Errorf("request_log = %v, want %s", got, want)
+	}
+}
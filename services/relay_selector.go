@@ -0,0 +1,37 @@
+package services
+
+// ============================================================================
+// 可插拔的 Provider 选择器
+// ============================================================================
+
+// Selector 决定已过滤 providers 的尝试顺序
+// 输入为 FilterProviders / FilterGeminiProviders 过滤后的结果（Active 与 LastResort 合并传入），
+// 返回按尝试顺序排列的 providers；实现可据此接入一致性哈希、按成本排序等自定义算法
+type Selector interface {
+	Select(providers []ProviderLike, ctx *RequestContext) []ProviderLike
+}
+
+// SelectorFunc 函数形式的 Selector
+type SelectorFunc func(providers []ProviderLike, ctx *RequestContext) []ProviderLike
+
+// Select 实现 Selector 接口
+func (f SelectorFunc) Select(providers []ProviderLike, ctx *RequestContext) []ProviderLike {
+	return f(providers, ctx)
+}
+
+// RoundRobinSelector 默认选择器：按 Level 分组、同 Level 内轮询、兜底 provider 追加到末尾
+// 与 SelectProviders 行为完全一致
+type RoundRobinSelector struct {
+	State    *RoundRobinState // 轮询状态，为 nil 时不轮询（保持原顺序）
+	Platform Platform         // 轮询状态的平台标识
+}
+
+// NewRoundRobinSelector 创建默认选择器
+func NewRoundRobinSelector(state *RoundRobinState, platform Platform) *RoundRobinSelector {
+	return &RoundRobinSelector{State: state, Platform: platform}
+}
+
+// Select 实现 Selector 接口
+func (s *RoundRobinSelector) Select(providers []ProviderLike, _ *RequestContext) []ProviderLike {
+	return SelectProviders(s.State, s.Platform, providers)
+}
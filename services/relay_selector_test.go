@@ -0,0 +1,48 @@
+package services
+
+import "testing"
+
+func TestRoundRobinSelector_MatchesSelectProviders(t *testing.T) {
+	providers := []MockProvider{
+		{Name: "a", Level: 1},
+		{Name: "b", Level: 1},
+		{Name: "c", Level: 2},
+		{Name: "z", Level: 1, LastResort: true},
+	}
+
+	expectedState := NewRoundRobinState()
+	selector := NewRoundRobinSelector(NewRoundRobinState(), "claude")
+
+	for round := 0; round < 3; round++ {
+		want := SelectProviders(expectedState, "claude", providers)
+		got := selector.Select(toProviderLikes(providers), nil)
+		if len(got) != len(want) {
+			t.Fatalf("第 %d 轮长度 = %d, 期望 %d", round+1, len(got), len(want))
+		}
+		for i := range want {
+			if got[i].GetName() != want[i].Name {
+				t.Errorf("第 %d 轮 [%d] = %s, 期望 %s", round+1, i, got[i].GetName(), want[i].Name)
+			}
+		}
+	}
+}
+
+func TestProviderRouteGroupWithSelector(t *testing.T) {
+	providers := []Provider{
+		{Name: "a", APIURL: "https://a", APIKey: "k", Enabled: true},
+		{Name: "b", APIURL: "https://b", APIKey: "k", Enabled: true},
+	}
+	reverse := SelectorFunc(func(ps []ProviderLike, _ *RequestContext) []ProviderLike {
+		out := make([]ProviderLike, 0, len(ps))
+		for i := len(ps) - 1; i >= 0; i-- {
+			out = append(out, ps[i])
+		}
+		return out
+	})
+
+	group := ProviderRouteGroupWithSelector("claude", FormatClaude, 1, reverse, providers, nil, nil, nil)
+	got := group.Select(&RequestContext{})
+	if len(got) != 2 || got[0].GetName() != "b" {
+		t.Errorf("自定义 Selector 未生效: %v", got)
+	}
+}
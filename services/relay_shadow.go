@@ -0,0 +1,206 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// 影子流量（候选 provider 对比测试）
+// ============================================================================
+
+const (
+	// DefaultShadowConcurrency 默认最多同时进行的影子请求数
+	DefaultShadowConcurrency = 4
+	// DefaultShadowTimeout 单个影子请求的默认超时
+	DefaultShadowTimeout = 2 * time.Minute
+	// DefaultShadowRecordLimit 默认保留的对比记录条数（超出后丢弃最旧的）
+	DefaultShadowRecordLimit = 100
+	// maxShadowBodyBytes 记录的响应体上限，超出部分截断
+	maxShadowBodyBytes = 1 << 20
+)
+
+// ShadowRecord 一次影子请求的对比记录：主路径响应与候选 provider 响应
+type ShadowRecord struct {
+	RecordedAt      time.Time     `json:"recordedAt"`
+	Endpoint        string        `json:"endpoint"`
+	RequestBody     []byte        `json:"requestBody"`
+	PrimaryProvider string        `json:"primaryProvider"`
+	PrimaryStatus   int           `json:"primaryStatus"`
+	PrimaryBody     []byte        `json:"primaryBody"`
+	ShadowProvider  string        `json:"shadowProvider"`
+	ShadowStatus    int           `json:"shadowStatus"`
+	ShadowBody      []byte        `json:"shadowBody"`
+	ShadowError     string        `json:"shadowError,omitempty"`
+	ShadowDuration  time.Duration `json:"shadowDuration"`
+}
+
+// shadowSendFunc 向候选 provider 发送请求，返回状态码与响应体
+type shadowSendFunc func(ctx context.Context, candidate Provider, endpoint string, headers map[string]string, body []byte) (int, []byte, error)
+
+// ShadowSender 按采样率把请求镜像发送给候选 provider，记录其响应与主路径响应用于事后对比
+// Mirror 不阻塞：未采中或并发已满时直接放弃，影子请求在后台 goroutine 中完成，
+// 其结果与错误只进入对比记录，不影响主路径
+type ShadowSender struct {
+	Candidate  Provider      // 候选 provider
+	SampleRate float64       // 采样率（0~1），<= 0 不发送，>= 1 全部发送
+	Timeout    time.Duration // 单个影子请求超时，<= 0 使用 DefaultShadowTimeout
+
+	sem       chan struct{} // 并发上限
+	randFloat func() float64
+	send      shadowSendFunc
+	wg        sync.WaitGroup
+	dropped   atomic.Uint64
+
+	mu         sync.Mutex
+	records    []ShadowRecord
+	maxRecords int
+}
+
+// NewShadowSender 创建影子流量发送器，maxConcurrent <= 0 时使用 DefaultShadowConcurrency
+func NewShadowSender(candidate Provider, sampleRate float64, maxConcurrent int) *ShadowSender {
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultShadowConcurrency
+	}
+	return &ShadowSender{
+		Candidate:  candidate.Clone(),
+		SampleRate: sampleRate,
+		Timeout:    DefaultShadowTimeout,
+		sem:        make(chan struct{}, maxConcurrent),
+		randFloat:  rand.Float64,
+		send:       sendShadowRequest,
+		maxRecords: DefaultShadowRecordLimit,
+	}
+}
+
+// shouldSample 按采样率决定本次请求是否镜像
+func (s *ShadowSender) shouldSample() bool {
+	if s == nil || s.SampleRate <= 0 {
+		return false
+	}
+	if s.SampleRate >= 1 {
+		return true
+	}
+	return s.randFloat() < s.SampleRate
+}
+
+// Mirror 在主路径完成后调用：按采样率把请求镜像发送给候选 provider，返回是否已发出
+// 并发已满时放弃本次镜像（计入 Dropped），不会等待；请求体与主路径响应体会被复制，调用方可立即复用缓冲区
+func (s *ShadowSender) Mirror(ctx *RequestContext, endpoint, primaryProvider string, primaryStatus int, primaryBody []byte) bool {
+	if ctx == nil || !s.shouldSample() {
+		return false
+	}
+	select {
+	case s.sem <- struct{}{}:
+	default:
+		s.dropped.Add(1)
+		return false
+	}
+
+	record := ShadowRecord{
+		RecordedAt:      clockNow(),
+		Endpoint:        endpoint,
+		RequestBody:     bytes.Clone(ctx.BodyBytes),
+		PrimaryProvider: primaryProvider,
+		PrimaryStatus:   primaryStatus,
+		PrimaryBody:     truncateShadowBody(primaryBody),
+		ShadowProvider:  s.Candidate.Name,
+	}
+	headers := cloneMap(ctx.ClientHeaders)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.sem }()
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Printf("[WARN] 影子请求 panic（已忽略）: %v\n", r)
+			}
+		}()
+
+		timeout := s.Timeout
+		if timeout <= 0 {
+			timeout = DefaultShadowTimeout
+		}
+		reqCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		start := time.Now()
+		status, body, err := s.send(reqCtx, s.Candidate, endpoint, headers, record.RequestBody)
+		record.ShadowDuration = time.Since(start)
+		record.ShadowStatus = status
+		record.ShadowBody = truncateShadowBody(body)
+		if err != nil {
+			record.ShadowError = err.Error()
+		}
+		s.addRecord(record)
+	}()
+	return true
+}
+
+// Records 返回对比记录的副本（按时间先后）
+func (s *ShadowSender) Records() []ShadowRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ShadowRecord(nil), s.records...)
+}
+
+// Dropped 返回因并发已满而放弃的镜像次数
+func (s *ShadowSender) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Wait 等待进行中的影子请求完成（用于关闭服务或测试）
+func (s *ShadowSender) Wait() {
+	s.wg.Wait()
+}
+
+func (s *ShadowSender) addRecord(record ShadowRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	if over := len(s.records) - s.maxRecords; over > 0 {
+		s.records = append(s.records[:0:0], s.records[over:]...)
+	}
+}
+
+func truncateShadowBody(body []byte) []byte {
+	if len(body) > maxShadowBodyBytes {
+		body = body[:maxShadowBodyBytes]
+	}
+	return bytes.Clone(body)
+}
+
+// sendShadowRequest 默认发送实现：客户端认证头替换为候选 provider 的认证后 POST 到其端点
+func sendShadowRequest(ctx context.Context, candidate Provider, endpoint string, headers map[string]string, body []byte) (int, []byte, error) {
+	targetURL := joinURL(candidate.APIURL, candidate.GetEffectiveEndpoint(endpoint))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, fmt.Errorf("创建影子请求失败: %w", err)
+	}
+	for key, value := range headers {
+		switch strings.ToLower(key) {
+		case "authorization", "x-api-key", "x-goog-api-key", "content-length", "accept-encoding":
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+
+	setProviderAuth(req.Header, candidate)
+
+	resp, err := ClientFor(candidate).Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxShadowBodyBytes))
+	return resp.StatusCode, respBody, err
+}
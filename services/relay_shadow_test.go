@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestShadowSender_Mirror(t *testing.T) {
+	var gotAuth, gotClientKey, gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotClientKey = r.Header.Get("X-Api-Key")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"candidate":true}`))
+	}))
+	defer upstream.Close()
+
+	s := NewShadowSender(Provider{Name: "candidate", APIURL: upstream.URL, APIKey: "cand-key"}, 1, 1)
+	rc := &RequestContext{
+		BodyBytes:     []byte(`{"model":"m"}`),
+		ClientHeaders: map[string]string{"X-Api-Key": "client-key", "Content-Type": "application/json"},
+	}
+	if !s.Mirror(rc, "/v1/messages", "primary", 200, []byte(`{"primary":true}`)) {
+		t.Fatal("采样率为 1 时应发出影子请求")
+	}
+	rc.BodyBytes[2] = 'X' // 调用方立即复用缓冲区不影响影子请求
+	s.Wait()
+
+	if gotAuth != "Bearer cand-key" || gotClientKey != "" {
+		t.Errorf("认证头应替换为候选 provider 的: Authorization=%q X-Api-Key=%q", gotAuth, gotClientKey)
+	}
+	if gotBody != `{"model":"m"}` {
+		t.Errorf("影子请求体 = %q", gotBody)
+	}
+	records := s.Records()
+	if len(records) != 1 {
+		t.Fatalf("records = %d, want 1", len(records))
+	}
+	r := records[0]
+	if r.PrimaryProvider != "primary" || string(r.PrimaryBody) != `{"primary":true}` ||
+		r.ShadowProvider != "candidate" || r.ShadowStatus != 200 || string(r.ShadowBody) != `{"candidate":true}` || r.ShadowError != "" {
+		t.Errorf("record = %+v", r)
+	}
+}
+
+func TestShadowSender_SamplingAndConcurrency(t *testing.T) {
+	rc := &RequestContext{BodyBytes: []byte(`{}`)}
+
+	t.Run("未采中不发送", func(t *testing.T) {
+		s := NewShadowSender(Provider{Name: "c"}, 0.5, 1)
+		s.randFloat = func() float64 { return 0.9 }
+		if s.Mirror(rc, "/v1/messages", "p", 200, nil) {
+			t.Error("随机数高于采样率时不应发送")
+		}
+		if NewShadowSender(Provider{}, 0, 1).Mirror(rc, "/v1/messages", "p", 200, nil) {
+			t.Error("采样率为 0 时不应发送")
+		}
+	})
+
+	t.Run("并发已满时放弃且不阻塞", func(t *testing.T) {
+		release := make(chan struct{})
+		s := NewShadowSender(Provider{Name: "c"}, 1, 1)
+		s.send = func(ctx context.Context, _ Provider, _ string, _ map[string]string, _ []byte) (int, []byte, error) {
+			<-release
+			return http.StatusOK, nil, nil
+		}
+
+		if !s.Mirror(rc, "/v1/messages", "p", 200, nil) {
+			t.Fatal("第一个影子请求应发出")
+		}
+		if s.Mirror(rc, "/v1/messages", "p", 200, nil) {
+			t.Error("并发已满时应放弃")
+		}
+		if s.Dropped() != 1 {
+			t.Errorf("Dropped() = %d, want 1", s.Dropped())
+		}
+		close(release)
+		s.Wait()
+		if len(s.Records()) != 1 {
+			t.Errorf("records = %d, want 1", len(s.Records()))
+		}
+	})
+
+	t.Run("只保留最近的记录", func(t *testing.T) {
+		s := NewShadowSender(Provider{Name: "c"}, 1, 1)
+		s.maxRecords = 2
+		for i := 0; i < 3; i++ {
+			s.addRecord(ShadowRecord{PrimaryStatus: i})
+		}
+		if records := s.Records(); len(records) != 2 || records[0].PrimaryStatus != 1 {
+			t.Errorf("records = %+v", records)
+		}
+	})
+}
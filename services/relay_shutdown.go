@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// 优雅关闭
+// ============================================================================
+
+// ErrShutdownTimeout 关闭时在 ctx 截止前未能排空在途请求或日志队列
+var ErrShutdownTimeout = errors.New("relay shutdown timed out")
+
+// defaultQueueDrainTimeout ctx 未设置截止时间时，等待日志队列排空的最长时间
+const defaultQueueDrainTimeout = 10 * time.Second
+
+// inflightTracker 在途请求计数器
+// 进入排空状态后拒绝新请求，并可等待计数归零
+type inflightTracker struct {
+	mu       sync.Mutex
+	count    int
+	draining bool
+	idle     chan struct{} // 排空状态下计数归零时关闭
+}
+
+func newInflightTracker() *inflightTracker {
+	return &inflightTracker{}
+}
+
+// enter 登记一个新请求；已进入排空状态时返回 false
+func (t *inflightTracker) enter() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.count++
+	return true
+}
+
+// leave 请求结束
+func (t *inflightTracker) leave() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count--
+	if t.draining && t.count == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// Inflight 返回当前在途请求数
+func (t *inflightTracker) Inflight() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count
+}
+
+// drain 进入排空状态并等待在途请求全部结束，ctx 结束时返回 ErrShutdownTimeout
+func (t *inflightTracker) drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	if t.count == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: 仍有 %d 个在途请求", ErrShutdownTimeout, t.Inflight())
+	}
+}
+
+// middleware 统计在途请求，排空期间的新请求直接返回 503
+func (t *inflightTracker) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !t.enter() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "relay is shutting down"})
+			return
+		}
+		defer t.leave()
+		c.Next()
+	}
+}
+
+// Shutdown 优雅关闭代理服务
+//  1. 停止接收新请求（新请求返回 503）
+//  2. 等待在途请求结束（请求日志在 handler 结束前已写入队列）
+//  3. 关闭 HTTP 服务器
+//  4. 排空并关闭数据库写入队列，确保最后一批 request_log 落盘，并输出已缓冲的跳过日志
+//
+// 所有步骤共享 ctx 的截止时间，超时返回包装了 ErrShutdownTimeout 的错误；
+// 即使等待在途请求超时，仍会尽力关闭服务器和排空队列
+func (prs *ProviderRelayService) Shutdown(ctx context.Context) error {
+	var errs []error
+
+	fmt.Printf("[INFO] 代理服务开始关闭，在途请求: %d\n", prs.inflight.Inflight())
+	if err := prs.inflight.drain(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if prs.server != nil {
+		if err := prs.server.Shutdown(ctx); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+				err = fmt.Errorf("%w: %v", ErrShutdownTimeout, err)
+			}
+			errs = append(errs, fmt.Errorf("关闭 HTTP 服务器失败: %w", err))
+		}
+	}
+
+	timeout := defaultQueueDrainTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if timeout <= 0 {
+		// 已超时也给队列一个最短的排空窗口，尽量不丢日志
+		timeout = 100 * time.Millisecond
+	}
+	if err := ShutdownGlobalDBQueue(timeout); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %v", ErrShutdownTimeout, err))
+	}
+	FlushSkipLogs()
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	fmt.Println("[INFO] 代理服务已关闭，日志队列已排空")
+	return nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInflightTracker_Drain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tracker := newInflightTracker()
+	release := make(chan struct{})
+	entered := make(chan struct{})
+
+	router := gin.New()
+	router.Use(tracker.middleware())
+	router.GET("/slow", func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		done <- w.Code
+	}()
+	<-entered
+
+	t.Run("超时返回错误", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := tracker.drain(ctx); !errors.Is(err, ErrShutdownTimeout) {
+			t.Errorf("drain() error = %v, 期望 ErrShutdownTimeout", err)
+		}
+	})
+
+	t.Run("排空期间拒绝新请求", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, 期望 503", w.Code)
+		}
+	})
+
+	t.Run("在途请求结束后返回", func(t *testing.T) {
+		drained := make(chan error, 1)
+		go func() { drained <- tracker.drain(context.Background()) }()
+
+		close(release)
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("在途请求 status = %d, 期望 200", code)
+		}
+		select {
+		case err := <-drained:
+			if err != nil {
+				t.Errorf("drain() error = %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("在途请求结束后 drain 未返回")
+		}
+		if n := tracker.Inflight(); n != 0 {
+			t.Errorf("Inflight() = %d, 期望 0", n)
+		}
+	})
+}
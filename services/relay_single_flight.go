@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// ============================================================================
+// 相同请求合并（single-flight）
+// ============================================================================
+
+// SingleFlight 合并进行中的相同请求：同一 key 同时只有一个请求真正访问上游，其余等待并共享其响应
+// 与 IdempotencyCache 不同，请求完成后立即移除记录，不缓存结果
+type SingleFlight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{} // 首个请求完成时关闭
+	result  IdempotencyResult
+	waiters int // 等待共享结果的请求数
+}
+
+// NewSingleFlight 创建请求合并器
+func NewSingleFlight() *SingleFlight {
+	return &SingleFlight{calls: make(map[string]*flightCall)}
+}
+
+// Do 执行 fn 并返回结果；key 相同的请求正在进行时不执行 fn，等待其完成后返回同一结果（shared=true）
+// key 为空时直接执行 fn，不做合并；fn panic 时等待者收到零值结果，panic 继续向上传播
+func (sf *SingleFlight) Do(key string, fn func() IdempotencyResult) (result IdempotencyResult, shared bool) {
+	if key == "" {
+		return fn(), false
+	}
+
+	sf.mu.Lock()
+	if call, ok := sf.calls[key]; ok {
+		call.waiters++
+		sf.mu.Unlock()
+		<-call.done
+		return call.result, true
+	}
+	call := &flightCall{done: make(chan struct{})}
+	sf.calls[key] = call
+	sf.mu.Unlock()
+
+	defer func() {
+		sf.mu.Lock()
+		delete(sf.calls, key)
+		sf.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.result = fn()
+	return call.result, false
+}
+
+// Inflight 返回正在进行的合并组数
+func (sf *SingleFlight) Inflight() int {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return len(sf.calls)
+}
+
+// SingleFlightKey 计算请求的合并键：方法 + 路径 + 客户端身份 + 规范化请求体 的 SHA-256
+// 流式请求（stream:true 或 Gemini streamGenerateContent）与空请求体返回空串（不合并）；
+// 客户端身份参与计算，不同租户的相同请求不会共享响应
+func SingleFlightKey(method, path, apiKeyHash string, body []byte) string {
+	if len(body) == 0 || gjson.GetBytes(body, "stream").Bool() || strings.Contains(path, ":streamGenerateContent") {
+		return ""
+	}
+	h := sha256.New()
+	for _, part := range []string{method, path, apiKeyHash} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(normalizeJSONBody(body))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeJSONBody 规范化 JSON 请求体（去除空白、对象 key 排序，数字保持原样），非 JSON 原样返回
+func normalizeJSONBody(body []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return body
+	}
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return normalized
+}
+
+// SetRequestCoalescing 开启/关闭相同请求合并（默认关闭）
+// 开启后，字节级相同（规范化后）的非流式请求在进行中时只转发一次，其余请求共享同一响应；流式请求不受影响
+func (prs *ProviderRelayService) SetRequestCoalescing(enabled bool) {
+	prs.coalescing.Store(enabled)
+}
+
+// coalesceMiddleware 相同请求合并中间件，未开启时直接放行
+// 首个请求的上游调用与其客户端连接解绑（context.WithoutCancel）：该客户端断开不会中断其他等待者共享的调用；
+// 首个请求没有写出任何响应（如 panic 或处理函数直接返回）时，等待者各自重新执行处理函数，而不是收到空的 200
+func coalesceMiddleware(enabled *atomic.Bool, sf *SingleFlight) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !enabled.Load() || c.Request.Method != http.MethodPost || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := SingleFlightKey(c.Request.Method, c.Request.URL.Path,
+			ClientAPIKeyHash(cloneHeaders(c.Request.Header)), body)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		result, shared := sf.Do(key, func() IdempotencyResult {
+			capture := &captureWriter{ResponseWriter: c.Writer}
+			c.Writer = capture
+			c.Request = c.Request.WithContext(context.WithoutCancel(c.Request.Context()))
+			defer func() { c.Writer = capture.ResponseWriter }()
+			c.Next()
+			if !capture.Written() {
+				return IdempotencyResult{}
+			}
+			return IdempotencyResult{
+				StatusCode:  capture.Status(),
+				ContentType: capture.Header().Get("Content-Type"),
+				Body:        capture.buf.Bytes(),
+			}
+		})
+		if !shared {
+			return
+		}
+		if result.StatusCode == 0 {
+			fmt.Printf("[WARN] 合并的首个请求未产生响应，重新处理：%s\n", c.Request.URL.Path)
+			c.Next()
+			return
+		}
+		fmt.Printf("[INFO] 合并相同请求：%s 共享进行中请求的响应\n", c.Request.URL.Path)
+		c.Data(result.StatusCode, result.ContentType, result.Body)
+		c.Abort()
+	}
+}
+
+// captureWriter 转发写入的同时保留一份响应体，供合并的等待者共享
+type captureWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.buf.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.buf.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
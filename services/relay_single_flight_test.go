@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSingleFlightKey(t *testing.T) {
+	a := SingleFlightKey("POST", "/v1/messages", "u1", []byte(`{"model":"m","max_tokens":10}`))
+	b := SingleFlightKey("POST", "/v1/messages", "u1", []byte("{ \"max_tokens\": 10,\n \"model\": \"m\" }"))
+	if a == "" || a != b {
+		t.Errorf("规范化后相同的请求体应得到相同的键: %q / %q", a, b)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"不同租户", SingleFlightKey("POST", "/v1/messages", "u2", []byte(`{"model":"m","max_tokens":10}`))},
+		{"不同路径", SingleFlightKey("POST", "/responses", "u1", []byte(`{"model":"m","max_tokens":10}`))},
+		{"不同内容", SingleFlightKey("POST", "/v1/messages", "u1", []byte(`{"model":"m","max_tokens":11}`))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.key == a {
+				t.Error("应得到不同的键")
+			}
+		})
+	}
+
+	for name, key := range map[string]string{
+		"流式请求":      SingleFlightKey("POST", "/v1/messages", "", []byte(`{"stream":true}`)),
+		"Gemini 流式": SingleFlightKey("POST", "/gemini/v1beta/models/g:streamGenerateContent", "", []byte(`{"contents":[]}`)),
+		"空请求体":      SingleFlightKey("POST", "/v1/messages", "", nil),
+	} {
+		if key != "" {
+			t.Errorf("%s 不应合并", name)
+		}
+	}
+}
+
+func TestCoalesceMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var enabled atomic.Bool
+	enabled.Store(true)
+	var upstreamCalls atomic.Int32
+	release := make(chan struct{})
+
+	sf := NewSingleFlight()
+	router := gin.New()
+	router.Use(coalesceMiddleware(&enabled, sf))
+	router.POST("/v1/messages", func(c *gin.Context) {
+		upstreamCalls.Add(1)
+		<-release
+		c.JSON(http.StatusOK, gin.H{"id": "msg_1"})
+	})
+
+	const n = 5
+	var wg sync.WaitGroup
+	bodies := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"m"}`))
+			router.ServeHTTP(rec, req)
+			bodies[i] = rec.Body.String()
+		}(i)
+	}
+	// 等待其余请求都在等待首个请求的结果后再放行上游
+	waiters := func() int {
+		sf.mu.Lock()
+		defer sf.mu.Unlock()
+		total := 0
+		for _, call := range sf.calls {
+			total += call.waiters
+		}
+		return total
+	}
+	for deadline := time.Now().Add(5 * time.Second); waiters() < n-1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待者 = %d, 期望 %d", waiters(), n-1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls := upstreamCalls.Load(); calls != 1 {
+		t.Errorf("上游调用 %d 次, 期望 1", calls)
+	}
+	for i, body := range bodies {
+		if body != `{"id":"msg_1"}` {
+			t.Errorf("第 %d 个响应 = %q", i, body)
+		}
+	}
+
+	t.Run("未开启时不合并", func(t *testing.T) {
+		enabled.Store(false)
+		upstreamCalls.Store(0)
+		for i := 0; i < 2; i++ {
+			router.ServeHTTP(httptest.NewRecorder(),
+				httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"m"}`)))
+		}
+		if calls := upstreamCalls.Load(); calls != 2 {
+			t.Errorf("上游调用 %d 次, 期望 2", calls)
+		}
+	})
+}
+
+func TestCoalesceMiddleware_LeaderWithoutResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var enabled atomic.Bool
+	enabled.Store(true)
+	var upstreamCalls atomic.Int32
+	release := make(chan struct{})
+	leaderCtxErr := make(chan error, 1)
+
+	sf := NewSingleFlight()
+	router := gin.New()
+	router.Use(coalesceMiddleware(&enabled, sf))
+	router.POST("/v1/messages", func(c *gin.Context) {
+		if upstreamCalls.Add(1) == 1 {
+			<-release
+			// 首个请求的客户端已断开，处理函数不写任何响应
+			leaderCtxErr <- c.Request.Context().Err()
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": "msg_retry"})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"m"}`)).WithContext(ctx)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); sf.Inflight() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("首个请求未开始")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	waiter := httptest.NewRecorder()
+	go func() {
+		defer wg.Done()
+		router.ServeHTTP(waiter, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"m"}`)))
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		sf.mu.Lock()
+		waiting := 0
+		for _, call := range sf.calls {
+			waiting += call.waiters
+		}
+		sf.mu.Unlock()
+		if waiting == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("第二个请求未进入等待")
+		}
+	}
+
+	cancel()
+	close(release)
+	wg.Wait()
+
+	if err := <-leaderCtxErr; err != nil {
+		t.Errorf("首个请求的客户端断开不应取消共享的上游调用: %v", err)
+	}
+	if waiter.Code != http.StatusOK || waiter.Body.String() != `{"id":"msg_retry"}` {
+		t.Errorf("首个请求无响应时等待者应重新处理, got %d %q", waiter.Code, waiter.Body.String())
+	}
+	if calls := upstreamCalls.Load(); calls != 2 {
+		t.Errorf("上游调用 %d 次, 期望 2", calls)
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// 跳过日志去重
+// ============================================================================
+
+// DefaultSkipLogWindow 同一 (provider, 原因) 跳过日志的默认去重窗口
+const DefaultSkipLogWindow = 60 * time.Second
+
+// skipLogPruneThreshold 记录数超过该值时清理过期记录，避免 provider 频繁增删导致无限增长
+const skipLogPruneThreshold = 1024
+
+// skipLogLimiter 限制同一 key 的日志在窗口内只输出一次
+// 首次出现立即输出，窗口内重复出现只计数，窗口过后再次输出并附带省略次数
+type skipLogLimiter struct {
+	mu         sync.Mutex
+	window     time.Duration
+	last       map[string]time.Time
+	suppressed map[string]int
+}
+
+var skipLogs = &skipLogLimiter{
+	window:     DefaultSkipLogWindow,
+	last:       make(map[string]time.Time),
+	suppressed: make(map[string]int),
+}
+
+// SetSkipLogWindow 设置跳过日志的去重窗口，<= 0 时关闭去重（每次都输出）
+func SetSkipLogWindow(window time.Duration) {
+	skipLogs.mu.Lock()
+	defer skipLogs.mu.Unlock()
+	skipLogs.window = window
+	skipLogs.last = make(map[string]time.Time)
+	skipLogs.suppressed = make(map[string]int)
+}
+
+// allow 判断 key 在 now 时刻是否应输出日志，返回上次输出后被省略的次数
+func (l *skipLogLimiter) allow(key string, now time.Time) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.window <= 0 {
+		return true, 0
+	}
+
+	if last, ok := l.last[key]; ok && now.Sub(last) < l.window {
+		l.suppressed[key]++
+		return false, 0
+	}
+
+	if len(l.last) >= skipLogPruneThreshold {
+		for k, t := range l.last {
+			if now.Sub(t) >= l.window {
+				delete(l.last, k)
+				delete(l.suppressed, k)
+			}
+		}
+	}
+
+	suppressed := l.suppressed[key]
+	delete(l.suppressed, key)
+	l.last[key] = now
+	return true, suppressed
+}
+
+// logSkipf 输出 provider 跳过日志，同一 (平台, provider, 原因) 在窗口内只输出一次
+func logSkipf(kind, name string, reason SkipReason, format string, args ...any) {
+	ok, suppressed := skipLogs.allow(kind+"|"+name+"|"+string(reason), clockNow())
+	if !ok {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if suppressed > 0 {
+		msg += fmt.Sprintf("（期间省略 %d 条相同日志）", suppressed)
+	}
+	writeSkipLog(msg)
+}
+
+// ============================================================================
+// 跳过日志异步输出
+// ============================================================================
+
+// DefaultSkipLogBuffer 跳过日志异步输出的默认缓冲条数
+const DefaultSkipLogBuffer = 1024
+
+// asyncLogSink 缓冲日志并由单个后台 goroutine 写出，请求处理路径不做阻塞的 stdout 写入
+// 缓冲区满时直接丢弃（计入 DroppedSkipLogs），不会让请求等待日志输出
+type asyncLogSink struct {
+	entries chan logEntry
+	out     io.Writer
+	done    chan struct{}
+}
+
+// logEntry 一条日志；flushed 非空时为刷新标记，写出之前的日志后关闭
+type logEntry struct {
+	line    string
+	flushed chan struct{}
+}
+
+func newAsyncLogSink(out io.Writer, size int) *asyncLogSink {
+	s := &asyncLogSink{
+		entries: make(chan logEntry, size),
+		out:     out,
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *asyncLogSink) run() {
+	defer close(s.done)
+	w := bufio.NewWriter(s.out)
+	for e := range s.entries {
+		if e.flushed != nil {
+			_ = w.Flush()
+			close(e.flushed)
+			continue
+		}
+		_, _ = w.WriteString(e.line)
+		_ = w.WriteByte('\n')
+		// 缓冲区已空时立即写出，避免日志滞留
+		if len(s.entries) == 0 {
+			_ = w.Flush()
+		}
+	}
+	_ = w.Flush()
+}
+
+// write 非阻塞写入，缓冲区满时丢弃
+func (s *asyncLogSink) write(line string) {
+	select {
+	case s.entries <- logEntry{line: line}:
+	default:
+		droppedSkipLogs.Add(1)
+	}
+}
+
+// flush 等待此前写入的日志全部输出
+func (s *asyncLogSink) flush() {
+	flushed := make(chan struct{})
+	s.entries <- logEntry{flushed: flushed}
+	<-flushed
+}
+
+// close 输出剩余日志并停止后台 goroutine，调用方需保证之后不再写入
+func (s *asyncLogSink) close() {
+	close(s.entries)
+	<-s.done
+}
+
+var (
+	skipLogSinkMu   sync.RWMutex
+	skipLogSink     = newAsyncLogSink(os.Stdout, DefaultSkipLogBuffer)
+	droppedSkipLogs atomic.Uint64
+)
+
+// writeSkipLog 输出一行跳过日志：开启异步输出时进入缓冲区，否则直接写 stdout
+func writeSkipLog(line string) {
+	skipLogSinkMu.RLock()
+	defer skipLogSinkMu.RUnlock()
+	if skipLogSink == nil {
+		fmt.Println(line)
+		return
+	}
+	skipLogSink.write(line)
+}
+
+// SetSkipLogBuffer 设置跳过日志异步输出的缓冲条数（默认 DefaultSkipLogBuffer）
+// size <= 0 时关闭异步输出，恢复为同步写 stdout；切换前已缓冲的日志会先全部输出
+func SetSkipLogBuffer(size int) {
+	skipLogSinkMu.Lock()
+	defer skipLogSinkMu.Unlock()
+	if skipLogSink != nil {
+		skipLogSink.close()
+		skipLogSink = nil
+	}
+	if size > 0 {
+		skipLogSink = newAsyncLogSink(os.Stdout, size)
+	}
+}
+
+// FlushSkipLogs 等待已缓冲的跳过日志全部输出（用于关闭服务或测试）
+func FlushSkipLogs() {
+	skipLogSinkMu.RLock()
+	defer skipLogSinkMu.RUnlock()
+	if skipLogSink != nil {
+		skipLogSink.flush()
+	}
+}
+
+// DroppedSkipLogs 返回因缓冲区已满而丢弃的跳过日志条数
+func DroppedSkipLogs() uint64 {
+	return droppedSkipLogs.Load()
+}
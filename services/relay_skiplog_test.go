@@ -0,0 +1,72 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer 可并发写入的 strings.Builder
+type syncBuffer struct {
+	mu sync.Mutex
+	sb strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sb.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sb.String()
+}
+
+func TestAsyncLogSink(t *testing.T) {
+	t.Run("flush 后按顺序输出", func(t *testing.T) {
+		var out syncBuffer
+		sink := newAsyncLogSink(&out, 16)
+		defer sink.close()
+
+		sink.write("a")
+		sink.write("b")
+		sink.flush()
+		if got := out.String(); got != "a\nb\n" {
+			t.Errorf("输出 = %q, want %q", got, "a\nb\n")
+		}
+	})
+
+	t.Run("缓冲区满时丢弃而不阻塞", func(t *testing.T) {
+		block := make(chan struct{})
+		sink := newAsyncLogSink(writerFunc(func(p []byte) (int, error) {
+			<-block
+			return len(p), nil
+		}), 1)
+
+		before := DroppedSkipLogs()
+		for i := 0; i < 10; i++ {
+			sink.write("x")
+		}
+		if DroppedSkipLogs()-before == 0 {
+			t.Error("缓冲区满时应丢弃日志")
+		}
+		close(block)
+		sink.close()
+	})
+
+	t.Run("close 输出剩余日志", func(t *testing.T) {
+		var out syncBuffer
+		sink := newAsyncLogSink(&out, 16)
+		sink.write("last")
+		sink.close()
+		if got := out.String(); got != "last\n" {
+			t.Errorf("输出 = %q", got)
+		}
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
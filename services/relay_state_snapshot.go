@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// 路由状态快照（只读，用于管理接口）
+// ============================================================================
+
+// RoundRobinSnapshot RoundRobinState 的只读副本
+type RoundRobinSnapshot struct {
+	LastStart   map[string]string    `json:"lastStart"`             // key: "platform:level" -> 上次起始 provider
+	Pinned      map[string]PinState  `json:"pinned,omitempty"`      // 成功置顶中的 provider（见 StickyAfterSuccess）
+	CooledUntil map[string]time.Time `json:"cooledUntil,omitempty"` // key: "platform/name" -> 成功降权截止时间
+}
+
+// PinState 置顶状态
+type PinState struct {
+	Provider string    `json:"provider"`
+	Until    time.Time `json:"until"`
+}
+
+// Snapshot 在轮询锁内复制当前状态，返回值与内部状态不共享内存
+// 已过期的置顶与降权记录不包含在内
+func (rrs *RoundRobinState) Snapshot() RoundRobinSnapshot {
+	now := clockNow()
+	rrs.mu.Lock()
+	defer rrs.mu.Unlock()
+
+	snap := RoundRobinSnapshot{LastStart: maps.Clone(rrs.lastStart)}
+	if snap.LastStart == nil {
+		snap.LastStart = map[string]string{}
+	}
+	for key, pin := range rrs.pinned {
+		if pin.until.After(now) {
+			if snap.Pinned == nil {
+				snap.Pinned = make(map[string]PinState)
+			}
+			snap.Pinned[key] = PinState{Provider: pin.name, Until: pin.until}
+		}
+	}
+	for key, until := range rrs.cooledUntil {
+		if until.After(now) {
+			if snap.CooledUntil == nil {
+				snap.CooledUntil = make(map[string]time.Time)
+			}
+			snap.CooledUntil[key] = until
+		}
+	}
+	return snap
+}
+
+// RelayState 代理服务路由状态的只读快照，可直接序列化为 JSON
+// 各部分分别在各自的锁内复制，部分之间不保证是同一时刻的状态（不会为了快照阻塞请求处理）
+type RelayState struct {
+	CapturedAt     time.Time                    `json:"capturedAt"`
+	RoundRobin     map[string]string            `json:"roundRobin"`     // key: "platform:level" -> 上次起始 provider
+	LastUsed       map[string]*LastUsedProvider `json:"lastUsed"`       // 各平台最后使用的 provider
+	Blacklist      []BlacklistStatus            `json:"blacklist"`      // 各平台的拉黑记录（含过期时间）
+	Inflight       int                          `json:"inflight"`       // 在途请求数
+	Draining       bool                         `json:"draining"`       // 是否正在优雅关闭
+	Coalescing     int                          `json:"coalescing"`     // 正在合并的相同请求组数
+	ResumableFlows int                          `json:"resumableFlows"` // 支持续传的进行中流式响应数
+	Errors         []string                     `json:"errors,omitempty"`
+}
+
+// snapshotPlatforms 快照时查询拉黑记录的基础平台，轮询记录中出现的自定义平台会追加在后
+var snapshotPlatforms = []string{"claude", "codex", "gemini"}
+
+// StateSnapshot 收集当前的路由状态：轮询位置、最后使用的 provider、拉黑记录与在途请求数
+// 内存状态只在各自的锁内复制，拉黑记录在锁外查询数据库；查询失败记入 Errors，不影响其余部分
+func (prs *ProviderRelayService) StateSnapshot() RelayState {
+	state := RelayState{CapturedAt: clockNow()}
+
+	prs.rrMu.Lock()
+	state.RoundRobin = maps.Clone(prs.rrLastStart)
+	prs.rrMu.Unlock()
+	if state.RoundRobin == nil {
+		state.RoundRobin = map[string]string{}
+	}
+
+	prs.lastUsedMu.RLock()
+	state.LastUsed = make(map[string]*LastUsedProvider, len(prs.lastUsed))
+	for platform, used := range prs.lastUsed {
+		if used != nil {
+			copied := *used
+			used = &copied
+		}
+		state.LastUsed[platform] = used
+	}
+	prs.lastUsedMu.RUnlock()
+
+	if prs.inflight != nil {
+		state.Inflight, state.Draining = prs.inflight.snapshot()
+	}
+	if prs.singleFlight != nil {
+		state.Coalescing = prs.singleFlight.Inflight()
+	}
+	if prs.streamResumer != nil {
+		state.ResumableFlows = prs.streamResumer.Inflight()
+	}
+
+	if prs.blacklistService != nil {
+		for _, platform := range platformsOf(state.RoundRobin) {
+			statuses, err := prs.blacklistService.GetBlacklistStatus(platform)
+			if err != nil {
+				state.Errors = append(state.Errors, fmt.Sprintf("%s 拉黑记录: %v", platform, err))
+				continue
+			}
+			state.Blacklist = append(state.Blacklist, statuses...)
+		}
+	}
+	return state
+}
+
+// platformsOf 返回基础平台与轮询 key（"platform:level"）中出现的其他平台
+func platformsOf(roundRobin map[string]string) []string {
+	platforms := slices.Clone(snapshotPlatforms)
+	var extra []string
+	for key := range roundRobin {
+		idx := strings.LastIndex(key, ":")
+		if idx <= 0 {
+			continue
+		}
+		if platform := key[:idx]; !slices.Contains(platforms, platform) && !slices.Contains(extra, platform) {
+			extra = append(extra, platform)
+		}
+	}
+	slices.Sort(extra)
+	return append(platforms, extra...)
+}
+
+// snapshot 返回在途请求数与是否正在排空
+func (t *inflightTracker) snapshot() (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count, t.draining
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProviderRelayService_StateSnapshot(t *testing.T) {
+	prs := NewProviderRelayService(nil, nil, nil, nil, nil, "")
+	prs.roundRobinOrder("claude", 1, []Provider{{Name: "a"}, {Name: "b"}})
+	prs.roundRobinOrder("custom:tool", 2, []Provider{{Name: "c"}, {Name: "d"}})
+	prs.setLastUsedProvider("claude", "a")
+	prs.inflight.enter()
+	defer prs.inflight.leave()
+
+	state := prs.StateSnapshot()
+	if state.RoundRobin["claude:1"] != "a" || state.RoundRobin["custom:tool:2"] != "c" {
+		t.Errorf("RoundRobin = %v", state.RoundRobin)
+	}
+	if state.LastUsed["claude"] == nil || state.LastUsed["claude"].ProviderName != "a" || state.LastUsed["codex"] != nil {
+		t.Errorf("LastUsed = %+v", state.LastUsed)
+	}
+	if state.Inflight != 1 || state.Draining {
+		t.Errorf("Inflight = %d, Draining = %v", state.Inflight, state.Draining)
+	}
+
+	// 快照与内部状态不共享内存
+	state.RoundRobin["claude:1"] = "x"
+	state.LastUsed["claude"].ProviderName = "x"
+	if again := prs.StateSnapshot(); again.RoundRobin["claude:1"] != "a" || again.LastUsed["claude"].ProviderName != "a" {
+		t.Error("修改快照不应影响内部状态")
+	}
+
+	if _, err := json.Marshal(state); err != nil {
+		t.Errorf("快照应可序列化: %v", err)
+	}
+	if got := platformsOf(state.RoundRobin); len(got) != 4 || got[3] != "custom:tool" {
+		t.Errorf("platformsOf() = %v", got)
+	}
+}
+
+func TestRoundRobinState_Snapshot(t *testing.T) {
+	clock := NewManualClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer SetClock(clock)()
+
+	rrs := NewRoundRobinState()
+	rrs.SetSuccessMode(StickyAfterSuccess, time.Minute)
+	id := func(s string) string { return s }
+	Reorder(rrs, PlatformClaude, 1, []string{"a", "b"}, id)
+	rrs.RecordSuccess("claude", 1, "b")
+
+	snap := rrs.Snapshot()
+	if snap.LastStart["claude:1"] != "a" || snap.Pinned["claude:1"].Provider != "b" {
+		t.Errorf("Snapshot() = %+v", snap)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if snap := rrs.Snapshot(); len(snap.Pinned) != 0 {
+		t.Errorf("过期的置顶不应出现在快照中: %+v", snap.Pinned)
+	}
+
+	// 与热路径并发读取不产生数据竞争（go test -race）
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); Reorder(rrs, PlatformClaude, 1, []string{"a", "b"}, id) }()
+		go func() { defer wg.Done(); _ = rrs.Snapshot() }()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Provider 成功率统计
+// ============================================================================
+
+// DefaultStatsWindowSize 默认每个 provider 保留的最近结果数
+const DefaultStatsWindowSize = 50
+
+// ProviderStats 按 provider 名称维护最近请求结果的滑动窗口
+// 窗口可按条数（windowSize）和/或时间（windowDuration）限制，两者同时设置时都生效
+type ProviderStats struct {
+	mu             sync.Mutex
+	windowSize     int
+	windowDuration time.Duration
+	outcomes       map[string][]statsOutcome
+}
+
+type statsOutcome struct {
+	at      time.Time
+	success bool
+}
+
+// NewProviderStats 创建成功率统计
+//   - windowSize: 每个 provider 保留的最近结果数，<= 0 时使用 DefaultStatsWindowSize
+//   - windowDuration: 结果的有效时长，<= 0 表示不按时间淘汰
+func NewProviderStats(windowSize int, windowDuration time.Duration) *ProviderStats {
+	if windowSize <= 0 {
+		windowSize = DefaultStatsWindowSize
+	}
+	return &ProviderStats{
+		windowSize:     windowSize,
+		windowDuration: windowDuration,
+		outcomes:       make(map[string][]statsOutcome),
+	}
+}
+
+// Record 记录一次请求结果
+func (ps *ProviderStats) Record(name string, success bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	now := clockNow()
+	window := append(ps.prune(ps.outcomes[name], now), statsOutcome{at: now, success: success})
+	if len(window) > ps.windowSize {
+		window = window[len(window)-ps.windowSize:]
+	}
+	ps.outcomes[name] = window
+}
+
+// SuccessRate 返回窗口内的成功率（0~1）；没有样本时返回 1，即未知 provider 按健康处理
+func (ps *ProviderStats) SuccessRate(name string) float64 {
+	rate, _ := ps.rate(name)
+	return rate
+}
+
+// Samples 返回窗口内的样本数
+func (ps *ProviderStats) Samples(name string) int {
+	_, n := ps.rate(name)
+	return n
+}
+
+func (ps *ProviderStats) rate(name string) (float64, int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	window := ps.prune(ps.outcomes[name], clockNow())
+	ps.outcomes[name] = window
+	if len(window) == 0 {
+		return 1, 0
+	}
+	success := 0
+	for _, o := range window {
+		if o.success {
+			success++
+		}
+	}
+	return float64(success) / float64(len(window)), len(window)
+}
+
+// prune 淘汰超出时间窗口的结果（调用方需持有锁）
+func (ps *ProviderStats) prune(window []statsOutcome, now time.Time) []statsOutcome {
+	if ps.windowDuration <= 0 {
+		return window
+	}
+	i := 0
+	for i < len(window) && now.Sub(window[i].at) > ps.windowDuration {
+		i++
+	}
+	return window[i:]
+}
+
+// ApplyMinSuccessRate 将成功率低于 minRate 的 Active providers 移入 Skipped
+// 样本数不足 minSamples 的 provider 不做判断；若全部 provider 都低于阈值则不做过滤，避免自行造成服务中断
+func (r *FilterResult[T]) ApplyMinSuccessRate(stats *ProviderStats, minRate float64, minSamples int) {
+	if stats == nil || minRate <= 0 {
+		return
+	}
+
+	kept := make([]T, 0, len(r.Active))
+	var skipped []SkipInfo
+	for _, p := range r.Active {
+		rate, n := stats.rate(p.GetName())
+		if n >= minSamples && rate < minRate {
+			skipped = append(skipped, SkipInfo{
+				Name:   p.GetName(),
+				Reason: SkipReasonLowSuccessRate,
+				Detail: fmt.Sprintf("%.0f%% < %.0f%%", rate*100, minRate*100),
+			})
+			continue
+		}
+		kept = append(kept, p)
+	}
+
+	if len(kept) == 0 {
+		return
+	}
+	r.Active = kept
+	for _, s := range skipped {
+		r.addSkip(s.Name, s.Reason, s.Detail)
+	}
+}
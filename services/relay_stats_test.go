@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProviderStats(t *testing.T) {
+	t.Run("按条数窗口", func(t *testing.T) {
+		ps := NewProviderStats(4, 0)
+		if rate := ps.SuccessRate("p"); rate != 1 {
+			t.Errorf("无样本成功率 = %v, 期望 1", rate)
+		}
+		for _, ok := range []bool{false, false, true, true, true, false} {
+			ps.Record("p", ok)
+		}
+		// 只保留最后 4 条: true true true false
+		if rate := ps.SuccessRate("p"); rate != 0.75 {
+			t.Errorf("成功率 = %v, 期望 0.75", rate)
+		}
+		if n := ps.Samples("p"); n != 4 {
+			t.Errorf("样本数 = %d, 期望 4", n)
+		}
+	})
+
+	t.Run("按时间窗口", func(t *testing.T) {
+		clk := NewManualClock(time.Unix(1700000000, 0))
+		defer SetClock(clk)()
+
+		ps := NewProviderStats(10, 20*time.Second)
+		ps.Record("p", false)
+		clk.Advance(30 * time.Second)
+		ps.Record("p", true)
+		if rate := ps.SuccessRate("p"); rate != 1 {
+			t.Errorf("过期结果应被淘汰，成功率 = %v", rate)
+		}
+	})
+}
+
+func TestFilterResult_ApplyMinSuccessRate(t *testing.T) {
+	ps := NewProviderStats(10, 0)
+	for i := 0; i < 5; i++ {
+		ps.Record("bad", false)
+		ps.Record("good", true)
+	}
+	ps.Record("new", false) // 样本不足
+
+	result := FilterResult[Provider]{Active: []Provider{{Name: "bad"}, {Name: "good"}, {Name: "new"}}}
+	result.ApplyMinSuccessRate(ps, 0.5, 3)
+
+	if len(result.Active) != 2 || result.Active[0].Name != "good" || result.Active[1].Name != "new" {
+		t.Errorf("Active = %v", result.Active)
+	}
+	if result.SkippedCount != 1 || result.Skipped[0].Reason != SkipReasonLowSuccessRate {
+		t.Errorf("Skipped = %v", result.Skipped)
+	}
+
+	allBad := FilterResult[Provider]{Active: []Provider{{Name: "bad"}}}
+	allBad.ApplyMinSuccessRate(ps, 0.5, 3)
+	if len(allBad.Active) != 1 {
+		t.Error("全部低于阈值时不应过滤")
+	}
+}
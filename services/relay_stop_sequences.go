@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// stopSequenceKeys 各格式的停止序列字段路径
+var stopSequenceKeys = map[Format]string{
+	FormatOpenAI: "stop",
+	FormatClaude: "stop_sequences",
+	FormatGemini: "generationConfig.stopSequences",
+}
+
+// NormalizeStopSequences 将请求体中的停止序列统一写到目标格式对应的字段
+//   - OpenAI: stop（字符串或数组）
+//   - Claude: stop_sequences（数组）
+//   - Gemini: generationConfig.stopSequences（数组）
+//
+// 优先读取目标格式自身的字段，其次按 OpenAI/Claude/Gemini 顺序读取；其他格式的字段会被删除
+// 请求中没有任何停止序列时原样返回
+func NormalizeStopSequences(bodyBytes []byte, targetFormat Format) ([]byte, error) {
+	targetKey, ok := stopSequenceKeys[targetFormat]
+	if !ok {
+		return bodyBytes, fmt.Errorf("不支持的格式: %q", targetFormat)
+	}
+
+	var sequences []string
+	found := false
+	for _, format := range []Format{targetFormat, FormatOpenAI, FormatClaude, FormatGemini} {
+		value := gjson.GetBytes(bodyBytes, stopSequenceKeys[format])
+		if !value.Exists() {
+			continue
+		}
+		found = true
+		sequences = stopSequencesFrom(value)
+		break
+	}
+	if !found {
+		return bodyBytes, nil
+	}
+
+	result := bodyBytes
+	var err error
+	for format, key := range stopSequenceKeys {
+		if format == targetFormat || !gjson.GetBytes(result, key).Exists() {
+			continue
+		}
+		if result, err = sjson.DeleteBytes(result, key); err != nil {
+			return bodyBytes, fmt.Errorf("删除 %s 失败: %w", key, err)
+		}
+	}
+
+	if len(sequences) == 0 {
+		// 空停止序列等同于未设置，删除目标字段避免上游拒绝空数组
+		if gjson.GetBytes(result, targetKey).Exists() {
+			if result, err = sjson.DeleteBytes(result, targetKey); err != nil {
+				return bodyBytes, fmt.Errorf("删除 %s 失败: %w", targetKey, err)
+			}
+		}
+		return result, nil
+	}
+
+	if result, err = sjson.SetBytes(result, targetKey, sequences); err != nil {
+		return bodyBytes, fmt.Errorf("设置 %s 失败: %w", targetKey, err)
+	}
+	return result, nil
+}
+
+// stopSequencesFrom 读取字符串或字符串数组形式的停止序列，忽略空字符串
+func stopSequencesFrom(value gjson.Result) []string {
+	var sequences []string
+	if value.IsArray() {
+		for _, item := range value.Array() {
+			if s := item.String(); s != "" {
+				sequences = append(sequences, s)
+			}
+		}
+		return sequences
+	}
+	if s := value.String(); value.Type == gjson.String && s != "" {
+		sequences = append(sequences, s)
+	}
+	return sequences
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestNormalizeStopSequences(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		target  Format
+		wantKey string
+		want    []string
+		gone    []string
+	}{
+		{"OpenAI 字符串 -> Claude", `{"stop":"END"}`, FormatClaude, "stop_sequences", []string{"END"}, []string{"stop"}},
+		{"OpenAI 数组 -> Gemini", `{"stop":["a","b"]}`, FormatGemini, "generationConfig.stopSequences", []string{"a", "b"}, []string{"stop"}},
+		{"Claude -> OpenAI", `{"stop_sequences":["x"]}`, FormatOpenAI, "stop", []string{"x"}, []string{"stop_sequences"}},
+		{"Gemini -> Claude", `{"generationConfig":{"stopSequences":["y"],"temperature":1}}`, FormatClaude, "stop_sequences", []string{"y"}, []string{"generationConfig.stopSequences"}},
+		{"目标字段优先", `{"stop":"a","stop_sequences":["b"]}`, FormatClaude, "stop_sequences", []string{"b"}, []string{"stop"}},
+		{"空停止序列", `{"stop":""}`, FormatClaude, "stop_sequences", nil, []string{"stop", "stop_sequences"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := NormalizeStopSequences([]byte(tt.body), tt.target)
+			if err != nil {
+				t.Fatalf("NormalizeStopSequences() error = %v", err)
+			}
+			got := gjson.GetBytes(out, tt.wantKey).Array()
+			if len(got) != len(tt.want) {
+				t.Fatalf("%s = %s, 期望 %v", tt.wantKey, gjson.GetBytes(out, tt.wantKey).Raw, tt.want)
+			}
+			for i := range tt.want {
+				if got[i].String() != tt.want[i] {
+					t.Errorf("%s[%d] = %s, 期望 %s", tt.wantKey, i, got[i].String(), tt.want[i])
+				}
+			}
+			for _, key := range tt.gone {
+				if gjson.GetBytes(out, key).Exists() {
+					t.Errorf("%s 应被删除: %s", key, out)
+				}
+			}
+		})
+	}
+
+	if out, _ := NormalizeStopSequences([]byte(`{"model":"m"}`), FormatClaude); string(out) != `{"model":"m"}` {
+		t.Errorf("无停止序列时应原样返回: %s", out)
+	}
+	if _, err := NormalizeStopSequences([]byte(`{}`), "unknown"); err == nil {
+		t.Error("未知格式应返回错误")
+	}
+}
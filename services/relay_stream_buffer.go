@@ -0,0 +1,177 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============================================================================
+// 短流缓冲与故障转移（StreamBuffer）
+// ============================================================================
+
+// DefaultStreamBufferBytes 缓冲的字节上限：token 估算偏低时（如大量工具调用参数）避免无限缓冲
+const DefaultStreamBufferBytes = 1024 * 1024
+
+// ErrStreamIncomplete 上游流在输出完成前出错或断开，且仍在缓冲阈值内（尚未向客户端写入任何内容）
+var ErrStreamIncomplete = errors.New("upstream stream failed before completion")
+
+var streamBufferTokens atomic.Int64
+
+// SetStreamBufferTokens 开启短流缓冲：输出不超过 maxTokens 的流式响应先完整缓冲，
+// 完成前出错则丢弃已收到的部分并切换到下一个 provider 从头重新请求；超过阈值后不再缓冲，继续使用当前 provider
+// maxTokens <= 0 关闭（默认），以首字延迟换取短回答的完整性
+func SetStreamBufferTokens(maxTokens int) {
+	if maxTokens < 0 {
+		maxTokens = 0
+	}
+	streamBufferTokens.Store(int64(maxTokens))
+}
+
+// CurrentStreamBuffer 返回按当前配置构造的 StreamBuffer
+func CurrentStreamBuffer() StreamBuffer {
+	return StreamBuffer{
+		MaxTokens: int(streamBufferTokens.Load()),
+		MaxBytes:  DefaultStreamBufferBytes,
+	}
+}
+
+// StreamBuffer 在向客户端转发前缓冲上游 SSE 流，直到流完成或输出 token 数超过 MaxTokens：
+//   - 流完成（message_stop、[DONE]、response.completed、finish_reason 等）：返回完整的缓冲数据
+//   - 完成前出现 error 事件、读取失败或上游提前结束：关闭上游并返回 ErrStreamIncomplete，由调用方故障转移
+//   - 输出超过 MaxTokens 或缓冲超过 MaxBytes：停止缓冲，已缓冲的数据原样放回流的开头，此后的错误不再故障转移
+//
+// 与 StreamGuard 的区别：StreamGuard 只检查内容之前的错误，StreamBuffer 覆盖短回答的整个生命周期
+type StreamBuffer struct {
+	MaxTokens int // 输出 token 估算值上限（见 EstimateInputTokens 的计数规则），<= 0 表示不缓冲
+	MaxBytes  int // 缓冲字节上限，<= 0 表示不限
+}
+
+// Enabled 是否需要缓冲
+func (b StreamBuffer) Enabled() bool {
+	return b.MaxTokens > 0
+}
+
+// Buffer 缓冲上游流并返回供转发的流；返回错误时 body 已关闭
+func (b StreamBuffer) Buffer(body io.ReadCloser) (io.ReadCloser, error) {
+	if !b.Enabled() || body == nil {
+		return body, nil
+	}
+
+	var buf []byte
+	var est tokenEstimator
+	chunk := make([]byte, 4096)
+	scanned := 0
+	fail := func(format string, args ...any) (io.ReadCloser, error) {
+		_ = body.Close()
+		return nil, fmt.Errorf("%w: "+format, append([]any{ErrStreamIncomplete}, args...)...)
+	}
+	for {
+		for {
+			end, sepLen := sseEventEnd(buf[scanned:])
+			if end < 0 {
+				break
+			}
+			event := buf[scanned : scanned+end]
+			scanned += end + sepLen
+			if kind, detail := classifySSEEvent(event); kind == sseEventError {
+				return fail("%s", detail)
+			}
+			if sseEventDone(event) {
+				return replayStream(buf, body), nil
+			}
+			est.count(sseDeltaText(event))
+			if est.tokens() > b.MaxTokens {
+				return replayStream(buf, body), nil
+			}
+		}
+		if b.MaxBytes > 0 && len(buf) >= b.MaxBytes {
+			return replayStream(buf, body), nil
+		}
+
+		n, err := body.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if err == nil {
+			continue
+		}
+		if err != io.EOF {
+			return fail("%v", err)
+		}
+		// 上游已结束：末尾未以空行结束的事件同样检查
+		if tail := bytes.TrimSpace(buf[scanned:]); len(tail) > 0 {
+			if kind, detail := classifySSEEvent(tail); kind == sseEventError {
+				return fail("%s", detail)
+			}
+			if sseEventDone(tail) {
+				return &guardedStream{Reader: bytes.NewReader(buf), Closer: body}, nil
+			}
+		}
+		return fail("stream ended without completion event (%d bytes)", len(buf))
+	}
+}
+
+// sseEventDone 事件是否表示输出已完成
+// Anthropic: message_stop；OpenAI: [DONE] 或 finish_reason；Responses: response.completed；Gemini: finishReason
+func sseEventDone(event []byte) bool {
+	name, payload := sseEventPayload(event)
+	if payload == "[DONE]" || name == "message_stop" {
+		return true
+	}
+	switch gjson.Get(payload, "type").String() {
+	case "message_stop", "response.completed":
+		return true
+	}
+	for _, choice := range gjson.Get(payload, "choices").Array() {
+		if choice.Get("finish_reason").String() != "" {
+			return true
+		}
+	}
+	for _, candidate := range gjson.Get(payload, "candidates").Array() {
+		if candidate.Get("finishReason").String() != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// sseDeltaText 提取事件中新增的输出文本（正文、思考、工具调用参数），用于估算已输出的 token 数
+func sseDeltaText(event []byte) string {
+	_, payload := sseEventPayload(event)
+	if payload == "" || !gjson.Valid(payload) {
+		return ""
+	}
+	root := gjson.Parse(payload)
+
+	var sb strings.Builder
+	for _, path := range []string{
+		"delta.text", "delta.thinking", "delta.partial_json", // Anthropic
+		"choices.#.delta.content", "choices.#.delta.reasoning_content", "choices.#.delta.tool_calls.#.function.arguments", // OpenAI
+		"candidates.#.content.parts.#.text", // Gemini
+	} {
+		appendStrings(&sb, root.Get(path))
+	}
+	// Responses API 的 *.delta 事件，delta 为字符串
+	if strings.HasSuffix(root.Get("type").String(), ".delta") {
+		if delta := root.Get("delta"); delta.Type == gjson.String {
+			sb.WriteString(delta.String())
+		}
+	}
+	return sb.String()
+}
+
+// appendStrings 递归写入结果中的所有字符串（# 查询返回嵌套数组）
+func appendStrings(sb *strings.Builder, value gjson.Result) {
+	switch {
+	case value.IsArray():
+		for _, item := range value.Array() {
+			appendStrings(sb, item)
+		}
+	case value.Type == gjson.String:
+		sb.WriteString(value.String())
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStreamBuffer_Buffer(t *testing.T) {
+	errReset := errors.New("connection reset")
+	buffer := StreamBuffer{MaxTokens: 5, MaxBytes: 4096}
+
+	delta := func(text string) string {
+		return "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"" + text + "\"}}\n\n"
+	}
+	start := "event: message_start\ndata: {\"type\":\"message_start\"}\n\n"
+	stop := "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+
+	tests := []struct {
+		name    string
+		body    string
+		readErr error // 非 nil 时上游输出 body 后返回该错误
+		wantErr bool
+	}{
+		{"短回答完整结束", start + delta("hi") + stop, nil, false},
+		{"短回答中途出现 error 事件", start + delta("hi") + "event: error\ndata: {\"type\":\"error\",\"error\":{\"message\":\"Overloaded\"}}\n\n", nil, true},
+		{"短回答中途断开", start + delta("hi"), errReset, true},
+		{"未收到结束事件就 EOF", start + delta("hi"), nil, true},
+		{"超过阈值后提交当前 provider", start + delta("aaaaaaaaaaaa") + delta("bbbbbbbbbbbb") + "event: error\ndata: {\"type\":\"error\"}\n\n", nil, false},
+		{"OpenAI [DONE]", "data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\ndata: [DONE]", nil, false},
+		{"OpenAI finish_reason 后断开", "data: {\"choices\":[{\"delta\":{\"content\":\"a\"},\"finish_reason\":\"stop\"}]}\n\n", errReset, false},
+		{"Gemini finishReason", "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"a\"}]},\"finishReason\":\"STOP\"}]}\n\n", nil, false},
+		{"Responses 完成事件", "data: {\"type\":\"response.output_text.delta\",\"delta\":\"a\"}\n\ndata: {\"type\":\"response.completed\"}\n\n", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var src io.Reader = strings.NewReader(tt.body)
+			if tt.readErr != nil {
+				src = &brokenReader{r: src, err: tt.readErr}
+			}
+			upstream := &closeRecorder{Reader: src}
+
+			stream, err := buffer.Buffer(upstream)
+			if tt.wantErr {
+				if !errors.Is(err, ErrStreamIncomplete) {
+					t.Fatalf("Buffer() error = %v, want ErrStreamIncomplete", err)
+				}
+				if !upstream.closed {
+					t.Error("出错时应关闭上游")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Buffer() error = %v", err)
+			}
+			out, _ := io.ReadAll(stream)
+			if string(out) != tt.body {
+				t.Errorf("输出 = %q; 缓冲的数据应原样放回流中", out)
+			}
+			_ = stream.Close()
+			if !upstream.closed {
+				t.Error("Close 应关闭上游")
+			}
+		})
+	}
+}
+
+func TestStreamBuffer_Disabled(t *testing.T) {
+	if CurrentStreamBuffer().Enabled() {
+		t.Fatal("默认应关闭")
+	}
+	defer SetStreamBufferTokens(0)
+	SetStreamBufferTokens(100)
+	if got := CurrentStreamBuffer(); !got.Enabled() || got.MaxTokens != 100 {
+		t.Errorf("CurrentStreamBuffer() = %+v", got)
+	}
+
+	upstream := &closeRecorder{Reader: strings.NewReader("event: error\ndata: {}\n\n")}
+	stream, err := StreamBuffer{}.Buffer(upstream)
+	if err != nil || stream != upstream {
+		t.Errorf("关闭时应原样返回上游: %v", err)
+	}
+}
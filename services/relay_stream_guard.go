@@ -0,0 +1,205 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============================================================================
+// 流式响应首部错误检测（StreamGuard）
+// ============================================================================
+
+const (
+	// DefaultStreamGuardEvents 默认最多预读的事件数
+	DefaultStreamGuardEvents = 8
+	// DefaultStreamGuardBytes 默认最多预读的字节数
+	DefaultStreamGuardBytes = 32 * 1024
+)
+
+// ErrStreamErrorBeforeContent 上游返回 2xx 后，在任何内容之前发送了 error 事件
+// 此时尚未向客户端写入任何内容，调用方可以安全地切换到下一个 provider
+var ErrStreamErrorBeforeContent = errors.New("upstream stream error before content")
+
+var (
+	streamGuardEvents atomic.Int64
+	streamGuardBytes  atomic.Int64
+)
+
+func init() {
+	streamGuardEvents.Store(DefaultStreamGuardEvents)
+	streamGuardBytes.Store(DefaultStreamGuardBytes)
+}
+
+// SetStreamGuardWindow 设置流式响应的预读窗口：最多 maxEvents 个事件、maxBytes 字节
+// maxEvents <= 0 关闭预读（直接转发上游流，与旧行为一致）；maxBytes <= 0 表示不限字节数
+func SetStreamGuardWindow(maxEvents, maxBytes int) {
+	if maxEvents < 0 {
+		maxEvents = 0
+	}
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	streamGuardEvents.Store(int64(maxEvents))
+	streamGuardBytes.Store(int64(maxBytes))
+}
+
+// CurrentStreamGuard 返回按当前配置构造的 StreamGuard
+func CurrentStreamGuard() StreamGuard {
+	return StreamGuard{
+		MaxEvents: int(streamGuardEvents.Load()),
+		MaxBytes:  int(streamGuardBytes.Load()),
+	}
+}
+
+// StreamGuard 在向客户端转发前预读上游 SSE 流的前几个事件：
+//   - 内容之前出现 error 事件：关闭上游并返回 ErrStreamErrorBeforeContent，由调用方故障转移
+//   - 出现内容事件、超出预读窗口或上游结束：停止检查，已预读的数据原样放回流的开头
+//
+// 一旦开始转发就不再检查，内容已发出后的错误不会触发故障转移
+type StreamGuard struct {
+	MaxEvents int // 最多预读的事件数，<= 0 表示不预读
+	MaxBytes  int // 最多预读的字节数，<= 0 表示不限
+}
+
+// Enabled 是否需要预读
+func (g StreamGuard) Enabled() bool {
+	return g.MaxEvents > 0
+}
+
+// Peek 预读上游流并返回供转发的流；检测到首部错误时返回 ErrStreamErrorBeforeContent，
+// 上游在内容之前读取失败时返回该错误，两种情况下 body 均已关闭
+func (g StreamGuard) Peek(body io.ReadCloser) (io.ReadCloser, error) {
+	if !g.Enabled() || body == nil {
+		return body, nil
+	}
+
+	var buf []byte
+	chunk := make([]byte, 4096)
+	scanned, events := 0, 0
+	for {
+		for {
+			end, sepLen := sseEventEnd(buf[scanned:])
+			if end < 0 {
+				break
+			}
+			event := buf[scanned : scanned+end]
+			scanned += end + sepLen
+			events++
+			switch kind, detail := classifySSEEvent(event); kind {
+			case sseEventError:
+				_ = body.Close()
+				return nil, fmt.Errorf("%w: %s", ErrStreamErrorBeforeContent, detail)
+			case sseEventContent:
+				return replayStream(buf, body), nil
+			}
+			if events >= g.MaxEvents {
+				return replayStream(buf, body), nil
+			}
+		}
+		if g.MaxBytes > 0 && len(buf) >= g.MaxBytes {
+			return replayStream(buf, body), nil
+		}
+
+		n, err := body.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if err == nil {
+			continue
+		}
+		if err != io.EOF {
+			_ = body.Close()
+			return nil, err
+		}
+		// 上游已结束：末尾未以空行结束的事件同样检查
+		if tail := bytes.TrimSpace(buf[scanned:]); len(tail) > 0 {
+			if kind, detail := classifySSEEvent(tail); kind == sseEventError {
+				_ = body.Close()
+				return nil, fmt.Errorf("%w: %s", ErrStreamErrorBeforeContent, detail)
+			}
+		}
+		return &guardedStream{Reader: bytes.NewReader(buf), Closer: body}, nil
+	}
+}
+
+// guardedStream 先输出已预读的数据，再继续读取上游
+type guardedStream struct {
+	io.Reader
+	io.Closer
+}
+
+func replayStream(buf []byte, body io.ReadCloser) io.ReadCloser {
+	return &guardedStream{Reader: io.MultiReader(bytes.NewReader(buf), body), Closer: body}
+}
+
+type sseEventKind int
+
+const (
+	sseEventPreamble sseEventKind = iota // 无内容的前导事件（message_start、ping、仅含 role 的 chunk 等）
+	sseEventContent                      // 携带内容或表示流结束
+	sseEventError                        // 错误事件
+)
+
+// sseEventPayload 提取 SSE 事件的事件名与 data 内容（多行 data 以换行连接）
+func sseEventPayload(event []byte) (string, string) {
+	var name string
+	var data []string
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if value, ok := bytes.CutPrefix(line, []byte("event:")); ok {
+			name = strings.TrimSpace(string(value))
+		} else if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			data = append(data, strings.TrimPrefix(string(value), " "))
+		}
+	}
+	return name, strings.TrimSpace(strings.Join(data, "\n"))
+}
+
+// classifySSEEvent 判断一个 SSE 事件的类型，error 类型同时返回错误描述
+// 兼容 Anthropic（event: error / type=error）、OpenAI（data 中的 error 对象）与 Gemini（candidates）的格式
+func classifySSEEvent(event []byte) (sseEventKind, string) {
+	name, payload := sseEventPayload(event)
+
+	if payload == "[DONE]" {
+		return sseEventContent, ""
+	}
+	if name == "error" || gjson.Get(payload, "type").String() == "error" || isErrorValue(gjson.Get(payload, "error")) {
+		detail := payload
+		for _, path := range []string{"error.message", "message", "error"} {
+			if msg := gjson.Get(payload, path); msg.Exists() && msg.Type == gjson.String {
+				detail = msg.String()
+				break
+			}
+		}
+		return sseEventError, detail
+	}
+	if payload == "" || !gjson.Valid(payload) {
+		return sseEventPreamble, ""
+	}
+
+	eventType := gjson.Get(payload, "type").String()
+	switch {
+	case eventType == "content_block_delta", strings.HasSuffix(eventType, ".delta"):
+		return sseEventContent, ""
+	case gjson.Get(payload, "candidates").Exists():
+		return sseEventContent, ""
+	}
+	for _, choice := range gjson.Get(payload, "choices").Array() {
+		delta := choice.Get("delta")
+		if delta.Get("content").String() != "" || delta.Get("reasoning_content").String() != "" ||
+			delta.Get("tool_calls").Exists() || choice.Get("finish_reason").String() != "" {
+			return sseEventContent, ""
+		}
+	}
+	return sseEventPreamble, ""
+}
+
+// isErrorValue error 字段是否表示错误：对象或非空字符串
+// 部分 OpenAI 兼容中转在正常 chunk 中也带 "error":null，不能仅按字段存在判断
+func isErrorValue(v gjson.Result) bool {
+	return v.IsObject() || (v.Type == gjson.String && v.Str != "")
+}
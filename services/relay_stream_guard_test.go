@@ -0,0 +1,95 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// closeRecorder 记录 Close 是否被调用
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestStreamGuard_Peek(t *testing.T) {
+	errReset := errors.New("connection reset")
+	guard := StreamGuard{MaxEvents: 4, MaxBytes: 1024}
+
+	tests := []struct {
+		name    string
+		body    string
+		readErr error // 非 nil 时上游输出 body 后返回该错误
+		wantErr error
+	}{
+		{"Anthropic 内容前的 error 事件",
+			"event: message_start\ndata: {\"type\":\"message_start\"}\n\nevent: error\ndata: {\"type\":\"error\",\"error\":{\"message\":\"Overloaded\"}}\n\n",
+			nil, ErrStreamErrorBeforeContent},
+		{"OpenAI 仅含 role 的 chunk 后出错",
+			"data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\ndata: {\"error\":{\"message\":\"rate limited\"}}\n\n",
+			nil, ErrStreamErrorBeforeContent},
+		{"未以空行结束的错误事件", "data: {\"error\":{\"message\":\"boom\"}}", nil, ErrStreamErrorBeforeContent},
+		{"内容之前读取失败", "event: ping\ndata: {}\n\n", errReset, errReset},
+		{"内容之后的错误不拦截",
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"hi\"}}\n\nevent: error\ndata: {\"type\":\"error\"}\n\n",
+			nil, nil},
+		{"超出预读窗口后不再检查",
+			strings.Repeat("event: ping\ndata: {\"type\":\"ping\"}\n\n", 4) + "event: error\ndata: {\"type\":\"error\"}\n\n",
+			nil, nil},
+		{"Gemini 内容", "data: {\"candidates\":[{\"content\":{}}]}\n\ndata: {\"error\":{}}\n\n", nil, nil},
+		{"OpenAI 兼容中转的 error:null 不是错误",
+			"data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}],\"error\":null}\n\ndata: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}],\"error\":\"\"}\n\n",
+			nil, nil},
+		{"正常结束", "data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\ndata: [DONE]\n\n", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var src io.Reader = strings.NewReader(tt.body)
+			if tt.readErr != nil {
+				src = &brokenReader{r: src, err: tt.readErr}
+			}
+			upstream := &closeRecorder{Reader: src}
+
+			stream, err := guard.Peek(upstream)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Peek() error = %v, want %v", err, tt.wantErr)
+				}
+				if !upstream.closed {
+					t.Error("出错时应关闭上游")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Peek() error = %v", err)
+			}
+			out, err := io.ReadAll(stream)
+			if err != nil || string(out) != tt.body {
+				t.Errorf("输出 = %q, %v; 预读的数据应原样放回流中", out, err)
+			}
+			_ = stream.Close()
+			if !upstream.closed {
+				t.Error("Close 应关闭上游")
+			}
+		})
+	}
+}
+
+func TestStreamGuard_Disabled(t *testing.T) {
+	defer SetStreamGuardWindow(DefaultStreamGuardEvents, DefaultStreamGuardBytes)
+	SetStreamGuardWindow(0, 0)
+	if CurrentStreamGuard().Enabled() {
+		t.Fatal("maxEvents 为 0 时应关闭")
+	}
+	upstream := &closeRecorder{Reader: strings.NewReader("event: error\ndata: {}\n\n")}
+	stream, err := CurrentStreamGuard().Peek(upstream)
+	if err != nil || stream != upstream {
+		t.Errorf("关闭时应原样返回上游: %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ============================================================================
+// 流式响应断线续传（Last-Event-ID）
+// ============================================================================
+
+// LastEventIDHeader SSE 续传请求头
+const LastEventIDHeader = "Last-Event-ID"
+
+// DefaultMaxStreamResumes 单个流最多续传次数
+const DefaultMaxStreamResumes = 3
+
+// ErrNotResumable 流尚未转发过带 id 的事件，无法续传（调用方应按原逻辑故障转移）
+var ErrNotResumable = errors.New("stream not resumable: no event id forwarded")
+
+// StreamResumer 记录每个进行中请求最后转发的 SSE 事件 ID，并在上游中途断开时构造续传请求
+// 仅对 Provider.ResumableStream 为 true 的上游使用；其余上游断开时仍按原逻辑故障转移
+type StreamResumer struct {
+	mu      sync.Mutex
+	lastIDs map[string]string // key: 请求 ID -> value: 最后转发的事件 ID
+}
+
+// NewStreamResumer 创建续传记录器
+func NewStreamResumer() *StreamResumer {
+	return &StreamResumer{lastIDs: make(map[string]string)}
+}
+
+// LastEventID 返回请求最后转发的事件 ID，未转发过带 id 的事件时返回空串
+func (sr *StreamResumer) LastEventID(requestID string) string {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.lastIDs[requestID]
+}
+
+// Inflight 返回正在跟踪的请求数
+func (sr *StreamResumer) Inflight() int {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return len(sr.lastIDs)
+}
+
+// Forget 请求结束后清理记录
+func (sr *StreamResumer) Forget(requestID string) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	delete(sr.lastIDs, requestID)
+}
+
+func (sr *StreamResumer) track(requestID string) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if _, ok := sr.lastIDs[requestID]; !ok {
+		sr.lastIDs[requestID] = ""
+	}
+}
+
+func (sr *StreamResumer) record(requestID, eventID string) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.lastIDs[requestID] = eventID
+}
+
+// ReconnectRequest 基于原请求构造续传请求：复制请求并设置 Last-Event-ID
+// 原请求需支持 GetBody（http.NewRequest 传入 bytes.Reader 等时自动设置）以便重放请求体
+func (sr *StreamResumer) ReconnectRequest(requestID string, req *http.Request) (*http.Request, error) {
+	lastID := sr.LastEventID(requestID)
+	if lastID == "" {
+		return nil, ErrNotResumable
+	}
+	clone := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("请求体无法重放")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("重放请求体失败: %w", err)
+		}
+		clone.Body = body
+	}
+	clone.Header.Set(LastEventIDHeader, lastID)
+	return clone, nil
+}
+
+// Wrap 包装上游 SSE 响应体：只向下游输出完整的事件，并记录每个事件的 id
+// 上游中途出错（非 EOF）且已转发过带 id 的事件时，调用 reconnect(lastEventID) 获取新的响应体继续读取，
+// 最多续传 maxResumes 次（<= 0 使用 DefaultMaxStreamResumes）；无法续传时返回原错误，调用方按原逻辑处理
+// 断开时未完整到达的事件会被丢弃，由续传后的上游从 lastEventID 之后重新发送，下游不会收到半个事件
+// Close 时关闭当前上游并清理记录
+func (sr *StreamResumer) Wrap(
+	requestID string,
+	body io.ReadCloser,
+	reconnect func(lastEventID string) (io.ReadCloser, error),
+	maxResumes int,
+) io.ReadCloser {
+	if maxResumes <= 0 {
+		maxResumes = DefaultMaxStreamResumes
+	}
+	sr.track(requestID)
+	return &resumableStream{
+		sr:         sr,
+		requestID:  requestID,
+		src:        body,
+		reconnect:  reconnect,
+		maxResumes: maxResumes,
+		buf:        make([]byte, 8192),
+	}
+}
+
+type resumableStream struct {
+	sr         *StreamResumer
+	requestID  string
+	src        io.ReadCloser
+	reconnect  func(lastEventID string) (io.ReadCloser, error)
+	maxResumes int
+	resumes    int
+
+	buf     []byte
+	partial []byte // 尚未以空行结束的事件
+	pending []byte // 已完整、待输出的事件
+	err     error  // 上游结束（EOF 或不可续传的错误），pending 输出完后返回
+}
+
+func (rs *resumableStream) Read(p []byte) (int, error) {
+	for len(rs.pending) == 0 {
+		if rs.err != nil {
+			return 0, rs.err
+		}
+		rs.fill()
+	}
+	n := copy(p, rs.pending)
+	rs.pending = rs.pending[n:]
+	return n, nil
+}
+
+// fill 从上游读取一次，把完整的事件移入 pending
+func (rs *resumableStream) fill() {
+	n, err := rs.src.Read(rs.buf)
+	if n > 0 {
+		rs.partial = append(rs.partial, rs.buf[:n]...)
+		rs.takeCompleteEvents()
+	}
+	if err == nil {
+		return
+	}
+	if err == io.EOF {
+		// 上游正常结束：末尾不完整的事件原样输出
+		rs.pending = append(rs.pending, rs.partial...)
+		rs.partial = nil
+		rs.err = io.EOF
+		return
+	}
+	if !rs.resume() {
+		rs.err = err
+	}
+}
+
+// resume 尝试续传，成功时替换上游并丢弃未完整到达的事件
+func (rs *resumableStream) resume() bool {
+	if rs.reconnect == nil || rs.resumes >= rs.maxResumes {
+		return false
+	}
+	lastID := rs.sr.LastEventID(rs.requestID)
+	if lastID == "" {
+		return false
+	}
+	next, err := rs.reconnect(lastID)
+	if err != nil {
+		fmt.Printf("[WARN] 流续传失败（Last-Event-ID=%s）: %v\n", lastID, err)
+		return false
+	}
+	_ = rs.src.Close()
+	rs.src = next
+	rs.partial = nil
+	rs.resumes++
+	fmt.Printf("[INFO] 上游流中途断开，已从 Last-Event-ID=%s 续传（第 %d 次）\n", lastID, rs.resumes)
+	return true
+}
+
+// takeCompleteEvents 将 partial 中以空行结束的事件移入 pending，并记录事件 id
+func (rs *resumableStream) takeCompleteEvents() {
+	for {
+		end, sepLen := sseEventEnd(rs.partial)
+		if end < 0 {
+			return
+		}
+		event := rs.partial[:end+sepLen]
+		if id, ok := sseEventID(event); ok {
+			rs.sr.record(rs.requestID, id)
+		}
+		rs.pending = append(rs.pending, event...)
+		rs.partial = rs.partial[end+sepLen:]
+	}
+}
+
+func (rs *resumableStream) Close() error {
+	rs.sr.Forget(rs.requestID)
+	return rs.src.Close()
+}
+
+// sseEventEnd 返回第一个事件结束空行的位置与分隔符长度，未找到时返回 -1
+func sseEventEnd(data []byte) (int, int) {
+	lf := bytes.Index(data, []byte("\n\n"))
+	crlf := bytes.Index(data, []byte("\r\n\r\n"))
+	switch {
+	case crlf >= 0 && (lf < 0 || crlf < lf):
+		return crlf, 4
+	case lf >= 0:
+		return lf, 2
+	default:
+		return -1, 0
+	}
+}
+
+// sseEventID 提取事件中的 id 字段（最后一个 id 行生效），不存在时返回 false
+func sseEventID(event []byte) (string, bool) {
+	id, found := "", false
+	for _, line := range bytes.Split(event, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		value, ok := bytes.CutPrefix(line, []byte("id:"))
+		if !ok {
+			continue
+		}
+		id, found = string(bytes.TrimPrefix(value, []byte(" "))), true
+	}
+	return id, found && id != ""
+}
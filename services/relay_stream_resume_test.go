@@ -0,0 +1,129 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// brokenReader 输出 data 后返回 err（模拟上游中途断开）
+type brokenReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		return n, b.err
+	}
+	return n, err
+}
+
+func (b *brokenReader) Close() error { return nil }
+
+func TestStreamResumer_Wrap(t *testing.T) {
+	errReset := errors.New("connection reset")
+
+	t.Run("断开后带 Last-Event-ID 续传且丢弃半个事件", func(t *testing.T) {
+		sr := NewStreamResumer()
+		first := &brokenReader{
+			r:   strings.NewReader("id: 1\ndata: a\n\nid: 2\ndata: b\n\nid: 3\ndata: par"),
+			err: errReset,
+		}
+		var gotLastID string
+		body := sr.Wrap("req-1", first, func(lastEventID string) (io.ReadCloser, error) {
+			gotLastID = lastEventID
+			return io.NopCloser(strings.NewReader("id: 3\ndata: c\n\n")), nil
+		}, 0)
+
+		out, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+		want := "id: 1\ndata: a\n\nid: 2\ndata: b\n\nid: 3\ndata: c\n\n"
+		if string(out) != want {
+			t.Errorf("输出 = %q, want %q", out, want)
+		}
+		if gotLastID != "2" {
+			t.Errorf("Last-Event-ID = %q, want 2", gotLastID)
+		}
+		if sr.LastEventID("req-1") != "3" {
+			t.Errorf("LastEventID() = %q, want 3", sr.LastEventID("req-1"))
+		}
+		_ = body.Close()
+		if sr.Inflight() != 0 {
+			t.Error("Close 后应清理记录")
+		}
+	})
+
+	t.Run("未转发过 id 时返回原错误", func(t *testing.T) {
+		sr := NewStreamResumer()
+		called := false
+		body := sr.Wrap("req-2", &brokenReader{r: strings.NewReader("data: a\n\n"), err: errReset},
+			func(string) (io.ReadCloser, error) {
+				called = true
+				return nil, nil
+			}, 0)
+		out, err := io.ReadAll(body)
+		if !errors.Is(err, errReset) || called {
+			t.Errorf("err = %v, reconnect 调用 = %v", err, called)
+		}
+		if string(out) != "data: a\n\n" {
+			t.Errorf("已完整的事件应输出, 实际 %q", out)
+		}
+	})
+
+	t.Run("超过续传次数上限", func(t *testing.T) {
+		sr := NewStreamResumer()
+		resumes := 0
+		reconnect := func(string) (io.ReadCloser, error) {
+			resumes++
+			return &brokenReader{r: strings.NewReader("id: x\ndata: y\n\n"), err: errReset}, nil
+		}
+		body := sr.Wrap("req-3", &brokenReader{r: strings.NewReader("id: 1\ndata: a\n\n"), err: errReset}, reconnect, 2)
+		if _, err := io.ReadAll(body); !errors.Is(err, errReset) {
+			t.Errorf("err = %v, want %v", err, errReset)
+		}
+		if resumes != 2 {
+			t.Errorf("续传 %d 次, 期望 2", resumes)
+		}
+	})
+
+	t.Run("正常结束时输出末尾不完整的事件", func(t *testing.T) {
+		sr := NewStreamResumer()
+		body := sr.Wrap("req-4", io.NopCloser(strings.NewReader("id: 1\r\ndata: a\r\n\r\ndata: [DONE]")), nil, 0)
+		out, err := io.ReadAll(body)
+		if err != nil || string(out) != "id: 1\r\ndata: a\r\n\r\ndata: [DONE]" {
+			t.Errorf("ReadAll() = %q, %v", out, err)
+		}
+		if sr.LastEventID("req-4") != "1" {
+			t.Errorf("CRLF 事件 id 未识别: %q", sr.LastEventID("req-4"))
+		}
+	})
+}
+
+func TestStreamResumer_ReconnectRequest(t *testing.T) {
+	sr := NewStreamResumer()
+	req, _ := http.NewRequest(http.MethodPost, "http://upstream/v1/messages", bytes.NewReader([]byte(`{"stream":true}`)))
+
+	if _, err := sr.ReconnectRequest("req", req); !errors.Is(err, ErrNotResumable) {
+		t.Fatalf("无 id 时应返回 ErrNotResumable, got %v", err)
+	}
+
+	sr.track("req")
+	sr.record("req", "evt-7")
+	resumed, err := sr.ReconnectRequest("req", req)
+	if err != nil {
+		t.Fatalf("ReconnectRequest() error = %v", err)
+	}
+	if resumed.Header.Get(LastEventIDHeader) != "evt-7" || req.Header.Get(LastEventIDHeader) != "" {
+		t.Errorf("请求头设置错误: %v / 原请求 %v", resumed.Header, req.Header)
+	}
+	if body, _ := io.ReadAll(resumed.Body); string(body) != `{"stream":true}` {
+		t.Errorf("请求体未重放: %q", body)
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// ============================================================================
+// 成功后的排序调整：降权（分散）或置顶（粘滞）
+// ============================================================================
+
+// SuccessMode 成功后的排序调整模式，同一时刻只能启用一种
+type SuccessMode int
+
+const (
+	// SuccessModeOff 不调整，按纯轮询排序
+	SuccessModeOff SuccessMode = iota
+	// SuccessCooldown 成功后降权：刚成功的 provider 在窗口期内移到同 Level 末尾，分散流量
+	SuccessCooldown
+	// StickyAfterSuccess 成功后置顶：刚成功的 provider 在窗口期内保持在同 Level 首位，
+	// 适合连接复用与 prompt 缓存命中占主要成本的场景
+	StickyAfterSuccess
+)
+
+// String 返回模式名称
+func (m SuccessMode) String() string {
+	switch m {
+	case SuccessModeOff:
+		return "off"
+	case SuccessCooldown:
+		return "cooldown"
+	case StickyAfterSuccess:
+		return "sticky"
+	default:
+		return fmt.Sprintf("SuccessMode(%d)", int(m))
+	}
+}
+
+// stickyPin 置顶记录
+type stickyPin struct {
+	name  string
+	until time.Time
+}
+
+// SetSuccessMode 设置成功后的排序调整模式与窗口时长
+// window <= 0 或 mode 为 SuccessModeOff 时关闭；切换模式会清空另一模式残留的记录
+// 调整只影响顺序，不会将 provider 排除
+func (rrs *RoundRobinState) SetSuccessMode(mode SuccessMode, window time.Duration) {
+	if window <= 0 {
+		mode, window = SuccessModeOff, 0
+	}
+	if mode == SuccessModeOff {
+		window = 0
+	}
+
+	rrs.mu.Lock()
+	defer rrs.mu.Unlock()
+
+	if mode != SuccessCooldown {
+		rrs.cooledUntil = make(map[string]time.Time)
+	}
+	if mode != StickyAfterSuccess {
+		rrs.pinned = make(map[string]stickyPin)
+	}
+	rrs.successMode = mode
+	rrs.successWindow = window
+}
+
+// SetSuccessCooldown 设置成功后降权时长，<= 0 关闭
+// 等价于 SetSuccessMode(SuccessCooldown, d)
+func (rrs *RoundRobinState) SetSuccessCooldown(d time.Duration) {
+	rrs.SetSuccessMode(SuccessCooldown, d)
+}
+
+// RecordSuccess 记录 provider 成功处理了一次请求，未开启成功后调整时无操作
+//   - SuccessCooldown: provider 在窗口期内于该平台所有 Level 降权
+//   - StickyAfterSuccess: provider 在窗口期内置顶于 platform/level 的首位（覆盖该 Level 之前的置顶）
+func (rrs *RoundRobinState) RecordSuccess(platform string, level int, name string) {
+	rrs.mu.Lock()
+	defer rrs.mu.Unlock()
+
+	now := clockNow()
+	switch rrs.successMode {
+	case SuccessCooldown:
+		rrs.cooledUntil[platform+"/"+name] = now.Add(rrs.successWindow)
+
+		// 顺带清理已过期的记录，避免 map 无限增长
+		for key, until := range rrs.cooledUntil {
+			if !now.Before(until) {
+				delete(rrs.cooledUntil, key)
+			}
+		}
+	case StickyAfterSuccess:
+		rrs.pinned[fmt.Sprintf("%s:%d", platform, level)] = stickyPin{name: name, until: now.Add(rrs.successWindow)}
+	}
+}
+
+// InCooldown 返回 provider 是否处于成功降权期
+func (rrs *RoundRobinState) InCooldown(platform, name string) bool {
+	rrs.mu.Lock()
+	defer rrs.mu.Unlock()
+	return rrs.inCooldownLocked(platform, name, clockNow())
+}
+
+func (rrs *RoundRobinState) inCooldownLocked(platform, name string, now time.Time) bool {
+	until, ok := rrs.cooledUntil[platform+"/"+name]
+	return ok && now.Before(until)
+}
+
+// Pinned 返回 platform/level 当前置顶的 provider，未置顶或已过期时返回空串
+func (rrs *RoundRobinState) Pinned(platform string, level int) string {
+	rrs.mu.Lock()
+	defer rrs.mu.Unlock()
+
+	pin, ok := rrs.pinned[fmt.Sprintf("%s:%d", platform, level)]
+	if !ok || !clockNow().Before(pin.until) {
+		return ""
+	}
+	return pin.name
+}
+
+// applySuccessCooldown 将处于降权期的 provider 稳定地移到列表末尾（调用方需持有 rrs.mu）
+// 全部处于降权期时保持原顺序；不修改原切片
+func applySuccessCooldown[T any](rrs *RoundRobinState, platform string, providers []T, getName func(T) string) []T {
+	if rrs.successMode != SuccessCooldown || len(rrs.cooledUntil) == 0 || len(providers) <= 1 {
+		return providers
+	}
+
+	now := clockNow()
+	fresh := make([]T, 0, len(providers))
+	var cooled []T
+	for _, p := range providers {
+		if rrs.inCooldownLocked(platform, getName(p), now) {
+			cooled = append(cooled, p)
+		} else {
+			fresh = append(fresh, p)
+		}
+	}
+	if len(cooled) == 0 || len(fresh) == 0 {
+		return providers
+	}
+	return append(fresh, cooled...)
+}
+
+// applyStickyPin 置顶期内将置顶 provider 移到首位，其余保持原顺序（调用方需持有 rrs.mu）
+// 返回 false 表示未置顶、已过期或置顶 provider 不在当前列表中，调用方应按轮询排序；不修改原切片
+// 顺带清理已过期的置顶记录
+func applyStickyPin[T any](rrs *RoundRobinState, key string, providers []T, getName func(T) string) ([]T, bool) {
+	if pin, ok := rrs.pinned[key]; ok && !clockNow().Before(pin.until) {
+		delete(rrs.pinned, key)
+	}
+	return stickyPinOrder(rrs, key, providers, getName)
+}
+
+// stickyPinOrder applyStickyPin 的只读版本：不清理过期的置顶记录（调用方需持有 rrs.mu）
+func stickyPinOrder[T any](rrs *RoundRobinState, key string, providers []T, getName func(T) string) ([]T, bool) {
+	if rrs.successMode != StickyAfterSuccess {
+		return nil, false
+	}
+	pin, ok := rrs.pinned[key]
+	if !ok || !clockNow().Before(pin.until) {
+		return nil, false
+	}
+
+	idx := -1
+	for i, p := range providers {
+		if getName(p) == pin.name {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return nil, false
+	}
+
+	result := make([]T, 0, len(providers))
+	result = append(result, providers[idx])
+	result = append(result, providers[:idx]...)
+	return append(result, providers[idx+1:]...), true
+}
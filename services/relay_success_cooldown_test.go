@@ -0,0 +1,135 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoundRobinState_SuccessCooldown(t *testing.T) {
+	clk := NewManualClock(time.Unix(1700000000, 0))
+	defer SetClock(clk)()
+
+	names := func(ps []string) string {
+		out := ""
+		for _, p := range ps {
+			out += p
+		}
+		return out
+	}
+	id := func(s string) string { return s }
+
+	rrs := NewRoundRobinState()
+	providers := []string{"a", "b", "c"}
+
+	// 未开启时 RecordSuccess 无效果
+	rrs.RecordSuccess("claude", 1, "a")
+	if rrs.InCooldown("claude", "a") {
+		t.Fatal("未开启成功降权时不应进入降权期")
+	}
+
+	rrs.SetSuccessCooldown(10 * time.Second)
+
+	t.Run("降权 provider 移到末尾", func(t *testing.T) {
+		rrs.RecordSuccess("claude", 1, "b")
+		// 轮询从 b 开始：b c a → b 降权后 c a b
+		rrs.lastStart["claude:1"] = "a"
+		if got := names(Reorder(rrs, "claude", 1, providers, id)); got != "cab" {
+			t.Errorf("Reorder() = %s, 期望 cab", got)
+		}
+		// 轮询位置不受降权影响
+		if rrs.lastStart["claude:1"] != "b" {
+			t.Errorf("lastStart = %s, 期望 b", rrs.lastStart["claude:1"])
+		}
+	})
+
+	t.Run("其他平台不受影响", func(t *testing.T) {
+		if rrs.InCooldown("codex", "b") {
+			t.Error("降权应按平台隔离")
+		}
+	})
+
+	t.Run("全部降权时保持轮询顺序", func(t *testing.T) {
+		rrs.RecordSuccess("claude", 1, "a")
+		rrs.RecordSuccess("claude", 1, "c")
+		rrs.lastStart["claude:1"] = "a"
+		if got := names(Reorder(rrs, "claude", 1, providers, id)); got != "bca" {
+			t.Errorf("Reorder() = %s, 期望 bca", got)
+		}
+	})
+
+	t.Run("过期后恢复", func(t *testing.T) {
+		clk.Advance(11 * time.Second)
+		if rrs.InCooldown("claude", "b") {
+			t.Error("降权期已过")
+		}
+		rrs.lastStart["claude:1"] = "a"
+		if got := names(Reorder(rrs, "claude", 1, providers, id)); got != "bca" {
+			t.Errorf("Reorder() = %s, 期望 bca", got)
+		}
+	})
+}
+
+func TestRoundRobinState_StickyAfterSuccess(t *testing.T) {
+	clk := NewManualClock(time.Unix(1700000000, 0))
+	defer SetClock(clk)()
+
+	names := func(ps []string) string {
+		out := ""
+		for _, p := range ps {
+			out += p
+		}
+		return out
+	}
+	id := func(s string) string { return s }
+
+	rrs := NewRoundRobinState()
+	providers := []string{"a", "b", "c"}
+	rrs.SetSuccessMode(StickyAfterSuccess, 10*time.Second)
+
+	t.Run("成功后置顶且暂停轮询", func(t *testing.T) {
+		rrs.RecordSuccess("claude", 1, "b")
+		for i := 0; i < 3; i++ {
+			if got := names(Reorder(rrs, "claude", 1, providers, id)); got != "bac" {
+				t.Fatalf("第 %d 次 Reorder() = %s, 期望 bac", i+1, got)
+			}
+		}
+		if rrs.Pinned("claude", 1) != "b" {
+			t.Errorf("Pinned() = %q, 期望 b", rrs.Pinned("claude", 1))
+		}
+	})
+
+	t.Run("按 Level 隔离", func(t *testing.T) {
+		if rrs.Pinned("claude", 2) != "" || rrs.Pinned("codex", 1) != "" {
+			t.Error("置顶应按 platform/level 隔离")
+		}
+	})
+
+	t.Run("置顶 provider 不在列表中时按轮询排序", func(t *testing.T) {
+		if got := names(Reorder(rrs, "claude", 1, []string{"a", "c"}, id)); got != "ac" {
+			t.Errorf("Reorder() = %s, 期望 ac", got)
+		}
+	})
+
+	t.Run("与降权模式互斥", func(t *testing.T) {
+		if rrs.InCooldown("claude", "b") {
+			t.Error("置顶模式下不应记录降权")
+		}
+		rrs.SetSuccessMode(SuccessCooldown, 10*time.Second)
+		if rrs.Pinned("claude", 1) != "" {
+			t.Error("切换到降权模式后应清空置顶记录")
+		}
+		rrs.SetSuccessMode(StickyAfterSuccess, 10*time.Second)
+	})
+
+	t.Run("过期后恢复轮询", func(t *testing.T) {
+		rrs.RecordSuccess("claude", 1, "c")
+		clk.Advance(11 * time.Second)
+		if rrs.Pinned("claude", 1) != "" {
+			t.Error("置顶期已过")
+		}
+		rrs.lastStart["claude:1"] = "a"
+		if got := names(Reorder(rrs, "claude", 1, providers, id)); got != "bca" {
+			t.Errorf("Reorder() = %s, 期望 bca", got)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ============================================================================
+// 中转自行插入内容的标记（请求体转换的幂等约定）
+// ============================================================================
+
+// SyntheticMarker 中转插入的内容块/条目上附加的标记字段（值为 true）
+// 请求体转换在重试时可能被再次执行：各转换通过该标记识别自己此前插入的内容并跳过，避免重复插入
+// 上游会拒绝未知字段，转发前由 StripSyntheticMarkers 统一移除
+const SyntheticMarker = "x-relay-synthetic"
+
+// markSynthetic 为插入的内容块附加 SyntheticMarker
+func markSynthetic(block map[string]interface{}) map[string]interface{} {
+	block[SyntheticMarker] = true
+	return block
+}
+
+// IsSynthetic 内容块/条目是否由中转插入
+func IsSynthetic(block gjson.Result) bool {
+	return block.Get(SyntheticMarker).Bool()
+}
+
+// StripSyntheticMarkers 移除 Claude 消息内容块与 Responses input 条目上的 SyntheticMarker 字段，转发给上游前调用
+// 返回：处理后的请求体、是否有修改、错误；不含标记时原样返回
+func StripSyntheticMarkers(bodyBytes []byte) ([]byte, bool, error) {
+	if !bytes.Contains(bodyBytes, []byte(SyntheticMarker)) {
+		return bodyBytes, false, nil
+	}
+
+	var paths []string
+	gjson.GetBytes(bodyBytes, "messages").ForEach(func(i, msg gjson.Result) bool {
+		msg.Get("content").ForEach(func(j, block gjson.Result) bool {
+			if block.Get(SyntheticMarker).Exists() {
+				paths = append(paths, fmt.Sprintf("messages.%d.content.%d.%s", i.Int(), j.Int(), SyntheticMarker))
+			}
+			return true
+		})
+		return true
+	})
+	gjson.GetBytes(bodyBytes, "input").ForEach(func(i, item gjson.Result) bool {
+		if item.Get(SyntheticMarker).Exists() {
+			paths = append(paths, fmt.Sprintf("input.%d.%s", i.Int(), SyntheticMarker))
+		}
+		return true
+	})
+	if len(paths) == 0 {
+		return bodyBytes, false, nil
+	}
+
+	result := bodyBytes
+	var err error
+	for _, path := range paths {
+		if result, err = sjson.DeleteBytes(result, path); err != nil {
+			return bodyBytes, false, fmt.Errorf("移除 %s 失败: %w", path, err)
+		}
+	}
+	return result, true, nil
+}
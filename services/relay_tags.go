@@ -0,0 +1,108 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ============================================================================
+// 按标签限定/排除 Provider
+// ============================================================================
+
+const (
+	// ProviderTagsHeader 只使用带有其中任一标签的 provider（逗号分隔）
+	ProviderTagsHeader = "X-Provider-Tags"
+	// ExcludeProviderTagsHeader 排除带有其中任一标签的 provider（逗号分隔）
+	ExcludeProviderTagsHeader = "X-Exclude-Provider-Tags"
+)
+
+// GetTags 返回标签
+func (p Provider) GetTags() []string { return p.Tags }
+
+// GetTags 返回标签
+func (g GeminiProvider) GetTags() []string { return g.Tags }
+
+// taggedProvider 声明了标签的 provider
+type taggedProvider interface {
+	GetTags() []string
+}
+
+// TagSet 标签集合，比较时忽略大小写与首尾空白
+type TagSet map[string]bool
+
+// NewTagSet 由标签列表构造集合，空白标签被忽略
+func NewTagSet(tags ...string) TagSet {
+	set := make(TagSet, len(tags))
+	for _, tag := range tags {
+		if tag = normalizeTag(tag); tag != "" {
+			set[tag] = true
+		}
+	}
+	return set
+}
+
+// ParseTagSet 解析逗号分隔的标签列表（如请求头的值）
+func ParseTagSet(value string) TagSet {
+	return NewTagSet(strings.Split(value, ",")...)
+}
+
+// firstMatch 返回 tags 中第一个属于集合的标签
+func (s TagSet) firstMatch(tags []string) (string, bool) {
+	for _, tag := range tags {
+		if tag = normalizeTag(tag); s[tag] {
+			return tag, true
+		}
+	}
+	return "", false
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// TagsFromRequest 从请求头读取标签限定/排除集合，未提供时为空集合
+func TagsFromRequest(ctx *RequestContext) (include, exclude TagSet) {
+	if ctx == nil {
+		return nil, nil
+	}
+	return ParseTagSet(ctx.ClientHeaders[http.CanonicalHeaderKey(ProviderTagsHeader)]),
+		ParseTagSet(ctx.ClientHeaders[http.CanonicalHeaderKey(ExcludeProviderTagsHeader)])
+}
+
+// ApplyTags 按标签过滤 Active 与 LastResort providers，被过滤的移入 Skipped
+//   - exclude 非空：带有其中任一标签的 provider 被跳过（SkipReasonTagExcluded），优先于 include
+//   - include 非空：不带其中任何标签的 provider 被跳过（SkipReasonTagNotIncluded）；为空表示不限
+//
+// 标签是显式的路由池划分，全部被过滤时 Active 为空（与 ApplyMinSuccessRate 的保底策略不同）
+func (r *FilterResult[T]) ApplyTags(include, exclude TagSet) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return
+	}
+	r.Active = r.filterByTags(r.Active, include, exclude)
+	r.LastResort = r.filterByTags(r.LastResort, include, exclude)
+}
+
+func (r *FilterResult[T]) filterByTags(providers []T, include, exclude TagSet) []T {
+	if providers == nil {
+		return nil
+	}
+	kept := make([]T, 0, len(providers))
+	for _, p := range providers {
+		var tags []string
+		if tp, ok := any(p).(taggedProvider); ok {
+			tags = tp.GetTags()
+		}
+		if tag, ok := exclude.firstMatch(tags); ok {
+			r.addSkip(p.GetName(), SkipReasonTagExcluded, tag)
+			continue
+		}
+		if len(include) > 0 {
+			if _, ok := include.firstMatch(tags); !ok {
+				r.addSkip(p.GetName(), SkipReasonTagNotIncluded, strings.Join(tags, ","))
+				continue
+			}
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
@@ -0,0 +1,77 @@
+package services
+
+import "testing"
+
+func TestFilterResult_ApplyTags(t *testing.T) {
+	providers := []Provider{
+		{Name: "stable", APIURL: "https://a", APIKey: "k", Enabled: true, Tags: []string{"prod"}},
+		{Name: "beta", APIURL: "https://a", APIKey: "k", Enabled: true, Tags: []string{"Beta", "prod"}},
+		{Name: "eu", APIURL: "https://a", APIKey: "k", Enabled: true, Tags: []string{" eu-only "}},
+		{Name: "untagged", APIURL: "https://a", APIKey: "k", Enabled: true},
+	}
+
+	tests := []struct {
+		name       string
+		include    TagSet
+		exclude    TagSet
+		wantActive []string
+		wantReason map[string]SkipReason
+	}{
+		{"未指定标签不过滤", nil, nil, []string{"stable", "beta", "eu", "untagged"}, nil},
+		{"限定标签", NewTagSet("prod"), nil, []string{"stable", "beta"},
+			map[string]SkipReason{"eu": SkipReasonTagNotIncluded, "untagged": SkipReasonTagNotIncluded}},
+		{"排除标签忽略大小写", nil, NewTagSet("beta"), []string{"stable", "eu", "untagged"},
+			map[string]SkipReason{"beta": SkipReasonTagExcluded}},
+		{"排除优先于限定", NewTagSet("prod", "EU-ONLY"), ParseTagSet("beta, "), []string{"stable", "eu"},
+			map[string]SkipReason{"beta": SkipReasonTagExcluded, "untagged": SkipReasonTagNotIncluded}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FilterProviders(providers, "claude", "", nil, nil, nil)
+			result.ApplyTags(tt.include, tt.exclude)
+
+			if len(result.Active) != len(tt.wantActive) {
+				t.Fatalf("Active = %+v, want %v", result.Active, tt.wantActive)
+			}
+			for i, name := range tt.wantActive {
+				if result.Active[i].Name != name {
+					t.Errorf("Active[%d] = %s, want %s", i, result.Active[i].Name, name)
+				}
+			}
+			if len(result.Skipped) != len(tt.wantReason) || result.SkippedCount != len(tt.wantReason) {
+				t.Fatalf("Skipped = %+v, want %v", result.Skipped, tt.wantReason)
+			}
+			for _, skip := range result.Skipped {
+				if skip.Reason != tt.wantReason[skip.Name] {
+					t.Errorf("%s 跳过原因 = %s, want %s", skip.Name, skip.Reason, tt.wantReason[skip.Name])
+				}
+			}
+		})
+	}
+}
+
+func TestTagsFromRequest(t *testing.T) {
+	rc := &RequestContext{ClientHeaders: map[string]string{
+		"X-Provider-Tags":         "prod, eu-only",
+		"X-Exclude-Provider-Tags": "Beta",
+	}}
+	include, exclude := TagsFromRequest(rc)
+	if len(include) != 2 || !include["prod"] || !include["eu-only"] {
+		t.Errorf("include = %v", include)
+	}
+	if len(exclude) != 1 || !exclude["beta"] {
+		t.Errorf("exclude = %v", exclude)
+	}
+	if include, exclude := TagsFromRequest(nil); include != nil || exclude != nil {
+		t.Error("nil 上下文应返回空集合")
+	}
+
+	gemini := FilterGeminiProviders([]GeminiProvider{
+		{Name: "g1", BaseURL: "https://g", APIKey: "k", Enabled: true, Tags: []string{"beta"}},
+		{Name: "g2", BaseURL: "https://g", APIKey: "k", Enabled: true},
+	}, nil)
+	gemini.ApplyTags(TagsFromRequest(rc))
+	if len(gemini.Active) != 0 {
+		t.Errorf("Gemini 未按标签过滤: %+v", gemini.Active)
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// 按 Level 配置的请求超时
+// ============================================================================
+
+var (
+	levelTimeoutsMu sync.RWMutex
+	levelTimeouts   map[int]time.Duration // Level -> 单次请求超时
+)
+
+// SetLevelTimeouts 设置各 Level 的单次请求超时（传 nil 清空）
+// 未配置的 Level 使用平台默认超时，可用于高优先级 Level 快速失败、低优先级 Level 放宽等待
+func SetLevelTimeouts(timeouts map[int]time.Duration) {
+	copied := make(map[int]time.Duration, len(timeouts))
+	for level, d := range timeouts {
+		if d > 0 {
+			copied[level] = d
+		}
+	}
+
+	levelTimeoutsMu.Lock()
+	defer levelTimeoutsMu.Unlock()
+	levelTimeouts = copied
+}
+
+// timeoutProvider 单独配置了请求超时的 provider
+type timeoutProvider interface {
+	GetTimeout() time.Duration
+}
+
+// GetTimeout 返回单独配置的请求超时，0 表示未配置
+func (p Provider) GetTimeout() time.Duration { return time.Duration(p.TimeoutSec) * time.Second }
+
+// GetTimeout 返回单独配置的请求超时，0 表示未配置
+func (g GeminiProvider) GetTimeout() time.Duration { return time.Duration(g.TimeoutSec) * time.Second }
+
+// TimeoutFor 返回 provider 的单次请求超时
+// 优先级：provider 自身的 TimeoutSec > Level 超时（SetLevelTimeouts）> 平台默认（Gemini 为 DefaultGeminiTimeout，其余为 DefaultRequestTimeout）
+func TimeoutFor(p ProviderLike) time.Duration {
+	if tp, ok := p.(timeoutProvider); ok {
+		if d := tp.GetTimeout(); d > 0 {
+			return d
+		}
+	}
+	fallback := DefaultRequestTimeout
+	switch p.(type) {
+	case GeminiProvider, *GeminiProvider:
+		fallback = DefaultGeminiTimeout
+	}
+	return timeoutForLevelOr(p.GetLevel(), fallback)
+}
+
+// attemptTimeout 返回本次尝试的超时：TimeoutFor(p) 与转发循环按重试时间预算分配的
+// Selection.AttemptTimeout（见 RetryContext.AttemptTimeout）中较小者，后者未设置时不限制
+func attemptTimeout(ctx context.Context, p ProviderLike) time.Duration {
+	timeout := TimeoutFor(p)
+	if sel, ok := SelectionFromContext(ctx); ok && sel.AttemptTimeout > 0 && sel.AttemptTimeout < timeout {
+		timeout = sel.AttemptTimeout
+	}
+	return timeout
+}
+
+// TimeoutForLevel 返回指定 Level 的单次请求超时，未配置时返回 DefaultRequestTimeout
+func TimeoutForLevel(level int) time.Duration {
+	return timeoutForLevelOr(level, DefaultRequestTimeout)
+}
+
+// timeoutForLevelOr 返回指定 Level 的单次请求超时，未配置时返回 fallback
+func timeoutForLevelOr(level int, fallback time.Duration) time.Duration {
+	if level <= 0 {
+		level = DefaultProviderLevel
+	}
+
+	levelTimeoutsMu.RLock()
+	defer levelTimeoutsMu.RUnlock()
+	if d, ok := levelTimeouts[level]; ok {
+		return d
+	}
+	return fallback
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ============================================================================
+// tool_use 修复分析（纯函数）
+// ============================================================================
+
+// toolInterruptedMessage 补充的 tool_result / function_call_output 内容
+const toolInterruptedMessage = "工具调用被中断（中转站切换），请重新执行此操作"
+
+// Patch 一次待应用到请求体的修改：在数组 Path 的 Index 位置插入 Value
+// 由 repairToolUse 等分析函数产出，不包含任何副作用，便于测试、模糊测试和复用分析结果
+type Patch struct {
+	Path        string                   // 目标数组的 sjson 路径（messages / input）
+	Index       int                      // 插入位置（等于数组长度时为追加），基于前序修改应用后的数组
+	Value       interface{}              // 插入的值
+	Blocks      []map[string]interface{} // 补充的 tool_result / function_call_output 块（Value 中携带的同一批内容）
+	DanglingIDs []string                 // 本次修改补齐的 tool_use / function_call ID
+	SourceIndex int                      // 触发修改的条目下标（assistant 消息或 function_call）
+}
+
+// repairToolUse 分析 Claude messages 数组，返回修复未完成 tool_use 所需的修改
+// 检查最后一条 assistant 消息中的 tool_use，其后一条 user 消息没有 tool_result 时，
+// 产出一个追加到 messages 末尾的 user 消息（每个 tool_use 对应一个 is_error 的 tool_result）
+// 补充的 tool_result 带有 SyntheticMarker；此后任意位置已有对应的补充 tool_result 的 tool_use 不再重复补充
+// 不打印、不修改输入；无需修复时返回空；messages 存在但不是数组时返回错误
+func repairToolUse(messages gjson.Result) ([]Patch, error) {
+	if !messages.Exists() {
+		return nil, nil
+	}
+	if !messages.IsArray() {
+		return nil, fmt.Errorf("messages 不是数组")
+	}
+	messagesArray := messages.Array()
+
+	// 从后向前查找最后一条 assistant 消息
+	lastAssistantIdx := -1
+	for i := len(messagesArray) - 1; i >= 0; i-- {
+		if messagesArray[i].Get("role").String() == "assistant" {
+			lastAssistantIdx = i
+			break
+		}
+	}
+	if lastAssistantIdx == -1 {
+		return nil, nil
+	}
+
+	// 收集 assistant 消息中所有 tool_use 的 ID
+	var toolUseIDs []string
+	content := messagesArray[lastAssistantIdx].Get("content")
+	if !content.IsArray() {
+		return nil, nil
+	}
+	content.ForEach(func(_, item gjson.Result) bool {
+		if item.Get("type").String() == "tool_use" {
+			if id := item.Get("id").String(); id != "" {
+				toolUseIDs = append(toolUseIDs, id)
+			}
+		}
+		return true
+	})
+	if len(toolUseIDs) == 0 {
+		return nil, nil
+	}
+
+	// 此前已补充过（重试时再次执行）的 tool_use 不再重复补充
+	toolUseIDs = withoutSyntheticResults(toolUseIDs, messagesArray[lastAssistantIdx+1:])
+	if len(toolUseIDs) == 0 {
+		return nil, nil
+	}
+
+	// 正常情况下，assistant 消息后面紧跟一个包含 tool_result 的 user 消息
+	if lastAssistantIdx+1 < len(messagesArray) {
+		nextMsg := messagesArray[lastAssistantIdx+1]
+		if nextMsg.Get("role").String() == "user" {
+			hasToolResult := false
+			nextMsg.Get("content").ForEach(func(_, item gjson.Result) bool {
+				hasToolResult = item.Get("type").String() == "tool_result"
+				return !hasToolResult
+			})
+			if hasToolResult {
+				return nil, nil
+			}
+		}
+	}
+
+	toolResults := make([]map[string]interface{}, 0, len(toolUseIDs))
+	for _, id := range toolUseIDs {
+		toolResults = append(toolResults, markSynthetic(map[string]interface{}{
+			"type":        "tool_result",
+			"tool_use_id": id,
+			"content":     toolInterruptedMessage,
+			"is_error":    true,
+		}))
+	}
+
+	return []Patch{{
+		Path:        "messages",
+		Index:       len(messagesArray),
+		Value:       map[string]interface{}{"role": "user", "content": toolResults},
+		Blocks:      toolResults,
+		DanglingIDs: toolUseIDs,
+		SourceIndex: lastAssistantIdx,
+	}}, nil
+}
+
+// withoutSyntheticResults 去掉 messages 中已有补充 tool_result（带 SyntheticMarker）的 tool_use ID
+func withoutSyntheticResults(ids []string, messages []gjson.Result) []string {
+	answered := make(map[string]bool)
+	for _, msg := range messages {
+		msg.Get("content").ForEach(func(_, block gjson.Result) bool {
+			if block.Get("type").String() == "tool_result" && IsSynthetic(block) {
+				answered[block.Get("tool_use_id").String()] = true
+			}
+			return true
+		})
+	}
+	if len(answered) == 0 {
+		return ids
+	}
+	kept := ids[:0:0]
+	for _, id := range ids {
+		if !answered[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// repairFunctionCalls 分析 Responses API 的 input 数组，返回修复未完成 function_call 所需的修改
+// 每个没有对应 function_call_output 的 function_call 产出一个追加到末尾的 function_call_output
+func repairFunctionCalls(input gjson.Result) ([]Patch, error) {
+	if !input.Exists() {
+		return nil, nil
+	}
+	if !input.IsArray() {
+		return nil, fmt.Errorf("input 不是数组")
+	}
+	items := input.Array()
+
+	outputs := make(map[string]bool)
+	for _, item := range items {
+		if item.Get("type").String() == "function_call_output" {
+			outputs[item.Get("call_id").String()] = true
+		}
+	}
+
+	var patches []Patch
+	for i, item := range items {
+		if item.Get("type").String() != "function_call" {
+			continue
+		}
+		id := item.Get("call_id").String()
+		if id == "" || outputs[id] {
+			continue
+		}
+		outputs[id] = true
+		output := markSynthetic(map[string]interface{}{
+			"type":    "function_call_output",
+			"call_id": id,
+			"output":  toolInterruptedMessage,
+		})
+		patches = append(patches, Patch{
+			Path:        "input",
+			Index:       len(items) + len(patches),
+			Value:       output,
+			Blocks:      []map[string]interface{}{output},
+			DanglingIDs: []string{id},
+			SourceIndex: i,
+		})
+	}
+	return patches, nil
+}
+
+// applyPatches 按顺序将修改应用到请求体，返回新的请求体（不修改原切片）
+func applyPatches(bodyBytes []byte, patches []Patch) ([]byte, error) {
+	modified := bodyBytes
+	for _, patch := range patches {
+		var err error
+		modified, err = insertAt(modified, patch.Path, patch.Index, patch.Value)
+		if err != nil {
+			return bodyBytes, err
+		}
+	}
+	return modified, nil
+}
+
+// insertAt 在 path 指向的数组的 index 位置插入 value；index 等于数组长度时直接追加
+func insertAt(bodyBytes []byte, path string, index int, value interface{}) ([]byte, error) {
+	items := gjson.GetBytes(bodyBytes, path).Array()
+	if index < 0 || index > len(items) {
+		return nil, fmt.Errorf("%s 下标越界: %d（长度 %d）", path, index, len(items))
+	}
+	if index == len(items) {
+		return sjson.SetBytes(bodyBytes, fmt.Sprintf("%s.%d", path, index), value)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	rebuilt := make([]json.RawMessage, 0, len(items)+1)
+	for i, item := range items {
+		if i == index {
+			rebuilt = append(rebuilt, raw)
+		}
+		rebuilt = append(rebuilt, json.RawMessage(item.Raw))
+	}
+	array, err := json.Marshal(rebuilt)
+	if err != nil {
+		return nil, err
+	}
+	return sjson.SetRawBytes(bodyBytes, path, array)
+}
+
+// DanglingToolUseIDs 返回请求体中未完成的 tool_use / function_call ID，不修改请求体
+// 可用于统计或决策（例如只记录而不修复）
+func DanglingToolUseIDs(bodyBytes []byte) []string {
+	var patches []Patch
+	if messages := gjson.GetBytes(bodyBytes, "messages"); messages.Exists() {
+		patches, _ = repairToolUse(messages)
+	} else {
+		patches, _ = repairFunctionCalls(gjson.GetBytes(bodyBytes, "input"))
+	}
+
+	var ids []string
+	for _, patch := range patches {
+		ids = append(ids, patch.DanglingIDs...)
+	}
+	return ids
+}
@@ -0,0 +1,50 @@
+package services
+
+import "sync/atomic"
+
+// ============================================================================
+// tool_use 自动修复模式
+// ============================================================================
+
+// ToolUseRepairMode 未配对 tool_use / function_call 的处理方式（见 FixIncompleteToolUse）
+type ToolUseRepairMode int32
+
+const (
+	// ToolUseRepairAuto 补充错误 tool_result / function_call_output（默认）
+	ToolUseRepairAuto ToolUseRepairMode = iota
+	// ToolUseRepairWarn 仅打印告警，请求体保持不变，由上游决定是否报错
+	ToolUseRepairWarn
+	// ToolUseRepairOff 完全关闭检测
+	ToolUseRepairOff
+)
+
+// String 实现 fmt.Stringer
+func (m ToolUseRepairMode) String() string {
+	switch m {
+	case ToolUseRepairAuto:
+		return "auto"
+	case ToolUseRepairWarn:
+		return "warn"
+	case ToolUseRepairOff:
+		return "off"
+	default:
+		return "unknown"
+	}
+}
+
+var toolUseRepairMode atomic.Int32
+
+// SetToolUseRepairMode 设置中转自动修复 tool_use 的方式，未知取值按 ToolUseRepairAuto 处理
+// 补充的错误 tool_result 有时会让模型误以为工具失败而重复执行，此时可改为 ToolUseRepairWarn 或 ToolUseRepairOff
+// 请求转换流水线中显式配置的 FixToolUse 步骤不受此设置影响
+func SetToolUseRepairMode(mode ToolUseRepairMode) {
+	if mode < ToolUseRepairAuto || mode > ToolUseRepairOff {
+		mode = ToolUseRepairAuto
+	}
+	toolUseRepairMode.Store(int32(mode))
+}
+
+// CurrentToolUseRepairMode 返回当前的 tool_use 修复模式
+func CurrentToolUseRepairMode() ToolUseRepairMode {
+	return ToolUseRepairMode(toolUseRepairMode.Load())
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestRepairToolUse(t *testing.T) {
+	tests := []struct {
+		name        string
+		messages    string
+		wantIDs     []string
+		wantIndex   int
+		wantErr     bool
+		wantPatches int
+	}{
+		{"没有 messages", ``, nil, 0, false, 0},
+		{"不是数组", `{"a":1}`, nil, 0, true, 0},
+		{"没有 assistant", `[{"role":"user","content":"hi"}]`, nil, 0, false, 0},
+		{"已有 tool_result", `[
+			{"role":"assistant","content":[{"type":"tool_use","id":"t1"}]},
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1"}]}]`, nil, 0, false, 0},
+		{"缺少 tool_result", `[
+			{"role":"user","content":"hi"},
+			{"role":"assistant","content":[{"type":"text","text":"x"},{"type":"tool_use","id":"t1"},{"type":"tool_use","id":"t2"}]}]`,
+			[]string{"t1", "t2"}, 2, false, 1},
+		{"assistant 后跟普通 user 消息", `[
+			{"role":"user","content":"hi"},
+			{"role":"assistant","content":[{"type":"tool_use","id":"t1"}]},
+			{"role":"user","content":"继续"}]`,
+			[]string{"t1"}, 3, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := repairToolUse(gjson.Parse(tt.messages))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("repairToolUse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(patches) != tt.wantPatches {
+				t.Fatalf("patches = %d, 期望 %d", len(patches), tt.wantPatches)
+			}
+			if tt.wantPatches == 0 {
+				return
+			}
+			if !reflect.DeepEqual(patches[0].DanglingIDs, tt.wantIDs) || patches[0].Index != tt.wantIndex || patches[0].SourceIndex != 1 {
+				t.Errorf("patch = %+v", patches[0])
+			}
+		})
+	}
+}
+
+// TestFixIncompleteToolUse_AppendOrder 补充的 user 消息追加在 messages 末尾，与抽取前的行为一致
+func TestFixIncompleteToolUse_AppendOrder(t *testing.T) {
+	body := `{"messages":[
+		{"role":"user","content":"hi"},
+		{"role":"assistant","content":[{"type":"tool_use","id":"t1"}]},
+		{"role":"user","content":"继续"}]}`
+	fixed, report, err := FixIncompleteToolUseWithMode([]byte(body), ToolUseRepairAuto)
+	if err != nil || report == nil {
+		t.Fatalf("FixIncompleteToolUseWithMode() report=%v err=%v", report, err)
+	}
+
+	var roles []string
+	for _, msg := range gjson.GetBytes(fixed, "messages").Array() {
+		roles = append(roles, msg.Get("role").String())
+	}
+	if !reflect.DeepEqual(roles, []string{"user", "assistant", "user", "user"}) {
+		t.Fatalf("消息顺序 = %v", roles)
+	}
+	if gjson.GetBytes(fixed, "messages.2.content").String() != "继续" {
+		t.Errorf("原有消息位置被改变: %s", fixed)
+	}
+	if gjson.GetBytes(fixed, "messages.3.content.0.tool_use_id").String() != "t1" || report.InjectedIndex != 3 {
+		t.Errorf("补充消息应追加在末尾: injected=%d %s", report.InjectedIndex, fixed)
+	}
+	if len(report.InjectedContent) != 1 || report.InjectedContent[0]["tool_use_id"] != "t1" {
+		t.Errorf("InjectedContent = %v", report.InjectedContent)
+	}
+}
+
+func TestDanglingToolUseIDs(t *testing.T) {
+	claude := `{"messages":[{"role":"assistant","content":[{"type":"tool_use","id":"t1"}]}]}`
+	if got := DanglingToolUseIDs([]byte(claude)); !reflect.DeepEqual(got, []string{"t1"}) {
+		t.Errorf("Claude = %v", got)
+	}
+	responses := `{"input":[{"type":"function_call","call_id":"c1"},{"type":"function_call","call_id":"c2"},{"type":"function_call_output","call_id":"c1"}]}`
+	if got := DanglingToolUseIDs([]byte(responses)); !reflect.DeepEqual(got, []string{"c2"}) {
+		t.Errorf("Responses = %v", got)
+	}
+}
+
+// FuzzRepairToolUse 任意输入都不应 panic；产出的修改应用后应不再需要修复
+func FuzzRepairToolUse(f *testing.F) {
+	f.Add(`{"messages":[{"role":"assistant","content":[{"type":"tool_use","id":"t1"}]}]}`)
+	f.Add(`{"messages":[{"role":"assistant","content":[{"type":"tool_use","id":"t1"}]},{"role":"user","content":"x"}]}`)
+	f.Add(`{"input":[{"type":"function_call","call_id":"c1"}]}`)
+	f.Add(`{"messages":"oops"}`)
+
+	f.Fuzz(func(t *testing.T, body string) {
+		if !gjson.Valid(body) {
+			return
+		}
+		fixed, report, err := FixIncompleteToolUseWithReport([]byte(body))
+		if err != nil || report == nil {
+			return
+		}
+		if ids := DanglingToolUseIDs(fixed); len(ids) != 0 {
+			t.Errorf("修复后仍有未完成的 tool_use: %v\n输入: %s\n输出: %s", ids, body, fixed)
+		}
+	})
+}
+
+func TestFixIncompleteToolUse_RepairMode(t *testing.T) {
+	defer SetToolUseRepairMode(ToolUseRepairAuto)
+
+	dangling := `{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"bash","input":{}}]}]}`
+	responses := `{"input":[{"type":"function_call","call_id":"c1","name":"bash","arguments":"{}"}]}`
+
+	tests := []struct {
+		name      string
+		mode      ToolUseRepairMode
+		wantFixed bool
+	}{
+		{"默认自动修复", ToolUseRepairAuto, true},
+		{"仅告警不修改", ToolUseRepairWarn, false},
+		{"关闭", ToolUseRepairOff, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetToolUseRepairMode(tt.mode)
+			for _, body := range []string{dangling, responses} {
+				got, fixed, err := FixIncompleteToolUse([]byte(body))
+				if err != nil {
+					t.Fatalf("FixIncompleteToolUse() error = %v", err)
+				}
+				if fixed != tt.wantFixed {
+					t.Errorf("fixed = %v, want %v", fixed, tt.wantFixed)
+				}
+				if !tt.wantFixed && string(got) != body {
+					t.Errorf("请求体不应被修改: %s", got)
+				}
+			}
+
+			// 流水线中显式配置的步骤始终修复
+			got, err := FixToolUse().Transform([]byte(dangling))
+			if err != nil || len(DanglingToolUseIDs(got)) != 0 {
+				t.Errorf("FixToolUse() = %s, %v", got, err)
+			}
+		})
+	}
+
+	SetToolUseRepairMode(ToolUseRepairMode(42))
+	if CurrentToolUseRepairMode() != ToolUseRepairAuto {
+		t.Errorf("未知模式应回落为 auto, 实际 %v", CurrentToolUseRepairMode())
+	}
+}
+
+func TestFixIncompleteToolUse_Idempotent(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"Claude 末尾 tool_use", `{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":[{"type":"tool_use","id":"t1"}]}]}`},
+		{"Claude 补充后被后续消息隔开", `{"messages":[{"role":"assistant","content":[{"type":"tool_use","id":"t1"}]},{"role":"user","content":"继续"},{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","x-relay-synthetic":true}]}]}`},
+		{"Responses function_call", `{"input":[{"type":"function_call","call_id":"c1"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			once, err := FixToolUse().Transform([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("第一次修复 error = %v", err)
+			}
+			twice, fixed, err := FixIncompleteToolUseWithMode(once, ToolUseRepairAuto)
+			if err != nil || fixed != nil || string(twice) != string(once) {
+				t.Errorf("重复执行不应再次修改: report=%v err=%v\n第一次: %s\n第二次: %s", fixed, err, once, twice)
+			}
+		})
+	}
+}
+
+func TestStripSyntheticMarkers(t *testing.T) {
+	body := `{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":[{"type":"tool_use","id":"t1"}]}]}`
+	fixed, _, err := FixIncompleteToolUse([]byte(body))
+	if err != nil {
+		t.Fatalf("FixIncompleteToolUse() error = %v", err)
+	}
+	if !IsSynthetic(gjson.GetBytes(fixed, "messages.2.content.0")) {
+		t.Fatalf("补充的 tool_result 应带标记: %s", fixed)
+	}
+
+	stripped, changed, err := StripSyntheticMarkers(fixed)
+	if err != nil || !changed {
+		t.Fatalf("StripSyntheticMarkers() changed=%v err=%v", changed, err)
+	}
+	if gjson.GetBytes(stripped, "messages.2.content.0."+SyntheticMarker).Exists() {
+		t.Errorf("标记未移除: %s", stripped)
+	}
+	if gjson.GetBytes(stripped, "messages.2.content.0.tool_use_id").String() != "t1" {
+		t.Errorf("tool_result 内容被破坏: %s", stripped)
+	}
+
+	responses, _, _ := FixIncompleteToolUse([]byte(`{"input":[{"type":"function_call","call_id":"c1"}]}`))
+	if stripped, changed, _ := StripSyntheticMarkers(responses); !changed || gjson.GetBytes(stripped, "input.1."+SyntheticMarker).Exists() {
+		t.Errorf("Responses 标记未移除: %s", stripped)
+	}
+
+	if _, changed, _ := StripSyntheticMarkers([]byte(body)); changed {
+		t.Error("无标记时不应修改")
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ============================================================================
+// 上游错误识别
+// ============================================================================
+
+// 归一化后的上游错误类型
+const (
+	UpstreamErrorOverloaded     = "overloaded"      // 上游过载
+	UpstreamErrorRateLimit      = "rate_limit"      // 限流
+	UpstreamErrorQuotaExceeded  = "quota_exceeded"  // 额度/余额耗尽
+	UpstreamErrorAuth           = "auth"            // 认证失败
+	UpstreamErrorInvalidRequest = "invalid_request" // 请求本身有问题
+	UpstreamErrorServer         = "server"          // 上游服务端错误
+	UpstreamErrorUnknown        = "unknown"         // 未识别
+)
+
+// UpstreamError 归一化后的上游错误
+type UpstreamError struct {
+	HTTPCode  int    `json:"httpCode"`
+	Type      string `json:"type"`      // 归一化类型（UpstreamErrorXxx）
+	RawType   string `json:"rawType"`   // 上游原始类型（error.type / error.status / error.code）
+	Message   string `json:"message"`   // 上游错误信息
+	Retryable bool   `json:"retryable"` // 是否值得在同一 provider 上重试（否则应直接切换）
+}
+
+// Error 实现 error 接口
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("upstream %s error (status %d, %s): %s", e.Type, e.HTTPCode, e.RawType, e.Message)
+}
+
+// ParseUpstreamError 根据状态码和响应体识别上游错误
+// 支持 OpenAI（{"error":{"message","type","code"}}）、Claude（{"type":"error","error":{"type","message"}}）、
+// Gemini（{"error":{"code","message","status"}}）格式，以及以 SSE error 事件返回的错误。
+// 很多上游在 HTTP 200 中返回过载/额度错误，因此 2xx 也会检查响应体。
+// 返回 false 表示未检测到错误
+func ParseUpstreamError(body []byte, httpCode int) (*UpstreamError, bool) {
+	errObj, found := findErrorObject(body)
+	isErrorStatus := httpCode >= http.StatusBadRequest
+
+	if !found && !isErrorStatus {
+		return nil, false
+	}
+
+	ue := &UpstreamError{HTTPCode: httpCode}
+	if found {
+		ue.Message = errObj.Get("message").String()
+		ue.RawType = firstNonEmpty(
+			errObj.Get("type").String(),
+			errObj.Get("status").String(),
+			errObj.Get("code").String(),
+		)
+	}
+	if ue.Message == "" {
+		ue.Message = strings.TrimSpace(string(body))
+	}
+
+	ue.Type = normalizeUpstreamErrorType(ue.RawType, ue.Message, httpCode)
+	switch ue.Type {
+	case UpstreamErrorOverloaded, UpstreamErrorRateLimit, UpstreamErrorServer:
+		ue.Retryable = true
+	}
+
+	return ue, true
+}
+
+// findErrorObject 在 JSON 或 SSE 响应体中查找错误对象
+func findErrorObject(body []byte) (gjson.Result, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return gjson.Result{}, false
+	}
+
+	// JSON 响应体
+	if trimmed[0] == '{' || trimmed[0] == '[' {
+		return errorObjectFromJSON(gjson.ParseBytes(trimmed))
+	}
+
+	// SSE 响应体：逐行检查 data 字段
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if !gjson.Valid(data) {
+			continue
+		}
+		if obj, ok := errorObjectFromJSON(gjson.Parse(data)); ok {
+			return obj, true
+		}
+	}
+	return gjson.Result{}, false
+}
+
+// errorObjectFromJSON 提取 JSON 中的 error 对象
+// Gemini 批量响应可能是数组，取第一个元素
+func errorObjectFromJSON(root gjson.Result) (gjson.Result, bool) {
+	if root.IsArray() {
+		root = root.Get("0")
+	}
+	errObj := root.Get("error")
+	if errObj.IsObject() {
+		return errObj, true
+	}
+	// 部分中转直接返回 {"error": "message"}
+	if errObj.Type == gjson.String && errObj.String() != "" {
+		return gjson.Parse(fmt.Sprintf(`{"message":%q}`, errObj.String())), true
+	}
+	return gjson.Result{}, false
+}
+
+// normalizeUpstreamErrorType 将上游原始错误类型归一化
+func normalizeUpstreamErrorType(rawType, message string, httpCode int) string {
+	raw := strings.ToLower(rawType)
+	msg := strings.ToLower(message)
+
+	switch {
+	case strings.Contains(raw, "overloaded") || httpCode == 529 || strings.Contains(msg, "overloaded"):
+		return UpstreamErrorOverloaded
+	case strings.Contains(raw, "insufficient_quota") || strings.Contains(raw, "billing") ||
+		strings.Contains(msg, "quota") || strings.Contains(msg, "余额") || strings.Contains(msg, "额度"):
+		return UpstreamErrorQuotaExceeded
+	case strings.Contains(raw, "rate_limit") || raw == "resource_exhausted" || httpCode == http.StatusTooManyRequests:
+		return UpstreamErrorRateLimit
+	case strings.Contains(raw, "authentication") || strings.Contains(raw, "permission") ||
+		raw == "unauthenticated" || httpCode == http.StatusUnauthorized || httpCode == http.StatusForbidden:
+		return UpstreamErrorAuth
+	case strings.Contains(raw, "invalid_request") || raw == "invalid_argument" ||
+		raw == "not_found_error" || httpCode == http.StatusBadRequest || httpCode == http.StatusNotFound:
+		return UpstreamErrorInvalidRequest
+	case strings.Contains(raw, "api_error") || raw == "internal" || raw == "unavailable" ||
+		httpCode >= http.StatusInternalServerError:
+		return UpstreamErrorServer
+	}
+	return UpstreamErrorUnknown
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package services
+
+import "testing"
+
+func TestParseUpstreamError(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		httpCode      int
+		wantFound     bool
+		wantType      string
+		wantRetryable bool
+	}{
+		{
+			name:      "正常响应",
+			body:      `{"id": "msg_1", "type": "message", "content": []}`,
+			httpCode:  200,
+			wantFound: false,
+		},
+		{
+			name:          "Claude 过载（HTTP 200）",
+			body:          `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`,
+			httpCode:      200,
+			wantFound:     true,
+			wantType:      UpstreamErrorOverloaded,
+			wantRetryable: true,
+		},
+		{
+			name:      "OpenAI 额度耗尽（HTTP 200）",
+			body:      `{"error": {"message": "You exceeded your current quota", "type": "insufficient_quota", "code": "insufficient_quota"}}`,
+			httpCode:  200,
+			wantFound: true,
+			wantType:  UpstreamErrorQuotaExceeded,
+		},
+		{
+			name:          "SSE error 事件",
+			body:          "event: error\ndata: {\"type\": \"error\", \"error\": {\"type\": \"overloaded_error\", \"message\": \"Overloaded\"}}\n\n",
+			httpCode:      200,
+			wantFound:     true,
+			wantType:      UpstreamErrorOverloaded,
+			wantRetryable: true,
+		},
+		{
+			name:          "Gemini 限流",
+			body:          `{"error": {"code": 429, "message": "Resource has been exhausted", "status": "RESOURCE_EXHAUSTED"}}`,
+			httpCode:      429,
+			wantFound:     true,
+			wantType:      UpstreamErrorRateLimit,
+			wantRetryable: true,
+		},
+		{
+			name:      "认证失败",
+			body:      `{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`,
+			httpCode:  401,
+			wantFound: true,
+			wantType:  UpstreamErrorAuth,
+		},
+		{
+			name:          "非 JSON 的 502",
+			body:          `<html>Bad Gateway</html>`,
+			httpCode:      502,
+			wantFound:     true,
+			wantType:      UpstreamErrorServer,
+			wantRetryable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ue, found := ParseUpstreamError([]byte(tt.body), tt.httpCode)
+			if found != tt.wantFound {
+				t.Fatalf("found = %v, 期望 %v", found, tt.wantFound)
+			}
+			if !found {
+				return
+			}
+			if ue.Type != tt.wantType {
+				t.Errorf("Type = %s, 期望 %s (raw=%s)", ue.Type, tt.wantType, ue.RawType)
+			}
+			if ue.Retryable != tt.wantRetryable {
+				t.Errorf("Retryable = %v, 期望 %v", ue.Retryable, tt.wantRetryable)
+			}
+			if ue.Message == "" {
+				t.Error("Message 不应为空")
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import "github.com/tidwall/gjson"
+
+// ============================================================================
+// Token 用量归一化
+// ============================================================================
+
+// Usage 归一化后的 token 用量，字段与 ReqeustLog 一一对应
+type Usage struct {
+	InputTokens       int `json:"input_tokens"`
+	OutputTokens      int `json:"output_tokens"`
+	CacheCreateTokens int `json:"cache_create_tokens"`
+	CacheReadTokens   int `json:"cache_read_tokens"`
+	ReasoningTokens   int `json:"reasoning_tokens"`
+}
+
+// IsZero 判断是否未解析到任何用量
+func (u Usage) IsZero() bool { return u == Usage{} }
+
+// ApplyTo 将用量写入请求日志（覆盖对应字段）
+func (u Usage) ApplyTo(log *ReqeustLog) {
+	log.InputTokens = u.InputTokens
+	log.OutputTokens = u.OutputTokens
+	log.CacheCreateTokens = u.CacheCreateTokens
+	log.CacheReadTokens = u.CacheReadTokens
+	log.ReasoningTokens = u.ReasoningTokens
+}
+
+// ExtractUsage 从响应体（非流式响应或单个 SSE 事件的 data）中提取用量并归一化
+//   - Claude: usage / message.usage（input_tokens、output_tokens、cache_creation_input_tokens、cache_read_input_tokens）
+//   - OpenAI: Chat Completions 的 prompt_tokens/completion_tokens，或 Responses API 的 input_tokens/output_tokens（含 response.usage）
+//   - Gemini: usageMetadata（promptTokenCount、candidatesTokenCount、cachedContentTokenCount、thoughtsTokenCount）
+func ExtractUsage(bodyBytes []byte, format Format) Usage {
+	switch format {
+	case FormatClaude:
+		usage := firstExisting(bodyBytes, "usage", "message.usage")
+		return Usage{
+			InputTokens:       int(usage.Get("input_tokens").Int()),
+			OutputTokens:      int(usage.Get("output_tokens").Int()),
+			CacheCreateTokens: int(usage.Get("cache_creation_input_tokens").Int()),
+			CacheReadTokens:   int(usage.Get("cache_read_input_tokens").Int()),
+		}
+	case FormatOpenAI, FormatOpenAIResponses:
+		usage := firstExisting(bodyBytes, "usage", "response.usage")
+		if usage.Get("prompt_tokens").Exists() || usage.Get("completion_tokens").Exists() {
+			// Chat Completions
+			return Usage{
+				InputTokens:     int(usage.Get("prompt_tokens").Int()),
+				OutputTokens:    int(usage.Get("completion_tokens").Int()),
+				CacheReadTokens: int(usage.Get("prompt_tokens_details.cached_tokens").Int()),
+				ReasoningTokens: int(usage.Get("completion_tokens_details.reasoning_tokens").Int()),
+			}
+		}
+		// Responses API
+		return Usage{
+			InputTokens:     int(usage.Get("input_tokens").Int()),
+			OutputTokens:    int(usage.Get("output_tokens").Int()),
+			CacheReadTokens: int(usage.Get("input_tokens_details.cached_tokens").Int()),
+			ReasoningTokens: int(usage.Get("output_tokens_details.reasoning_tokens").Int()),
+		}
+	case FormatGemini:
+		var log ReqeustLog
+		mergeGeminiUsageMetadata(gjson.GetBytes(bodyBytes, "usageMetadata"), &log)
+		return Usage{
+			InputTokens:     log.InputTokens,
+			OutputTokens:    log.OutputTokens,
+			CacheReadTokens: log.CacheReadTokens,
+			ReasoningTokens: log.ReasoningTokens,
+		}
+	default:
+		return Usage{}
+	}
+}
+
+// firstExisting 返回第一个存在的路径对应的值
+func firstExisting(bodyBytes []byte, paths ...string) gjson.Result {
+	for _, path := range paths {
+		if v := gjson.GetBytes(bodyBytes, path); v.Exists() {
+			return v
+		}
+	}
+	return gjson.Result{}
+}
@@ -0,0 +1,54 @@
+package services
+
+import "testing"
+
+func TestExtractUsage(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		format Format
+		want   Usage
+	}{
+		{
+			"Claude 非流式",
+			`{"usage":{"input_tokens":10,"output_tokens":20,"cache_creation_input_tokens":3,"cache_read_input_tokens":4}}`,
+			FormatClaude, Usage{InputTokens: 10, OutputTokens: 20, CacheCreateTokens: 3, CacheReadTokens: 4},
+		},
+		{
+			"Claude message_start 事件",
+			`{"type":"message_start","message":{"usage":{"input_tokens":7,"cache_read_input_tokens":2}}}`,
+			FormatClaude, Usage{InputTokens: 7, CacheReadTokens: 2},
+		},
+		{
+			"OpenAI Chat",
+			`{"usage":{"prompt_tokens":11,"completion_tokens":5,"prompt_tokens_details":{"cached_tokens":6},"completion_tokens_details":{"reasoning_tokens":2}}}`,
+			FormatOpenAI, Usage{InputTokens: 11, OutputTokens: 5, CacheReadTokens: 6, ReasoningTokens: 2},
+		},
+		{
+			"OpenAI Responses 事件",
+			`{"type":"response.completed","response":{"usage":{"input_tokens":9,"output_tokens":4,"input_tokens_details":{"cached_tokens":1},"output_tokens_details":{"reasoning_tokens":3}}}}`,
+			FormatOpenAI, Usage{InputTokens: 9, OutputTokens: 4, CacheReadTokens: 1, ReasoningTokens: 3},
+		},
+		{
+			"Gemini",
+			`{"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":2,"cachedContentTokenCount":5,"thoughtsTokenCount":1}}`,
+			FormatGemini, Usage{InputTokens: 8, OutputTokens: 2, CacheReadTokens: 5, ReasoningTokens: 1},
+		},
+		{"无用量", `{"id":"x"}`, FormatClaude, Usage{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExtractUsage([]byte(tt.body), tt.format)
+			if got != tt.want {
+				t.Errorf("ExtractUsage() = %+v, 期望 %+v", got, tt.want)
+			}
+		})
+	}
+
+	var log ReqeustLog
+	Usage{InputTokens: 1, OutputTokens: 2, ReasoningTokens: 3}.ApplyTo(&log)
+	if log.InputTokens != 1 || log.OutputTokens != 2 || log.ReasoningTokens != 3 {
+		t.Errorf("ApplyTo() = %+v", log)
+	}
+}
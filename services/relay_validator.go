@@ -0,0 +1,84 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ============================================================================
+// 默认配置验证器
+// ============================================================================
+
+// DefaultConfigValidator 默认的 Provider 配置验证器，可直接作为 FilterProviders 的 configValidator
+// 检查项：
+//   - APIURL 为合法的 http(s) URL
+//   - APIKey 非空
+//   - Level 非负
+//   - SupportedModels 若已配置则不能为空
+//   - ModelMapping 目标模型在 SupportedModels 中（同 ValidateConfiguration）
+//
+// 返回：每个问题对应一条可操作的提示，无问题时返回 nil
+func DefaultConfigValidator(p *Provider) []string {
+	var errs []string
+
+	if msg := providerURLProblem("apiUrl", p.APIURL); msg != "" {
+		errs = append(errs, msg)
+	}
+	if strings.TrimSpace(p.APIKey) == "" {
+		errs = append(errs, "apiKey 为空：请填写供应商提供的 API Key")
+	}
+	if p.Level < 0 {
+		errs = append(errs, fmt.Sprintf("level 为负数 (%d)：请设置为 1-10，数字越小优先级越高", p.Level))
+	}
+	if p.SupportedModels != nil && len(p.SupportedModels) == 0 {
+		errs = append(errs, "supportedModels 已配置但为空：请添加支持的模型，或删除该字段以支持所有模型")
+	}
+	for model := range p.SupportedModels {
+		if strings.TrimSpace(model) == "" {
+			errs = append(errs, "supportedModels 包含空模型名：请删除空条目")
+			break
+		}
+	}
+	errs = append(errs, p.ValidateConfiguration()...)
+
+	return errs
+}
+
+// DefaultGeminiConfigValidator 默认的 GeminiProvider 配置验证器
+// 检查项：BaseURL 为合法的 http(s) URL、Level 非负
+func DefaultGeminiConfigValidator(p *GeminiProvider) []string {
+	var errs []string
+
+	if msg := providerURLProblem("baseUrl", p.BaseURL); msg != "" {
+		errs = append(errs, msg)
+	}
+	if strings.TrimSpace(p.APIKey) == "" && !p.AllowKeyless {
+		errs = append(errs, "apiKey 为空：请填写供应商提供的 API Key；本地无需认证的端点可开启 allowKeyless")
+	}
+	if p.Level < 0 {
+		errs = append(errs, fmt.Sprintf("level 为负数 (%d)：请设置为 1-10，数字越小优先级越高", p.Level))
+	}
+
+	return errs
+}
+
+// providerURLProblem 校验 URL 是否为合法的 http(s) 地址，返回问题描述；合法时返回空字符串
+func providerURLProblem(field, raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return fmt.Sprintf("%s 为空：请填写供应商的 API 地址，如 https://api.example.com", field)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Sprintf("%s 格式错误 (%s)：%v", field, raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Sprintf("%s 协议无效 (%s)：必须以 http:// 或 https:// 开头", field, raw)
+	}
+	if u.Host == "" {
+		return fmt.Sprintf("%s 缺少主机名 (%s)：请检查地址是否完整", field, raw)
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultConfigValidator(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider Provider
+		wantErrs []string // 每条期望错误包含的关键字
+	}{
+		{
+			name:     "有效配置",
+			provider: Provider{APIURL: "https://api.example.com", APIKey: "sk-1", Level: 1},
+		},
+		{
+			name:     "缺少协议",
+			provider: Provider{APIURL: "api.example.com", APIKey: "sk-1"},
+			wantErrs: []string{"apiUrl 协议无效"},
+		},
+		{
+			name:     "空 Key 和负 Level",
+			provider: Provider{APIURL: "http://localhost:8080", Level: -1},
+			wantErrs: []string{"apiKey 为空", "level 为负数"},
+		},
+		{
+			name:     "空白名单",
+			provider: Provider{APIURL: "https://x.com", APIKey: "k", SupportedModels: map[string]bool{}},
+			wantErrs: []string{"supportedModels 已配置但为空"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := DefaultConfigValidator(&tt.provider)
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("错误 = %v, 期望 %d 条", errs, len(tt.wantErrs))
+			}
+			for i, want := range tt.wantErrs {
+				if !strings.Contains(errs[i], want) {
+					t.Errorf("错误[%d] = %s, 期望包含 %s", i, errs[i], want)
+				}
+			}
+		})
+	}
+
+	if errs := DefaultGeminiConfigValidator(&GeminiProvider{BaseURL: "ftp://x", APIKey: "k"}); len(errs) != 1 {
+		t.Errorf("Gemini ftp 地址应报错，实际 %v", errs)
+	}
+}
+
+func TestGeminiProvider_HasValidConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider GeminiProvider
+		want     bool
+	}{
+		{"完整配置", GeminiProvider{BaseURL: "https://g", APIKey: "k"}, true},
+		{"缺少 APIKey", GeminiProvider{BaseURL: "https://g"}, false},
+		{"允许无 Key 的本地端点", GeminiProvider{BaseURL: "http://127.0.0.1:8080", AllowKeyless: true}, true},
+		{"缺少 BaseURL", GeminiProvider{APIKey: "k", AllowKeyless: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.provider.HasValidConfig(); got != tt.want {
+				t.Errorf("HasValidConfig() = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+
+	if errs := DefaultGeminiConfigValidator(&GeminiProvider{BaseURL: "https://g"}); len(errs) != 1 || !strings.Contains(errs[0], "apiKey") {
+		t.Errorf("缺少 APIKey 应报错，实际 %v", errs)
+	}
+}
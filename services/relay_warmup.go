@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// 启动时预热 provider 连接
+// ============================================================================
+
+const (
+	// DefaultWarmUpConcurrency 预热时最多同时进行的请求数
+	DefaultWarmUpConcurrency = 4
+	// maxWarmUpBodyBytes 预热响应体最多读取的字节数（读完才能让连接回到连接池）
+	maxWarmUpBodyBytes = 1 << 20
+)
+
+// WarmUpResult 单个 provider 的预热结果
+type WarmUpResult struct {
+	Provider string
+	Status   int           // 上游状态码，请求失败时为 0
+	Duration time.Duration // 请求耗时（含 DNS 与 TLS 握手）
+	Err      error         // 请求失败或认证失败（401/403）时非空
+}
+
+// WarmUp 并发向每个已启用的 provider 发送 GET /v1/models，预先建立连接（DNS、TLS 握手）并尽早暴露认证错误
+// 最多 DefaultWarmUpConcurrency 个请求同时进行，单个请求超时为 DefaultModelsTimeout；
+// 未启用或未配置 APIURL 的 provider 跳过。失败只记录警告，不返回错误，结果按 providers 的顺序返回
+func WarmUp(providers []Provider) []WarmUpResult {
+	return warmUpWith(providers, DefaultWarmUpConcurrency, sendWarmUpRequest)
+}
+
+// warmUpFunc 对单个 provider 发送预热请求，返回状态码
+type warmUpFunc func(ctx context.Context, p Provider) (int, error)
+
+func warmUpWith(providers []Provider, concurrency int, send warmUpFunc) []WarmUpResult {
+	if concurrency <= 0 {
+		concurrency = DefaultWarmUpConcurrency
+	}
+
+	targets := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		if p.Enabled && strings.TrimSpace(p.APIURL) != "" {
+			targets = append(targets, p)
+		}
+	}
+
+	results := make([]WarmUpResult, len(targets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, p := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultModelsTimeout)
+			defer cancel()
+
+			start := time.Now()
+			status, err := send(ctx, p)
+			if err == nil && (status == http.StatusUnauthorized || status == http.StatusForbidden) {
+				err = fmt.Errorf("认证失败 (HTTP %d)", status)
+			}
+			results[i] = WarmUpResult{Provider: p.Name, Status: status, Duration: time.Since(start), Err: err}
+
+			if err != nil {
+				fmt.Printf("[WARN] 预热 Provider %s 失败: %v\n", p.Name, err)
+			} else {
+				fmt.Printf("[INFO] 预热 Provider %s 完成: HTTP %d (%s)\n", p.Name, status, results[i].Duration.Round(time.Millisecond))
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// sendWarmUpRequest 默认预热实现：通过 provider 实际使用的 HTTP 客户端请求 /v1/models，读完响应体以复用连接
+func sendWarmUpRequest(ctx context.Context, p Provider) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, joinURL(p.APIURL, "/v1/models"), nil)
+	if err != nil {
+		return 0, fmt.Errorf("创建预热请求失败: %w", err)
+	}
+	setProviderAuth(req.Header, p)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := ClientFor(p).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxWarmUpBodyBytes))
+	return resp.StatusCode, nil
+}
+
+// setProviderAuth 按 provider 的认证方式设置请求头（默认 Bearer，与转发逻辑一致）
+func setProviderAuth(header http.Header, p Provider) {
+	switch strings.ToLower(strings.TrimSpace(p.ConnectivityAuthType)) {
+	case "x-api-key":
+		header.Set("x-api-key", p.APIKey)
+		header.Set(AnthropicVersionHeader, DefaultAnthropicVersion)
+	case "", "bearer":
+		header.Set("Authorization", fmt.Sprintf("Bearer %s", p.APIKey))
+	default:
+		headerName := strings.TrimSpace(p.ConnectivityAuthType)
+		if strings.EqualFold(headerName, "custom") {
+			headerName = "Authorization"
+		}
+		header.Set(headerName, p.APIKey)
+	}
+	if name, value := VersionHeader(p); name != "" {
+		header.Set(name, value)
+	}
+}
+
+// SetWarmUpOnStart 开启/关闭启动时预热（默认关闭）
+// 开启后 Start 在后台对 claude/codex 的已启用 provider 执行 WarmUp，不阻塞启动
+func (prs *ProviderRelayService) SetWarmUpOnStart(enabled bool) {
+	prs.warmUpOnStart.Store(enabled)
+}
+
+// warmUpProviders 加载 claude/codex 的 provider 配置并预热，加载失败只记录警告
+func (prs *ProviderRelayService) warmUpProviders() {
+	var providers []Provider
+	for _, kind := range []string{"claude", "codex"} {
+		loaded, err := prs.loadRelayProviders(kind)
+		if err != nil {
+			fmt.Printf("[WARN] 预热时加载 %s 配置失败: %v\n", kind, err)
+			continue
+		}
+		providers = append(providers, loaded...)
+	}
+	WarmUp(providers)
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarmUp(t *testing.T) {
+	var paths atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths.Store(r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":[]}`))
+	}))
+	defer server.Close()
+
+	results := WarmUp([]Provider{
+		{Name: "ok", APIURL: server.URL, APIKey: "good", Enabled: true},
+		{Name: "badkey", APIURL: server.URL, APIKey: "bad", Enabled: true},
+		{Name: "off", APIURL: server.URL, APIKey: "good"},
+		{Name: "nourl", APIKey: "good", Enabled: true},
+	})
+
+	if len(results) != 2 {
+		t.Fatalf("结果数 = %d, 期望 2（跳过未启用与无 URL 的 provider）: %+v", len(results), results)
+	}
+	if results[0].Provider != "ok" || results[0].Status != http.StatusOK || results[0].Err != nil {
+		t.Errorf("ok 结果 = %+v", results[0])
+	}
+	if results[1].Provider != "badkey" || results[1].Status != http.StatusUnauthorized || results[1].Err == nil {
+		t.Errorf("认证失败应返回错误: %+v", results[1])
+	}
+	if got := paths.Load(); got != "/v1/models" {
+		t.Errorf("请求路径 = %v, want /v1/models", got)
+	}
+}
+
+func TestWarmUp_BoundedConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	send := func(ctx context.Context, p Provider) (int, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if p.Name == "down" {
+			return 0, errors.New("dial tcp: connection refused")
+		}
+		return http.StatusOK, nil
+	}
+
+	providers := make([]Provider, 0, 6)
+	for _, name := range []string{"a", "b", "c", "d", "e", "down"} {
+		providers = append(providers, Provider{Name: name, APIURL: "https://" + name, Enabled: true})
+	}
+
+	results := warmUpWith(providers, 2, send)
+	if peak.Load() > 2 {
+		t.Errorf("并发峰值 = %d, 上限 2", peak.Load())
+	}
+	if len(results) != 6 || results[5].Err == nil || results[0].Err != nil {
+		t.Errorf("结果 = %+v", results)
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// ============================================================================
+// 加权随机排序
+// ============================================================================
+
+// ReorderWeightedRandom 按权重生成随机排列：权重越大越可能排在前面
+// 大量请求下各 provider 排在首位的概率与其权重成正比，没有轮询那样可预测的顺序
+// 权重 <= 0 的 provider 排在所有正权重 provider 之后，并保持输入顺序
+// rng 为 nil 时使用全局随机源；测试中传入固定种子的 rng 可得到确定结果；不修改原切片
+//
+// 与 Reorder 互补：可在 GroupByLevel 之后对同 Level 的 providers 使用，代替轮询
+func ReorderWeightedRandom[T any](providers []T, getWeight func(T) int, rng *rand.Rand) []T {
+	if len(providers) <= 1 {
+		return providers
+	}
+
+	float := rand.Float64
+	if rng != nil {
+		float = rng.Float64
+	}
+
+	// Efraimidis–Spirakis 加权抽样：key = u^(1/w)，按 key 降序排列即为按权重不放回抽样的顺序
+	type keyed struct {
+		p   T
+		key float64
+	}
+	items := make([]keyed, len(providers))
+	for i, p := range providers {
+		key := -1.0 // 非正权重排在最后
+		if w := getWeight(p); w > 0 {
+			key = math.Pow(float(), 1/float64(w))
+		}
+		items[i] = keyed{p: p, key: key}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].key > items[j].key })
+
+	result := make([]T, len(items))
+	for i, item := range items {
+		result[i] = item.p
+	}
+	return result
+}
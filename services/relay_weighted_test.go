@@ -0,0 +1,46 @@
+package services
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func TestReorderWeightedRandom(t *testing.T) {
+	type wp struct {
+		name   string
+		weight int
+	}
+	providers := []wp{{"a", 1}, {"b", 3}, {"zero", 0}, {"c", 6}, {"neg", -1}}
+	weight := func(p wp) int { return p.weight }
+
+	t.Run("相同种子结果确定", func(t *testing.T) {
+		first := ReorderWeightedRandom(providers, weight, rand.New(rand.NewPCG(1, 2)))
+		second := ReorderWeightedRandom(providers, weight, rand.New(rand.NewPCG(1, 2)))
+		for i := range first {
+			if first[i] != second[i] {
+				t.Fatalf("相同种子结果不同: %v vs %v", first, second)
+			}
+		}
+	})
+
+	t.Run("非正权重排在最后且保持顺序", func(t *testing.T) {
+		got := ReorderWeightedRandom(providers, weight, rand.New(rand.NewPCG(3, 4)))
+		if len(got) != len(providers) || got[3].name != "zero" || got[4].name != "neg" {
+			t.Errorf("ReorderWeightedRandom() = %v", got)
+		}
+	})
+
+	t.Run("首位分布与权重成正比", func(t *testing.T) {
+		rng := rand.New(rand.NewPCG(5, 6))
+		counts := map[string]int{}
+		const n = 20000
+		for i := 0; i < n; i++ {
+			counts[ReorderWeightedRandom(providers, weight, rng)[0].name]++
+		}
+		for name, want := range map[string]float64{"a": 0.1, "b": 0.3, "c": 0.6} {
+			if got := float64(counts[name]) / n; got < want-0.02 || got > want+0.02 {
+				t.Errorf("%s 排在首位的比例 = %.3f, 期望约 %.1f", name, got, want)
+			}
+		}
+	})
+}